@@ -0,0 +1,541 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func addCommand(g *Globals) *Command {
+	cmd := newCommand(g, "add", "<local-path>... [category]", "Add existing local projects to the archive")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr add ~/Desktop/my-project",
+		"parkr add ~/code/experiment pycharm",
+		"parkr add --move ~/work/analysis",
+		"parkr add --dry-run ~/old-projects/thesis",
+		"parkr add ~/code/a ~/code/b ~/code/c",
+		"parkr add --dry-run --all-under ~/old-projects",
+		"parkr add --all-under ~/old-projects --move",
+		"parkr add --all-under ~/old-projects --interactive",
+		"parkr add --exclude node_modules/ --exclude '*.pyc' ~/code/webapp",
+		"parkr add --name thesis-2024 ~/old-projects/thesis",
+		"parkr add --existing merge ~/laptop-copy/thesis",
+		"parkr add --master cold ~/old-projects/thesis",
+	}
+	category := cmd.Flags.String("category", "", "Archive category, instead of detecting it from each project")
+	master := cmd.Flags.String("master", "", "Archive in this `master` instead of the default one")
+	move := cmd.Flags.Bool("move", false, "Delete each local copy once it is in the archive and verified")
+	deleteExcluded := cmd.Flags.Bool("delete-excluded", false, "With --move, also delete files excluded from the archive (by default such a local copy is kept)")
+	keepOnMismatch := cmd.Flags.Bool("keep-on-mismatch", true, "With --move, keep the local copy if the archive copy doesn't match it (false: undo the add instead)")
+	allUnder := cmd.Flags.String("all-under", "", "Add every subdirectory of this directory as a project")
+	interactive := cmd.Flags.Bool("interactive", false, "With --all-under, pick which subdirectories to add")
+	name := cmd.Flags.String("name", "", "Project `name` to use instead of the directory's name")
+	hidden := cmd.Flags.Bool("include-hidden", false, "Also add directories whose names start with '.', as if include_hidden were on")
+	existing := cmd.Flags.String("existing", "", "If the archive already has an untracked project of that name: merge into it or overwrite it")
+	var excludes stringList
+	cmd.Flags.Var(&excludes, "exclude", "Leave paths matching this "+core.VolatileFile+" pattern out of the archive, now and on later parks (repeatable)")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		min := 1
+		if *allUnder != "" {
+			min = 0
+		}
+		if err := requireArgs(cmd, args, min, -1); err != nil {
+			return err
+		}
+		if *interactive && *allUnder == "" {
+			return usageErrorf("--interactive can only be used with --all-under")
+		}
+		if *interactive && g.JSON() {
+			return usageErrorf("--interactive can't be used with --format json")
+		}
+		if *existing != "" && *existing != core.ExistingMerge && *existing != core.ExistingOverwrite {
+			return usageErrorf("--existing must be %s or %s", core.ExistingMerge, core.ExistingOverwrite)
+		}
+		opts := AddOptions{
+			Category:       *category,
+			Master:         *master,
+			Move:           *move,
+			Exclude:        excludes,
+			DeleteExcluded: *deleteExcluded,
+			KeepOnMismatch: *keepOnMismatch,
+			Name:           *name,
+			Existing:       *existing,
+			IncludeHidden:  *hidden,
+		}
+
+		// "add <path> <category>" names a category unless the second
+		// argument is itself a directory to add
+		if len(args) == 2 && *allUnder == "" {
+			if _, err := os.Stat(args[1]); os.IsNotExist(err) {
+				if opts.Category != "" && opts.Category != args[1] {
+					return usageErrorf("give the category either as an argument or with --category, not both")
+				}
+				opts.Category = args[1]
+				args = args[:1]
+			}
+		}
+
+		if len(args) == 1 && *allUnder == "" {
+			return AddCmd(ctx, g, args[0], opts)
+		}
+		if opts.Name != "" {
+			return usageErrorf("--name can only be used when adding a single directory")
+		}
+		paths := args
+		if *allUnder != "" {
+			state, err := g.StateManager().Load()
+			if err != nil {
+				return err
+			}
+			dirs, err := core.ProjectDirsUnder(*allUnder, opts.IncludeHidden || state.Settings.IncludeHidden)
+			if err != nil {
+				return err
+			}
+			if *interactive {
+				if dirs, err = chooseAddDirs(ctx, g, *allUnder, dirs, opts); err != nil || dirs == nil {
+					return err
+				}
+			}
+			paths = append(paths, dirs...)
+		}
+		return AddAllCmd(ctx, g, paths, opts)
+	}
+	return cmd
+}
+
+// AddOptions holds the flags accepted by add
+type AddOptions struct {
+	Category       string
+	Master         string
+	Move           bool
+	Exclude        []string
+	DeleteExcluded bool
+	KeepOnMismatch bool
+	Name           string
+	Existing       string
+	IncludeHidden  bool
+}
+
+// AddCmd copies an existing local project into the archive
+func AddCmd(ctx context.Context, g *Globals, localPath string, opts AddOptions) error {
+	if !g.JSON() && !g.DryRun {
+		fmt.Printf("Adding %s...\n", localPath)
+	}
+
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	if opts.Name == "" && opts.Existing == "" && !g.DryRun && !g.Yes && !g.JSON() && isInteractive() {
+		proceed, err := resolveAddClash(ctx, g, sm, localPath, &opts)
+		if err != nil || !proceed {
+			return err
+		}
+	}
+
+	createCategory, err := confirmNewCategories(g, sm, []string{localPath}, opts.Master, opts.Category)
+	if err != nil {
+		return err
+	}
+	result, err := core.Add(ctx, sm, localPath, core.AddOptions{
+		Category:        opts.Category,
+		Master:          opts.Master,
+		Move:            opts.Move,
+		DryRun:          g.DryRun,
+		Exclude:         opts.Exclude,
+		DeleteExcluded:  opts.DeleteExcluded,
+		AbortOnMismatch: !opts.KeepOnMismatch,
+		CreateCategory:  createCategory,
+		Name:            opts.Name,
+		Existing:        opts.Existing,
+		IncludeHidden:   opts.IncludeHidden,
+	})
+	if err != nil {
+		return err
+	}
+
+	if g.JSON() {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else if result.DryRun {
+		printAddPlan(g, result, opts.Move)
+	} else if len(result.Mismatches) > 0 {
+		printAddMismatches(g, result)
+	} else if len(result.Unarchived) > 0 {
+		printAddUnarchived(g, result)
+	} else if result.Moved {
+		fmt.Printf("Successfully added '%s' to %s and removed the local copy\n", result.Project, result.ArchivePath)
+	} else if result.Existing == core.ExistingMerge {
+		fmt.Printf("Successfully added '%s' from %s, merged into %s\n", result.Project, result.LocalPath, result.ArchivePath)
+		fmt.Printf("Files only the archive copy had were kept; run 'parkr pull %s' to bring them into the local copy.\n", result.Project)
+	} else {
+		fmt.Printf("Successfully added '%s' from %s to %s\n", result.Project, result.LocalPath, result.ArchivePath)
+	}
+
+	if len(result.Conflicts) > 0 {
+		return fmt.Errorf("'%s' can't be added: %d conflict(s)", result.Project, len(result.Conflicts))
+	}
+	if len(result.Mismatches) > 0 {
+		return fmt.Errorf("'%s' was added but not moved: %d mismatch(es)", result.Project, len(result.Mismatches))
+	}
+	if len(result.Unarchived) > 0 && !result.DryRun {
+		return fmt.Errorf("'%s' was added but not moved: %d excluded path(s) are not in the archive", result.Project, len(result.Unarchived))
+	}
+	return nil
+}
+
+// AddAllCmd adds several local projects, continuing past failures, and
+// summarises what was added, skipped and in conflict
+func AddAllCmd(ctx context.Context, g *Globals, paths []string, opts AddOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	if len(paths) == 0 {
+		fmt.Println("No directories to add.")
+		return nil
+	}
+	if !g.JSON() && !g.DryRun {
+		fmt.Printf("Adding %d director(ies)...\n", len(paths))
+	}
+
+	createCategory, err := confirmNewCategories(g, sm, paths, opts.Master, opts.Category)
+	if err != nil {
+		return err
+	}
+	outcomes, err := core.AddAll(ctx, sm, paths, core.AddOptions{
+		Category:        opts.Category,
+		Master:          opts.Master,
+		Move:            opts.Move,
+		DryRun:          g.DryRun,
+		Exclude:         opts.Exclude,
+		DeleteExcluded:  opts.DeleteExcluded,
+		AbortOnMismatch: !opts.KeepOnMismatch,
+		CreateCategory:  createCategory,
+		Name:            opts.Name,
+		Existing:        opts.Existing,
+		IncludeHidden:   opts.IncludeHidden,
+	})
+	if g.JSON() {
+		if jsonErr := printJSON(outcomes); jsonErr != nil {
+			return jsonErr
+		}
+	} else {
+		printAddOutcomes(g, outcomes)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n := countNotAdded(outcomes); n > 0 {
+		return fmt.Errorf("%d of %d director(ies) could not be added", n, len(outcomes))
+	}
+	if n := countNotMoved(outcomes); n > 0 {
+		return fmt.Errorf("%d of %d director(ies) were added but not moved", n, len(outcomes))
+	}
+	return nil
+}
+
+// chooseAddDirs plans adding each of dirs and lets the user pick which to
+// add with the interactive selector; those that would be skipped or can't
+// be added are shown but can't be picked. Returns nil if the user
+// cancelled or picked nothing.
+func chooseAddDirs(ctx context.Context, g *Globals, parent string, dirs []string, opts AddOptions) ([]string, error) {
+	sm := g.StateManager()
+	fmt.Printf("Checking %d director(ies)...\n", len(dirs))
+	outcomes, err := core.AddAll(ctx, sm, dirs, core.AddOptions{
+		Category:       opts.Category,
+		Master:         opts.Master,
+		DryRun:         true,
+		Exclude:        opts.Exclude,
+		CreateCategory: true,
+		Existing:       opts.Existing,
+		IncludeHidden:  opts.IncludeHidden,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var items []core.SelectItem
+	for _, o := range outcomes {
+		item := core.SelectItem{Key: o.Path, Size: -1}
+		if o.Status == core.AddAdded {
+			item.Columns = []string{filepath.Base(o.Path), o.Result.Category, core.FormatSize(o.Result.Size)}
+			item.Size = o.Result.Size
+			item.Selected = true
+		} else {
+			item.Columns = []string{filepath.Base(o.Path), "", ""}
+			item.Disabled, item.Reason = true, o.Reason
+		}
+		items = append(items, item)
+	}
+
+	list := core.NewMultiSelect(items)
+	ok, err := chooseFromList(g, selector{
+		Title: fmt.Sprintf("Directories under %s to add:", parent),
+		Legend: []string{
+			"COLUMNS:",
+			"  Directory, category it would be added to, size to copy",
+		},
+		Labels: []string{"directory", "category", "size"},
+	}, list)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		fmt.Println("Cancelled.")
+		return nil, nil
+	}
+	chosen := list.Selected()
+	if len(chosen) == 0 {
+		fmt.Println("Nothing selected.")
+	}
+	return chosen, nil
+}
+
+// printAddOutcomes prints one line per directory and the totals by status
+func printAddOutcomes(g *Globals, outcomes []core.AddOutcome) {
+	counts := make(map[string]int)
+	var size int64
+	for _, o := range outcomes {
+		counts[o.Status]++
+		switch o.Status {
+		case core.AddAdded:
+			verb := "Added"
+			if g.DryRun {
+				verb = "Would add"
+			}
+			size += o.Result.Size
+			if len(o.Result.Mismatches) > 0 {
+				fmt.Printf("%sAdded %s as '%s' but kept the local copy: the archive copy doesn't match (%s)\n", g.mark("!"), o.Path, o.Result.Project, strings.Join(o.Result.Mismatches, ", "))
+				continue
+			}
+			if len(o.Result.Unarchived) > 0 && !g.DryRun {
+				fmt.Printf("%sAdded %s as '%s' but kept the local copy: %s excluded from the archive\n", g.mark("!"), o.Path, o.Result.Project, summarizePaths(o.Result.Unarchived))
+				continue
+			}
+			fmt.Printf("%s%s %s as '%s' (%s, %s)\n", g.mark("✓"), verb, o.Path, o.Result.Project, o.Result.Category, core.FormatSize(o.Result.Size))
+		case core.AddSkipped:
+			fmt.Printf("%sSkipped %s: %s\n", g.mark("-"), o.Path, o.Reason)
+		default:
+			fmt.Printf("%s%s %s: %s\n", g.mark("✗"), strings.ToUpper(o.Status[:1])+o.Status[1:], o.Path, o.Reason)
+		}
+	}
+
+	added := "added"
+	if g.DryRun {
+		added = "to add"
+	}
+	fmt.Printf("\n%d %s (%s), %d skipped, %d conflicting, %d failed\n",
+		counts[core.AddAdded], added, core.FormatSize(size), counts[core.AddSkipped], counts[core.AddConflict], counts[core.AddFailed])
+}
+
+// resolveAddClash asks what to do when the archive already has a project
+// with the name localPath would be added under: rename the new project,
+// show the differences, merge into or overwrite the existing copy, or
+// abort. It updates opts with the choice and reports whether to go on.
+func resolveAddClash(ctx context.Context, g *Globals, sm core.StateStore, localPath string, opts *AddOptions) (bool, error) {
+	clash, err := core.CheckAddClash(ctx, sm, localPath, "")
+	if err != nil || clash == nil {
+		return clash == nil, err
+	}
+
+	canReplace := clash.Existing != nil && !clash.Tracked
+	if clash.Existing != nil {
+		fmt.Printf("The archive already has a project named '%s' at %s", clash.Name, clash.Existing.Path)
+	} else {
+		fmt.Printf("A project named '%s' is already tracked", clash.Name)
+	}
+	if clash.Tracked {
+		fmt.Print("; parkr tracks it, so the new project needs another name")
+	}
+	fmt.Println(".")
+
+	choices := "r=rename, a=abort"
+	if canReplace {
+		choices = "r=rename, d=show differences, m=merge, o=overwrite, a=abort"
+	}
+	for {
+		switch ask("What now? ("+choices+")", "a") {
+		case "r", "rename":
+			opts.Name = ask("New name", clash.Suggested)
+			return true, nil
+		case "d", "diff":
+			if !canReplace {
+				continue
+			}
+			diffs, err := core.DiffArchiveCopy(ctx, sm, localPath, *clash.Existing)
+			if err != nil {
+				return false, err
+			}
+			printArchiveDiff(diffs)
+		case "m", "merge":
+			if !canReplace {
+				continue
+			}
+			opts.Existing = core.ExistingMerge
+			return true, nil
+		case "o", "overwrite":
+			if !canReplace {
+				continue
+			}
+			if confirm(g, fmt.Sprintf("Replace %s with %s, deleting files only the archive copy has?", clash.Existing.Path, localPath)) {
+				opts.Existing = core.ExistingOverwrite
+				return true, nil
+			}
+		case "a", "abort":
+			fmt.Println("Cancelled.")
+			return false, nil
+		}
+	}
+}
+
+// maxDiffLines caps the differences printArchiveDiff lists
+const maxDiffLines = 20
+
+// printArchiveDiff prints the first differences between a local directory
+// and an archive copy
+func printArchiveDiff(diffs []string) {
+	if len(diffs) == 0 {
+		fmt.Println("  No differences: the archive copy matches the local directory.")
+		return
+	}
+	for i, d := range diffs {
+		if i == maxDiffLines {
+			fmt.Printf("  ... and %d more\n", len(diffs)-maxDiffLines)
+			break
+		}
+		fmt.Printf("  %s\n", d)
+	}
+}
+
+// confirmNewCategories lists the categories the paths would be added to that
+// the master ("" for the default one) doesn't have, and asks whether to
+// create and register them. A dry run plans as if they were confirmed; JSON
+// output needs --yes.
+func confirmNewCategories(g *Globals, sm core.StateStore, paths []string, master, category string) (bool, error) {
+	if g.DryRun {
+		return true, nil
+	}
+	missing, err := core.MissingCategories(sm, paths, master, category)
+	if err != nil || len(missing) == 0 {
+		return false, err
+	}
+	if g.Yes || g.JSON() {
+		return g.Yes, nil
+	}
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if master == "" {
+		fmt.Println("These categories are not configured in the default master yet:")
+	} else {
+		fmt.Printf("These categories are not configured in master '%s' yet:\n", master)
+	}
+	for _, name := range names {
+		fmt.Printf("  %-12s %s\n", name, missing[name])
+	}
+	return confirm(g, "Create and register them?"), nil
+}
+
+// countNotAdded counts the directories that conflicted or failed
+func countNotAdded(outcomes []core.AddOutcome) int {
+	n := 0
+	for _, o := range outcomes {
+		if o.Status == core.AddConflict || o.Status == core.AddFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// countNotMoved counts the directories added with their local copy kept
+// because the archive copy didn't match or doesn't hold all of it
+func countNotMoved(outcomes []core.AddOutcome) int {
+	n := 0
+	for _, o := range outcomes {
+		if o.Result != nil && !o.Result.DryRun && (len(o.Result.Mismatches) > 0 || len(o.Result.Unarchived) > 0) {
+			n++
+		}
+	}
+	return n
+}
+
+// printAddPlan describes what a dry-run add would do
+func printAddPlan(g *Globals, result *core.AddResult, move bool) {
+	how := "given"
+	switch {
+	case result.Existing != "":
+		how = "of the existing copy"
+	case result.Detected:
+		how = "detected"
+	}
+	fmt.Printf("Would add '%s' from %s\n", result.Project, result.LocalPath)
+	fmt.Printf("  Category: %s (%s, master %s)\n", result.Category, how, result.Master)
+	if result.NewCategory != "" {
+		fmt.Printf("  New category: would be created at %s and registered, once confirmed\n", result.NewCategory)
+	}
+	if result.ArchivePath != "" {
+		fmt.Printf("  Archive:  %s\n", result.ArchivePath)
+	}
+	switch result.Existing {
+	case core.ExistingMerge:
+		fmt.Println("  The existing archive copy would be kept and the local files merged into it.")
+	case core.ExistingOverwrite:
+		fmt.Println("  The existing archive copy would be replaced by the local copy.")
+	}
+	if result.ExcludedSize > 0 {
+		fmt.Printf("  Size:     %s to copy (%s excluded)\n", core.FormatSize(result.Size), core.FormatSize(result.ExcludedSize))
+	} else {
+		fmt.Printf("  Size:     %s to copy\n", core.FormatSize(result.Size))
+	}
+	switch {
+	case move && len(result.Unarchived) > 0:
+		fmt.Printf("  The local copy would be kept: %s excluded from the archive; pass --delete-excluded to delete it anyway.\n", summarizePaths(result.Unarchived))
+	case move:
+		fmt.Println("  The local copy would then be verified against the archive copy and deleted.")
+	}
+	for _, c := range result.Conflicts {
+		fmt.Printf("  %s%s\n", g.mark("✗"), c)
+	}
+}
+
+// printAddMismatches explains why a moved project's local copy was kept
+func printAddMismatches(g *Globals, result *core.AddResult) {
+	fmt.Printf("Added '%s' from %s to %s, but kept the local copy: the archive copy doesn't match it\n", result.Project, result.LocalPath, result.ArchivePath)
+	for _, m := range result.Mismatches {
+		fmt.Printf("  %s%s\n", g.mark("✗"), m)
+	}
+	fmt.Println("Check the archive copy, then park and remove the project once it matches.")
+}
+
+// printAddUnarchived explains why a moved project's local copy was kept
+// although the archive copy matched it
+func printAddUnarchived(g *Globals, result *core.AddResult) {
+	fmt.Printf("Added '%s' from %s to %s, but kept the local copy: these are excluded from the archive and would be lost\n", result.Project, result.LocalPath, result.ArchivePath)
+	for i, p := range result.Unarchived {
+		if i == maxDiffLines {
+			fmt.Printf("  ... and %d more\n", len(result.Unarchived)-maxDiffLines)
+			break
+		}
+		fmt.Printf("  %s%s\n", g.mark("!"), p)
+	}
+	fmt.Printf("Remove the local copy with 'parkr rm %s' once they're not needed, or add with --delete-excluded.\n", result.Project)
+}
+
+// summarizePaths describes a list of paths in a few words
+func summarizePaths(paths []string) string {
+	if len(paths) == 1 {
+		return paths[0] + " is"
+	}
+	return fmt.Sprintf("%s and %d other path(s) are", paths[0], len(paths)-1)
+}
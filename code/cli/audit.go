@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func auditCommand(g *Globals) *Command {
+	cmd := newCommand(g, "audit", "", "Show the audit log of commands that changed projects or state")
+	cmd.Examples = []string{
+		"parkr audit",
+		"parkr audit --project ml-pipeline",
+		"parkr audit --since 2026-03-01 --until 2026-04-01",
+		"parkr audit --all-states",
+	}
+	project := cmd.Flags.String("project", "", "Show only commands that affected `project`")
+	since := cmd.Flags.String("since", "", "Show only commands run on or after `date` (YYYY-MM-DD)")
+	until := cmd.Flags.String("until", "", "Show only commands run before `date` (YYYY-MM-DD)")
+	limit := cmd.Flags.Int("limit", 0, "Show only the latest `n` records")
+	allStates := cmd.Flags.Bool("all-states", false, "Show commands run against every state file, not just the selected one")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		if *limit < 0 {
+			return usageErrorf("--limit can't be negative")
+		}
+		filter := core.AuditFilter{Project: *project}
+		if !*allStates {
+			filter.StatePath = g.StateManager().StatePath()
+		}
+		var err error
+		if filter.Since, err = parseAuditDate("--since", *since); err != nil {
+			return err
+		}
+		if filter.Until, err = parseAuditDate("--until", *until); err != nil {
+			return err
+		}
+		return AuditCmd(ctx, g, filter, *limit)
+	}
+	return cmd
+}
+
+// parseAuditDate parses a YYYY-MM-DD flag value as local midnight, treating
+// "" as no bound
+func parseAuditDate(flag, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, usageErrorf("invalid %s '%s' (expected YYYY-MM-DD)", flag, value)
+	}
+	return t, nil
+}
+
+// AuditCmd prints the audit records matching filter, newest first, naming
+// each one's state file unless the filter selects one
+func AuditCmd(ctx context.Context, g *Globals, filter core.AuditFilter, limit int) error {
+	path := core.AuditLogPath()
+	g.logf("Reading audit log %s", path)
+
+	records, err := core.LoadAudit(path, filter)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	if g.JSON() {
+		if records == nil {
+			records = []core.AuditRecord{}
+		}
+		return printJSON(records)
+	}
+	if len(records) == 0 {
+		fmt.Println("No matching audit records.")
+		return nil
+	}
+	fmt.Printf("%-19s  %-6s %-10s %-24s %s\n", "TIME", "RESULT", "SIZE", "PROJECTS", "COMMAND")
+	for _, r := range records {
+		size := "-"
+		if r.Bytes > 0 {
+			size = core.FormatSize(r.Bytes)
+		}
+		projects := strings.Join(r.Projects, ",")
+		if projects == "" {
+			projects = "-"
+		}
+		fmt.Printf("%-19s  %-6s %-10s %-24s %s\n", r.Time.Local().Format("2006-01-02 15:04:05"), r.Result, size, projects,
+			strings.TrimSpace("parkr "+r.Command+" "+strings.Join(r.Args, " ")))
+		if r.Error != "" {
+			fmt.Printf("%21s%s\n", "", r.Error)
+		}
+		if filter.StatePath == "" {
+			fmt.Printf("%21sstate: %s\n", "", r.StatePath)
+		}
+	}
+	return nil
+}
+
+// eventTotals returns the projects named by the events the command
+// published, in order, and the combined size of their copies
+func (g *Globals) eventTotals() ([]string, int64) {
+	var projects []string
+	var bytes int64
+	seen := make(map[string]bool)
+	for _, e := range g.events {
+		if !seen[e.Project] {
+			seen[e.Project] = true
+			projects = append(projects, e.Project)
+		}
+		if e.Size != nil {
+			bytes += *e.Size
+		}
+	}
+	return projects, bytes
+}
+
+// recordAudit appends a run of an audited command, begun at started, to
+// the audit log, warning (in verbose mode) rather than failing the command
+// on error. Dry runs, runs that changed nothing and usage errors aren't
+// recorded.
+func recordAudit(g *Globals, cmd *Command, args, positional []string, started time.Time, runErr error) {
+	var usage *usageError
+	if g.DryRun || g.unchanged || errors.As(runErr, &usage) {
+		return
+	}
+	record := core.AuditRecord{
+		Time:       time.Now(),
+		Command:    cmd.Name,
+		Args:       args,
+		StatePath:  g.StateManager().StatePath(),
+		DurationMS: time.Since(started).Milliseconds(),
+		Result:     core.AuditOK,
+	}
+	record.Projects, record.Bytes = g.eventTotals()
+	if runErr != nil {
+		record.Result = core.AuditError
+		record.Error = runErr.Error()
+		// A failed grab, park or rm published no event, but its project is
+		// the one it was given
+		if len(record.Projects) == 0 && strings.HasPrefix(cmd.Args, "<project>") && len(positional) > 0 {
+			record.Projects = positional[:1]
+		}
+	}
+	if err := core.RecordAudit(core.AuditLogPath(), record); err != nil {
+		g.logf("Warning: failed to write audit log: %v", err)
+	}
+}
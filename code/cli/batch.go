@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// Outcomes of one project in a batch grab or park
+const (
+	batchOK        = "ok"
+	batchCancelled = "cancelled"
+	batchFailed    = "failed"
+)
+
+// batchOutcome is one project's outcome in a batch grab or park
+type batchOutcome struct {
+	Project string `json:"project"`
+	Status  string `json:"status"`
+	Result  any    `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// runBatch runs one command for each of projects in turn, continuing past
+// failures, and reports every project's outcome: as text after each one
+// and in a closing summary, or as a JSON list. run returns the project's
+// result, or nil if the user cancelled it. Named twice, a project runs
+// once. An interrupt stops the batch.
+func runBatch(ctx context.Context, g *Globals, verb, done string, projects []string, run func(projectName string) (any, error)) error {
+	var outcomes []batchOutcome
+	counts := make(map[string]int)
+	for i, projectName := range projects {
+		if slices.Contains(projects[:i], projectName) {
+			continue
+		}
+		result, err := run(projectName)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return cmp.Or(err, ctxErr)
+		}
+		outcome := batchOutcome{Project: projectName, Status: batchOK, Result: result}
+		switch {
+		case err != nil:
+			outcome.Status, outcome.Error = batchFailed, err.Error()
+			if !g.JSON() {
+				fmt.Printf("%sFailed to %s '%s': %v\n", g.mark("✗"), verb, projectName, err)
+			}
+		case result == nil:
+			outcome.Status = batchCancelled
+		}
+		counts[outcome.Status]++
+		outcomes = append(outcomes, outcome)
+	}
+
+	if g.JSON() {
+		if err := printJSON(outcomes); err != nil {
+			return err
+		}
+	} else {
+		label := done
+		if g.DryRun {
+			label = "to " + verb
+		}
+		fmt.Printf("\n%d %s, %d cancelled, %d failed\n", counts[batchOK], label, counts[batchCancelled], counts[batchFailed])
+	}
+	if n := counts[batchFailed]; n > 0 {
+		return fmt.Errorf("%d of %d project(s) could not be %s", n, len(outcomes), done)
+	}
+	return nil
+}
+
+// expandProjects expands the glob patterns among a command's project
+// arguments against a core.MatchProjects set. When there are any, it lists
+// the projects they match and asks before going on, needing --yes without
+// a terminal or with JSON output; it returns nil if the user declined.
+func expandProjects(ctx context.Context, g *Globals, args []string, set, verb string) ([]string, error) {
+	matches, err := core.MatchProjects(ctx, g.StateManager(), args, set)
+	if err != nil {
+		return nil, err
+	}
+	projects := core.MatchedProjects(matches)
+	if !slices.ContainsFunc(matches, func(m core.PatternMatch) bool { return m.Pattern }) {
+		return projects, nil
+	}
+
+	if !g.JSON() {
+		for _, m := range matches {
+			if m.Pattern {
+				fmt.Printf("'%s' matches %d project(s): %s\n", m.Arg, len(m.Projects), strings.Join(m.Projects, ", "))
+			}
+		}
+	}
+	if g.DryRun || g.Yes {
+		return projects, nil
+	}
+	if g.JSON() || !isInteractive() {
+		return nil, fmt.Errorf("the patterns match %d project(s); use --yes to %s them", len(projects), verb)
+	}
+	if !confirm(g, fmt.Sprintf("%s these %d project(s)?", strings.ToUpper(verb[:1])+verb[1:], len(projects))) {
+		g.unchanged = true
+		fmt.Println("Cancelled.")
+		return nil, nil
+	}
+	return projects, nil
+}
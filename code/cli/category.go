@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func categoryCommand(g *Globals) *Command {
+	cmd := newCommand(g, "category", "[add <master> <name> <path> | rm <master> <name> | rename <master> <old> <new>]", "Show, add, remove or rename the categories of a master")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr category",
+		"parkr category add primary data /Volumes/Extra/project-archive/data",
+		"parkr category add nas notebooks /volume1/archive/notebooks --scaffold",
+		"parkr category rename primary pycharm python",
+		"parkr category rename primary misc scratch --path /Volumes/Extra/scratch-archive",
+		"parkr category rm primary rstudio",
+	}
+	scaffold := cmd.Flags.Bool("scaffold", false, "With add, create the category directory")
+	path := cmd.Flags.String("path", "", "With rename, move the category's directory to `path` (default: renamed alongside, if named after the category)")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			g.unchanged = true
+			return CategoryListCmd(ctx, g)
+		}
+		if *scaffold && args[0] != "add" {
+			return usageErrorf("--scaffold can only be used with category add")
+		}
+		if *path != "" && args[0] != "rename" {
+			return usageErrorf("--path can only be used with category rename")
+		}
+		switch args[0] {
+		case "add":
+			if err := requireArgs(cmd, args, 4, 4); err != nil {
+				return err
+			}
+			return CategoryAddCmd(ctx, g, args[1], args[2], args[3], core.AddCategoryOptions{Scaffold: *scaffold, DryRun: g.DryRun})
+		case "rm":
+			if err := requireArgs(cmd, args, 3, 3); err != nil {
+				return err
+			}
+			return CategoryRemoveCmd(ctx, g, args[1], args[2])
+		case "rename":
+			if err := requireArgs(cmd, args, 4, 4); err != nil {
+				return err
+			}
+			return CategoryRenameCmd(ctx, g, args[1], args[2], args[3], core.RenameCategoryOptions{Path: *path, DryRun: g.DryRun})
+		default:
+			return usageErrorf("unknown category action '%s'", args[0])
+		}
+	}
+	return cmd
+}
+
+// CategoryListCmd prints every master's categories, their directories and
+// how many tracked projects each holds
+func CategoryListCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	categories, err := core.ListCategories(sm)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		if categories == nil {
+			categories = []core.CategoryInfo{}
+		}
+		return printJSON(categories)
+	}
+
+	if !g.Plain() {
+		fmt.Printf("%-16s %-16s %-10s %s\n", "MASTER", "CATEGORY", "PROJECTS", "PATH")
+		fmt.Println(strings.Repeat("-", 90))
+	}
+	for _, c := range categories {
+		if g.Plain() {
+			printFields("master", c.Master, "category", c.Name, "projects", strconv.Itoa(c.Projects), "path", c.Path)
+			continue
+		}
+		fmt.Printf("%-16s %-16s %-10d %s\n", c.Master, c.Name, c.Projects, c.Path)
+	}
+	return nil
+}
+
+// CategoryAddCmd registers a new category of a master
+func CategoryAddCmd(ctx context.Context, g *Globals, master, name, path string, opts core.AddCategoryOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+	if !core.IsRemote(path) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		path = abs
+	}
+
+	if err := core.AddCategory(ctx, sm, master, name, path, opts); err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(core.CategoryInfo{Master: master, Name: name, Path: path})
+	}
+	if opts.DryRun {
+		fmt.Printf("Would add category '%s' to master '%s' at %s\n", name, master, path)
+		return nil
+	}
+	fmt.Printf("Added category '%s' to master '%s' at %s\n", name, master, path)
+	return nil
+}
+
+// CategoryRemoveCmd unregisters a category, leaving its directory in place
+func CategoryRemoveCmd(ctx context.Context, g *Globals, master, name string) error {
+	sm := g.StateManager()
+	if err := core.RemoveCategory(sm, master, name, g.DryRun); err != nil {
+		return err
+	}
+	if g.DryRun {
+		fmt.Printf("Would remove category '%s' from master '%s'\n", name, master)
+		return nil
+	}
+	fmt.Printf("Removed category '%s' from master '%s'; its directory was left in place\n", name, master)
+	return nil
+}
+
+// CategoryRenameCmd renames a category, moving its directory after
+// confirmation
+func CategoryRenameCmd(ctx context.Context, g *Globals, master, from, to string, opts core.RenameCategoryOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+	if opts.Path != "" && !core.IsRemote(opts.Path) {
+		abs, err := filepath.Abs(opts.Path)
+		if err != nil {
+			return err
+		}
+		opts.Path = abs
+	}
+
+	plan, err := core.RenameCategory(ctx, sm, master, from, to, core.RenameCategoryOptions{Path: opts.Path, DryRun: true})
+	if err != nil {
+		return err
+	}
+	if !g.JSON() {
+		verb := "Would rename"
+		if !opts.DryRun {
+			verb = "Renaming"
+		}
+		fmt.Printf("%s category '%s' of master '%s' to '%s' (%d tracked project(s))\n", verb, from, master, to, len(plan.Projects))
+		if plan.Moved {
+			fmt.Printf("  Moving %s to %s\n", plan.OldPath, plan.NewPath)
+		} else {
+			fmt.Printf("  Its directory stays at %s\n", plan.OldPath)
+		}
+	}
+	if opts.DryRun {
+		if g.JSON() {
+			return printJSON(plan)
+		}
+		return nil
+	}
+	if plan.Moved && !confirm(g, "Move the directory and rename the category?") {
+		g.unchanged = true
+		fmt.Println("Cancelled.")
+		return nil
+	}
+
+	rename, err := core.RenameCategory(ctx, sm, master, from, to, opts)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(rename)
+	}
+	fmt.Printf("Renamed category '%s' of master '%s' to '%s'\n", from, master, to)
+	return nil
+}
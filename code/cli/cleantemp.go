@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func cleanTempCommand(g *Globals) *Command {
+	cmd := newCommand(g, "clean-temp", "", "Remove temporary checkouts that have no changes")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr clean-temp",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		return CleanTempCmd(ctx, g)
+	}
+	return cmd
+}
+
+// CleanTempCmd removes clean ephemeral checkouts made with grab --temp
+func CleanTempCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	outcomes, err := core.CleanTemp(ctx, sm, core.CleanTempOptions{DryRun: g.DryRun})
+	if g.JSON() {
+		if jsonErr := printJSON(outcomes); jsonErr != nil {
+			return jsonErr
+		}
+		return err
+	}
+
+	if len(outcomes) == 0 && err == nil {
+		fmt.Println("No temporary checkouts.")
+		return nil
+	}
+	for _, o := range outcomes {
+		switch {
+		case !o.Removed:
+			fmt.Printf("Kept %s: %s\n", o.Project, o.Skipped)
+		case g.DryRun:
+			fmt.Printf("Would remove %s (%s)\n", o.Project, o.LocalPath)
+		default:
+			fmt.Printf("Removed %s (%s)\n", o.Project, o.LocalPath)
+		}
+	}
+	return err
+}
@@ -0,0 +1,546 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// Output formats accepted by --format
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatPlain = "plain"
+)
+
+// OutputEnv names the environment variable that picks text or plain output
+// when --format isn't given, ahead of the output setting
+const OutputEnv = "PARKR_OUTPUT"
+
+// Globals holds the flags accepted by every command
+type Globals struct {
+	StatePath string
+	Profile   string
+	DryRun    bool
+	Yes       bool
+	// Format is empty unless --format was given, so the output setting
+	// can pick between text and plain
+	Format  string
+	Verbose bool
+	Timeout time.Duration
+	// LockTimeout is how long to wait for another parkr run to release
+	// the state file
+	LockTimeout time.Duration
+
+	// events collects the project events published while the command ran,
+	// for its audit record
+	events []core.ProjectEvent
+	// unchanged is set by an audited command that turned out to change
+	// nothing, such as prune without --exec, so it isn't audited
+	unchanged bool
+	// plain caches the output style Plain chose, once it has looked
+	plain *bool
+}
+
+// register adds the global flags to a flag set
+func (g *Globals) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.StatePath, "state", g.StatePath, "Path to the state file")
+	fs.StringVar(&g.Profile, "profile", g.Profile, "Use the named profile's state file")
+	fs.BoolVar(&g.DryRun, "dry-run", g.DryRun, "Show what would happen without changing anything")
+	fs.BoolVar(&g.Yes, "yes", g.Yes, "Answer yes to all confirmation prompts")
+	fs.StringVar(&g.Format, "format", g.Format, "Output format: text, plain or json")
+	fs.BoolVar(&g.Verbose, "verbose", g.Verbose, "Print additional detail")
+	fs.DurationVar(&g.Timeout, "timeout", g.Timeout, "Abort the operation after this long (e.g. 30m)")
+	fs.DurationVar(&g.LockTimeout, "lock-timeout", g.LockTimeout, "Wait this long for another parkr run to release the state file (0 to fail at once)")
+}
+
+// validate checks global flag values after parsing
+func (g *Globals) validate() error {
+	switch g.Format {
+	case "", FormatText, FormatJSON, FormatPlain:
+	default:
+		return usageErrorf("invalid --format '%s' (expected text, plain or json)", g.Format)
+	}
+	if g.Timeout < 0 {
+		return usageErrorf("invalid --timeout '%s'", g.Timeout)
+	}
+	if g.LockTimeout < 0 {
+		return usageErrorf("invalid --lock-timeout '%s'", g.LockTimeout)
+	}
+	if g.Profile != "" {
+		if g.StatePath != "" {
+			return usageErrorf("give either --state or --profile, not both")
+		}
+		if err := core.ValidateProfileName(g.Profile); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	return nil
+}
+
+// context returns a context cancelled on SIGINT/SIGTERM or when --timeout
+// expires. The returned stop function releases the associated resources.
+func (g *Globals) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if g.Timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// StateManager returns a state manager for the selected state file, with
+// the project history and event integrations subscribed to its events
+func (g *Globals) StateManager() *core.StateManager {
+	var sm *core.StateManager
+	switch {
+	case g.StatePath != "":
+		sm = core.NewStateManagerAt(g.StatePath)
+	case g.Profile != "":
+		sm = core.NewStateManagerForProfile(g.Profile)
+	default:
+		sm = core.NewStateManager()
+	}
+	sm.SetLockTimeout(g.LockTimeout)
+	subscribeEvents(g, sm)
+	return sm
+}
+
+// JSON reports whether machine-readable output was requested
+func (g *Globals) JSON() bool {
+	return g.Format == FormatJSON
+}
+
+// Plain reports whether text output is plain: one line of labeled fields
+// per item, without tables, symbols, or lines redrawn in place, for screen
+// readers. Without --format it is chosen by $PARKR_OUTPUT, then the output
+// setting.
+func (g *Globals) Plain() bool {
+	switch g.Format {
+	case FormatPlain:
+		return true
+	case FormatText, FormatJSON:
+		return false
+	}
+	if g.plain == nil {
+		output := os.Getenv(OutputEnv)
+		if output == "" {
+			// A state file that can't be read leaves the default; the
+			// command itself reports why
+			if state, err := g.StateManager().Load(); err == nil {
+				output = state.Settings.Output
+			}
+		}
+		plain := output == core.OutputPlain
+		g.plain = &plain
+	}
+	return *g.plain
+}
+
+// logf prints progress detail to stderr when --verbose is set
+func (g *Globals) logf(format string, args ...any) {
+	if g.Verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Command is a single parkr subcommand
+type Command struct {
+	Name    string
+	Aliases []string
+	Args    string // Positional argument synopsis, e.g. "<project>"
+	Summary string
+	// Examples are full command lines shown by "parkr help <command>"
+	Examples []string
+	Flags    *flag.FlagSet
+	Run      func(ctx context.Context, args []string) error
+	// Audited commands change projects or state, and each run is appended
+	// to the audit log
+	Audited bool
+	// Locked commands change files, in the archive or locally, and hold
+	// the state file lock from start to finish so another parkr run can't
+	// interleave its own changes
+	Locked bool
+}
+
+// newCommand creates a command whose flag set already includes the globals
+func newCommand(g *Globals, name, args, summary string, aliases ...string) *Command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	g.register(fs)
+	return &Command{
+		Name:    name,
+		Aliases: aliases,
+		Args:    args,
+		Summary: summary,
+		Flags:   fs,
+	}
+}
+
+// stringList is a flag that may be given several times, collecting every
+// value
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// usageError marks an error caused by invalid arguments (exit code 2)
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string { return e.msg }
+
+func usageErrorf(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// flagError converts a flag parsing error into a usage error, leaving
+// flag.ErrHelp intact so callers can detect -h
+func flagError(err error) error {
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	return &usageError{msg: err.Error()}
+}
+
+// requireArgs checks the number of positional arguments
+func requireArgs(cmd *Command, args []string, min, max int) error {
+	if len(args) < min {
+		return usageErrorf("missing arguments\nUsage: parkr %s %s", cmd.Name, cmd.Args)
+	}
+	if max >= 0 && len(args) > max {
+		return usageErrorf("unexpected argument '%s'\nUsage: parkr %s %s", args[max], cmd.Name, cmd.Args)
+	}
+	return nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments and returns the positional arguments in order
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, flagError(err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Commands returns the built-in commands in help order
+func Commands(g *Globals) []*Command {
+	return []*Command{
+		initCommand(g),
+		listCommand(g),
+		addCommand(g),
+		grabCommand(g),
+		parkCommand(g),
+		rmCommand(g),
+		renameCommand(g),
+		mvCommand(g),
+		pullCommand(g),
+		restoreCommand(g),
+		infoCommand(g),
+		whichCommand(g),
+		historyCommand(g),
+		auditCommand(g),
+		inspectCommand(g),
+		catCommand(g),
+		extractCommand(g),
+		tagCommand(g),
+		statusCommand(g),
+		localCommand(g),
+		reportCommand(g),
+		driftCommand(g),
+		refreshSizesCommand(g),
+		pruneCommand(g),
+		statsCommand(g),
+		digestCommand(g),
+		quotaCommand(g),
+		masterCommand(g),
+		categoryCommand(g),
+		verifyCommand(g),
+		gcCommand(g),
+		trashCommand(g),
+		undoCommand(g),
+		cleanTempCommand(g),
+		dupesCommand(g),
+		exportCommand(g),
+		profilesCommand(g),
+		configCommand(g),
+		migrateStateCommand(g),
+	}
+}
+
+// findCommand looks up a command by name or alias
+func findCommand(commands []*Command, name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// Main runs parkr with the given command-line arguments (excluding the
+// program name) and returns the process exit code
+func Main(args []string) int {
+	g := &Globals{LockTimeout: core.DefaultLockTimeout}
+	commands := Commands(g)
+
+	root := flag.NewFlagSet("parkr", flag.ContinueOnError)
+	root.SetOutput(io.Discard)
+	g.register(root)
+	if err := root.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(commands)
+			return ExitOK
+		}
+		return reportError(flagError(err))
+	}
+	args = root.Args()
+
+	if len(args) == 0 {
+		printUsage(commands)
+		return ExitUsage
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "--help", "-h":
+		if len(args) > 1 {
+			cmd := findCommand(commands, args[1])
+			if cmd == nil {
+				fmt.Fprintf(os.Stderr, "Error: unknown command '%s'\n", args[1])
+				return ExitUsage
+			}
+			printCommandHelp(cmd)
+			return ExitOK
+		}
+		printUsage(commands)
+		return ExitOK
+	}
+
+	cmd := findCommand(commands, name)
+	if cmd == nil {
+		// Fall back to an external parkr-<command> executable on PATH
+		if path, ok := FindPlugin(name); ok {
+			code, err := RunPlugin(g, path, args[1:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			return code
+		}
+		fmt.Fprintf(os.Stderr, "Error: unknown command '%s'\n", name)
+		printUsage(commands)
+		return ExitUsage
+	}
+
+	positional, err := parseInterspersed(cmd.Flags, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandHelp(cmd)
+		return ExitOK
+	}
+	if err != nil {
+		return reportError(err)
+	}
+	if err := g.validate(); err != nil {
+		return reportError(err)
+	}
+	if err := g.StateManager().CheckBackend(); err != nil {
+		return reportError(err)
+	}
+
+	ctx, stop := g.context()
+	defer stop()
+
+	started := time.Now()
+	err = runLocked(ctx, g, cmd, positional)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s: %w", g.Timeout, err)
+	}
+	if cmd.Audited {
+		recordAudit(g, cmd, args[1:], positional, started, err)
+	}
+	exportMetrics(g, cmd, started, err)
+	return reportError(err)
+}
+
+// runLocked runs cmd, holding the state file lock throughout if it is a
+// Locked command, so another parkr run can't interleave its own changes
+func runLocked(ctx context.Context, g *Globals, cmd *Command, args []string) error {
+	if !cmd.Locked || g.DryRun {
+		return cmd.Run(ctx, args)
+	}
+	unlock, err := g.StateManager().Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return cmd.Run(ctx, args)
+}
+
+// Exit codes, as documented in the spec
+const (
+	ExitOK                 = 0
+	ExitError              = 1
+	ExitUsage              = 2
+	ExitArchiveUnreachable = 3
+	ExitStateFile          = 4
+)
+
+// ExitCode maps an error returned by a command to a process exit code
+func ExitCode(err error) int {
+	var ue *usageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &ue):
+		return ExitUsage
+	case errors.Is(err, core.ErrArchiveUnreachable):
+		return ExitArchiveUnreachable
+	case errors.Is(err, core.ErrStateFile), errors.Is(err, core.ErrStateLocked):
+		return ExitStateFile
+	default:
+		return ExitError
+	}
+}
+
+// reportError prints err and maps it to an exit code
+func reportError(err error) int {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return ExitCode(err)
+}
+
+// printUsage prints the top-level help text
+func printUsage(commands []*Command) {
+	fmt.Println("parkr - Project archive manager")
+	fmt.Println()
+	fmt.Println("Usage: parkr [global options] <command> [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, cmd := range commands {
+		synopsis := strings.TrimSpace(cmd.Name + " " + cmd.Args)
+		fmt.Printf("  %-24s %s\n", synopsis, cmd.Summary)
+
+		var opts []string
+		cmd.Flags.VisitAll(func(f *flag.Flag) {
+			if !isGlobalFlag(f.Name) {
+				opts = append(opts, "--"+f.Name)
+			}
+		})
+		if len(opts) > 0 {
+			fmt.Printf("  %-24s Options: %s\n", "", strings.Join(opts, ", "))
+		}
+	}
+	fmt.Printf("  %-24s %s\n", "help [command]", "Show this help message, or details of one command")
+
+	fmt.Println()
+	fmt.Println("Global options:")
+	fmt.Println("  --state <path>           Use an alternate state file (default $PARKR_STATE_PATH, or ~/.parkr/state.json)")
+	fmt.Println("  --profile <name>         Use a named profile (~/.parkr/profiles/<name>)")
+	fmt.Println("  --dry-run                Show what would happen without changing anything")
+	fmt.Println("  --yes                    Answer yes to all confirmation prompts")
+	fmt.Println("  --format <format>        Output format: text, plain or json (default $PARKR_OUTPUT, the output setting, or text)")
+	fmt.Println("  --verbose                Print additional detail")
+	fmt.Println("  --timeout <duration>     Abort the operation after this long (e.g. 30m)")
+	fmt.Println("  --lock-timeout <duration>")
+	fmt.Printf("  %-24s %s\n", "", "Wait this long for another parkr run to release the state file (default 30s, 0 to fail at once)")
+
+	if plugins := ListPlugins(); len(plugins) > 0 {
+		fmt.Println()
+		fmt.Println("Plugins (parkr-<name> on PATH):")
+		for _, name := range plugins {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+}
+
+// printCommandHelp prints a command's usage, options and examples, generated
+// from its definition
+func printCommandHelp(cmd *Command) {
+	fmt.Printf("Usage: %s\n\n", strings.TrimSpace("parkr "+cmd.Name+" [options] "+cmd.Args))
+	fmt.Println(cmd.Summary)
+	if len(cmd.Aliases) > 0 {
+		fmt.Printf("\nAliases: %s\n", strings.Join(cmd.Aliases, ", "))
+	}
+
+	var lines [][2]string
+	cmd.Flags.VisitAll(func(f *flag.Flag) {
+		if isGlobalFlag(f.Name) {
+			return
+		}
+		name, usage := flag.UnquoteUsage(f)
+		synopsis := "--" + f.Name
+		if name != "" {
+			synopsis += " <" + name + ">"
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		lines = append(lines, [2]string{synopsis, usage})
+	})
+	if len(lines) > 0 {
+		fmt.Println()
+		fmt.Println("Options:")
+		for _, l := range lines {
+			fmt.Printf("  %-24s %s\n", l[0], l[1])
+		}
+	}
+
+	if len(cmd.Examples) > 0 {
+		fmt.Println()
+		fmt.Println("Examples:")
+		for _, e := range cmd.Examples {
+			fmt.Printf("  %s\n", e)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Global options are listed by 'parkr help'.")
+}
+
+// isGlobalFlag reports whether name is one of the global flags
+func isGlobalFlag(name string) bool {
+	switch name {
+	case "state", "profile", "dry-run", "yes", "format", "verbose", "timeout", "lock-timeout":
+		return true
+	}
+	return false
+}
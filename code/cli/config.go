@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func configCommand(g *Globals) *Command {
+	cmd := newCommand(g, "config", "[set <key> <value> | unset <key>]", "Show or change configuration")
+	cmd.Examples = []string{
+		"parkr config",
+		"parkr config set metadata_file DESCRIPTION",
+		"parkr config set recent_park_size 10G",
+		"parkr config set verification hash",
+		"parkr config set --project ml-pipeline verification git",
+	}
+	project := cmd.Flags.String("project", "", "Set or unset the key for `project` only (verification only)")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return ConfigCmd(ctx, g)
+		}
+
+		sm := g.StateManager()
+		switch args[0] {
+		case "set":
+			if err := requireArgs(cmd, args, 3, 3); err != nil {
+				return err
+			}
+			if err := setConfig(sm, *project, args[1], args[2]); err != nil {
+				return err
+			}
+			fmt.Printf("Set %s to %s%s\n", args[1], args[2], projectSuffix(*project))
+		case "unset":
+			if err := requireArgs(cmd, args, 2, 2); err != nil {
+				return err
+			}
+			if err := setConfig(sm, *project, args[1], ""); err != nil {
+				return err
+			}
+			fmt.Printf("Unset %s%s\n", args[1], projectSuffix(*project))
+		default:
+			return usageErrorf("unknown config action '%s'", args[0])
+		}
+		return nil
+	}
+	return cmd
+}
+
+// setConfig sets a configuration key globally, or for one project when
+// project is non-empty
+func setConfig(sm core.StateStore, project, key, value string) error {
+	if project == "" {
+		if err := core.SetConfig(sm, key, value); err != nil {
+			return usageErrorf("%v", err)
+		}
+		return nil
+	}
+	if key != "verification" {
+		return usageErrorf("--project only applies to verification")
+	}
+	err := core.SetProjectVerification(sm, project, value)
+	if err != nil && !errors.Is(err, core.ErrProjectNotFound) {
+		return usageErrorf("%v", err)
+	}
+	return err
+}
+
+// projectSuffix describes the --project scope in confirmation messages
+func projectSuffix(project string) string {
+	if project == "" {
+		return ""
+	}
+	return fmt.Sprintf(" for '%s'", project)
+}
+
+// configOutput is the JSON document printed by config
+type configOutput struct {
+	StatePath     string                       `json:"state_path"`
+	Masters       map[string]map[string]string `json:"masters"`
+	DefaultMaster string                       `json:"default_master"`
+	LocalRoots    map[string]string            `json:"local_roots"`
+	Settings      map[string]string            `json:"settings"`
+}
+
+// ConfigCmd shows the state file location, archive and local roots, and
+// the value of every configuration key
+func ConfigCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+
+	localRoots := make(map[string]string)
+	for _, categories := range state.Masters {
+		for category := range categories {
+			localRoots[category] = state.LocalRoot(category)
+		}
+	}
+	settings := make(map[string]string)
+	for _, k := range core.ConfigKeys() {
+		settings[k.Name] = k.Value(&state.Settings)
+	}
+
+	if g.JSON() {
+		return printJSON(configOutput{
+			StatePath:     sm.StatePath(),
+			Masters:       state.Masters,
+			DefaultMaster: state.DefaultMaster,
+			LocalRoots:    localRoots,
+			Settings:      settings,
+		})
+	}
+
+	fmt.Printf("State file: %s\n", sm.StatePath())
+	fmt.Printf("Default master: %s\n\n", state.DefaultMaster)
+	printCategoryPaths("Archive roots ("+state.DefaultMaster+"):", state.Masters[state.DefaultMaster])
+	fmt.Println()
+	printCategoryPaths("Local roots:", localRoots)
+	fmt.Println()
+	fmt.Println("Settings:")
+	for _, k := range core.ConfigKeys() {
+		value := k.Value(&state.Settings)
+		if value == "" {
+			value = "(default)"
+		}
+		fmt.Printf("  %-20s %-20s %s\n", k.Name, value, k.Description)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func digestCommand(g *Globals) *Command {
+	cmd := newCommand(g, "digest", "", "Summarise stale projects, disk usage, parks and scrubs")
+	cmd.Examples = []string{
+		"parkr digest",
+		"parkr digest --send",
+		"parkr digest --send --every 24h",
+		"parkr digest --stale-days 30",
+	}
+	send := cmd.Flags.Bool("send", false, "Deliver the digest to digest_email and digest_webhook instead of printing it")
+	every := cmd.Flags.Duration("every", 0, "Keep running and send a digest every `interval` (e.g. 24h); implies --send")
+	staleDays := cmd.Flags.Int("stale-days", 0, "List unparked work and scrubs older than `n` days (default: digest_stale_days setting)")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		if *staleDays < 0 {
+			return usageErrorf("--stale-days can't be negative")
+		}
+		if *every < 0 {
+			return usageErrorf("--every can't be negative")
+		}
+		opts := DigestOptions{Send: *send || *every > 0, StaleDays: *staleDays}
+		if *every > 0 {
+			return DigestLoopCmd(ctx, g, opts, *every)
+		}
+		return DigestCmd(ctx, g, opts)
+	}
+	return cmd
+}
+
+// DigestOptions holds the flags accepted by digest
+type DigestOptions struct {
+	Send      bool
+	StaleDays int
+}
+
+// DigestCmd prints the health digest, or sends it to the configured targets
+func DigestCmd(ctx context.Context, g *Globals, opts DigestOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	homeDir, _ := os.UserHomeDir()
+	digest, err := core.BuildDigest(ctx, sm, opts.StaleDays, homeDir, time.Now())
+	if err != nil {
+		return err
+	}
+	subject := digestSubject(digest)
+	body := formatDigest(digest)
+
+	if !opts.Send {
+		if g.JSON() {
+			return printJSON(digest)
+		}
+		fmt.Println(subject)
+		fmt.Println()
+		fmt.Print(body)
+		return nil
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	targets := state.Settings.DigestTargets()
+	if g.DryRun {
+		if len(targets) == 0 {
+			return fmt.Errorf("no digest target configured; set digest_email or digest_webhook")
+		}
+		fmt.Printf("Would send \"%s\" to %s\n", subject, strings.Join(targets, ", "))
+		return nil
+	}
+	if err := core.SendDigest(ctx, &state.Settings, digest, subject, body); err != nil {
+		return err
+	}
+	if !g.JSON() {
+		fmt.Printf("Sent \"%s\" to %s\n", subject, strings.Join(targets, ", "))
+	}
+	return nil
+}
+
+// DigestLoopCmd sends a digest now and then every interval until ctx is
+// cancelled, for running under a service manager instead of cron. A failed
+// send is reported and retried at the next interval.
+func DigestLoopCmd(ctx context.Context, g *Globals, opts DigestOptions, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := DigestCmd(ctx, g, opts); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// digestSubject sums up a digest in one line
+func digestSubject(d *core.Digest) string {
+	if d.Healthy() {
+		return fmt.Sprintf("parkr digest %s: all clear", d.GeneratedAt.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("parkr digest %s: %d stale project(s), %d archive copy(ies) not scrubbed recently",
+		d.GeneratedAt.Format("2006-01-02"), len(d.Stale), len(d.Unscrubbed))
+}
+
+// formatDigest renders a digest as plain text for the terminal or email
+func formatDigest(d *core.Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "UNPARKED WORK OLDER THAN %d DAYS\n", d.StaleDays)
+	if len(d.Stale) == 0 {
+		b.WriteString("  None.\n")
+	}
+	for _, e := range d.Stale {
+		fmt.Fprintf(&b, "  %-30s %-10s %-14s last parked %s\n", e.Name, formatSizeOrUnknown(e.LocalSize), e.Status, core.FormatAge(e.LastParkAt))
+	}
+
+	b.WriteString("\nDISK USAGE\n")
+	fmt.Fprintf(&b, "  %d grabbed project(s), %s local; %s safe to delete\n", d.Grabbed, core.FormatSize(d.LocalTotal), core.FormatSize(d.Recoverable))
+	if d.Disk != nil {
+		fmt.Fprintf(&b, "  Local volume: %s free of %s\n", core.FormatSize(d.Disk.Free), core.FormatSize(d.Disk.Total))
+	}
+
+	b.WriteString("\nRECENT PARKS\n")
+	if len(d.RecentParks) == 0 {
+		b.WriteString("  None.\n")
+	}
+	for _, e := range d.RecentParks {
+		fmt.Fprintf(&b, "  %-30s %s\n", e.Name, core.FormatAge(e.LastParkAt))
+	}
+
+	fmt.Fprintf(&b, "\nSCRUBS (%d passed within %d days)\n", d.Scrubbed, d.StaleDays)
+	if len(d.Unscrubbed) == 0 {
+		b.WriteString("  Every archive copy passed a recent scrub.\n")
+	}
+	for i, s := range d.Unscrubbed {
+		if i == maxDiffLines {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(d.Unscrubbed)-maxDiffLines)
+			break
+		}
+		fmt.Fprintf(&b, "  %-30s last passed %s\n", s.Name, core.FormatAge(s.VerifiedAt))
+	}
+	if len(d.Unscrubbed) > 0 {
+		b.WriteString("  Run 'parkr verify --scrub' to check them.\n")
+	}
+	return b.String()
+}
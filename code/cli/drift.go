@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func driftCommand(g *Globals) *Command {
+	cmd := newCommand(g, "drift", "[project...]", "Show grabbed projects whose local and archive copies differ, and which side changed")
+	cmd.Examples = []string{
+		"parkr drift",
+		"parkr drift ml-pipeline --all",
+		"parkr --format json drift",
+	}
+	all := cmd.Flags.Bool("all", false, "Also list projects whose copies match")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		return DriftCmd(ctx, g, args, *all)
+	}
+	return cmd
+}
+
+// DriftCmd prints the drift between the local and archive copies of the
+// named grabbed projects, or all of them
+func DriftCmd(ctx context.Context, g *Globals, names []string, all bool) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	entries, err := core.Drift(ctx, sm, names)
+	if err != nil {
+		return err
+	}
+	if !all {
+		var drifted []core.DriftEntry
+		for _, e := range entries {
+			if e.Drift != core.DriftInSync {
+				drifted = append(drifted, e)
+			}
+		}
+		entries = drifted
+	}
+
+	if g.JSON() {
+		if entries == nil {
+			entries = []core.DriftEntry{}
+		}
+		return printJSON(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("Every grabbed project matches its archive copy.")
+		return nil
+	}
+
+	if !g.Plain() {
+		fmt.Printf("%-30s %-16s %-11s %-13s %-8s %-12s %s\n", "PROJECT", "DRIFT", "LOCAL ONLY", "ARCHIVE ONLY", "CHANGED", "LOCAL SIZE", "ARCHIVE SIZE")
+		fmt.Println(strings.Repeat("-", 108))
+	}
+	for _, e := range entries {
+		if g.Plain() {
+			printDriftFields(e)
+			continue
+		}
+		if e.Error != "" || e.Drift == core.DriftLocalMissing || e.Drift == core.DriftArchiveMissing {
+			fmt.Printf("%-30s %s\n", e.Name, e.Drift)
+			if e.Error != "" {
+				fmt.Printf("  %s\n", e.Error)
+			}
+			continue
+		}
+		fmt.Printf("%-30s %-16s %-11d %-13d %-8d %-12s %s\n", e.Name, e.Drift, e.LocalOnly, e.ArchiveOnly, e.Changed,
+			core.FormatSize(e.LocalBytes), core.FormatSize(e.ArchiveBytes))
+	}
+
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.Drift]++
+	}
+	var hints []string
+	if counts[core.DriftLocalAhead] > 0 {
+		hints = append(hints, "park local-ahead projects")
+	}
+	if counts[core.DriftArchiveAhead] > 0 {
+		hints = append(hints, "pull archive-ahead ones")
+	}
+	if counts[core.DriftDiverged] > 0 {
+		hints = append(hints, "merge diverged ones by hand before parking")
+	}
+	if len(hints) > 0 {
+		fmt.Printf("\nTo catch up: %s.\n", strings.Join(hints, "; "))
+	}
+	return nil
+}
+
+// printDriftFields prints a drift entry as plain output, one line
+func printDriftFields(e core.DriftEntry) {
+	if e.Error != "" || e.Drift == core.DriftLocalMissing || e.Drift == core.DriftArchiveMissing {
+		printFields("project", e.Name, "drift", e.Drift, "error", e.Error)
+		return
+	}
+	printFields("project", e.Name, "drift", e.Drift,
+		"local only", strconv.Itoa(e.LocalOnly), "archive only", strconv.Itoa(e.ArchiveOnly), "changed", strconv.Itoa(e.Changed),
+		"local size", core.FormatSize(e.LocalBytes), "archive size", core.FormatSize(e.ArchiveBytes))
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func dupesCommand(g *Globals) *Command {
+	cmd := newCommand(g, "dupes", "", "Find archived projects with identical or matching contents")
+	cmd.Examples = []string{
+		"parkr dupes",
+		"parkr dupes --rehash",
+	}
+	rehash := cmd.Flags.Bool("rehash", false, "Rehash every project instead of reusing the index")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		return DupesCmd(ctx, g, *rehash)
+	}
+	return cmd
+}
+
+// DupesCmd updates the hash index and reports duplicate projects
+func DupesCmd(ctx context.Context, g *Globals, rehash bool) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	index, hashed, err := core.UpdateHashIndex(ctx, sm, sm.StatePath(), rehash)
+	if err != nil {
+		return err
+	}
+	g.logf("Hashed %d of %d project(s)", hashed, len(index))
+
+	groups := core.FindDuplicates(index)
+	if g.JSON() {
+		if groups == nil {
+			groups = []core.DuplicateGroup{}
+		}
+		return printJSON(groups)
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No duplicate projects found.")
+		return nil
+	}
+
+	var wasted int64
+	for _, grp := range groups {
+		label := "Identical"
+		if grp.Kind == core.DupeManifest {
+			label = "Same files, different contents"
+		}
+		fmt.Printf("%s (%s each): %s\n", label, core.FormatSize(grp.Size), strings.Join(grp.Projects, ", "))
+		if grp.Kind == core.DupeIdentical {
+			wasted += grp.Size * int64(len(grp.Projects)-1)
+		}
+	}
+	fmt.Println()
+	fmt.Printf("Space held by identical copies: %s\n", core.FormatSize(wasted))
+	return nil
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// subscribeEvents records sm's project events in the project history and
+// passes them to the configured event_hook and event_webhook. Failures
+// warn rather than failing the command, whose operation has already
+// happened.
+func subscribeEvents(g *Globals, sm *core.StateManager) {
+	sm.Events().Subscribe(func(e core.ProjectEvent) {
+		g.events = append(g.events, e)
+		if err := core.RecordProjectEvent(sm.StatePath(), e); err != nil {
+			g.logf("Warning: failed to record project history: %v", err)
+		}
+	})
+	sm.Events().Subscribe(func(e core.ProjectEvent) {
+		state, err := sm.Load()
+		if err != nil {
+			return
+		}
+		ctx := context.Background()
+		if hook := state.Settings.EventHook; hook != "" {
+			g.logf("Running event hook for %s %s", e.Op, e.Project)
+			if err := core.RunEventHook(ctx, hook, e); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: event hook failed for %s %s: %v\n", e.Op, e.Project, err)
+			}
+		}
+		if url := state.Settings.EventWebhook; url != "" {
+			g.logf("Posting %s %s to %s", e.Op, e.Project, url)
+			if err := core.PostEventWebhook(ctx, url, e); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: event webhook failed for %s %s: %v\n", e.Op, e.Project, err)
+			}
+		}
+	})
+}
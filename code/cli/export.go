@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func exportCommand(g *Globals) *Command {
+	cmd := newCommand(g, "export", "[file]", "Export configuration for setting up another machine")
+	cmd.Examples = []string{
+		"parkr export --projects laptop.json",
+	}
+	projects := cmd.Flags.Bool("projects", false, "Include project metadata")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 1); err != nil {
+			return err
+		}
+		path := ""
+		if len(args) > 0 {
+			path = args[0]
+		}
+		return ExportCmd(ctx, g, path, *projects)
+	}
+	return cmd
+}
+
+// ExportCmd writes the configuration as JSON to path, or stdout if path is ""
+func ExportCmd(ctx context.Context, g *Globals, path string, withProjects bool) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	export, err := core.ExportConfig(sm, withProjects)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return printJSON(export)
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize config: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if !g.JSON() {
+		fmt.Printf("Exported configuration to %s\n", path)
+	}
+	return nil
+}
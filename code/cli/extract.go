@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func catCommand(g *Globals) *Command {
+	cmd := newCommand(g, "cat", "<project> <path>", "Print a file from an archived project")
+	cmd.Examples = []string{
+		"parkr cat ml-pipeline config/train.yaml",
+		"parkr cat ml-pipeline backups/runs.tar.gz/run-12/metrics.csv",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 2, 2); err != nil {
+			return err
+		}
+		return CatCmd(ctx, g, args[0], args[1])
+	}
+	return cmd
+}
+
+// CatCmd writes a file from an archived project to stdout
+func CatCmd(ctx context.Context, g *Globals, projectName, filePath string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	r, err := core.OpenArchiveFile(ctx, sm, projectName, filePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+func extractCommand(g *Globals) *Command {
+	cmd := newCommand(g, "extract", "<project> <path> [dest]", "Copy a file or directory out of an archived project")
+	cmd.Examples = []string{
+		"parkr extract ml-pipeline notebooks/eda.ipynb",
+		"parkr extract ml-pipeline data/raw ./raw-data",
+	}
+	force := cmd.Flags.Bool("force", false, "Overwrite an existing destination")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 2, 3); err != nil {
+			return err
+		}
+		dest := path.Base(args[1])
+		if len(args) == 3 {
+			dest = args[2]
+		}
+		return ExtractCmd(ctx, g, args[0], args[1], dest, *force)
+	}
+	return cmd
+}
+
+// ExtractCmd copies a file or directory from an archived project to dest
+func ExtractCmd(ctx context.Context, g *Globals, projectName, filePath, dest string, force bool) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	result, err := core.Extract(ctx, sm, projectName, filePath, dest, core.ExtractOptions{Force: force, DryRun: g.DryRun})
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(result)
+	}
+	if result.DryRun {
+		fmt.Printf("Would extract %s from '%s' to %s\n", result.Path, result.Project, result.Dest)
+		return nil
+	}
+	fmt.Printf("Extracted %s from '%s' to %s (%d file(s), %s)\n",
+		result.Path, result.Project, result.Dest, result.Files, core.FormatSize(result.Bytes))
+	return nil
+}
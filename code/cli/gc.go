@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func gcCommand(g *Globals) *Command {
+	cmd := newCommand(g, "gc", "", "Remove leftover temp and empty directories and expired trash from the archive")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr --dry-run gc",
+		"parkr gc",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		return GCCmd(ctx, g)
+	}
+	return cmd
+}
+
+// GCCmd removes leftover data from the archive and reports space reclaimed
+func GCCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	result, err := core.GC(ctx, sm, core.GCOptions{DryRun: g.DryRun})
+	if err != nil {
+		return err
+	}
+
+	failed := false
+	for _, item := range result.Items {
+		if item.Error != "" {
+			failed = true
+		}
+	}
+
+	if g.JSON() {
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else {
+		for _, m := range result.Skipped {
+			fmt.Printf("Skipping read-only or remote master '%s'\n", m)
+		}
+		if len(result.Items) == 0 {
+			fmt.Println("Nothing to clean up.")
+			return nil
+		}
+
+		verb := "Removed"
+		if result.DryRun {
+			verb = "Would remove"
+		}
+		for _, item := range result.Items {
+			desc := "empty directory"
+			switch item.Kind {
+			case core.GCTempDir:
+				desc = "temp directory"
+			case core.GCTrash:
+				desc = "expired trash"
+			}
+			if item.Error != "" {
+				fmt.Printf("Failed to remove %s %s: %s\n", desc, item.Path, item.Error)
+				continue
+			}
+			fmt.Printf("%s %s %s (%s)\n", verb, desc, item.Path, core.FormatSize(item.Size))
+		}
+		if result.DryRun {
+			fmt.Printf("Would reclaim %s\n", core.FormatSize(result.Reclaimed))
+		} else {
+			fmt.Printf("Reclaimed %s\n", core.FormatSize(result.Reclaimed))
+		}
+	}
+
+	if failed {
+		return fmt.Errorf("some items could not be removed")
+	}
+	return nil
+}
@@ -1,81 +1,204 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"path/filepath"
-	"time"
 
 	"github.com/jamespark/parkr/core"
 )
 
-// GrabCmd checks out a project from archive to local
-func GrabCmd(projectName string) error {
-	sm := core.NewStateManager()
-	state, err := sm.Load()
-	if err != nil {
-		return err
+func grabCommand(g *Globals) *Command {
+	cmd := newCommand(g, "grab", "<project>...", "Copy projects from archive to local", "checkout")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr grab ml-pipeline",
+		"parkr grab ml-pipeline analysis webapp",
+		"parkr grab 'ml-*'",
+		"parkr grab --latest analysis",
+		"parkr grab --temp old-experiment",
+		"parkr grab --jobs 8 node-monorepo",
+		"parkr grab --bwlimit 5M ml-pipeline",
+		"parkr grab --verify ml-pipeline",
+		"parkr grab --master backup ml-pipeline",
 	}
-
-	// Check if already grabbed
-	if existingProject, exists := state.Projects[projectName]; exists && existingProject.IsGrabbed {
-		return fmt.Errorf("project '%s' is already grabbed at %s", projectName, existingProject.LocalPath)
+	forceOverQuota := cmd.Flags.Bool("force-over-quota", false, "Grab even if an enforced category quota or grab limit would be exceeded")
+	cmd.Flags.BoolVar(forceOverQuota, "ignore-quota", false, "Same as --force-over-quota")
+	temp := cmd.Flags.Bool("temp", false, "Check out to a temporary location that clean-temp can delete")
+	latest := cmd.Flags.Bool("latest", false, "Grab the newest dated snapshot when the name matches several")
+	jobs := cmd.Flags.Int("jobs", 0, "Copy with up to `n` rsync processes at once (default: transfer_jobs setting)")
+	bwlimit := cmd.Flags.String("bwlimit", "", "Limit the transfer `rate` per second, e.g. 5M; 0 for no limit (default: bwlimit setting)")
+	verify := cmd.Flags.Bool("verify", false, "Check every copied file against the checksums written by park")
+	master := cmd.Flags.String("master", "", "Grab the copy in this `master`, when the project is in more than one")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, -1); err != nil {
+			return err
+		}
+		if *jobs < 0 {
+			return usageErrorf("--jobs can't be negative")
+		}
+		if err := checkBwLimit(*bwlimit); err != nil {
+			return err
+		}
+		opts := GrabOptions{
+			IgnoreQuota: *forceOverQuota,
+			Temp:        *temp,
+			Latest:      *latest,
+			Jobs:        *jobs,
+			BwLimit:     *bwlimit,
+			Verify:      *verify,
+			Master:      *master,
+		}
+		projects, err := expandProjects(ctx, g, args, core.MatchUngrabbed, "grab")
+		if err != nil || projects == nil {
+			return err
+		}
+		if len(projects) > 1 {
+			return GrabAllCmd(ctx, g, projects, opts)
+		}
+		return GrabCmd(ctx, g, projects[0], opts)
 	}
+	return cmd
+}
 
-	// Find project in archive
-	archiveProjects, err := core.DiscoverArchiveProjects(state)
-	if err != nil {
-		return fmt.Errorf("failed to scan archive: %w", err)
-	}
+// GrabOptions holds the flags accepted by grab
+type GrabOptions struct {
+	IgnoreQuota bool
+	Temp        bool
+	Latest      bool
+	Jobs        int
+	BwLimit     string
+	Verify      bool
+	Master      string
+}
 
-	archiveProject, exists := archiveProjects[projectName]
-	if !exists {
-		return fmt.Errorf("project '%s' not found in archive", projectName)
+// GrabCmd checks out a project from archive to local
+func GrabCmd(ctx context.Context, g *Globals, projectName string, opts GrabOptions) error {
+	result, err := grabProject(ctx, g, projectName, opts)
+	if err != nil || result == nil || !g.JSON() {
+		return err
 	}
+	return printJSON(result)
+}
 
-	// Determine local path
-	localRoot := core.GetDefaultLocalPath(archiveProject.Category)
-	localPath := filepath.Join(localRoot, projectName)
+// GrabAllCmd checks out several projects in turn, continuing past failures,
+// and summarises which were grabbed
+func GrabAllCmd(ctx context.Context, g *Globals, projects []string, opts GrabOptions) error {
+	return runBatch(ctx, g, "grab", "grabbed", projects, func(projectName string) (any, error) {
+		result, err := grabProject(ctx, g, projectName, opts)
+		if result == nil {
+			return nil, err
+		}
+		return result, err
+	})
+}
 
-	// Check if local path already exists
-	if _, err := os.Stat(localPath); err == nil {
-		return fmt.Errorf("local path already exists: %s (use --force to overwrite)", localPath)
+// grabProject checks out a project, printing its progress and outcome as
+// text unless the output is JSON. It returns nil if the user cancelled.
+func grabProject(ctx context.Context, g *Globals, projectName string, opts GrabOptions) (*core.GrabResult, error) {
+	if !g.JSON() && !g.DryRun {
+		fmt.Printf("Grabbing %s...\n", projectName)
 	}
 
-	// Ensure local root exists
-	if err := os.MkdirAll(localRoot, 0755); err != nil {
-		return fmt.Errorf("failed to create local directory: %w", err)
-	}
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
 
-	// Create the destination directory
-	if err := os.MkdirAll(localPath, 0755); err != nil {
-		return fmt.Errorf("failed to create project directory: %w", err)
+	grabOpts := core.GrabOptions{
+		DryRun:      g.DryRun,
+		IgnoreQuota: opts.IgnoreQuota,
+		Temp:        opts.Temp,
+		Latest:      opts.Latest,
+		Jobs:        opts.Jobs,
+		BwLimit:     opts.BwLimit,
+		Verify:      opts.Verify,
+		Master:      opts.Master,
+	}
+	confirmed := false
+	if !g.DryRun {
+		ok, err := confirmStaleGrab(ctx, g, sm, projectName, grabOpts)
+		if err != nil || !ok {
+			return nil, err
+		}
+		confirmed = true
 	}
 
-	fmt.Printf("Grabbing %s from %s to %s...\n", projectName, archiveProject.Path, localPath)
-
-	// Rsync from archive to local
-	if err := core.Rsync(archiveProject.Path, localPath); err != nil {
-		// Clean up on failure
-		os.RemoveAll(localPath)
-		return fmt.Errorf("failed to copy project: %w", err)
+	progress, finish := transferProgress(g, projectName, "copying")
+	grabOpts.Progress = progress
+	result, err := core.Grab(ctx, sm, projectName, grabOpts)
+	finish(err)
+	if err != nil || g.JSON() {
+		return result, err
+	}
+	for _, w := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if result.Stale && !confirmed {
+		printStaleNotice(g, result)
+	}
+	if result.DryRun {
+		if result.Resumed {
+			fmt.Printf("Would resume the interrupted grab of '%s' into %s\n", result.Project, result.LocalPath)
+			return result, nil
+		}
+		fmt.Printf("Would grab '%s' from %s to %s\n", result.Project, result.ArchivePath, result.LocalPath)
+		return result, nil
 	}
 
-	// Update state
-	now := time.Now()
-	state.Projects[projectName] = &core.Project{
-		LocalPath:       localPath,
-		Master:          archiveProject.Master,
-		ArchiveCategory: archiveProject.Category,
-		GrabbedAt:       &now,
-		IsGrabbed:       true,
-		NoHashMode:      true, // Default to no-hash mode for Phase 1
+	if result.Resumed {
+		fmt.Println("Resumed an interrupted grab.")
+	}
+	if result.Verified > 0 {
+		fmt.Printf("Verified %d file(s) against the archive checksums.\n", result.Verified)
+	}
+	fmt.Printf("Successfully grabbed '%s' from %s to %s\n", result.Project, result.ArchivePath, result.LocalPath)
+	if result.Ephemeral {
+		fmt.Println("This is a temporary checkout; 'parkr clean-temp' removes it once it has no changes.")
 	}
+	return result, nil
+}
 
-	if err := sm.Save(state); err != nil {
-		return fmt.Errorf("failed to update state: %w", err)
+// confirmStaleGrab asks before grabbing a stale project when the
+// stale_grab_action setting is confirm, and reports whether to go on.
+// Without a terminal to ask on, a stale grab needs --yes. Otherwise it
+// always goes on, leaving the notice to be printed after the grab.
+func confirmStaleGrab(ctx context.Context, g *Globals, sm core.StateStore, projectName string, opts core.GrabOptions) (bool, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return false, err
+	}
+	if state.Settings.StaleGrabAction != core.StaleGrabConfirm {
+		return true, nil
 	}
+	opts.DryRun = true
+	plan, err := core.Grab(ctx, sm, projectName, opts)
+	if err != nil {
+		return false, err
+	}
+	if !plan.Stale {
+		return true, nil
+	}
+	if !g.JSON() {
+		printStaleNotice(g, plan)
+	}
+	if g.Yes {
+		return true, nil
+	}
+	if g.JSON() || !isInteractive() {
+		return false, fmt.Errorf("'%s' was last updated %s, more than %d days ago; use --yes to grab it anyway",
+			plan.Project, core.FormatAge(plan.LastUpdated), plan.StaleDays)
+	}
+	if !confirm(g, "Grab it anyway?") {
+		g.unchanged = true
+		fmt.Println("Cancelled.")
+		return false, nil
+	}
+	return true, nil
+}
 
-	fmt.Printf("Successfully grabbed '%s' to %s\n", projectName, localPath)
-	return nil
+// printStaleNotice points out that a grabbed project's archive copy hasn't
+// been updated in over stale_grab_days
+func printStaleNotice(g *Globals, result *core.GrabResult) {
+	fmt.Printf("%sStale project: '%s' was last updated %s (%s), more than %d days ago.\n",
+		g.mark("⚠"), result.Project, formatTimestamp(result.LastUpdated), core.FormatAge(result.LastUpdated), result.StaleDays)
 }
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func historyCommand(g *Globals) *Command {
+	cmd := newCommand(g, "history", "<project>", "Show when a project was grabbed, parked, changed and removed, and where")
+	cmd.Examples = []string{
+		"parkr history ml-pipeline",
+		"parkr history ml-pipeline --limit 5",
+	}
+	limit := cmd.Flags.Int("limit", 0, "Show only the latest `n` events")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, 1); err != nil {
+			return err
+		}
+		if *limit < 0 {
+			return usageErrorf("--limit can't be negative")
+		}
+		return HistoryCmd(ctx, g, args[0], *limit)
+	}
+	return cmd
+}
+
+// HistoryCmd prints the recorded grabs, parks and removals of a project,
+// newest first
+func HistoryCmd(ctx context.Context, g *Globals, projectName string, limit int) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	events, err := core.LoadProjectHistory(sm.StatePath(), projectName)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	if g.JSON() {
+		if events == nil {
+			events = []core.ProjectEvent{}
+		}
+		return printJSON(events)
+	}
+	if len(events) == 0 {
+		fmt.Printf("No history recorded for '%s'.\n", projectName)
+		return nil
+	}
+	fmt.Printf("%-19s  %-6s %-20s %-10s %s\n", "TIME", "OP", "HOST", "SIZE", "LOCAL PATH")
+	for _, e := range events {
+		size := "-"
+		if e.Size != nil {
+			size = core.FormatSize(*e.Size)
+		}
+		fmt.Printf("%-19s  %-6s %-20s %-10s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Op, e.Host, size, e.LocalPath)
+	}
+	return nil
+}
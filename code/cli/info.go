@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func infoCommand(g *Globals) *Command {
+	cmd := newCommand(g, "info", "<project>", "Show detailed information about a project")
+	cmd.Examples = []string{
+		"parkr info ml-pipeline",
+		"parkr info --transfers 20 ml-pipeline",
+	}
+	transfers := cmd.Flags.Int("transfers", 5, "Show the latest `n` grabs and parks from the audit log (0 to hide them)")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, 1); err != nil {
+			return err
+		}
+		if *transfers < 0 {
+			return usageErrorf("--transfers can't be negative")
+		}
+		return InfoCmd(ctx, g, args[0], *transfers)
+	}
+	return cmd
+}
+
+// InfoCmd prints archive and local details for a project, and up to
+// transfers of its latest grabs and parks recorded in the audit log
+func InfoCmd(ctx context.Context, g *Globals, projectName string, transfers int) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	info, err := core.Info(ctx, sm, projectName)
+	if err != nil {
+		return err
+	}
+	if transfers > 0 {
+		// The project's details are still worth showing without them
+		info.Transfers, err = core.RecentTransfers(core.AuditLogPath(), sm.StatePath(), info.Name, transfers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	if g.JSON() {
+		return printJSON(info)
+	}
+
+	fmt.Printf("Project: %s\n", info.Name)
+	if info.Description != "" {
+		fmt.Printf("Description: %s\n", info.Description)
+	}
+	fmt.Printf("Category: %s (master %s)\n", info.Category, info.Master)
+	fmt.Printf("Archive: %s (%s)\n", info.ArchivePath, formatSizeOrUnknown(info.ArchiveSize))
+	if info.Grabbed {
+		fmt.Printf("Local: %s (%s)\n", info.LocalPath, formatSizeOrUnknown(info.LocalSize))
+	} else {
+		fmt.Println("Local: not grabbed")
+	}
+	fmt.Printf("Checked out: %s\n", formatTimestamp(info.GrabbedAt))
+	fmt.Printf("Last checkin: %s\n", formatTimestamp(info.LastParkAt))
+	fmt.Printf("Status: %s\n", stateLabel(info.State))
+	if info.Grabbed {
+		fmt.Printf("Last modified: %s\n", formatTimestamp(info.LastModified))
+		fmt.Printf("Verification: %s\n", info.Verification)
+		if info.HashMode != nil {
+			fmt.Printf("Content hash: %s\n", info.HashMode)
+		}
+	}
+	fmt.Printf("Archive exists: %s\n", yesNo(info.ArchiveExists))
+	if info.Encrypted {
+		fmt.Println("Encrypted: Yes")
+	}
+	if info.Grabbed {
+		fmt.Printf("Local exists: %s\n", yesNo(info.LocalExists))
+	}
+	if len(info.Versions) > 0 {
+		fmt.Printf("Kept versions: %d\n", len(info.Versions))
+		for _, v := range info.Versions {
+			fmt.Printf("  %s  parked %s  %s\n", formatTimestamp(&v.KeptAt), formatTimestamp(v.ParkedAt), v.Path)
+		}
+	}
+	if transfers > 0 {
+		printTransferHistory(g, info.Transfers)
+	}
+	return nil
+}
+
+// printTransferHistory prints a project's latest grabs and parks from the
+// audit log, newest first
+func printTransferHistory(g *Globals, records []core.AuditRecord) {
+	if len(records) == 0 {
+		fmt.Println("Recent transfers: none recorded")
+		return
+	}
+	fmt.Println("Recent transfers:")
+	for _, r := range records {
+		size, took := "-", "-"
+		if r.Bytes > 0 {
+			size = core.FormatSize(r.Bytes)
+		}
+		if r.DurationMS > 0 {
+			took = formatDuration(r.Duration())
+		}
+		when := formatTimestamp(&r.Time)
+		if g.Plain() {
+			printFields("time", when, "command", r.Command, "result", r.Result, "size", size, "duration", took, "error", r.Error)
+			continue
+		}
+		fmt.Printf("  %s  %-5s %-6s %-10s %s\n", when, r.Command, r.Result, size, took)
+		if r.Error != "" {
+			fmt.Printf("    %s\n", r.Error)
+		}
+	}
+}
+
+// formatTimestamp formats an optional time for display
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// formatDuration formats how long a command ran, to the second
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return "<1s"
+	}
+	return d.Round(time.Second).String()
+}
+
+// yesNo formats a boolean as Yes or No
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
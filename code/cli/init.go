@@ -1,23 +1,144 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"sort"
 
 	"github.com/jamespark/parkr/core"
 )
 
+func initCommand(g *Globals) *Command {
+	cmd := newCommand(g, "init", "", "Initialize parkr state file")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr init",
+		"parkr init --defaults --scaffold --archive /Volumes/Extra/project-archive",
+		"parkr init --clone-host james@old-laptop --with-projects",
+	}
+	archive := cmd.Flags.String("archive", "", "Archive root `dir` holding the category directories (default "+core.DefaultArchiveRoot+")")
+	scaffold := cmd.Flags.Bool("scaffold", false, "Create the category directories and check they are writable")
+	defaults := cmd.Flags.Bool("defaults", false, "Don't prompt; use defaults for anything not given on the command line")
+	from := cmd.Flags.String("from", "", "Copy configuration from a `file` written by 'parkr export'")
+	cloneHost := cmd.Flags.String("clone-host", "", "Copy configuration from `user@host` over ssh")
+	withProjects := cmd.Flags.Bool("with-projects", false, "Also copy project metadata with --from or --clone-host")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		if *from != "" && *cloneHost != "" {
+			return usageErrorf("give either --from or --clone-host, not both")
+		}
+		if (*from != "" || *cloneHost != "") && *archive != "" {
+			return usageErrorf("--archive can't be combined with --from or --clone-host")
+		}
+		return InitCmd(ctx, g, InitOptions{
+			ArchiveRoot:  *archive,
+			Scaffold:     *scaffold,
+			Defaults:     *defaults,
+			From:         *from,
+			CloneHost:    *cloneHost,
+			WithProjects: *withProjects,
+		})
+	}
+	return cmd
+}
+
+// InitOptions holds the flags accepted by init
+type InitOptions struct {
+	ArchiveRoot string
+	Scaffold    bool
+	// Defaults disables prompting, for provisioning scripts
+	Defaults bool
+	// From and CloneHost copy configuration from an export file or from
+	// another machine over ssh
+	From         string
+	CloneHost    string
+	WithProjects bool
+}
+
 // InitCmd initializes parkr state file
-func InitCmd() error {
-	sm := core.NewStateManager()
+func InitCmd(ctx context.Context, g *Globals, opts InitOptions) error {
+	sm := g.StateManager()
 
 	if sm.Exists() {
 		return fmt.Errorf("state file already exists at %s", sm.StatePath())
 	}
 
-	if err := sm.CreateDefault(); err != nil {
-		return fmt.Errorf("failed to create state file: %w", err)
+	var export *core.ConfigExport
+	switch {
+	case opts.From != "":
+		data, err := os.ReadFile(opts.From)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", opts.From, err)
+		}
+		if export, err = core.ParseConfigExport(data); err != nil {
+			return err
+		}
+	case opts.CloneHost != "":
+		var err error
+		g.logf("Fetching configuration from %s", opts.CloneHost)
+		if export, err = core.FetchConfigExport(ctx, opts.CloneHost, opts.WithProjects); err != nil {
+			return err
+		}
+	}
+	if export != nil && !opts.WithProjects {
+		export.Projects = nil
+	}
+
+	if !opts.Defaults && !g.Yes && !g.JSON() && isInteractive() {
+		if opts.ArchiveRoot == "" && export == nil {
+			opts.ArchiveRoot = ask("Archive root", core.DefaultArchiveRoot)
+		}
+		if !opts.Scaffold && !g.DryRun {
+			opts.Scaffold = confirm(g, "Create the category directories now?")
+		}
+	}
+
+	result, err := core.Init(sm, core.InitOptions{
+		ArchiveRoot: opts.ArchiveRoot,
+		Scaffold:    opts.Scaffold,
+		From:        export,
+		DryRun:      g.DryRun,
+	})
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("Initialized parkr state file at %s\n", sm.StatePath())
+	if g.JSON() {
+		return printJSON(result)
+	}
+	if result.DryRun {
+		fmt.Printf("Would initialize parkr state file at %s\n", result.StatePath)
+	} else {
+		for _, dir := range result.Created {
+			fmt.Printf("Created %s\n", dir)
+		}
+		fmt.Printf("Initialized parkr state file at %s\n", result.StatePath)
+	}
+
+	if result.Projects > 0 {
+		fmt.Printf("Imported %d project(s)\n", result.Projects)
+	}
+	printCategoryPaths("Archive categories:", result.Categories)
+	if len(result.LocalRoots) > 0 {
+		printCategoryPaths("Local directories:", result.LocalRoots)
+	}
 	return nil
 }
+
+// printCategoryPaths prints a category-to-directory mapping sorted by category
+func printCategoryPaths(title string, paths map[string]string) {
+	categories := make([]string, 0, len(paths))
+	for c := range paths {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+
+	fmt.Println(title)
+	for _, c := range categories {
+		fmt.Printf("  %-12s %s\n", c, paths[c])
+	}
+}
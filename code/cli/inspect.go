@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func inspectCommand(g *Globals) *Command {
+	cmd := newCommand(g, "inspect", "<project>", "Show an archived project's contents without grabbing it")
+	cmd.Examples = []string{
+		"parkr inspect ml-pipeline",
+		"parkr --format json inspect ml-pipeline",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, 1); err != nil {
+			return err
+		}
+		return InspectCmd(ctx, g, args[0])
+	}
+	return cmd
+}
+
+// InspectCmd prints the top-level contents, size and manifest of an
+// archived project
+func InspectCmd(ctx context.Context, g *Globals, projectName string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	insp, err := core.Inspect(ctx, sm, sm.StatePath(), projectName)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(insp)
+	}
+
+	fmt.Printf("Project: %s\n", insp.Name)
+	if insp.Description != "" {
+		fmt.Printf("Description: %s\n", insp.Description)
+	}
+	fmt.Printf("Category: %s (master %s)\n", insp.Category, insp.Master)
+	fmt.Printf("Archive: %s\n", insp.ArchivePath)
+	fmt.Printf("Size: %s in %d file(s)\n", core.FormatSize(insp.Size), insp.Files)
+	fmt.Printf("Last modified: %s\n", formatTimestamp(insp.Newest))
+	fmt.Printf("Manifest hash: %s\n", insp.ManifestHash)
+	if insp.ContentHash != "" {
+		fmt.Printf("Content hash: %s\n", insp.ContentHash)
+	}
+
+	if len(insp.Entries) == 0 {
+		fmt.Println("\nThe project is empty.")
+		return nil
+	}
+	fmt.Println()
+	if !g.Plain() {
+		fmt.Printf("%-40s %-12s %s\n", "NAME", "SIZE", "FILES")
+		fmt.Println(strings.Repeat("-", 62))
+	}
+	for _, e := range insp.Entries {
+		name := e.Name
+		if e.IsDir {
+			name += "/"
+		}
+		if g.Plain() {
+			printFields("name", name, "size", core.FormatSize(e.Size), "files", strconv.Itoa(e.Files))
+			continue
+		}
+		fmt.Printf("%-40s %-12s %d\n", name, core.FormatSize(e.Size), e.Files)
+	}
+	return nil
+}
@@ -1,67 +1,189 @@
 package cli
 
 import (
+	"context"
 	"fmt"
-	"sort"
+	"os"
+	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/jamespark/parkr/core"
 )
 
+func listCommand(g *Globals) *Command {
+	cmd := newCommand(g, "list", "[category]", "List all projects in archive", "ls")
+	cmd.Examples = []string{
+		"parkr list",
+		"parkr list pycharm",
+		"parkr list --long",
+		"parkr list --refresh-sizes",
+		"parkr list --master backup",
+	}
+	long := cmd.Flags.Bool("long", false, "Show each project's description")
+	hidden := cmd.Flags.Bool("include-hidden", false, "Also list projects whose names start with '.'")
+	master := cmd.Flags.String("master", "", "List only the projects in this `master`")
+	refresh := cmd.Flags.Bool("refresh-sizes", false, "Measure slow masters' projects now instead of showing their last known sizes")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 1); err != nil {
+			return err
+		}
+		category := ""
+		if len(args) > 0 {
+			category = args[0]
+		}
+		return ListCmd(ctx, g, category, ListOptions{Long: *long, IncludeHidden: *hidden, RefreshSizes: *refresh, Master: *master})
+	}
+	return cmd
+}
+
+// ListOptions holds the flags accepted by list
+type ListOptions struct {
+	Long          bool
+	IncludeHidden bool
+	RefreshSizes  bool
+	Master        string
+}
+
 // ListCmd lists all projects in archive
-func ListCmd(category string) error {
-	sm := core.NewStateManager()
-	state, err := sm.Load()
+func ListCmd(ctx context.Context, g *Globals, category string, opts ListOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	entries, err := core.List(ctx, sm, category, core.ListOptions{
+		IncludeHidden: opts.IncludeHidden,
+		StatePath:     sm.StatePath(),
+		RefreshSizes:  opts.RefreshSizes,
+		Master:        opts.Master,
+	})
 	if err != nil {
 		return err
 	}
+	refreshing := false
+	for _, e := range entries {
+		if e.SizeStale {
+			refreshing = startSizeRefresh(g, sm.StatePath())
+			break
+		}
+	}
 
-	// Discover projects in archive
-	archiveProjects, err := core.DiscoverArchiveProjects(state)
-	if err != nil {
-		return fmt.Errorf("failed to scan archive: %w", err)
+	if category == "" && opts.Master == "" {
+		var total int64
+		for _, e := range entries {
+			total += max(e.Size, 0)
+		}
+		recordSizeSample(g, sm.StatePath(), "list", nil, &total)
 	}
 
-	if len(archiveProjects) == 0 {
+	if g.JSON() {
+		if entries == nil {
+			entries = []core.ListEntry{}
+		}
+		return printJSON(entries)
+	}
+
+	if len(entries) == 0 {
 		fmt.Println("No projects found in archive.")
 		return nil
 	}
+	if g.Plain() {
+		printListFields(entries, opts.Long)
+	} else {
+		printListTable(entries, opts.Long)
+	}
 
-	// Filter by category if specified
-	var projects []core.ArchiveProject
-	for _, p := range archiveProjects {
-		if category == "" || p.Category == category {
-			projects = append(projects, p)
-		}
+	if refreshing {
+		fmt.Println("\nRefreshing sizes on slow masters in the background; run 'parkr list --refresh-sizes' to wait for them.")
 	}
+	return nil
+}
 
-	// Sort by name
-	sort.Slice(projects, func(i, j int) bool {
-		return projects[i].Name < projects[j].Name
-	})
+// printListTable prints list entries as a table, with their descriptions
+// if long is set
+func printListTable(entries []core.ListEntry, long bool) {
+	// Last known sizes carry their date, so widen the column to fit
+	sizes := make([]string, len(entries))
+	sizeWidth := 12
+	for i, e := range entries {
+		sizes[i] = formatListSize(e)
+		sizeWidth = max(sizeWidth, len(sizes[i]))
+	}
+	extra := sizeWidth - 12
 
 	// Print header
-	fmt.Printf("%-30s %-12s %-12s %s\n", "PROJECT", "CATEGORY", "SIZE", "STATUS")
-	fmt.Println(strings.Repeat("-", 70))
+	if long {
+		fmt.Printf("%-30s %-12s %-*s %-30s %s\n", "PROJECT", "CATEGORY", sizeWidth, "SIZE", "STATUS", "DESCRIPTION")
+		fmt.Println(strings.Repeat("-", 120+extra))
+	} else {
+		fmt.Printf("%-30s %-12s %-*s %s\n", "PROJECT", "CATEGORY", sizeWidth, "SIZE", "STATUS")
+		fmt.Println(strings.Repeat("-", 90+extra))
+	}
 
 	// Print each project
-	for _, ap := range projects {
-		status := "archived"
-
-		// Check if grabbed in state
-		if stateProject, exists := state.Projects[ap.Name]; exists && stateProject.IsGrabbed {
-			status = "grabbed"
+	for i, e := range entries {
+		status := stateLabel(e.State)
+		if len(e.AlsoIn) > 0 {
+			status += " (also in " + strings.Join(e.AlsoIn, ", ") + ")"
+		}
+		if long {
+			fmt.Printf("%-30s %-12s %-*s %-30s %s\n", e.Name, e.Category, sizeWidth, sizes[i], status, e.Description)
+		} else {
+			fmt.Printf("%-30s %-12s %-*s %s\n", e.Name, e.Category, sizeWidth, sizes[i], status)
 		}
+	}
+}
 
-		// Get size
-		size, err := core.GetDirSize(ap.Path)
-		sizeStr := "?"
-		if err == nil {
-			sizeStr = core.FormatSize(size)
+// printListFields prints list entries as plain output, one line each
+func printListFields(entries []core.ListEntry, long bool) {
+	for _, e := range entries {
+		description := ""
+		if long {
+			description = e.Description
 		}
+		printFields("project", e.Name, "category", e.Category, "size", formatListSize(e),
+			"status", unmarked(stateLabel(e.State)), "also in", strings.Join(e.AlsoIn, ", "), "description", description)
+	}
+}
 
-		fmt.Printf("%-30s %-12s %-12s %s\n", ap.Name, ap.Category, sizeStr, status)
+// formatListSize formats a list entry's size, marking a slow master's last
+// known size with when it was measured
+func formatListSize(e core.ListEntry) string {
+	switch {
+	case e.SizeAsOf != nil:
+		return fmt.Sprintf("%s (as of %s)", core.FormatSize(e.Size), formatAsOf(*e.SizeAsOf))
+	case e.SizeStale:
+		return "pending"
 	}
+	return formatSizeOrUnknown(e.Size)
+}
 
-	return nil
+// formatAsOf formats when a size was measured as briefly as is unambiguous
+func formatAsOf(t time.Time) string {
+	t, now := t.Local(), time.Now()
+	switch {
+	case t.Year() == now.Year() && t.YearDay() == now.YearDay():
+		return t.Format("15:04")
+	case t.Year() == now.Year():
+		return t.Format("Jan 2")
+	}
+	return t.Format("Jan 2 2006")
+}
+
+// startSizeRefresh runs refresh-sizes against the state file as a detached
+// process, so list returns at once and the next one shows fresher sizes.
+// It reports whether the refresh was started.
+func startSizeRefresh(g *Globals, statePath string) bool {
+	exe, err := os.Executable()
+	if err != nil {
+		g.logf("Not refreshing sizes: %v", err)
+		return false
+	}
+	cmd := exec.Command(exe, "--state", statePath, "refresh-sizes")
+	if err := cmd.Start(); err != nil {
+		g.logf("Not refreshing sizes: %v", err)
+		return false
+	}
+	g.logf("Refreshing sizes in the background (pid %d)", cmd.Process.Pid)
+	cmd.Process.Release()
+	return true
 }
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func localCommand(g *Globals) *Command {
+	cmd := newCommand(g, "local", "[add-dir <path> | remove-dir <path> | adopt <project> <path>]", "List local project directories or manage extra directories to scan")
+	cmd.Examples = []string{
+		"parkr local",
+		"parkr --format json local --refresh",
+		"parkr local add-dir ~/experiments",
+		"parkr local remove-dir ~/experiments",
+		"parkr local adopt ml-pipeline ~/PycharmProjects/ml-pipeline",
+	}
+	refresh := cmd.Flags.Bool("refresh", false, "Recompute every size instead of using the size cache")
+	hidden := cmd.Flags.Bool("include-hidden", false, "Also list directories whose names start with '.'")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return LocalCmd(ctx, g, LocalOptions{Refresh: *refresh, IncludeHidden: *hidden})
+		}
+
+		sm := g.StateManager()
+		switch args[0] {
+		case "add-dir":
+			if err := requireArgs(cmd, args, 2, 2); err != nil {
+				return err
+			}
+			dir, err := core.AddLocalDirectory(sm, args[1])
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			fmt.Printf("Added local directory %s\n", dir)
+		case "remove-dir":
+			if err := requireArgs(cmd, args, 2, 2); err != nil {
+				return err
+			}
+			dir, err := core.RemoveLocalDirectory(sm, args[1])
+			if err != nil {
+				return usageErrorf("%v", err)
+			}
+			fmt.Printf("Removed local directory %s\n", dir)
+		case "adopt":
+			if err := requireArgs(cmd, args, 3, 3); err != nil {
+				return err
+			}
+			if g.DryRun {
+				fmt.Printf("[DRY RUN] Would track %s as the local copy of '%s'\n", args[2], args[1])
+				return nil
+			}
+			path, err := core.AdoptLocalCopy(sm, args[1], args[2])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Now tracking %s as the local copy of '%s'\n", path, args[1])
+		default:
+			return usageErrorf("unknown local action '%s'", args[0])
+		}
+		return nil
+	}
+	return cmd
+}
+
+// LocalOptions holds the flags accepted by local
+type LocalOptions struct {
+	Refresh       bool
+	IncludeHidden bool
+}
+
+// LocalCmd lists the project directories found locally, their sizes and
+// whether parkr tracks them
+func LocalCmd(ctx context.Context, g *Globals, opts LocalOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	projects, err := core.ScanLocal(ctx, sm, sm.StatePath(), core.LocalScanOptions{Refresh: opts.Refresh, IncludeHidden: opts.IncludeHidden})
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(projects)
+	}
+
+	if len(projects) == 0 {
+		fmt.Println("No local project directories found.")
+		return nil
+	}
+	var total int64
+	if !g.Plain() {
+		fmt.Printf("%-30s %-10s %-12s %s\n", "PROJECT", "STATUS", "SIZE", "PATH")
+		fmt.Println(strings.Repeat("-", 90))
+	}
+	for _, p := range projects {
+		if g.Plain() {
+			printFields("project", p.Name, "status", p.Status, "size", formatSizeOrUnknown(p.Size), "path", p.Path)
+		} else {
+			fmt.Printf("%-30s %-10s %-12s %s\n", p.Name, p.Status, formatSizeOrUnknown(p.Size), p.Path)
+		}
+		total += max(p.Size, 0)
+	}
+	fmt.Printf("\nTotal: %s in %d project(s)\n", core.FormatSize(total), len(projects))
+	printLocalDuplicates(g, projects)
+	return nil
+}
+
+// printLocalDuplicates warns about projects found in several local
+// directories, naming the tracked copy and how to adopt another
+func printLocalDuplicates(g *Globals, projects []core.LocalProject) {
+	var names []string
+	copies := make(map[string][]core.LocalProject)
+	for _, p := range projects {
+		if !p.Duplicate {
+			continue
+		}
+		if _, ok := copies[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+		copies[p.Name] = append(copies[p.Name], p)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	fmt.Println("\n" + g.mark("⚠") + "Projects with more than one local copy (parkr tracks only one):")
+	for _, name := range names {
+		tracked := ""
+		for _, p := range copies[name] {
+			if p.Status == core.LocalGrabbed {
+				tracked = p.Path
+			}
+		}
+		fmt.Printf("  %s:\n", name)
+		for _, p := range copies[name] {
+			switch {
+			case p.Path == tracked:
+				fmt.Printf("    %s (tracked)\n", p.Path)
+			case tracked != "":
+				fmt.Printf("    %s (not tracked; park ignores it, or adopt it with 'parkr local adopt %s %s')\n", p.Path, name, p.Path)
+			default:
+				fmt.Printf("    %s\n", p.Path)
+			}
+		}
+	}
+}
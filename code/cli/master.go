@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func masterCommand(g *Globals) *Command {
+	cmd := newCommand(g, "master", "[add <name> <root> | rm <master> | default <master> | read-only <master> on|off | slow <master> on|off | host <master> [host] | storage <master> tree|tar.zst | encrypt <master> <recipient> [identity-file] | encrypt <master> off | exclude <master> [name...]]", "Show, add or remove masters, choose the default, mark one read-only or slow, or set its SSH host, storage mode, encryption or ignored directories")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr master",
+		"parkr master add backup /Volumes/Backup/project-archive",
+		"parkr master add nas james@nas:/volume1/archive --categories code,data --scaffold",
+		"parkr master default backup",
+		"parkr master rm backup",
+		"parkr master read-only reference on",
+		"parkr master slow usb-backup on",
+		"parkr master host primary james@nas",
+		"parkr master host primary",
+		"parkr master storage cold tar.zst",
+		"parkr master encrypt cold age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p ~/.parkr/age.key",
+		"parkr master encrypt cold off",
+		"parkr master exclude primary lost+found @eaDir '#recycle'",
+		"parkr master exclude primary",
+	}
+	categories := cmd.Flags.String("categories", "", "With add, comma-separated `names` of the categories to create under the root (default "+strings.Join(core.DefaultCategories, ",")+")")
+	scaffold := cmd.Flags.Bool("scaffold", false, "With add, create the category directories")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return MasterListCmd(ctx, g)
+		}
+		if args[0] != "add" && (*categories != "" || *scaffold) {
+			return usageErrorf("--categories and --scaffold can only be used with master add")
+		}
+		switch args[0] {
+		case "add":
+			if err := requireArgs(cmd, args, 3, 3); err != nil {
+				return err
+			}
+			opts := core.AddMasterOptions{Scaffold: *scaffold, DryRun: g.DryRun}
+			if *categories != "" {
+				opts.Categories = strings.Split(*categories, ",")
+			}
+			return MasterAddCmd(ctx, g, args[1], args[2], opts)
+		case "rm", "default":
+			if err := requireArgs(cmd, args, 2, 2); err != nil {
+				return err
+			}
+			if args[0] == "rm" {
+				return MasterRemoveCmd(ctx, g, args[1])
+			}
+			return MasterDefaultCmd(ctx, g, args[1])
+		case "read-only", "slow":
+		case "host":
+			if err := requireArgs(cmd, args, 2, 3); err != nil {
+				return err
+			}
+			host := ""
+			if len(args) == 3 {
+				host = args[2]
+			}
+			return MasterHostCmd(ctx, g, args[1], host)
+		case "storage":
+			if err := requireArgs(cmd, args, 3, 3); err != nil {
+				return err
+			}
+			return MasterStorageCmd(ctx, g, args[1], args[2])
+		case "encrypt":
+			if err := requireArgs(cmd, args, 3, 4); err != nil {
+				return err
+			}
+			recipient, identity := args[2], ""
+			if len(args) == 4 {
+				identity = args[3]
+			}
+			if recipient == "off" {
+				if identity != "" {
+					return usageErrorf("unexpected argument '%s'", identity)
+				}
+				recipient = ""
+			}
+			return MasterEncryptCmd(ctx, g, args[1], recipient, identity)
+		case "exclude":
+			if err := requireArgs(cmd, args, 2, -1); err != nil {
+				return err
+			}
+			return MasterExcludeCmd(ctx, g, args[1], args[2:])
+		default:
+			return usageErrorf("unknown master action '%s'", args[0])
+		}
+		if err := requireArgs(cmd, args, 3, 3); err != nil {
+			return err
+		}
+		var on bool
+		switch args[2] {
+		case "on":
+			on = true
+		case "off":
+		default:
+			return usageErrorf("expected on or off, got '%s'", args[2])
+		}
+		if args[0] == "slow" {
+			return MasterSlowCmd(ctx, g, args[1], on)
+		}
+		return MasterReadOnlyCmd(ctx, g, args[1], on)
+	}
+	return cmd
+}
+
+// MasterListCmd prints the configured masters and their category paths
+func MasterListCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	masters, err := core.ListMasters(sm)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(masters)
+	}
+
+	for _, m := range masters {
+		var flags []string
+		if m.Default {
+			flags = append(flags, "default")
+		}
+		if m.ReadOnly {
+			flags = append(flags, "read-only")
+		}
+		if m.Host != "" {
+			flags = append(flags, "on "+m.Host)
+		} else if m.Slow {
+			flags = append(flags, "slow")
+		}
+		if m.Storage != core.StorageTree {
+			flags = append(flags, "stores "+m.Storage)
+		}
+		if m.Encrypted {
+			flags = append(flags, "encrypted")
+		}
+		if len(m.Exclude) > 0 {
+			flags = append(flags, "ignores "+strings.Join(m.Exclude, " "))
+		}
+		title := m.Name
+		if len(flags) > 0 {
+			title = fmt.Sprintf("%s (%s)", m.Name, strings.Join(flags, ", "))
+		}
+		printCategoryPaths(title, m.Categories)
+	}
+	return nil
+}
+
+// MasterAddCmd registers a new master under an archive root
+func MasterAddCmd(ctx context.Context, g *Globals, name, root string, opts core.AddMasterOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+	if !core.IsRemote(root) {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		root = abs
+	}
+
+	categories, err := core.AddMaster(ctx, sm, name, root, opts)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(core.MasterInfo{Name: name, Categories: categories, Storage: core.StorageTree})
+	}
+	if opts.DryRun {
+		printCategoryPaths(fmt.Sprintf("Would add master '%s':", name), categories)
+		return nil
+	}
+	printCategoryPaths(fmt.Sprintf("Added master '%s':", name), categories)
+	fmt.Printf("Use 'parkr add --master %s' or 'parkr master default %s' to archive projects in it.\n", name, name)
+	return nil
+}
+
+// MasterRemoveCmd unregisters a master, leaving its files in place
+func MasterRemoveCmd(ctx context.Context, g *Globals, name string) error {
+	sm := g.StateManager()
+	if err := core.RemoveMaster(sm, name); err != nil {
+		return err
+	}
+	fmt.Printf("Removed master '%s'; its archive directories were left in place\n", name)
+	return nil
+}
+
+// MasterDefaultCmd makes a master the default
+func MasterDefaultCmd(ctx context.Context, g *Globals, name string) error {
+	sm := g.StateManager()
+	if err := core.SetDefaultMaster(sm, name); err != nil {
+		return err
+	}
+	fmt.Printf("Master '%s' is now the default\n", name)
+	return nil
+}
+
+// MasterHostCmd sets or clears the SSH host of a master
+func MasterHostCmd(ctx context.Context, g *Globals, master, host string) error {
+	sm := g.StateManager()
+	if err := core.SetMasterHost(sm, master, host); err != nil {
+		return err
+	}
+	if host == "" {
+		fmt.Printf("Master '%s' now uses local paths\n", master)
+	} else {
+		fmt.Printf("Master '%s' is now reached over SSH on %s\n", master, host)
+	}
+	return nil
+}
+
+// MasterStorageCmd sets how a master stores parked projects
+func MasterStorageCmd(ctx context.Context, g *Globals, master, mode string) error {
+	sm := g.StateManager()
+	if err := core.SetMasterStorage(sm, master, mode); err != nil {
+		return err
+	}
+	fmt.Printf("Master '%s' now stores projects as %s; existing projects are converted when next parked\n", master, mode)
+	return nil
+}
+
+// MasterEncryptCmd turns encryption of parked projects on or off for a
+// master
+func MasterEncryptCmd(ctx context.Context, g *Globals, master, recipient, identity string) error {
+	sm := g.StateManager()
+	if identity != "" {
+		abs, err := filepath.Abs(identity)
+		if err != nil {
+			return err
+		}
+		identity = abs
+	}
+	// A recipients file is read on every park, from whatever directory
+	if _, err := os.Stat(recipient); recipient != "" && err == nil {
+		abs, err := filepath.Abs(recipient)
+		if err != nil {
+			return err
+		}
+		recipient = abs
+	}
+	if err := core.SetMasterEncryption(sm, master, recipient, identity); err != nil {
+		return err
+	}
+	switch {
+	case recipient == "":
+		fmt.Printf("Master '%s' no longer encrypts parked projects; existing ones are decrypted when next parked\n", master)
+	case identity == "":
+		fmt.Printf("Master '%s' now encrypts parked projects; with no identity set, this machine can park but not grab them\n", master)
+	default:
+		fmt.Printf("Master '%s' now encrypts parked projects; existing ones are encrypted when next parked\n", master)
+	}
+	return nil
+}
+
+// MasterExcludeCmd sets the directory names discovery ignores in a
+// master's categories
+func MasterExcludeCmd(ctx context.Context, g *Globals, master string, patterns []string) error {
+	sm := g.StateManager()
+	if err := core.SetMasterExclude(sm, master, patterns); err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		fmt.Printf("Master '%s' no longer ignores any directories\n", master)
+	} else {
+		fmt.Printf("Master '%s' now ignores %s\n", master, strings.Join(patterns, ", "))
+	}
+	return nil
+}
+
+// MasterReadOnlyCmd marks a master read-only or writable
+func MasterReadOnlyCmd(ctx context.Context, g *Globals, master string, readOnly bool) error {
+	sm := g.StateManager()
+	if err := core.SetMasterReadOnly(sm, master, readOnly); err != nil {
+		return err
+	}
+	if readOnly {
+		fmt.Printf("Master '%s' is now read-only\n", master)
+	} else {
+		fmt.Printf("Master '%s' is now writable\n", master)
+	}
+	return nil
+}
+
+// MasterSlowCmd marks a master slow or not
+func MasterSlowCmd(ctx context.Context, g *Globals, master string, slow bool) error {
+	sm := g.StateManager()
+	if err := core.SetMasterSlow(sm, master, slow); err != nil {
+		return err
+	}
+	if slow {
+		fmt.Printf("Master '%s' is now slow; list shows its last measured sizes and refreshes them in the background\n", master)
+	} else {
+		fmt.Printf("Master '%s' is no longer slow\n", master)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// exportMetrics sends a command run, begun at started, to the configured
+// metrics_endpoint, warning rather than failing the command if it can't.
+// Dry runs, usage errors and runs without a readable state file aren't
+// measured.
+func exportMetrics(g *Globals, cmd *Command, started time.Time, runErr error) {
+	var usage *usageError
+	if g.DryRun || errors.As(runErr, &usage) {
+		return
+	}
+	state, err := g.StateManager().Load()
+	if err != nil || state.Settings.MetricsEndpoint == "" {
+		return
+	}
+	projects, bytes := g.eventTotals()
+	m := core.CommandMetrics{
+		Command:  cmd.Name,
+		Duration: time.Since(started),
+		Projects: len(projects),
+		Bytes:    bytes,
+		Failed:   runErr != nil,
+	}
+	g.logf("Sending %s metrics to %s", cmd.Name, state.Settings.MetricsEndpoint)
+	if err := state.Settings.ExportMetrics(context.Background(), m); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to send metrics to %s: %v\n", state.Settings.MetricsEndpoint, err)
+	}
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func migrateStateCommand(g *Globals) *Command {
+	cmd := newCommand(g, "migrate-state", "[dest]", "Move the JSON state file and project history into a SQLite database")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr migrate-state --dry-run",
+		"parkr migrate-state",
+		"parkr --state ~/work/state.json migrate-state ~/work/state.db",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 1); err != nil {
+			return err
+		}
+		dest := ""
+		if len(args) == 1 {
+			dest = args[0]
+		}
+		return MigrateStateCmd(ctx, g, dest)
+	}
+	return cmd
+}
+
+// MigrateStateCmd copies the JSON state file into a SQLite database
+func MigrateStateCmd(ctx context.Context, g *Globals, dest string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	result, err := core.MigrateState(sm, dest, g.DryRun)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(result)
+	}
+
+	verb := "Migrated"
+	if result.DryRun {
+		verb = "Would migrate"
+	}
+	fmt.Printf("%s %d project(s) and %d history event(s) from %s to %s\n", verb, result.Projects, result.Events, result.Source, result.Dest)
+	switch {
+	case result.Retired != "" && result.DryRun:
+		fmt.Printf("Would rename %s to %s; parkr then uses the database by default\n", result.Source, result.Retired)
+	case result.Retired != "":
+		fmt.Printf("Renamed %s to %s; parkr now uses the database by default\n", result.Source, result.Retired)
+	case !result.DryRun:
+		fmt.Printf("Pass --state %s to use the database\n", result.Dest)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func mvCommand(g *Globals) *Command {
+	cmd := newCommand(g, "mv", "<project>", "Move a project's archive copy to another category or master", "move")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr mv analysis --category rstudio",
+		"parkr mv ml-pipeline --master backup",
+		"parkr mv old-notebook --category pycharm --master nas",
+	}
+	category := cmd.Flags.String("category", "", "Move the project to this `category` (default: the one it is in)")
+	master := cmd.Flags.String("master", "", "Move the project to this `master` (default: the one it is in)")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, 1); err != nil {
+			return err
+		}
+		if *category == "" && *master == "" {
+			return usageErrorf("mv needs --category, --master or both")
+		}
+		return MoveCmd(ctx, g, args[0], core.MoveOptions{Category: *category, Master: *master, DryRun: g.DryRun})
+	}
+	return cmd
+}
+
+// MoveCmd moves a project's archive copy to another category or master
+// after confirmation
+func MoveCmd(ctx context.Context, g *Globals, projectName string, opts core.MoveOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	plan, err := core.MoveProject(ctx, sm, projectName, core.MoveOptions{Category: opts.Category, Master: opts.Master, DryRun: true})
+	if err != nil {
+		return err
+	}
+	if !g.JSON() {
+		verb := "Would move"
+		if !opts.DryRun {
+			verb = "Moving"
+		}
+		fmt.Printf("%s '%s' from %s/%s to %s/%s\n", verb, projectName, plan.FromMaster, plan.FromCategory, plan.ToMaster, plan.ToCategory)
+		if plan.Moved {
+			fmt.Printf("  Archive: moving %s to %s\n", plan.OldPath, plan.NewPath)
+		} else {
+			fmt.Printf("  Archive: no copy at %s\n", plan.OldPath)
+		}
+	}
+	if opts.DryRun {
+		if g.JSON() {
+			return printJSON(plan)
+		}
+		return nil
+	}
+	if plan.Moved && !confirm(g, "Move the project?") {
+		g.unchanged = true
+		fmt.Println("Cancelled.")
+		return nil
+	}
+
+	move, err := core.MoveProject(ctx, sm, projectName, opts)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(move)
+	}
+	fmt.Printf("Moved '%s' to category '%s' of master '%s'\n", projectName, move.ToCategory, move.ToMaster)
+	return nil
+}
@@ -1,72 +1,286 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/jamespark/parkr/core"
 )
 
+func parkCommand(g *Globals) *Command {
+	cmd := newCommand(g, "park", "<project>...", "Sync local changes back to archive")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr park ml-pipeline",
+		"parkr park ml-pipeline analysis webapp",
+		"parkr park 'ml-*'",
+		"parkr park --verify-remote ml-pipeline",
+		"parkr park --jobs 8 node-monorepo",
+		"parkr park --bwlimit 5M ml-pipeline",
+		"parkr park --confirm-over 1G ml-pipeline",
+		"parkr park --no-delete ml-pipeline",
+		"parkr park --all",
+	}
+	verifyRemote := cmd.Flags.Bool("verify-remote", false, "Hash the archive copy after syncing and fail if it differs from local")
+	jobs := cmd.Flags.Int("jobs", 0, "Sync with up to `n` rsync processes at once (default: transfer_jobs setting)")
+	bwlimit := cmd.Flags.String("bwlimit", "", "Limit the transfer `rate` per second, e.g. 5M; 0 for no limit (default: bwlimit setting)")
+	confirmOver := cmd.Flags.String("confirm-over", "", "Ask before syncing more than `size` (e.g. 1G)")
+	noDelete := cmd.Flags.Bool("no-delete", false, "Only add and update archive files, keeping those deleted locally")
+	all := cmd.Flags.Bool("all", false, "Park every grabbed project with unparked changes")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if *all && len(args) > 0 {
+			return usageErrorf("give either projects or --all, not both")
+		}
+		if !*all {
+			if err := requireArgs(cmd, args, 1, -1); err != nil {
+				return err
+			}
+		}
+		if *jobs < 0 {
+			return usageErrorf("--jobs can't be negative")
+		}
+		if *noDelete && *verifyRemote {
+			return usageErrorf("--no-delete can't be combined with --verify-remote")
+		}
+		if err := checkBwLimit(*bwlimit); err != nil {
+			return err
+		}
+		var threshold int64
+		if *confirmOver != "" {
+			size, err := core.ParseSize(*confirmOver)
+			if err != nil {
+				return usageErrorf("invalid --confirm-over: %v", err)
+			}
+			threshold = size
+		}
+		opts := ParkOptions{
+			VerifyRemote: *verifyRemote,
+			Jobs:         *jobs,
+			BwLimit:      *bwlimit,
+			ConfirmOver:  threshold,
+			NoDelete:     *noDelete,
+		}
+		if *all {
+			return ParkDirtyCmd(ctx, g, opts)
+		}
+		projects, err := expandProjects(ctx, g, args, core.MatchGrabbed, "park")
+		if err != nil || projects == nil {
+			return err
+		}
+		if len(projects) > 1 {
+			return ParkAllCmd(ctx, g, projects, opts)
+		}
+		return ParkCmd(ctx, g, projects[0], opts)
+	}
+	return cmd
+}
+
+// ParkOptions holds the flags accepted by park
+type ParkOptions struct {
+	VerifyRemote bool
+	Jobs         int
+	BwLimit      string
+	ConfirmOver  int64 // Ask before syncing more bytes than this; 0 never asks
+	NoDelete     bool
+}
+
 // ParkCmd syncs local changes back to archive
-func ParkCmd(projectName string) error {
-	sm := core.NewStateManager()
-	state, err := sm.Load()
-	if err != nil {
+func ParkCmd(ctx context.Context, g *Globals, projectName string, opts ParkOptions) error {
+	result, err := parkProject(ctx, g, projectName, opts)
+	if err != nil || result == nil || !g.JSON() {
 		return err
 	}
+	return printJSON(result)
+}
 
-	// Check if project is grabbed
-	project, exists := state.Projects[projectName]
-	if !exists || !project.IsGrabbed {
-		return fmt.Errorf("project '%s' is not currently grabbed", projectName)
-	}
+// ParkAllCmd parks several projects in turn, continuing past failures, and
+// summarises which were parked
+func ParkAllCmd(ctx context.Context, g *Globals, projects []string, opts ParkOptions) error {
+	return runBatch(ctx, g, "park", "parked", projects, func(projectName string) (any, error) {
+		result, err := parkProject(ctx, g, projectName, opts)
+		if result == nil {
+			return nil, err
+		}
+		return result, err
+	})
+}
 
-	// Verify local path exists
-	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
-		return fmt.Errorf("local path does not exist: %s", project.LocalPath)
-	}
+// ParkDirtyCmd parks every grabbed project with unparked changes, leaving
+// out those also changed in the archive, and summarises what was synced
+func ParkDirtyCmd(ctx context.Context, g *Globals, opts ParkOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
 
-	// Get archive path
-	archivePath, err := state.GetArchivePath(projectName)
+	plan, err := core.PlanParkAll(ctx, sm)
 	if err != nil {
 		return err
 	}
+	for _, e := range plan.Conflicted {
+		fmt.Fprintf(os.Stderr, "Warning: skipping '%s', which was also changed in the archive since it was last synced; review it with 'parkr drift %s', then pull or park it\n", e.Name, e.Name)
+	}
+	if len(plan.Park) == 0 {
+		g.unchanged = true
+		if g.JSON() {
+			return printJSON([]batchOutcome{})
+		}
+		fmt.Printf("Nothing to park: %d grabbed project(s) have no unparked changes.\n", plan.Clean)
+		return nil
+	}
 
-	// Verify archive path exists
-	if _, err := os.Stat(archivePath); os.IsNotExist(err) {
-		return fmt.Errorf("archive path does not exist: %s", archivePath)
+	projects := make([]string, 0, len(plan.Park))
+	for _, e := range plan.Park {
+		projects = append(projects, e.Name)
+	}
+	if !g.JSON() {
+		fmt.Printf("%d project(s) with unparked changes: %s\n\n", len(projects), strings.Join(projects, ", "))
+	}
+	var parked []*core.ParkResult
+	err = runBatch(ctx, g, "park", "parked", projects, func(projectName string) (any, error) {
+		result, err := parkProject(ctx, g, projectName, opts)
+		if result == nil {
+			return nil, err
+		}
+		parked = append(parked, result)
+		return result, err
+	})
+	if !g.JSON() && !g.DryRun && len(parked) > 0 {
+		printParkSummary(parked, plan.Clean)
 	}
+	return err
+}
 
-	fmt.Printf("Parking %s from %s to %s...\n", projectName, project.LocalPath, archivePath)
+// printParkSummary lists the projects a park --all synced, with their sizes
+func printParkSummary(parked []*core.ParkResult, clean int) {
+	fmt.Println("\nSynced to the archive:")
+	var total int64
+	for _, r := range parked {
+		fmt.Printf("  %-30s %-12s %s\n", r.Project, core.FormatSize(r.Size), r.ArchivePath)
+		total += r.Size
+	}
+	fmt.Printf("TOTAL: %d project(s), %s; %d already clean\n", len(parked), core.FormatSize(total), clean)
+}
 
-	// Rsync from local to archive
-	if err := core.Rsync(project.LocalPath, archivePath); err != nil {
-		return fmt.Errorf("failed to sync project: %w", err)
+// parkProject parks a project, printing its progress and outcome as text
+// unless the output is JSON. It returns nil if the user cancelled.
+func parkProject(ctx context.Context, g *Globals, projectName string, opts ParkOptions) (*core.ParkResult, error) {
+	if !g.JSON() && !g.DryRun {
+		fmt.Printf("Parking %s...\n", projectName)
 	}
 
-	// Get newest mtime from local
-	newestInfo, err := core.GetNewestMtime(project.LocalPath)
-	if err != nil {
-		return fmt.Errorf("failed to get mtime: %w", err)
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	// A dry run previews as part of the park
+	if !g.DryRun && (!g.JSON() || opts.ConfirmOver > 0) {
+		proceed, err := previewPark(ctx, g, sm, projectName, opts)
+		if err != nil || !proceed {
+			return nil, err
+		}
 	}
 
-	// Update state
-	now := time.Now()
-	project.LastParkAt = &now
+	progress, finish := transferProgress(g, projectName, "syncing")
+	result, err := core.Park(ctx, sm, projectName, core.ParkOptions{
+		DryRun:       g.DryRun,
+		VerifyRemote: opts.VerifyRemote,
+		Jobs:         opts.Jobs,
+		BwLimit:      opts.BwLimit,
+		Progress:     progress,
+		NoDelete:     opts.NoDelete,
+	})
+	finish(err)
+	if err == nil && !result.DryRun {
+		recordParkSample(g, sm.StatePath(), result)
+	}
+	if err != nil || g.JSON() {
+		return result, err
+	}
+	if result.DryRun {
+		if result.Preview != nil {
+			printSyncPreview(result.Preview)
+		}
+		if result.Resumed {
+			fmt.Printf("Would resume the interrupted park of '%s' into %s\n", projectName, result.ArchivePath)
+			return result, nil
+		}
+		fmt.Printf("Would park '%s' from %s to %s\n", projectName, result.LocalPath, result.ArchivePath)
+		return result, nil
+	}
 
-	if newestInfo != nil && *newestInfo != nil {
-		mtime := (*newestInfo).ModTime()
-		project.LastParkMtime = &mtime
+	for _, w := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if result.Resumed {
+		fmt.Println("Resumed an interrupted park.")
+	}
+	if result.Version != nil {
+		fmt.Printf("Kept the previous archive copy at %s\n", result.Version.Path)
 	}
+	if result.RemoteVerified {
+		fmt.Println("Archive copy verified against local content hash.")
+	}
+	fmt.Printf("Successfully parked '%s' from %s to %s\n", projectName, result.LocalPath, result.ArchivePath)
+	return result, nil
+}
 
-	// For Phase 1, we're in no-hash mode
-	project.NoHashMode = true
+// previewPark shows what parking a project will transfer and delete, and
+// asks before going on if that is more than opts.ConfirmOver bytes. Without
+// a terminal to ask on, a large sync needs --yes.
+func previewPark(ctx context.Context, g *Globals, sm core.StateStore, projectName string, opts ParkOptions) (bool, error) {
+	preview, err := core.PreviewPark(ctx, sm, projectName, core.ParkOptions{NoDelete: opts.NoDelete})
+	if err != nil {
+		return false, err
+	}
+	confirmOver := opts.ConfirmOver
+	if !g.JSON() {
+		printSyncPreview(preview)
+	}
+	if confirmOver <= 0 || preview.Bytes <= confirmOver || g.Yes {
+		return true, nil
+	}
+	if g.JSON() || !isInteractive() {
+		return false, fmt.Errorf("parking '%s' would send up to %s, more than --confirm-over %s; use --yes to go ahead", projectName, core.FormatSize(preview.Bytes), core.FormatSize(confirmOver))
+	}
+	if !confirm(g, fmt.Sprintf("This sends up to %s, more than %s. Park anyway?", core.FormatSize(preview.Bytes), core.FormatSize(confirmOver))) {
+		fmt.Println("Cancelled.")
+		return false, nil
+	}
+	return true, nil
+}
 
-	if err := sm.Save(state); err != nil {
-		return fmt.Errorf("failed to update state: %w", err)
+// printSyncPreview prints how much a park will copy and the first archive
+// files it will delete
+func printSyncPreview(preview *core.SyncPreview) {
+	if preview.Rewrite {
+		fmt.Printf("Writes a new tarball of %s.\n", core.FormatSize(preview.Bytes))
+		return
+	}
+	removal := fmt.Sprintf("deletes %d file(s) from the archive", len(preview.Deleted))
+	if preview.TrashDays > 0 {
+		removal = fmt.Sprintf("moves %d file(s) from the archive to trash for %d day(s)", len(preview.Deleted), preview.TrashDays)
 	}
+	fmt.Printf("Copies %d file(s), up to %s; %s.\n", preview.Files, core.FormatSize(preview.Bytes), removal)
+	if preview.KeepVersions > 0 {
+		fmt.Printf("Keeps the current archive copy as a version first (up to %d kept).\n", preview.KeepVersions)
+	}
+	for i, name := range preview.Deleted {
+		if i == maxDiffLines {
+			fmt.Printf("  ... and %d more (use --no-delete to keep them)\n", len(preview.Deleted)-maxDiffLines)
+			break
+		}
+		fmt.Printf("  deleting %s\n", name)
+	}
+}
 
-	fmt.Printf("Successfully parked '%s'\n", projectName)
+// checkBwLimit validates a --bwlimit value
+func checkBwLimit(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := core.ParseSize(value); err != nil {
+		return usageErrorf("invalid --bwlimit: %v", err)
+	}
 	return nil
 }
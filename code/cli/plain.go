@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// printFields prints one line of plain output: labels and values in turn,
+// as "label: value" two spaces apart. Empty values are left out.
+func printFields(labelsAndValues ...string) {
+	var fields []string
+	for i := 0; i+1 < len(labelsAndValues); i += 2 {
+		if value := labelsAndValues[i+1]; value != "" {
+			fields = append(fields, labelsAndValues[i]+": "+value)
+		}
+	}
+	fmt.Println(strings.Join(fields, "  "))
+}
+
+// mark returns symbol and a space, to start a line of text output. Plain
+// output spells out errors and warnings instead, and drops other symbols,
+// whose lines already say what happened.
+func (g *Globals) mark(symbol string) string {
+	if !g.Plain() {
+		return symbol + " "
+	}
+	switch symbol {
+	case "✗":
+		return "Error: "
+	case "!", "⚠":
+		return "Warning: "
+	}
+	return ""
+}
+
+// unmarked removes the symbol that starts a status label, such as "✓ " in
+// "✓ Grabbed, clean", for plain output
+func unmarked(label string) string {
+	for _, symbol := range []string{"✓ ", "⚠ ", "✗ ", "… ", "! "} {
+		if rest, ok := strings.CutPrefix(label, symbol); ok {
+			return rest
+		}
+	}
+	return label
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pluginPrefix is the executable name prefix for external subcommands
+const pluginPrefix = "parkr-"
+
+// FindPlugin looks up an external subcommand (parkr-<name>) on PATH
+func FindPlugin(name string) (string, bool) {
+	if name == "" || strings.ContainsRune(name, os.PathSeparator) {
+		return "", false
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// ListPlugins returns the names of all external subcommands found on PATH
+func ListPlugins() []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !strings.HasPrefix(name, pluginPrefix) || entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			sub := strings.TrimPrefix(name, pluginPrefix)
+			if sub != "" && !seen[sub] {
+				seen[sub] = true
+				names = append(names, sub)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// RunPlugin executes an external subcommand with the given arguments,
+// passing through stdio. The state file location is exported to the plugin
+// as PARKR_STATE. Returns the plugin's exit code.
+func RunPlugin(g *Globals, path string, args []string) (int, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PARKR_STATE="+g.StateManager().StatePath())
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return ExitError, err
+	}
+	return ExitOK, nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func profilesCommand(g *Globals) *Command {
+	cmd := newCommand(g, "profiles", "", "List named profiles")
+	cmd.Examples = []string{
+		"parkr profiles",
+		"parkr --profile work init",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		return ProfilesCmd(ctx, g)
+	}
+	return cmd
+}
+
+// ProfilesCmd lists the profiles under core.ProfilesDir, marking the one
+// selected with --profile
+func ProfilesCmd(ctx context.Context, g *Globals) error {
+	names, err := core.ListProfiles()
+	if err != nil {
+		return err
+	}
+
+	if g.JSON() {
+		if names == nil {
+			names = []string{}
+		}
+		return printJSON(names)
+	}
+	if len(names) == 0 {
+		fmt.Println("No profiles. Create one with 'parkr --profile <name> init'.")
+		return nil
+	}
+	for _, name := range names {
+		marker := " "
+		if name == g.Profile {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
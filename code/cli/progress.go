@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// progressRedrawInterval limits how often a live board redraws for byte
+// counts alone; status changes always redraw
+const progressRedrawInterval = 100 * time.Millisecond
+
+// progressBoard shows the progress of operations running in parallel, one
+// line per project with its status, percent done and throughput. On a
+// terminal the lines are redrawn in place; otherwise a log line is written
+// whenever a project's status changes. It is safe for concurrent use.
+type progressBoard struct {
+	mu       sync.Mutex
+	out      io.Writer
+	live     bool
+	items    []*progressItem
+	byName   map[string]*progressItem
+	drawn    int // Lines written by the last redraw
+	lastDraw time.Time
+}
+
+// progressItem is one project's line on a progressBoard
+type progressItem struct {
+	name        string
+	status      string
+	done, total int64  // Bytes; total is 0 if unknown
+	detail      string // Shown after the throughput, such as the time left
+	started     time.Time
+	finished    time.Time
+}
+
+// newProgressBoard returns a board writing to f, redrawn in place if f is a
+// terminal and output isn't plain
+func newProgressBoard(g *Globals, f *os.File) *progressBoard {
+	return &progressBoard{out: f, live: isTerminal(f) && !g.Plain(), byName: make(map[string]*progressItem)}
+}
+
+// Update records a project's status and bytes done out of total (0 if
+// unknown). Projects are listed in the order they are first updated.
+func (b *progressBoard) Update(name, status string, done, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.set(b.item(name), status, done, total)
+}
+
+// UpdateDetail is Update with a detail shown after the throughput, such as
+// files done or time left. Changes to it alone don't force a redraw.
+func (b *progressBoard) UpdateDetail(name, status, detail string, done, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item := b.item(name)
+	item.detail = detail
+	b.set(item, status, done, total)
+}
+
+// Finish marks a project as done, or failed if err is non-nil
+func (b *progressBoard) Finish(name string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	item := b.item(name)
+	item.finished = time.Now()
+	item.detail = ""
+	if err != nil {
+		// The full error, with any tool output, is the caller's to print
+		msg, _, _ := strings.Cut(err.Error(), "\n")
+		b.set(item, "failed: "+msg, item.done, item.total)
+		return
+	}
+	done := item.done
+	if item.total > 0 {
+		done = item.total
+	}
+	b.set(item, "done", done, item.total)
+}
+
+// item returns a project's line, adding it if needed. The caller must hold
+// b.mu.
+func (b *progressBoard) item(name string) *progressItem {
+	item, ok := b.byName[name]
+	if !ok {
+		item = &progressItem{name: name, started: time.Now()}
+		b.items = append(b.items, item)
+		b.byName[name] = item
+	}
+	return item
+}
+
+// set updates an item and shows the change. The caller must hold b.mu.
+func (b *progressBoard) set(item *progressItem, status string, done, total int64) {
+	changed := item.status != status
+	item.status, item.done, item.total = status, done, total
+
+	if !b.live {
+		if changed {
+			fmt.Fprintf(b.out, "%s: %s\n", item.name, status)
+		}
+		return
+	}
+	now := time.Now()
+	if changed || now.Sub(b.lastDraw) >= progressRedrawInterval {
+		b.redraw(now)
+	}
+}
+
+// redraw rewrites every line in place. The caller must hold b.mu.
+func (b *progressBoard) redraw(now time.Time) {
+	var sb strings.Builder
+	if b.drawn > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", b.drawn)
+	}
+	for _, item := range b.items {
+		sb.WriteString("\r\x1b[K")
+		sb.WriteString(item.line(now))
+		sb.WriteString("\n")
+	}
+	io.WriteString(b.out, sb.String())
+	b.drawn = len(b.items)
+	b.lastDraw = now
+}
+
+// line formats the item for a live board
+func (item *progressItem) line(now time.Time) string {
+	percent := ""
+	if item.total > 0 {
+		percent = fmt.Sprintf("%3d%%", min(item.done*100/item.total, 100))
+	}
+	throughput := ""
+	end := now
+	if !item.finished.IsZero() {
+		end = item.finished
+	}
+	if elapsed := end.Sub(item.started).Seconds(); item.done > 0 && elapsed > 0 {
+		throughput = core.FormatSize(int64(float64(item.done)/elapsed)) + "/s"
+	}
+	line := fmt.Sprintf("%-30s %-24s %4s %12s", item.name, item.status, percent, throughput)
+	if item.detail != "" {
+		line += "  " + item.detail
+	}
+	return line
+}
+
+// transferProgress returns a core.ProgressFunc that shows a grab or park of
+// one project on a live board, and a function to call once it ends. The
+// ProgressFunc is nil, and nothing is shown, unless output is text to a
+// terminal.
+func transferProgress(g *Globals, name, status string) (core.ProgressFunc, func(error)) {
+	if g.JSON() || g.DryRun || !isTerminal(os.Stdout) {
+		return nil, func(error) {}
+	}
+	board := newProgressBoard(g, os.Stdout)
+	var started atomic.Bool
+	progress := func(p core.TransferProgress) {
+		started.Store(true)
+		var total int64
+		if p.Percent > 0 {
+			total = p.Bytes * 100 / int64(p.Percent)
+		}
+		board.UpdateDetail(name, status, transferDetail(p), p.Bytes, total)
+	}
+	finish := func(err error) {
+		// Errors before the copy started are reported by the caller alone
+		if started.Load() {
+			board.Finish(name, err)
+		}
+	}
+	return progress, finish
+}
+
+// transferDetail formats the files done and time left of a transfer
+func transferDetail(p core.TransferProgress) string {
+	var parts []string
+	if p.TotalFiles > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d files", p.Files, p.TotalFiles))
+	}
+	if p.ETA > 0 {
+		parts = append(parts, p.ETA.String()+" left")
+	}
+	return strings.Join(parts, ", ")
+}
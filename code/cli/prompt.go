@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// isInteractive reports whether stdin is a terminal
+func isInteractive() bool {
+	return isTerminal(os.Stdin)
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question on stdin. It returns true without asking
+// when --yes is set, and false when stdin is not a terminal.
+func confirm(g *Globals, prompt string) bool {
+	if g.Yes {
+		return true
+	}
+	if !isInteractive() {
+		return false
+	}
+
+	fmt.Printf("%s [y/N] ", prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// ask prompts for a line of input on stdin, returning def when the answer is
+// empty or stdin can't be read
+func ask(prompt, def string) string {
+	fmt.Printf("%s [%s]: ", prompt, def)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return def
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return def
+}
@@ -0,0 +1,374 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func pruneCommand(g *Globals) *Command {
+	cmd := newCommand(g, "prune", "<size> | --free <size|percent>", "Free up space by removing safe local copies (dry-run by default)")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr prune 20G",
+		"parkr prune 20G --exec",
+		"parkr prune --free 15% --park-first --exec",
+		"parkr prune 20G --exec --interactive",
+		"parkr prune 50G --keep-latest-per-tag",
+		"parkr prune 20G --cluster",
+	}
+	execute := cmd.Flags.Bool("exec", false, "Actually delete (default is dry-run)")
+	noHash := cmd.Flags.Bool("no-hash", false, "Use mtime verification for all projects")
+	force := cmd.Flags.Bool("force", false, "Skip verification entirely (dangerous)")
+	free := cmd.Flags.String("free", "", "Prune until the local volume has `size|percent` free (e.g. 50G or 20%)")
+	parkFirst := cmd.Flags.Bool("park-first", false, "Park dirty projects and remove them when safe candidates fall short")
+	interactive := cmd.Flags.Bool("interactive", false, "Pick which projects to remove")
+	keepLatest := cmd.Flags.Bool("keep-latest-per-tag", false, "Never remove the most recently modified project of each tag")
+	cluster := cmd.Flags.Bool("cluster", false, "List this machine's checkouts in the archive and report what other machines could free")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		opts := PruneOptions{
+			Exec:             *execute && !g.DryRun,
+			NoHash:           *noHash,
+			Force:            *force,
+			Free:             *free,
+			ParkFirst:        *parkFirst,
+			Interactive:      *interactive,
+			KeepLatestPerTag: *keepLatest,
+			Cluster:          *cluster,
+		}
+		if opts.Interactive && g.JSON() {
+			return usageErrorf("--interactive can't be used with --format json")
+		}
+		if opts.Free != "" {
+			if err := requireArgs(cmd, args, 0, 0); err != nil {
+				return usageErrorf("give either a size or --free, not both")
+			}
+			return PruneCmd(ctx, g, 0, opts)
+		}
+
+		if err := requireArgs(cmd, args, 1, 1); err != nil {
+			return err
+		}
+		target, err := core.ParseSize(args[0])
+		if err != nil {
+			return usageErrorf("%v", err)
+		}
+		return PruneCmd(ctx, g, target, opts)
+	}
+	return cmd
+}
+
+// PruneOptions holds the flags accepted by prune
+type PruneOptions struct {
+	Exec   bool
+	NoHash bool
+	Force  bool
+	// Free is a desired free-space level for the local volume; when set the
+	// target size is computed from it
+	Free string
+	// ParkFirst selects dirty projects to park and then remove when the
+	// safe candidates can't reach the target
+	ParkFirst bool
+	// Interactive lets the user pick the projects to remove
+	Interactive bool
+	// KeepLatestPerTag protects the newest project of each tag
+	KeepLatestPerTag bool
+	// Cluster shares this machine's checkouts through the archive and
+	// reports what the other machines sharing it could free
+	Cluster bool
+}
+
+// pruneOutput is the JSON document printed by prune
+type pruneOutput struct {
+	*core.PrunePlan
+	DryRun   bool                `json:"dry_run"`
+	Outcomes []core.PruneOutcome `json:"outcomes,omitempty"`
+	// Freed is the space the removed copies gave back
+	Freed int64 `json:"freed"`
+}
+
+// PruneCmd removes local copies of the oldest safe projects until target
+// bytes would be freed, or until the local volume reaches opts.Free
+func PruneCmd(ctx context.Context, g *Globals, target int64, opts PruneOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	var plan *core.PrunePlan
+	var err error
+	if opts.Free != "" {
+		plan, err = core.PlanPruneToFree(ctx, sm, opts.Free)
+	} else {
+		plan, err = core.PlanPrune(ctx, sm, target)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Cluster {
+		errs, err := plan.AddCluster(sm)
+		if err != nil {
+			return err
+		}
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if opts.KeepLatestPerTag {
+		plan.KeepLatestPerTag()
+	}
+
+	if opts.Interactive {
+		if opts.ParkFirst {
+			plan.ParkFirst()
+		}
+		ok, err := choosePruneProjects(g, plan)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	} else if plan.Shortfall > 0 && len(plan.Parkable()) > 0 {
+		switch {
+		case opts.ParkFirst:
+			plan.ParkFirst()
+		case opts.Exec && !g.JSON() && isInteractive():
+			printPrunePlan(plan)
+			fmt.Println()
+			prompt := fmt.Sprintf("Target not reached. Park %d project(s) with unparked work (%s) first and then remove them?",
+				len(plan.Parkable()), core.FormatSize(plan.ParkableSize()))
+			if confirm(g, prompt) {
+				plan.ParkFirst()
+			}
+		}
+	}
+
+	if !opts.Exec {
+		g.unchanged = true
+		if g.JSON() {
+			return printJSON(pruneOutput{PrunePlan: plan, DryRun: true})
+		}
+		printPrunePlan(plan)
+		warnUnverified(sm, plan)
+		printPruneCluster(plan.Cluster)
+		fmt.Println()
+		fmt.Println("Dry run - nothing deleted. Re-run with --exec to delete.")
+		return nil
+	}
+
+	if !g.JSON() {
+		printPrunePlan(plan)
+		warnUnverified(sm, plan)
+		fmt.Println()
+	}
+
+	// Prune is there to free space, and a copy moved to the trash still
+	// takes up its volume's, so prune always deletes
+	outcomes, err := core.ExecutePrune(ctx, sm, plan, core.PruneOptions{NoHash: opts.NoHash, Force: opts.Force, NoTrash: true})
+	if opts.Cluster {
+		if errs, err := plan.AddCluster(sm); err == nil {
+			for _, err := range errs {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+	if g.JSON() {
+		out := pruneOutput{PrunePlan: plan, Outcomes: outcomes, Freed: prunedSize(outcomes)}
+		if jsonErr := printJSON(out); jsonErr != nil {
+			return jsonErr
+		}
+	} else {
+		printPruneOutcomes(outcomes)
+		printPruneCluster(plan.Cluster)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, o := range outcomes {
+		if !o.Removed {
+			return fmt.Errorf("some projects could not be removed")
+		}
+	}
+	return nil
+}
+
+// choosePruneProjects lets the user adjust the plan's selection with the
+// interactive selector, or by row number without a terminal. Returns false
+// if the user cancelled.
+func choosePruneProjects(g *Globals, plan *core.PrunePlan) (bool, error) {
+	selected := make(map[string]bool)
+	for _, e := range plan.Selected {
+		selected[e.Name] = true
+	}
+
+	var items []core.SelectItem
+	for _, e := range plan.Candidates {
+		items = append(items, pruneSelectItem(e, selected[e.Name]))
+	}
+	for _, e := range plan.Selected {
+		if slices.Contains(plan.ToPark, e.Name) {
+			items = append(items, pruneSelectItem(e, true))
+		}
+	}
+	for _, e := range plan.Dirty {
+		items = append(items, pruneSelectItem(e, false))
+	}
+
+	list := core.NewMultiSelect(items)
+	ok, err := chooseFromList(g, selector{
+		Title:  fmt.Sprintf("Need to free up %s. Candidates (oldest first):", core.FormatSize(plan.Target)),
+		Target: plan.Target,
+		Legend: []string{
+			"COLUMNS:",
+			"  Project, local size, time since the newest local change, status",
+			"",
+			"STATUS:",
+			fmt.Sprintf("  %-24s %s", statusLabel(core.StatusSafe), "Unchanged since last park; removed after re-verification"),
+			fmt.Sprintf("  %-24s %s", statusLabel(core.StatusDirty), "Changed since last park; parked first, then removed"),
+			fmt.Sprintf("  %-24s %s", statusLabel(core.StatusNeverParked), "Not in the archive yet; parked first, then removed"),
+		},
+		Labels: []string{"project", "size", "modified", "status"},
+	}, list)
+	if err != nil || !ok {
+		return false, err
+	}
+	plan.Choose(list.Selected())
+	return true, nil
+}
+
+// pruneSelectItem is the selector row for a prune candidate
+func pruneSelectItem(e core.ReportEntry, selected bool) core.SelectItem {
+	return core.SelectItem{
+		Key:      e.Name,
+		Columns:  []string{e.Name, formatSizeOrUnknown(e.LocalSize), core.FormatAge(e.LastModified), statusLabel(e.Status)},
+		Size:     e.LocalSize,
+		Selected: selected,
+	}
+}
+
+// printPrunePlan prints the selected candidates and whether they meet the target
+func printPrunePlan(plan *core.PrunePlan) {
+	if plan.Volumes != nil {
+		for _, v := range plan.Volumes {
+			fmt.Printf("Local volume at %s: %s free of %s, target %s free",
+				v.Path, core.FormatSize(v.Disk.Free), core.FormatSize(v.Disk.Total), core.FormatSize(v.FreeTarget))
+			if v.Deficit > 0 {
+				fmt.Printf(", need %s\n", core.FormatSize(v.Deficit))
+			} else {
+				fmt.Println(", met")
+			}
+		}
+		if plan.Target == 0 {
+			fmt.Println("Free-space target already met - nothing to prune.")
+			return
+		}
+	}
+
+	fmt.Printf("Need to free up %s. Candidates (oldest first):\n\n", core.FormatSize(plan.Target))
+
+	if len(plan.Selected) == 0 {
+		fmt.Println("  (no projects are safe to delete)")
+	}
+	for i, e := range plan.Selected {
+		fmt.Printf("%d. %s (%s) - last modified %s\n", i+1, e.Name, formatSizeOrUnknown(e.LocalSize), core.FormatAge(e.LastModified))
+	}
+
+	fmt.Println()
+	fmt.Printf("Total: %s\n", core.FormatSize(plan.Total))
+	if len(plan.ToPark) > 0 {
+		fmt.Printf("Will park first: %s\n", strings.Join(plan.ToPark, ", "))
+	}
+	if len(plan.Kept) > 0 {
+		fmt.Printf("Kept as newest of their tag: %s\n", strings.Join(plan.Kept, ", "))
+	}
+	if plan.Shortfall > 0 {
+		fmt.Printf("Warning: %s short of target - not enough safe candidates\n", core.FormatSize(plan.Shortfall))
+		if len(plan.Parkable()) > 0 {
+			fmt.Printf("%d project(s) with unparked work (%s) could be parked and removed with --park-first\n",
+				len(plan.Parkable()), core.FormatSize(plan.ParkableSize()))
+		}
+	}
+}
+
+// printPruneCluster reports what the other machines sharing the archive
+// could free, as prune --cluster found in their checkout lists
+func printPruneCluster(machines []core.ClusterMachine) {
+	if machines == nil {
+		return
+	}
+	fmt.Println()
+	if len(machines) == 0 {
+		fmt.Println("No other machine has listed its checkouts in the archive; run 'parkr prune --cluster' there.")
+		return
+	}
+	fmt.Println("Other machines could free:")
+	for _, m := range machines {
+		var names []string
+		for _, c := range m.Candidates {
+			names = append(names, c.Project)
+		}
+		line := fmt.Sprintf("  %-20s %-10s listed %s", m.Host, core.FormatSize(m.Free), core.FormatAge(&m.UpdatedAt))
+		if len(names) > 0 {
+			line += ": " + strings.Join(names, ", ")
+		}
+		if m.Dirty > 0 {
+			line += fmt.Sprintf(" (%d more with unparked work)", m.Dirty)
+		}
+		fmt.Println(line)
+	}
+}
+
+// warnUnverified notes selected projects whose archive copies need a scrub
+// under the prune_verify_days rule before they can be removed
+func warnUnverified(sm core.StateStore, plan *core.PrunePlan) {
+	state, err := sm.Load()
+	if err != nil {
+		return
+	}
+	names := plan.UnverifiedSelected(state, time.Now())
+	if len(names) == 0 {
+		return
+	}
+	if state.Settings.PruneVerifyAction == core.VerifyActionBlock {
+		fmt.Printf("Warning: archive copies not verified in the last %d day(s) will be skipped: %s\n",
+			state.Settings.PruneVerifyDays, strings.Join(names, ", "))
+	} else {
+		fmt.Printf("Archive copies not verified in the last %d day(s) will be scrubbed before removal: %s\n",
+			state.Settings.PruneVerifyDays, strings.Join(names, ", "))
+	}
+}
+
+// printPruneOutcomes prints the result of each removal
+func printPruneOutcomes(outcomes []core.PruneOutcome) {
+	for _, o := range outcomes {
+		if o.Parked {
+			fmt.Printf("Parked %s\n", o.Project)
+		}
+		if o.Removed {
+			fmt.Printf("Removed %s (%s)\n", o.Project, formatSizeOrUnknown(o.Size))
+		} else {
+			fmt.Printf("Skipped %s: %s\n", o.Project, o.Error)
+		}
+	}
+	fmt.Printf("Freed %s\n", core.FormatSize(prunedSize(outcomes)))
+}
+
+// prunedSize returns the space freed by the copies prune removed
+func prunedSize(outcomes []core.PruneOutcome) int64 {
+	var freed int64
+	for _, o := range outcomes {
+		if o.Removed {
+			freed += max(o.Size, 0)
+		}
+	}
+	return freed
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func pullCommand(g *Globals) *Command {
+	cmd := newCommand(g, "pull", "<project>", "Re-sync a clean local copy after the archive was updated elsewhere")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr pull ml-pipeline",
+		"parkr --dry-run pull ml-pipeline",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, 1); err != nil {
+			return err
+		}
+		return PullCmd(ctx, g, args[0])
+	}
+	return cmd
+}
+
+// PullCmd copies archive updates made elsewhere into a clean local copy
+func PullCmd(ctx context.Context, g *Globals, projectName string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	result, err := core.Pull(ctx, sm, projectName, core.PullOptions{DryRun: g.DryRun})
+	if err != nil {
+		return err
+	}
+
+	if g.JSON() {
+		return printJSON(result)
+	}
+	switch {
+	case !result.Updated:
+		fmt.Printf("'%s' is up to date with %s\n", projectName, result.ArchivePath)
+	case result.DryRun:
+		fmt.Printf("Would pull '%s' from %s to %s\n", projectName, result.ArchivePath, result.LocalPath)
+	default:
+		fmt.Printf("Pulled '%s' from %s to %s\n", projectName, result.ArchivePath, result.LocalPath)
+	}
+	return nil
+}
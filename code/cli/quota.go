@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func quotaCommand(g *Globals) *Command {
+	cmd := newCommand(g, "quota", "[set <category> <size> | unset <category> | mode warn|enforce]", "Show or configure per-category local quotas, and show grab limits")
+	cmd.Examples = []string{
+		"parkr quota",
+		"parkr quota set pycharm 50G",
+		"parkr quota mode enforce",
+		"parkr config set max_grabbed 12",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			return QuotaCmd(ctx, g)
+		}
+
+		sm := g.StateManager()
+		switch args[0] {
+		case "set":
+			if err := requireArgs(cmd, args, 3, 3); err != nil {
+				return err
+			}
+			if _, err := core.ParseSize(args[2]); err != nil {
+				return usageErrorf("%v", err)
+			}
+			if err := core.SetCategoryQuota(sm, args[1], args[2]); err != nil {
+				return err
+			}
+			fmt.Printf("Quota for '%s' set to %s\n", args[1], args[2])
+		case "unset":
+			if err := requireArgs(cmd, args, 2, 2); err != nil {
+				return err
+			}
+			if err := core.UnsetCategoryQuota(sm, args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Quota for '%s' removed\n", args[1])
+		case "mode":
+			if err := requireArgs(cmd, args, 2, 2); err != nil {
+				return err
+			}
+			if args[1] != core.QuotaWarn && args[1] != core.QuotaEnforce {
+				return usageErrorf("invalid quota mode '%s' (expected warn or enforce)", args[1])
+			}
+			if err := core.SetQuotaMode(sm, args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Quota mode set to %s\n", args[1])
+		default:
+			return usageErrorf("unknown quota action '%s'", args[0])
+		}
+		return nil
+	}
+	return cmd
+}
+
+// quotaOutput is the JSON document printed by quota
+type quotaOutput struct {
+	Mode    string            `json:"mode"`
+	Quotas  []core.QuotaUsage `json:"quotas"`
+	Grabbed *core.GrabUsage   `json:"grabbed,omitempty"`
+}
+
+// QuotaCmd shows each category quota and how much of it is in use
+func QuotaCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	report, err := core.BuildReport(ctx, sm, core.SortName)
+	if err != nil {
+		return err
+	}
+	usages, err := core.QuotaUtilization(state, report.Categories)
+	if err != nil {
+		return err
+	}
+	grabbed, err := core.GrabbedUsage(ctx, state)
+	if err != nil {
+		return err
+	}
+
+	mode := core.QuotaWarn
+	if state.Settings.EnforceQuotas() {
+		mode = core.QuotaEnforce
+	}
+	if g.JSON() {
+		return printJSON(quotaOutput{Mode: mode, Quotas: usages, Grabbed: grabbed})
+	}
+
+	if len(usages) == 0 && grabbed == nil {
+		fmt.Println("No category quotas or grab limits configured.")
+		return nil
+	}
+	fmt.Printf("Quota mode: %s\n\n", mode)
+	if len(usages) > 0 {
+		printQuotaBars(g, usages)
+	}
+	if grabbed != nil {
+		if len(usages) > 0 {
+			fmt.Println()
+		}
+		printGrabLimits(g, grabbed)
+	}
+	return nil
+}
+
+// printQuotaBars prints a utilization bar for each category quota
+func printQuotaBars(g *Globals, usages []core.QuotaUsage) {
+	const width = 30
+	fmt.Println("QUOTAS:")
+	for _, u := range usages {
+		ratio := 0.0
+		if u.Limit > 0 {
+			ratio = float64(u.Used) / float64(u.Limit)
+		}
+		filled := min(int(ratio*width+0.5), width)
+		if g.Plain() {
+			over := ""
+			if u.Used > u.Limit {
+				over = "yes"
+			}
+			printFields("category", u.Category, "used", core.FormatSize(u.Used), "limit", core.FormatSize(u.Limit),
+				"percent", fmt.Sprintf("%.0f%%", ratio*100), "over quota", over)
+			continue
+		}
+		marker := ""
+		if u.Used > u.Limit {
+			marker = "  ⚠ over quota"
+		}
+		fmt.Printf("  %-16s [%s%s] %3.0f%%  %s / %s%s\n",
+			u.Category, strings.Repeat("#", filled), strings.Repeat(".", width-filled),
+			ratio*100, core.FormatSize(u.Used), core.FormatSize(u.Limit), marker)
+	}
+}
+
+// printGrabLimits prints the grabbed projects against the max_grabbed and
+// max_grabbed_size limits
+func printGrabLimits(g *Globals, u *core.GrabUsage) {
+	fmt.Println("GRAB LIMITS:")
+	row := func(limit, used, max string, over bool) {
+		if g.Plain() {
+			overLimit := ""
+			if over {
+				overLimit = "yes"
+			}
+			printFields("limit", limit, "used", used, "max", max, "over limit", overLimit)
+			return
+		}
+		marker := ""
+		if over {
+			marker = "  ⚠ over limit"
+		}
+		fmt.Printf("  %-16s %s / %s%s\n", limit, used, max, marker)
+	}
+	if u.MaxProjects > 0 {
+		row("projects", strconv.Itoa(u.Projects), strconv.Itoa(u.MaxProjects), u.Projects > u.MaxProjects)
+	}
+	if u.MaxSize > 0 {
+		row("size", core.FormatSize(u.Size), core.FormatSize(u.MaxSize), u.Size > u.MaxSize)
+	}
+}
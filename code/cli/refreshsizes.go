@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func refreshSizesCommand(g *Globals) *Command {
+	cmd := newCommand(g, "refresh-sizes", "", "Measure projects on slow masters for list to show")
+	cmd.Examples = []string{
+		"parkr refresh-sizes",
+		"parkr refresh-sizes --all",
+	}
+	all := cmd.Flags.Bool("all", false, "Measure every project, not just those whose last size is missing or over an hour old")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		return RefreshSizesCmd(ctx, g, *all)
+	}
+	return cmd
+}
+
+// RefreshSizesCmd records the current sizes of projects on slow masters
+func RefreshSizesCmd(ctx context.Context, g *Globals, all bool) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	result, err := core.RefreshArchiveSizes(ctx, sm, sm.StatePath(), all)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(result)
+	}
+
+	if result.Busy {
+		fmt.Println("Sizes are already being refreshed.")
+		return nil
+	}
+	fmt.Printf("Measured %d project(s)", result.Measured)
+	if result.Failed > 0 {
+		fmt.Printf(", %d could not be measured", result.Failed)
+	}
+	fmt.Println()
+	return nil
+}
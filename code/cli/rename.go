@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func renameCommand(g *Globals) *Command {
+	cmd := newCommand(g, "rename", "<project> <new-name>", "Rename a project's archive copy, local copy and state entry")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr rename ml-pipeline training-pipeline",
+		"parkr --dry-run rename old-experiment experiment-2024",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 2, 2); err != nil {
+			return err
+		}
+		return RenameCmd(ctx, g, args[0], args[1])
+	}
+	return cmd
+}
+
+// RenameCmd renames a project after confirmation, moving its copies
+func RenameCmd(ctx context.Context, g *Globals, from, to string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	plan, err := core.RenameProject(ctx, sm, from, to, true)
+	if err != nil {
+		return err
+	}
+	if !g.JSON() {
+		verb := "Would rename"
+		if !g.DryRun {
+			verb = "Renaming"
+		}
+		fmt.Printf("%s project '%s' to '%s'\n", verb, from, to)
+		if plan.ArchiveMoved {
+			fmt.Printf("  Archive: moving %s to %s\n", plan.OldArchivePath, plan.NewArchivePath)
+		} else {
+			fmt.Printf("  Archive: no copy at %s\n", plan.OldArchivePath)
+		}
+		if plan.NewLocalPath != "" {
+			fmt.Printf("  Local:   moving %s to %s\n", plan.OldLocalPath, plan.NewLocalPath)
+		}
+		if !plan.Tracked {
+			fmt.Println("  The project isn't tracked, so only its archive copy is renamed.")
+		}
+	}
+	if g.DryRun {
+		if g.JSON() {
+			return printJSON(plan)
+		}
+		return nil
+	}
+	if !confirm(g, "Rename the project?") {
+		g.unchanged = true
+		fmt.Println("Cancelled.")
+		return nil
+	}
+
+	rename, err := core.RenameProject(ctx, sm, from, to, false)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(rename)
+	}
+	fmt.Printf("Renamed project '%s' to '%s'\n", from, to)
+	return nil
+}
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func reportCommand(g *Globals) *Command {
+	cmd := newCommand(g, "report", "", "Disk usage analysis and pruning candidates")
+	cmd.Examples = []string{
+		"parkr report",
+		"parkr report --candidates",
+		"parkr report --by-category --explain",
+	}
+	candidatesOnly := cmd.Flags.Bool("candidates", false, "Show only projects safe to delete")
+	sortBy := cmd.Flags.String("sort", core.SortModified, "Sort by `field`: modified, size or name")
+	explain := cmd.Flags.Bool("explain", false, "Explain why each project is or isn't a pruning candidate")
+	minSize := cmd.Flags.String("min-size", "", "Hide projects smaller than `size` (e.g. 1G)")
+	byCategory := cmd.Flags.Bool("by-category", false, "Show per-category subtotals of local and recoverable space")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		threshold, err := parseMinSize(*minSize)
+		if err != nil {
+			return err
+		}
+		return ReportCmd(ctx, g, ReportOptions{
+			CandidatesOnly: *candidatesOnly,
+			SortBy:         *sortBy,
+			Explain:        *explain,
+			MinSize:        threshold,
+			ByCategory:     *byCategory,
+		})
+	}
+	return cmd
+}
+
+// ReportOptions holds the flags accepted by report
+type ReportOptions struct {
+	CandidatesOnly bool
+	SortBy         string
+	Explain        bool
+	MinSize        int64
+	ByCategory     bool
+}
+
+// ReportCmd shows disk usage of grabbed projects and pruning candidates
+func ReportCmd(ctx context.Context, g *Globals, opts ReportOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	report, err := core.BuildReport(ctx, sm, opts.SortBy)
+	if err != nil {
+		return err
+	}
+	recordSizeSample(g, sm.StatePath(), "report", &report.LocalTotal, nil)
+	report.FilterMinSize(opts.MinSize)
+
+	if g.JSON() {
+		if opts.CandidatesOnly {
+			report.Projects = report.Candidates
+		}
+		return printJSON(report)
+	}
+
+	if len(report.Projects) == 0 {
+		if opts.MinSize > 0 {
+			fmt.Printf("No grabbed projects of %s or more.\n", core.FormatSize(opts.MinSize))
+		} else {
+			fmt.Println("No projects are currently grabbed.")
+		}
+		return nil
+	}
+
+	if !opts.CandidatesOnly {
+		printProjectTable(g, report.Projects)
+		fmt.Println()
+		printSizeBands(g, report.SizeBands)
+		fmt.Println()
+	}
+
+	if opts.ByCategory {
+		printCategoryTotals(g, report.Categories)
+		fmt.Println()
+	}
+
+	if opts.Explain {
+		fmt.Println("CANDIDACY:")
+		for _, e := range report.Projects {
+			verdict := "not a candidate"
+			if e.Candidate {
+				verdict = "candidate"
+			}
+			fmt.Printf("  %s: %s - %s\n", e.Name, verdict, e.Reason)
+		}
+		fmt.Println()
+	}
+
+	if len(report.Candidates) == 0 {
+		fmt.Println("No pruning candidates (nothing is safe to delete).")
+		return nil
+	}
+
+	fmt.Println("PRUNING CANDIDATES (safe to delete, oldest first):")
+	for i, e := range report.Candidates {
+		fmt.Printf("%d. %s (%s) - last modified %s\n", i+1, e.Name, formatSizeOrUnknown(e.LocalSize), core.FormatAge(e.LastModified))
+	}
+	fmt.Println()
+	fmt.Printf("TOTAL RECOVERABLE: %s\n", core.FormatSize(report.Recoverable))
+
+	return nil
+}
+
+// printProjectTable prints the grabbed-projects table shared by report and status
+func printProjectTable(g *Globals, entries []core.ReportEntry) {
+	fmt.Println("GRABBED PROJECTS:")
+	if g.Plain() {
+		for _, e := range entries {
+			printFields("project", e.Name, "local size", formatSizeOrUnknown(e.LocalSize), "last modified", core.FormatAge(e.LastModified),
+				"last park", core.FormatAge(e.LastParkAt), "status", unmarked(stateLabel(e.State)))
+		}
+		return
+	}
+	fmt.Printf("%-30s %-12s %-16s %-16s %s\n", "PROJECT", "LOCAL SIZE", "LAST MODIFIED", "LAST PARK", "STATUS")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, e := range entries {
+		fmt.Printf("%-30s %-12s %-16s %-16s %s\n",
+			e.Name, formatSizeOrUnknown(e.LocalSize), core.FormatAge(e.LastModified), core.FormatAge(e.LastParkAt), stateLabel(e.State))
+	}
+}
+
+// printSizeBands prints how many grabbed projects fall in each size band
+func printSizeBands(g *Globals, bands []core.SizeBand) {
+	fmt.Println("SIZE BANDS:")
+	for _, b := range bands {
+		if g.Plain() {
+			printFields("band", b.Label, "projects", strconv.Itoa(b.Count), "size", core.FormatSize(b.Size))
+			continue
+		}
+		fmt.Printf("  %-8s %3d project(s)  %s\n", b.Label, b.Count, core.FormatSize(b.Size))
+	}
+}
+
+// printCategoryTotals prints per-category usage and recoverable subtotals
+func printCategoryTotals(g *Globals, totals []core.CategoryTotal) {
+	fmt.Println("BY CATEGORY:")
+	if g.Plain() {
+		for _, t := range totals {
+			printFields("category", t.Category, "projects", strconv.Itoa(t.Projects), "local size", core.FormatSize(t.LocalSize),
+				"candidates", strconv.Itoa(t.Candidates), "recoverable", core.FormatSize(t.Recoverable))
+		}
+		return
+	}
+	fmt.Printf("%-16s %-10s %-12s %-12s %s\n", "CATEGORY", "PROJECTS", "LOCAL SIZE", "CANDIDATES", "RECOVERABLE")
+	fmt.Println(strings.Repeat("-", 70))
+	for _, t := range totals {
+		fmt.Printf("%-16s %-10d %-12s %-12d %s\n",
+			t.Category, t.Projects, core.FormatSize(t.LocalSize), t.Candidates, core.FormatSize(t.Recoverable))
+	}
+}
+
+// parseMinSize parses a --min-size value, treating "" as no minimum
+func parseMinSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	size, err := core.ParseSize(s)
+	if err != nil {
+		return 0, usageErrorf("invalid --min-size: %v", err)
+	}
+	return size, nil
+}
+
+// formatSizeOrUnknown formats a size, showing "?" for unknown (-1) sizes
+func formatSizeOrUnknown(size int64) string {
+	if size < 0 {
+		return "?"
+	}
+	return core.FormatSize(size)
+}
+
+// statusLabel returns the display text for a project status
+func statusLabel(status string) string {
+	switch status {
+	case core.StatusSafe:
+		return "✓ Safe to delete"
+	case core.StatusDirty:
+		return "⚠ Unparked changes"
+	case core.StatusNeverParked:
+		return "✗ Never parked"
+	case core.StatusMissingLocal:
+		return "✗ Local copy missing"
+	default:
+		return status
+	}
+}
+
+// stateLabel returns the display text for a project state, the same in
+// every command that shows one
+func stateLabel(state string) string {
+	switch state {
+	case core.StateArchived:
+		return "Archived"
+	case core.StateGrabbing:
+		return "… Grabbing (unfinished)"
+	case core.StateGrabbedClean:
+		return "✓ Grabbed, clean"
+	case core.StateGrabbedDirty:
+		return "⚠ Grabbed, unparked changes"
+	case core.StateParking:
+		return "… Parking (unfinished)"
+	case core.StateConflicted:
+		return "✗ Conflicted: changed here and in the archive"
+	case core.StateMissingLocal:
+		return "✗ Local copy missing"
+	case core.StateMissingArchive:
+		return "✗ Archive copy missing"
+	default:
+		return state
+	}
+}
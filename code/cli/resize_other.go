@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package cli
+
+import "os"
+
+// notifyResize does nothing: there is no resize signal on this platform,
+// so the selector picks up a new size with the next key press
+func notifyResize(c chan<- os.Signal) (stop func()) {
+	return func() {}
+}
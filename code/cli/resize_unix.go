@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package cli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize relays terminal resizes (SIGWINCH) to c until stop is called
+func notifyResize(c chan<- os.Signal) (stop func()) {
+	signal.Notify(c, syscall.SIGWINCH)
+	return func() { signal.Stop(c) }
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func restoreCommand(g *Globals) *Command {
+	cmd := newCommand(g, "restore", "<project> [dest]", "List a project's kept archive versions or restore one")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr restore ml-pipeline",
+		"parkr restore ml-pipeline --version 1",
+		"parkr restore ml-pipeline --version 2026-03-15_093012 ./ml-pipeline-old",
+		"parkr restore ml-pipeline --version 2 --replace-archive",
+	}
+	version := cmd.Flags.String("version", "", "Restore `version`: a number counting back from the newest (1), or its name")
+	replace := cmd.Flags.Bool("replace-archive", false, "Sync the version over the archive copy instead of copying it to dest")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, 2); err != nil {
+			return err
+		}
+		if *version == "" {
+			if *replace || len(args) == 2 {
+				return usageErrorf("choose a version to restore with --version")
+			}
+			return VersionsCmd(ctx, g, args[0])
+		}
+		opts := core.RestoreOptions{Version: *version, ReplaceArchive: *replace, DryRun: g.DryRun}
+		if *replace && len(args) == 2 {
+			return usageErrorf("--replace-archive restores into the archive; drop the destination")
+		}
+		if len(args) == 2 {
+			opts.Dest = args[1]
+		}
+		return RestoreCmd(ctx, g, args[0], opts)
+	}
+	return cmd
+}
+
+// VersionsCmd lists the archive versions kept for a project, newest first
+func VersionsCmd(ctx context.Context, g *Globals, projectName string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	info, err := core.Info(ctx, sm, projectName)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		versions := info.Versions
+		if versions == nil {
+			versions = []core.ArchiveVersion{}
+		}
+		return printJSON(versions)
+	}
+	if len(info.Versions) == 0 {
+		fmt.Printf("No kept versions of '%s'. Set keep_versions to keep them when parking.\n", projectName)
+		return nil
+	}
+	fmt.Printf("%-4s %-19s  %-19s  %s\n", "#", "KEPT", "PARKED", "VERSION")
+	for i := len(info.Versions) - 1; i >= 0; i-- {
+		v := info.Versions[i]
+		fmt.Printf("%-4d %-19s  %-19s  %s\n", len(info.Versions)-i, formatTimestamp(&v.KeptAt), formatTimestamp(v.ParkedAt), filepath.Base(v.Path))
+	}
+	return nil
+}
+
+// RestoreCmd copies a kept version of a project to a local directory, or
+// syncs it over the archive copy after confirmation
+func RestoreCmd(ctx context.Context, g *Globals, projectName string, opts core.RestoreOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	if opts.ReplaceArchive && !opts.DryRun {
+		plan := opts
+		plan.DryRun = true
+		result, err := core.RestoreVersion(ctx, sm, projectName, plan)
+		if err != nil {
+			return err
+		}
+		if !confirm(g, fmt.Sprintf("Replace the archive copy at %s with version %s?", result.Dest, filepath.Base(result.Version.Path))) {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	}
+
+	result, err := core.RestoreVersion(ctx, sm, projectName, opts)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(result)
+	}
+	for _, w := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	name := filepath.Base(result.Version.Path)
+	switch {
+	case result.DryRun && result.ReplacedArchive:
+		fmt.Printf("Would replace the archive copy of '%s' at %s with version %s\n", projectName, result.Dest, name)
+	case result.DryRun:
+		fmt.Printf("Would copy version %s of '%s' to %s\n", name, projectName, result.Dest)
+	case result.ReplacedArchive:
+		if result.Kept != nil {
+			fmt.Printf("Kept the previous archive copy at %s\n", result.Kept.Path)
+		}
+		fmt.Printf("Replaced the archive copy of '%s' at %s with version %s\n", projectName, result.Dest, name)
+	default:
+		fmt.Printf("Copied version %s of '%s' to %s (not tracked by parkr)\n", name, projectName, result.Dest)
+	}
+	return nil
+}
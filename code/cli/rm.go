@@ -1,85 +1,116 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/jamespark/parkr/core"
 )
 
-// RmCmd removes the local copy of a project
-func RmCmd(projectName string, noHash bool, force bool) error {
-	sm := core.NewStateManager()
-	state, err := sm.Load()
-	if err != nil {
-		return err
+func rmCommand(g *Globals) *Command {
+	cmd := newCommand(g, "rm", "<project>...", "Remove local copies (keeps archive)")
+	cmd.Audited = true
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr rm --no-hash ml-pipeline",
+		"parkr --dry-run rm --no-hash ml-pipeline",
+		"parkr rm --no-hash 'experiment-2023-*'",
 	}
-
-	// Check if project is grabbed
-	project, exists := state.Projects[projectName]
-	if !exists || !project.IsGrabbed {
-		return fmt.Errorf("project '%s' is not currently grabbed", projectName)
+	noHash := cmd.Flags.Bool("no-hash", false, "Use mtime verification instead of the configured method")
+	force := cmd.Flags.Bool("force", false, "Delete without verification (dangerous)")
+	noTrash := cmd.Flags.Bool("no-trash", false, "Delete the local copy at once instead of moving it to the trash")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, -1); err != nil {
+			return err
+		}
+		projects, err := expandProjects(ctx, g, args, core.MatchGrabbed, "remove")
+		if err != nil || projects == nil {
+			return err
+		}
+		if len(projects) > 1 {
+			return RmAllCmd(ctx, g, projects, *noHash, *force, *noTrash)
+		}
+		return RmCmd(ctx, g, projects[0], *noHash, *force, *noTrash)
 	}
+	return cmd
+}
 
-	// Verify local path exists
-	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
-		// Local path doesn't exist, just update state
-		fmt.Printf("Warning: local path does not exist: %s\n", project.LocalPath)
-		project.IsGrabbed = false
-		if err := sm.Save(state); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
-		}
-		fmt.Printf("Updated state for '%s'\n", projectName)
-		return nil
+// RmCmd removes the local copy of a project
+func RmCmd(ctx context.Context, g *Globals, projectName string, noHash bool, force bool, noTrash bool) error {
+	if force && !g.JSON() {
+		fmt.Println("Warning: Skipping verification (--force)")
+	}
+	result, err := rmProject(ctx, g, projectName, noHash, force, noTrash)
+	if err != nil || !g.JSON() {
+		return err
 	}
+	return printJSON(result)
+}
 
-	// Safety verification
-	if !force {
-		if project.NoHashMode && !noHash {
-			return fmt.Errorf("project '%s' was parked with --no-hash. Use --no-hash or --force to delete", projectName)
+// RmAllCmd removes the local copies of several projects in turn,
+// continuing past failures, and summarises which were removed
+func RmAllCmd(ctx context.Context, g *Globals, projects []string, noHash bool, force bool, noTrash bool) error {
+	if force && !g.JSON() {
+		fmt.Println("Warning: Skipping verification (--force)")
+	}
+	return runBatch(ctx, g, "remove", "removed", projects, func(projectName string) (any, error) {
+		result, err := rmProject(ctx, g, projectName, noHash, force, noTrash)
+		if result == nil {
+			return nil, err
 		}
+		return result, err
+	})
+}
 
-		if noHash || project.NoHashMode {
-			// Mtime verification
-			if project.LastParkMtime == nil {
-				return fmt.Errorf("project '%s' has never been parked - cannot verify safety", projectName)
-			}
-
-			newestInfo, err := core.GetNewestMtime(project.LocalPath)
-			if err != nil {
-				return fmt.Errorf("failed to check local files: %w", err)
-			}
+// rmProject removes a project's local copy, printing the outcome as text
+// unless the output is JSON
+func rmProject(ctx context.Context, g *Globals, projectName string, noHash bool, force bool, noTrash bool) (*core.RmResult, error) {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
 
-			if newestInfo != nil && *newestInfo != nil {
-				currentMtime := (*newestInfo).ModTime()
-				if currentMtime.After(*project.LastParkMtime) {
-					return fmt.Errorf("project '%s' has been modified since last park (newest: %s, parked: %s). Park first or use --force",
-						projectName, currentMtime.Format("2006-01-02 15:04:05"), project.LastParkMtime.Format("2006-01-02 15:04:05"))
-				}
-			}
+	result, err := core.Rm(ctx, sm, projectName, core.RmOptions{
+		NoHash:  noHash,
+		Force:   force,
+		DryRun:  g.DryRun,
+		NoTrash: noTrash,
+	})
+	if err != nil || g.JSON() {
+		return result, err
+	}
 
-			fmt.Println("Mtime verification passed.")
+	if result.LocalMissing {
+		fmt.Printf("Warning: local path does not exist: %s\n", result.LocalPath)
+		if result.DryRun {
+			fmt.Printf("Would update state for '%s'\n", projectName)
 		} else {
-			// Hash verification would go here in Phase 2
-			fmt.Println("Hash verification not yet implemented - use --no-hash for mtime verification")
-			return fmt.Errorf("hash verification not available, use --no-hash")
+			fmt.Printf("Updated state for '%s'\n", projectName)
 		}
-	} else {
-		fmt.Println("Warning: Skipping verification (--force)")
+		return result, nil
 	}
 
-	// Delete local copy
-	fmt.Printf("Removing local copy at %s...\n", project.LocalPath)
-	if err := os.RemoveAll(project.LocalPath); err != nil {
-		return fmt.Errorf("failed to remove local copy: %w", err)
+	switch result.Verification {
+	case core.VerifyMtime:
+		fmt.Println("Mtime verification passed.")
+	case core.VerifyHash:
+		fmt.Println("Hash verification passed.")
+	case core.VerifyGit:
+		fmt.Println("Git verification passed.")
 	}
 
-	// Update state
-	project.IsGrabbed = false
-	if err := sm.Save(state); err != nil {
-		return fmt.Errorf("failed to update state: %w", err)
+	if result.DryRun {
+		fmt.Printf("Would remove local copy of '%s' at %s\n", projectName, result.LocalPath)
+		return result, nil
 	}
 
-	fmt.Printf("Successfully removed local copy of '%s'\n", projectName)
-	return nil
+	if result.Trashed != nil {
+		fmt.Printf("Moved local copy of '%s' at %s to the trash\n", projectName, result.LocalPath)
+		fmt.Printf("Run 'parkr trash restore %s' to bring it back\n", result.Trashed.ID)
+	} else {
+		fmt.Printf("Successfully removed local copy of '%s' at %s\n", projectName, result.LocalPath)
+	}
+	for _, w := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	return result, nil
 }
@@ -0,0 +1,398 @@
+package cli
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// selector describes a list shown with runSelector
+type selector struct {
+	Title string
+	// Target, if positive, is the amount of space the selection is
+	// measured against
+	Target int64
+	// Legend explains the columns and statuses in the help overlay
+	Legend []string
+	// Labels name the columns in plain output
+	Labels []string
+}
+
+// Keys understood by the selector
+const (
+	keyEscape    = 0x1b
+	keyEnter     = '\r'
+	keyNL        = '\n'
+	keyBackspace = 0x7f
+	keyCtrlH     = 0x08
+)
+
+// errNoTerminal is returned by runSelector when stdin can't be switched to
+// reading single keys
+var errNoTerminal = errors.New("failed to read keys from terminal")
+
+// selectorFooter is the one-line key summary shown under the list
+const selectorFooter = "space toggle · a all · / filter · enter confirm · q cancel · ? help"
+
+// filterFooter replaces selectorFooter while a filter is being typed
+const filterFooter = "type to filter · backspace delete · enter done"
+
+// chooseFromList lets the user change the list's selection and reports
+// whether they confirmed it: with the keyboard selector on a terminal,
+// otherwise, or for plain output, by reading row numbers from stdin
+func chooseFromList(g *Globals, s selector, list *core.MultiSelect) (bool, error) {
+	if isInteractive() && !g.Plain() {
+		ok, err := runSelector(s, list)
+		if !errors.Is(err, errNoTerminal) {
+			return ok, err
+		}
+		// A character device that isn't a terminal, such as /dev/null
+	}
+	return promptSelection(g, s, list, os.Stdin)
+}
+
+// promptSelection prints the list with numbered rows and reads one line
+// naming the rows to select: numbers and ranges such as "1 3 5-7", "all"
+// or "none". A blank line keeps the rows already selected; "q", or no
+// input at all, cancels.
+func promptSelection(g *Globals, s selector, list *core.MultiSelect, r io.Reader) (bool, error) {
+	items := list.Items()
+	widths := columnWidths(items)
+	digits := len(fmt.Sprint(len(items)))
+	fmt.Printf("%s\n\n", s.Title)
+	for i, it := range items {
+		if g.Plain() {
+			printSelectFields(s, i+1, it)
+			continue
+		}
+		fmt.Printf("  %*d. %s\n", digits, i+1, formatSelectItem(it, widths))
+	}
+	fmt.Println()
+	fmt.Println(selectionSummary(s, list))
+	keep := "blank keeps [x]"
+	if g.Plain() {
+		keep = "blank keeps the rows selected"
+	}
+	fmt.Printf("Rows to select (e.g. 1 3 5-7, all or none; %s; q cancels): ", keep)
+
+	// The answer isn't echoed when it comes from a pipe, so end the line
+	line, err := bufio.NewReader(r).ReadString('\n')
+	fmt.Println()
+	if err != nil && (err != io.EOF || line == "") {
+		return false, nil
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	switch answer {
+	case "":
+		return true, nil
+	case "q":
+		return false, nil
+	case "all", "none":
+		for i := range items {
+			list.SetSelected(i, answer == "all")
+		}
+		return true, nil
+	}
+
+	rows, err := parseRowNumbers(answer, len(items))
+	if err != nil {
+		return false, usageErrorf("invalid selection '%s': %v", answer, err)
+	}
+	chosen := make(map[int]bool)
+	for _, row := range rows {
+		if it := items[row-1]; it.Disabled {
+			return false, usageErrorf("row %d (%s) can't be selected: %s", row, it.Columns[0], it.Reason)
+		}
+		chosen[row-1] = true
+	}
+	for i := range items {
+		list.SetSelected(i, chosen[i])
+	}
+	return true, nil
+}
+
+// printSelectFields prints a numbered row as plain output, naming its
+// columns with the selector's labels
+func printSelectFields(s selector, row int, it core.SelectItem) {
+	fields := []string{"row", strconv.Itoa(row)}
+	for c, col := range it.Columns {
+		label := fmt.Sprintf("column %d", c+1)
+		if c < len(s.Labels) {
+			label = s.Labels[c]
+		}
+		fields = append(fields, label, unmarked(col))
+	}
+	selected := "no"
+	if it.Selected {
+		selected = "yes"
+	}
+	fields = append(fields, "selected", selected)
+	if it.Disabled {
+		fields = append(fields, "unavailable", cmp.Or(it.Reason, "yes"))
+	}
+	printFields(fields...)
+}
+
+// parseRowNumbers parses row numbers and ranges from 1 to n, separated by
+// spaces or commas
+func parseRowNumbers(text string, n int) ([]int, error) {
+	var rows []int
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == ',' }) {
+		from, to, isRange := strings.Cut(field, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a row number", field)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil || last < first {
+				return nil, fmt.Errorf("'%s' is not a range of rows", field)
+			}
+		}
+		if first < 1 || last > n {
+			return nil, fmt.Errorf("rows are numbered 1 to %d", n)
+		}
+		for row := first; row <= last; row++ {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// runSelector shows the list for toggling with the keyboard until the user
+// confirms (true) or cancels (false). It is redrawn to fit whenever the
+// terminal is resized.
+func runSelector(s selector, list *core.MultiSelect) (bool, error) {
+	restore, err := rawTerminal()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errNoTerminal, err)
+	}
+	defer restore()
+	resized := make(chan os.Signal, 1)
+	defer notifyResize(resized)()
+
+	in := bufio.NewReader(os.Stdin)
+	showHelp, filtering, redraw := false, false, true
+	for {
+		if redraw {
+			rows, cols := terminalSize()
+			if showHelp {
+				renderSelectorHelp(s, cols)
+			} else {
+				renderSelector(s, list, filtering, rows, cols)
+			}
+		}
+
+		// Reads time out so a resize is noticed between key presses
+		key, err := in.ReadByte()
+		if err == io.EOF {
+			select {
+			case <-resized:
+				redraw = true
+			default:
+				redraw = false
+			}
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		redraw = true
+		if showHelp {
+			// Any key closes the help overlay
+			showHelp = false
+			continue
+		}
+		if filtering {
+			switch filter := list.Filter(); {
+			case key == keyEnter || key == keyNL || key == keyEscape:
+				filtering = false
+			case key == keyBackspace || key == keyCtrlH:
+				if filter != "" {
+					list.SetFilter(filter[:len(filter)-1])
+				}
+			case key >= ' ' && key <= '~':
+				list.SetFilter(filter + string(key))
+			}
+			continue
+		}
+
+		switch key {
+		case '?':
+			showHelp = true
+		case '/':
+			filtering = true
+		case ' ', 'x':
+			list.Toggle()
+		case 'a':
+			list.ToggleAll()
+		case 'j':
+			list.Move(1)
+		case 'k':
+			list.Move(-1)
+		case keyEscape:
+			// Arrow keys arrive as ESC [ A (up) or ESC [ B (down)
+			if b, _ := in.ReadByte(); b != '[' {
+				continue
+			}
+			switch b, _ := in.ReadByte(); b {
+			case 'A':
+				list.Move(-1)
+			case 'B':
+				list.Move(1)
+			}
+		case keyEnter, keyNL:
+			fmt.Println()
+			return true, nil
+		case 'q':
+			fmt.Println()
+			return false, nil
+		}
+	}
+}
+
+// renderSelector redraws the list to fit a terminal of rows by cols,
+// scrolling it to keep the cursor in view
+func renderSelector(s selector, list *core.MultiSelect, filtering bool, rows, cols int) {
+	var head, body, foot []string
+	head = append(head, s.Title, "")
+	if filtering || list.Filter() != "" {
+		head = append(head, "Filter: "+list.Filter(), "")
+	}
+
+	// Widths are measured over all items, so the layout doesn't shift as
+	// the filter changes
+	items := list.Items()
+	widths := columnWidths(items)
+
+	// Show as many rows as fit between the header and the three footer
+	// lines, centred on the cursor where possible
+	visible := list.Visible()
+	height := max(rows-len(head)-3, 1)
+	top := min(max(list.Cursor()-height/2, 0), max(len(visible)-height, 0))
+	bottom := min(top+height, len(visible))
+	digits := len(fmt.Sprint(len(visible)))
+
+	for row := top; row < bottom; row++ {
+		it := items[visible[row]]
+		pointer := " "
+		if row == list.Cursor() {
+			pointer = ">"
+		}
+		body = append(body, fmt.Sprintf("%s %*d. %s", pointer, digits, row+1, formatSelectItem(it, widths)))
+	}
+	if len(visible) == 0 {
+		body = append(body, "  Nothing matches the filter.")
+	}
+
+	selected := selectionSummary(s, list)
+	if top > 0 || bottom < len(visible) {
+		selected += fmt.Sprintf(" · rows %d-%d of %d", top+1, bottom, len(visible))
+	}
+	foot = append(foot, "", selected)
+	if filtering {
+		foot = append(foot, filterFooter)
+	} else {
+		foot = append(foot, selectorFooter)
+	}
+
+	drawScreen(slices.Concat(head, body, foot), cols)
+}
+
+// columnWidths returns the widest value of each column over items
+func columnWidths(items []core.SelectItem) []int {
+	var widths []int
+	for _, it := range items {
+		for c, col := range it.Columns {
+			if c == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[c] = max(widths[c], len([]rune(col)))
+		}
+	}
+	return widths
+}
+
+// formatSelectItem formats an item's checkbox and columns, padding each
+// column but the last to widths, and the reason a disabled item can't be
+// selected
+func formatSelectItem(it core.SelectItem, widths []int) string {
+	box := "[ ]"
+	switch {
+	case it.Disabled:
+		box = "[-]"
+	case it.Selected:
+		box = "[x]"
+	}
+	var fields []string
+	for c, col := range it.Columns {
+		if c < len(it.Columns)-1 {
+			col += strings.Repeat(" ", widths[c]-len([]rune(col)))
+		}
+		fields = append(fields, col)
+	}
+	line := box + " " + strings.TrimRight(strings.Join(fields, " "), " ")
+	if it.Disabled && it.Reason != "" {
+		line += " (" + it.Reason + ")"
+	}
+	return line
+}
+
+// selectionSummary describes how many items are selected and their size
+func selectionSummary(s selector, list *core.MultiSelect) string {
+	summary := fmt.Sprintf("Selected: %d, %s", len(list.Selected()), core.FormatSize(list.SelectedSize()))
+	if s.Target > 0 {
+		summary += " of " + core.FormatSize(s.Target) + " needed"
+	}
+	return summary
+}
+
+// drawScreen clears the terminal and prints lines, cutting each to cols so
+// none wraps and pushes the top of the screen out of view. The last line
+// isn't ended, so a screenful doesn't scroll.
+func drawScreen(lines []string, cols int) {
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	for i, line := range lines {
+		if r := []rune(line); len(r) > cols {
+			line = string(r[:max(cols-1, 0)]) + "…"
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(line)
+	}
+	fmt.Print(b.String())
+}
+
+// renderSelectorHelp draws the help overlay listing keys and the list's
+// legend, cut to cols
+func renderSelectorHelp(s selector, cols int) {
+	lines := []string{
+		"KEYS:",
+		"  up / k        Move up",
+		"  down / j      Move down",
+		"  space / x     Select or deselect the row under the cursor",
+		"  a             Select all rows shown, or deselect them if all are selected",
+		"  /             Type a filter; only rows whose name contains it are shown",
+		"  enter         Confirm the selection",
+		"  q             Cancel without changing anything",
+		"  ?             Show or hide this help",
+		"",
+		"Rows marked [-] can't be selected; the reason follows them.",
+	}
+	if len(s.Legend) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, s.Legend...)
+	}
+	lines = append(lines, "", "Press any key to return.")
+	drawScreen(lines, cols)
+}
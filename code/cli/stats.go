@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func statsCommand(g *Globals) *Command {
+	cmd := newCommand(g, "stats", "", "Show recorded local and archive usage")
+	cmd.Examples = []string{
+		"parkr stats --trend",
+		"parkr stats --trend --period month --count 6",
+	}
+	trend := cmd.Flags.Bool("trend", false, "Show usage growth over recent periods")
+	period := cmd.Flags.String("period", core.PeriodWeek, "Trend `period`: week or month")
+	count := cmd.Flags.Int("count", 12, "Number of periods to show with --trend")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		if *count <= 0 {
+			return usageErrorf("--count must be positive")
+		}
+		return StatsCmd(ctx, g, StatsOptions{Trend: *trend, Period: *period, Count: *count})
+	}
+	return cmd
+}
+
+// StatsOptions holds the flags accepted by stats
+type StatsOptions struct {
+	Trend  bool
+	Period string
+	Count  int
+}
+
+// StatsCmd shows usage recorded by report (local) and list (archive)
+func StatsCmd(ctx context.Context, g *Globals, opts StatsOptions) error {
+	sm := g.StateManager()
+	samples, err := core.LoadSizeHistory(sm.StatePath())
+	if err != nil {
+		return err
+	}
+
+	if !opts.Trend {
+		return printLatestSizes(g, samples)
+	}
+
+	points, err := core.SizeTrend(samples, opts.Period, opts.Count, time.Now())
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	if g.JSON() {
+		return printJSON(points)
+	}
+
+	if len(samples) == 0 {
+		fmt.Println("No usage recorded yet. Run 'parkr report' and 'parkr list' to record local and archive totals.")
+		return nil
+	}
+
+	if !g.Plain() {
+		fmt.Printf("%-12s %-12s %-12s %-12s %s\n", strings.ToUpper(opts.Period), "LOCAL", "CHANGE", "ARCHIVE", "CHANGE")
+		fmt.Println(strings.Repeat("-", 62))
+	}
+	for i, p := range points {
+		var prevLocal, prevArchive *int64
+		if i > 0 {
+			prevLocal, prevArchive = points[i-1].LocalTotal, points[i-1].ArchiveTotal
+		}
+		if g.Plain() {
+			printFields(opts.Period, p.Start.Format("2006-01-02"),
+				"local", formatOptionalSize(p.LocalTotal), "local change", formatSizeChange(prevLocal, p.LocalTotal),
+				"archive", formatOptionalSize(p.ArchiveTotal), "archive change", formatSizeChange(prevArchive, p.ArchiveTotal))
+			continue
+		}
+		fmt.Printf("%-12s %-12s %-12s %-12s %s\n", p.Start.Format("2006-01-02"),
+			formatOptionalSize(p.LocalTotal), formatSizeChange(prevLocal, p.LocalTotal),
+			formatOptionalSize(p.ArchiveTotal), formatSizeChange(prevArchive, p.ArchiveTotal))
+	}
+	return nil
+}
+
+// printLatestSizes prints the most recent local and archive totals
+func printLatestSizes(g *Globals, samples []core.SizeSample) error {
+	local, archive := core.LatestSizes(samples)
+
+	if g.JSON() {
+		return printJSON(struct {
+			Local   *core.SizeSample `json:"local"`
+			Archive *core.SizeSample `json:"archive"`
+		}{local, archive})
+	}
+
+	if local == nil {
+		fmt.Println("Local usage:   not recorded (run 'parkr report')")
+	} else {
+		fmt.Printf("Local usage:   %s (as of %s)\n", core.FormatSize(*local.LocalTotal), local.Time.Format("2006-01-02 15:04"))
+	}
+	if archive == nil {
+		fmt.Println("Archive usage: not recorded (run 'parkr list')")
+	} else {
+		fmt.Printf("Archive usage: %s (as of %s)\n", core.FormatSize(*archive.ArchiveTotal), archive.Time.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// recordSizeSample appends a usage sample to the history, warning (in
+// verbose mode) rather than failing the command on error. Dry runs record
+// nothing.
+func recordSizeSample(g *Globals, statePath, source string, local, archive *int64) {
+	if g.DryRun {
+		return
+	}
+	sample := core.SizeSample{Time: time.Now(), Source: source, LocalTotal: local, ArchiveTotal: archive}
+	if err := core.RecordSizeSample(statePath, sample); err != nil {
+		g.logf("Warning: failed to record size history: %v", err)
+	}
+}
+
+// recordParkSample appends how much a park changed the archive's size to
+// the usage history, when the project's history has an earlier size to
+// compare with
+func recordParkSample(g *Globals, statePath string, result *core.ParkResult) {
+	delta, ok := core.ParkSizeDelta(statePath, result.Project, result.Size, result.ParkedAt)
+	if !ok || delta == 0 {
+		return
+	}
+	sample := core.SizeSample{Time: result.ParkedAt, Source: "park", ArchiveDelta: &delta}
+	if err := core.RecordSizeSample(statePath, sample); err != nil {
+		g.logf("Warning: failed to record size history: %v", err)
+	}
+}
+
+// formatOptionalSize formats a size that may not have been measured
+func formatOptionalSize(size *int64) string {
+	if size == nil {
+		return "-"
+	}
+	return core.FormatSize(*size)
+}
+
+// formatSizeChange formats the difference between two optional sizes
+func formatSizeChange(prev, cur *int64) string {
+	if prev == nil || cur == nil {
+		return "-"
+	}
+	delta := *cur - *prev
+	switch {
+	case delta > 0:
+		return "+" + core.FormatSize(delta)
+	case delta < 0:
+		return "-" + core.FormatSize(-delta)
+	default:
+		return "0"
+	}
+}
@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func statusCommand(g *Globals) *Command {
+	cmd := newCommand(g, "status", "", "Show grabbed projects and whether they have unparked work")
+	cmd.Examples = []string{
+		"parkr status",
+		"parkr status --sort size --min-size 1G",
+		"parkr status --check",
+		"parkr status --watch --interval 10s",
+	}
+	sortBy := cmd.Flags.String("sort", core.SortName, "Sort by `field`: modified, size or name")
+	minSize := cmd.Flags.String("min-size", "", "Hide projects smaller than `size` (e.g. 1G)")
+	check := cmd.Flags.Bool("check", false, "Also check each archive copy, showing those updated elsewhere or missing")
+	watch := cmd.Flags.Bool("watch", false, "Redraw the status every interval until interrupted")
+	interval := cmd.Flags.Duration("interval", 3*time.Second, "Time between redraws with --watch")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		threshold, err := parseMinSize(*minSize)
+		if err != nil {
+			return err
+		}
+		if *interval <= 0 {
+			return usageErrorf("--interval must be positive")
+		}
+		if *watch && g.JSON() {
+			return usageErrorf("--watch can't be combined with --format json")
+		}
+		opts := StatusOptions{SortBy: *sortBy, MinSize: threshold, Check: *check}
+		if *watch {
+			return WatchStatusCmd(ctx, g, opts, *interval)
+		}
+		return StatusCmd(ctx, g, opts)
+	}
+	return cmd
+}
+
+// StatusOptions holds the flags accepted by status
+type StatusOptions struct {
+	SortBy  string
+	MinSize int64
+	Check   bool
+}
+
+// StatusCmd shows all grabbed projects with their sync status
+func StatusCmd(ctx context.Context, g *Globals, opts StatusOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	report, err := core.BuildReport(ctx, sm, opts.SortBy)
+	if err != nil {
+		return err
+	}
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	quotas, err := core.QuotaUtilization(state, report.Categories)
+	if err != nil {
+		return err
+	}
+	report.FilterMinSize(opts.MinSize)
+	if opts.Check {
+		if err := core.CheckArchiveUpdates(ctx, state, report.Projects); err != nil {
+			return err
+		}
+	}
+
+	if g.JSON() {
+		return printJSON(report.Projects)
+	}
+
+	if len(report.Projects) == 0 {
+		if opts.MinSize > 0 {
+			fmt.Printf("No grabbed projects of %s or more.\n", core.FormatSize(opts.MinSize))
+		} else {
+			fmt.Println("No projects are currently grabbed.")
+		}
+		printTransfers(state.Transfers)
+		return nil
+	}
+
+	printProjectTable(g, report.Projects)
+	if len(quotas) > 0 {
+		fmt.Println()
+		printQuotaBars(g, quotas)
+	}
+	if opts.Check {
+		fmt.Println()
+		printArchiveUpdates(report.Projects)
+	}
+	fmt.Println()
+	printStatusTotals(report)
+	printTransfers(state.Transfers)
+	return nil
+}
+
+// printTransfers lists the grabs and parks that are running or were
+// interrupted, which the same command resumes
+func printTransfers(transfers map[string]*core.Transfer) {
+	if len(transfers) == 0 {
+		return
+	}
+	names := make([]string, 0, len(transfers))
+	for name := range transfers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println()
+	fmt.Println("UNFINISHED TRANSFERS (running, or interrupted; run the command again to resume):")
+	for _, name := range names {
+		t := transfers[name]
+		fmt.Printf("  parkr %s %s  (to %s, started %s)\n", t.Op, name, t.Dest, t.StartedAt.Format("2006-01-02 15:04"))
+	}
+}
+
+// WatchStatusCmd clears the screen and prints the status every interval
+// until ctx is cancelled. An error is shown in place of the table, so a
+// state file caught mid-update doesn't end the watch. Plain output isn't
+// cleared; each status follows the last after a blank line.
+func WatchStatusCmd(ctx context.Context, g *Globals, opts StatusOptions, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for first := true; ; first = false {
+		switch {
+		case !g.Plain():
+			fmt.Print("\033[H\033[2J")
+		case !first:
+			fmt.Println()
+		}
+		fmt.Printf("Every %s: parkr status    %s\n\n", interval, time.Now().Format("2006-01-02 15:04:05"))
+		if err := StatusCmd(ctx, g, opts); err != nil && ctx.Err() == nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printStatusTotals prints the local usage of the listed projects, how many
+// are safe to delete or have unparked work, and the space prune could free
+func printStatusTotals(report *core.Report) {
+	fmt.Printf("TOTAL: %d project(s), %s local; %d safe to delete, %d with unparked changes\n",
+		len(report.Projects), core.FormatSize(report.LocalTotal), len(report.Candidates), report.CountStatus(core.StatusDirty))
+	if report.Recoverable > 0 {
+		fmt.Printf("RECOVERABLE NOW: %s (see 'parkr report --candidates')\n", core.FormatSize(report.Recoverable))
+	} else {
+		fmt.Println("RECOVERABLE NOW: nothing is safe to delete")
+	}
+}
+
+// printArchiveUpdates lists projects whose archive copy changed elsewhere
+// or is missing
+func printArchiveUpdates(entries []core.ReportEntry) {
+	var updated, missing, unknown []string
+	for _, e := range entries {
+		switch e.ArchiveStatus {
+		case core.ArchiveUpdated:
+			updated = append(updated, e.Name)
+		case core.ArchiveMissing:
+			missing = append(missing, e.Name)
+		case core.ArchiveUnknown:
+			unknown = append(unknown, e.Name)
+		}
+	}
+	if len(updated) == 0 {
+		fmt.Println("No archive copies were updated elsewhere.")
+	} else {
+		fmt.Println("ARCHIVE UPDATED ELSEWHERE (run parkr pull <project>):")
+		for _, name := range updated {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("ARCHIVE COPY MISSING: %s\n", strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		fmt.Printf("Could not check (remote master, or never parked): %s\n", strings.Join(unknown, ", "))
+	}
+}
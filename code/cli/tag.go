@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func tagCommand(g *Globals) *Command {
+	cmd := newCommand(g, "tag", "<project> [tag...]", "Show or change a project's tags")
+	cmd.Examples = []string{
+		"parkr tag exp-lr-0.01",
+		"parkr tag exp-lr-0.01 lr-sweep",
+		"parkr tag --remove exp-lr-0.01 lr-sweep",
+	}
+	remove := cmd.Flags.Bool("remove", false, "Remove the given tags instead of adding them")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 1, -1); err != nil {
+			return err
+		}
+		return TagCmd(ctx, g, args[0], args[1:], *remove)
+	}
+	return cmd
+}
+
+// TagCmd adds (or with remove, removes) tags on a project and prints the
+// resulting tags
+func TagCmd(ctx context.Context, g *Globals, projectName string, tags []string, remove bool) error {
+	sm := g.StateManager()
+
+	var add, del []string
+	if remove {
+		del = tags
+	} else {
+		add = tags
+	}
+	current, err := core.UpdateTags(sm, projectName, add, del)
+	if err != nil {
+		return err
+	}
+
+	if g.JSON() {
+		if current == nil {
+			current = []string{}
+		}
+		return printJSON(current)
+	}
+	if len(current) == 0 {
+		fmt.Printf("%s has no tags\n", projectName)
+		return nil
+	}
+	fmt.Printf("%s: %s\n", projectName, strings.Join(current, ", "))
+	return nil
+}
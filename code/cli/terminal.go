@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// rawTerminal switches the terminal on stdin to unbuffered, unechoed input
+// so single key presses can be read. Reads wait at most a tenth of a second
+// for a key, returning io.EOF if none came, so callers can notice other
+// events such as a resize. The returned function restores the previous
+// settings.
+func rawTerminal() (restore func(), err error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "min", "0", "time", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(saved) }, nil
+}
+
+// terminalSize returns the rows and columns of the terminal on stdin,
+// falling back to 24x80 if it can't be read
+func terminalSize() (rows, cols int) {
+	out, err := stty("size")
+	if err == nil {
+		if f := strings.Fields(out); len(f) == 2 {
+			rows, _ = strconv.Atoi(f[0])
+			cols, _ = strconv.Atoi(f[1])
+		}
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// stty runs stty against the terminal on stdin and returns its output
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
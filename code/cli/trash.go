@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func trashCommand(g *Globals) *Command {
+	cmd := newCommand(g, "trash", "[list | restore <id|project> [dest] | empty]", "List, restore or empty the local copies rm moved to the trash")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr trash",
+		"parkr trash restore ml-pipeline",
+		"parkr trash restore 2026-03-15_093012 ~/code/ml-pipeline-old",
+		"parkr trash empty --expired",
+	}
+	expired := cmd.Flags.Bool("expired", false, "With empty, only remove copies older than local_trash_days")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		action := "list"
+		if len(args) > 0 {
+			action = args[0]
+		}
+		if *expired && action != "empty" {
+			return usageErrorf("--expired only applies to trash empty")
+		}
+		switch action {
+		case "list":
+			if err := requireArgs(cmd, args, 0, 1); err != nil {
+				return err
+			}
+			return TrashListCmd(ctx, g)
+		case "restore":
+			if err := requireArgs(cmd, args, 2, 3); err != nil {
+				return err
+			}
+			dest := ""
+			if len(args) == 3 {
+				dest = args[2]
+			}
+			return TrashRestoreCmd(ctx, g, args[1], dest)
+		case "empty":
+			if err := requireArgs(cmd, args, 1, 1); err != nil {
+				return err
+			}
+			return TrashEmptyCmd(ctx, g, *expired)
+		default:
+			return usageErrorf("unknown trash action '%s'", action)
+		}
+	}
+	return cmd
+}
+
+// TrashListCmd lists the local copies in the trash removed through the
+// selected state file, newest first
+func TrashListCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	items, err := core.ListTrash(state.TrashRoots(), sm.StatePath())
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		if items == nil {
+			items = []core.TrashedCopy{}
+		}
+		return printJSON(items)
+	}
+	if len(items) == 0 {
+		fmt.Println("The trash is empty.")
+		return nil
+	}
+	fmt.Printf("%-22s %-24s %-12s %-16s %s\n", "ID", "PROJECT", "SIZE", "TRASHED", "FROM")
+	var total int64
+	for _, item := range items {
+		fmt.Printf("%-22s %-24s %-12s %-16s %s\n", item.ID, item.Project, formatSizeOrUnknown(item.Size), core.FormatAge(&item.TrashedAt), item.Path)
+		total += max(item.Size, 0)
+	}
+	fmt.Printf("\nTOTAL: %d copy(s), %s\n", len(items), core.FormatSize(total))
+	return nil
+}
+
+// TrashRestoreCmd moves a copy out of the trash, to where it was removed
+// from unless dest is given
+func TrashRestoreCmd(ctx context.Context, g *Globals, spec, dest string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	result, err := core.RestoreTrash(ctx, sm, spec, dest, g.DryRun)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(result)
+	}
+	if result.DryRun {
+		fmt.Printf("Would restore '%s' (trashed %s) to %s\n", result.Item.Project, result.Item.ID, result.Dest)
+		return nil
+	}
+	fmt.Printf("Restored '%s' (trashed %s) to %s\n", result.Item.Project, result.Item.ID, result.Dest)
+	if result.Tracked {
+		fmt.Printf("'%s' is grabbed again at %s\n", result.Item.Project, result.Dest)
+	}
+	return nil
+}
+
+// TrashEmptyCmd permanently removes copies from the trash, all of them or
+// only the expired ones, after confirmation
+func TrashEmptyCmd(ctx context.Context, g *Globals, expiredOnly bool) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	days := 0
+	if expiredOnly {
+		if days = state.Settings.LocalTrashRetention(); days == 0 {
+			return fmt.Errorf("local_trash_days is off, so no copy has expired")
+		}
+	}
+
+	roots := state.TrashRoots()
+	plan, err := core.EmptyTrash(roots, sm.StatePath(), days, true)
+	if err != nil {
+		return err
+	}
+	if len(plan.Removed) == 0 {
+		if g.JSON() {
+			return printJSON(plan)
+		}
+		fmt.Println("Nothing to remove from the trash.")
+		return nil
+	}
+	if !g.DryRun && !confirm(g, fmt.Sprintf("Permanently delete %d copy(s) (%s) from the trash?", len(plan.Removed), core.FormatSize(plan.Freed))) {
+		fmt.Println("Cancelled.")
+		return nil
+	}
+
+	result := plan
+	if !g.DryRun {
+		if result, err = core.EmptyTrash(roots, sm.StatePath(), days, false); err != nil {
+			return err
+		}
+	}
+	if g.JSON() {
+		return printJSON(result)
+	}
+	verb := "Removed"
+	if result.DryRun {
+		verb = "Would remove"
+	}
+	for _, item := range result.Removed {
+		fmt.Printf("%s %s (%s, %s)\n", verb, item.ID, item.Project, formatSizeOrUnknown(item.Size))
+	}
+	if result.DryRun {
+		fmt.Printf("Would free %s\n", core.FormatSize(result.Freed))
+	} else {
+		fmt.Printf("Freed %s\n", core.FormatSize(result.Freed))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func undoCommand(g *Globals) *Command {
+	cmd := newCommand(g, "undo", "", "Undo the last rm, moving the local copy back from the trash")
+	cmd.Locked = true
+	cmd.Examples = []string{
+		"parkr undo --dry-run",
+		"parkr undo",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 0); err != nil {
+			return err
+		}
+		return UndoCmd(ctx, g)
+	}
+	return cmd
+}
+
+// UndoCmd reverts the latest journaled removal after confirmation
+func UndoCmd(ctx context.Context, g *Globals) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	plan, err := core.Undo(ctx, sm, true)
+	if errors.Is(err, core.ErrTrashNotFound) && !g.DryRun {
+		// The real undo drops the operation from the journal
+		_, err = core.Undo(ctx, sm, false)
+	}
+	if err != nil {
+		return err
+	}
+	if !g.DryRun {
+		if !g.JSON() {
+			printUndoPlan(plan)
+		}
+		if !confirm(g, fmt.Sprintf("Undo this %s?", plan.Op)) {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	}
+
+	result := plan
+	if !g.DryRun {
+		result, err = core.Undo(ctx, sm, false)
+		if result == nil {
+			return err
+		}
+	}
+	if g.JSON() {
+		if jsonErr := printJSON(result); jsonErr != nil {
+			return jsonErr
+		}
+		return err
+	}
+	if result.DryRun {
+		printUndoPlan(result)
+		return nil
+	}
+	for _, e := range result.Restored {
+		fmt.Printf("Restored '%s' to %s; it is grabbed again\n", e.Project, e.Trashed.Path)
+	}
+	return err
+}
+
+// printUndoPlan lists the local copies an undo moves back
+func printUndoPlan(result *core.UndoResult) {
+	fmt.Printf("Last operation: %s at %s\n", result.Op, formatTimestamp(&result.Restored[0].Time))
+	for _, e := range result.Restored {
+		fmt.Printf("  %s (%s) back to %s\n", e.Project, formatSizeOrUnknown(e.Trashed.Size), e.Trashed.Path)
+	}
+}
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func verifyCommand(g *Globals) *Command {
+	cmd := newCommand(g, "verify", "[project...]", "Check state against the archive and local copies")
+	cmd.Examples = []string{
+		"parkr verify",
+		"parkr verify --scrub ml-pipeline",
+		"parkr verify --scrub --sample 100",
+		"parkr verify --json",
+		"parkr verify --interactive",
+	}
+	scrub := cmd.Flags.Bool("scrub", false, "Also read and hash archive copies to check their contents")
+	sample := cmd.Flags.Int("sample", 0, "With --scrub, check only `n` random files of each archive copy that has checksums")
+	jsonOut := cmd.Flags.Bool("json", false, "Print findings as JSON with their check, severity and paths (same as --format json)")
+	interactive := cmd.Flags.Bool("interactive", false, "Step through the findings and apply suggested fixes")
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if *jsonOut {
+			g.Format = FormatJSON
+		}
+		if *interactive && (g.JSON() || !isInteractive()) {
+			return usageErrorf("--interactive needs a terminal and text output")
+		}
+		if *sample < 0 {
+			return usageErrorf("--sample can't be negative")
+		}
+		if *sample > 0 && !*scrub {
+			return usageErrorf("--sample needs --scrub")
+		}
+		opts := core.VerifyOptions{Projects: args, Scrub: *scrub, Sample: *sample}
+		if *interactive {
+			return VerifyRepairCmd(ctx, g, opts)
+		}
+		return VerifyCmd(ctx, g, opts)
+	}
+	return cmd
+}
+
+// VerifyCmd reports inconsistencies between state, archive and local disk
+func VerifyCmd(ctx context.Context, g *Globals, opts core.VerifyOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	report, err := core.Verify(ctx, sm, opts)
+	if err != nil {
+		return err
+	}
+
+	if g.JSON() {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range report.Findings {
+			mark := "✗"
+			if f.Severity == core.SeverityWarning {
+				mark = "!"
+			}
+			fmt.Printf("%s%s: %s\n", g.mark(mark), f.Project, f.Message)
+		}
+		if opts.Scrub {
+			fmt.Printf("Scrubbed %d archive copy(ies).\n", len(report.Scrubbed))
+		}
+		if len(report.Encrypted) > 0 {
+			fmt.Printf("%d archive copy(ies) are encrypted.\n", len(report.Encrypted))
+		}
+		if report.Ignored > 0 {
+			fmt.Printf("%d finding(s) ignored by verify_severity.\n", report.Ignored)
+		}
+		switch {
+		case report.Warnings > 0 && report.OK():
+			fmt.Printf("Checked %d project(s): %d warning(s), no errors.\n", report.Checked, report.Warnings)
+		case report.OK():
+			fmt.Printf("Checked %d project(s): no problems found.\n", report.Checked)
+		}
+	}
+
+	if !report.OK() {
+		return fmt.Errorf("checked %d project(s): %d error(s), %d warning(s) found", report.Checked, report.Errors, report.Warnings)
+	}
+	return nil
+}
+
+// VerifyRepairCmd runs verify and steps through its findings, offering the
+// repairs core suggests for each and applying the one chosen. It fails if
+// any errors are left unfixed.
+func VerifyRepairCmd(ctx context.Context, g *Globals, opts core.VerifyOptions) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	report, err := core.Verify(ctx, sm, opts)
+	if err != nil {
+		return err
+	}
+	if len(report.Findings) == 0 {
+		fmt.Printf("Checked %d project(s): no problems found.\n", report.Checked)
+		return nil
+	}
+
+	fixed, errorsLeft := 0, 0
+	unfixed := func(f core.VerifyFinding) {
+		if f.Severity == core.SeverityError {
+			errorsLeft++
+		}
+	}
+	for i, f := range report.Findings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fmt.Printf("\n[%d/%d] %s %s: %s\n", i+1, len(report.Findings), f.Severity, f.Project, f.Message)
+		repairs, err := core.SuggestRepairs(sm, f)
+		if err != nil {
+			return err
+		}
+		if f.Check == core.CheckLocalMissing {
+			repairs = append(repairs, core.Repair{Action: core.RepairAdopt, Description: "relink to another path"})
+		}
+		if len(repairs) == 0 {
+			fmt.Println("  No automatic fix; skipping.")
+			unfixed(f)
+			continue
+		}
+		for n, r := range repairs {
+			fmt.Printf("  %d) %s\n", n+1, r.Description)
+		}
+		fmt.Println("  s) skip    q) quit")
+
+		answer := ask("Fix", "s")
+		if answer == "q" {
+			for _, rest := range report.Findings[i:] {
+				unfixed(rest)
+			}
+			break
+		}
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(repairs) {
+			if answer != "s" {
+				fmt.Printf("  Unknown choice '%s'; skipping.\n", answer)
+			}
+			unfixed(f)
+			continue
+		}
+		repair := repairs[n-1]
+		if repair.Action == core.RepairAdopt && repair.Path == "" {
+			if repair.Path = ask("Path", ""); repair.Path == "" {
+				fmt.Println("  No path given; skipping.")
+				unfixed(f)
+				continue
+			}
+		}
+		if g.DryRun {
+			fmt.Printf("  Would %s\n", repair.Description)
+			unfixed(f)
+			continue
+		}
+		if err := core.ApplyRepair(sm, f.Project, repair); err != nil {
+			fmt.Printf("  Failed: %v\n", err)
+			unfixed(f)
+			continue
+		}
+		fmt.Println("  Fixed.")
+		fixed++
+	}
+
+	fmt.Printf("\nApplied %d fix(es).\n", fixed)
+	if errorsLeft > 0 {
+		return fmt.Errorf("%d error(s) left unfixed", errorsLeft)
+	}
+	return nil
+}
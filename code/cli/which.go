@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jamespark/parkr/core"
+)
+
+func whichCommand(g *Globals) *Command {
+	cmd := newCommand(g, "which", "[path]", "Show which project a file or directory belongs to")
+	cmd.Examples = []string{
+		"parkr which",
+		"parkr which ~/PycharmProjects/ml-pipeline/src/train.py",
+		"parkr --format json which /Volumes/Extra/project-archive/code/webapp",
+	}
+	cmd.Run = func(ctx context.Context, args []string) error {
+		if err := requireArgs(cmd, args, 0, 1); err != nil {
+			return err
+		}
+		path := "."
+		if len(args) == 1 {
+			path = args[0]
+		}
+		return WhichCmd(ctx, g, path)
+	}
+	return cmd
+}
+
+// WhichCmd prints the project a path belongs to, the copy it is in, and the
+// project's status and locations
+func WhichCmd(ctx context.Context, g *Globals, path string) error {
+	sm := g.StateManager()
+	g.logf("Using state file %s", sm.StatePath())
+
+	which, err := core.Which(ctx, sm, path)
+	if err != nil {
+		return err
+	}
+	if g.JSON() {
+		return printJSON(which)
+	}
+
+	fmt.Printf("Project: %s\n", which.Name)
+	fmt.Printf("Path: %s (%s copy, %s)\n", which.Path, which.Copy, which.Relative)
+	fmt.Printf("Category: %s (master %s)\n", which.Category, which.Master)
+	status := stateLabel(which.State)
+	if g.Plain() {
+		status = unmarked(status)
+	}
+	fmt.Printf("Status: %s\n", status)
+	fmt.Printf("Archive: %s\n", which.ArchivePath)
+	if which.Grabbed {
+		fmt.Printf("Local: %s\n", which.LocalPath)
+	} else {
+		fmt.Println("Local: not grabbed")
+	}
+	return nil
+}
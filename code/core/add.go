@@ -0,0 +1,641 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AddOptions controls how a local project is added to the archive
+type AddOptions struct {
+	// Category overrides the detected category
+	Category string
+	// Master archives the project in this master instead of the default
+	// one
+	Master string
+	// Move deletes the local copy once the archive copy is written and
+	// verified against it
+	Move bool
+	// DryRun reports the plan and any conflicts without copying anything
+	DryRun bool
+	// Exclude leaves paths out of the archive, using VolatileFile pattern
+	// syntax. They are added to the project's volatile file as skip
+	// entries, so later parks leave them out too.
+	Exclude []string
+	// DeleteExcluded lets Move delete a local copy with files that skip
+	// patterns leave out of the archive; by default such a copy is kept
+	DeleteExcluded bool
+	// AbortOnMismatch undoes the add if Move finds the archive copy does not
+	// match the local one. By default the local copy is kept and the project
+	// added as grabbed instead. Either way the local copy is never deleted.
+	AbortOnMismatch bool
+	// CreateCategory registers Category in the master, next to its other
+	// categories, if it isn't configured there yet
+	CreateCategory bool
+	// Name is the project name to use instead of the directory's base name,
+	// to avoid a clash with an existing project
+	Name string
+	// IncludeHidden adds directories whose names start with '.' as if the
+	// include_hidden setting were on
+	IncludeHidden bool
+	// Existing is ExistingMerge or ExistingOverwrite to add the project onto
+	// an untracked archive project with the same name, in that project's
+	// master and category; by default such a clash is a conflict
+	Existing string
+}
+
+// How Add treats an untracked archive project with the project's name
+const (
+	ExistingMerge     = "merge"     // Copy local files over it, keeping files only it has
+	ExistingOverwrite = "overwrite" // Replace it with the local copy
+)
+
+// AddResult describes a completed (or, in dry-run mode, planned) add
+type AddResult struct {
+	Project   string `json:"project"`
+	LocalPath string `json:"local_path"`
+	Master    string `json:"master"`
+	Category  string `json:"category"`
+	// Detected is set when Category was detected from the project's files
+	Detected    bool   `json:"detected"`
+	ArchivePath string `json:"archive_path"`
+	Size        int64  `json:"size"`
+	Moved       bool   `json:"moved,omitempty"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+	// Conflicts are the reasons the add would fail; only a dry run returns
+	// a result with conflicts
+	Conflicts []string `json:"conflicts,omitempty"`
+	// ExcludedSize is the size of the files left out by skip patterns
+	ExcludedSize int64 `json:"excluded_size,omitempty"`
+	// Mismatches lists how the archive copy differed from the local copy
+	// when Move verified it; the local copy was kept
+	Mismatches []string `json:"mismatches,omitempty"`
+	// Unarchived lists the paths skip patterns left out of the archive,
+	// which Move would have deleted with the local copy, so it kept it
+	// instead; see DeleteExcluded
+	Unarchived []string `json:"unarchived,omitempty"`
+	// NewCategory is the directory registered for Category, which was not
+	// configured in the master before
+	NewCategory string `json:"new_category,omitempty"`
+	// Existing is set when the project was merged into or overwrote an
+	// untracked archive project at ArchivePath
+	Existing string `json:"existing,omitempty"`
+}
+
+// planAdd resolves where a local directory would be archived and lists
+// anything that prevents adding it
+func planAdd(ctx context.Context, state *State, localPath string, opts AddOptions) (*AddResult, error) {
+	if opts.Existing != "" && opts.Existing != ExistingMerge && opts.Existing != ExistingOverwrite {
+		return nil, fmt.Errorf("invalid existing-project action '%s' (expected %s or %s)", opts.Existing, ExistingMerge, ExistingOverwrite)
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, errorf(ErrLocalPathMissing, "cannot add %s: %v", localPath, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cannot add %s: not a directory", localPath)
+	}
+
+	result := &AddResult{
+		Project:   opts.Name,
+		LocalPath: localPath,
+		Master:    state.DefaultMaster,
+		Category:  opts.Category,
+		DryRun:    opts.DryRun,
+	}
+	if opts.Master != "" {
+		if err := state.checkMaster(opts.Master); err != nil {
+			return nil, err
+		}
+		result.Master = opts.Master
+	}
+	if result.Project == "" {
+		result.Project = filepath.Base(localPath)
+	}
+	if result.Category == "" {
+		result.Category = state.Settings.detectCategory(localPath)
+		result.Detected = true
+	}
+	conflict := func(format string, args ...any) {
+		result.Conflicts = append(result.Conflicts, fmt.Sprintf(format, args...))
+	}
+
+	if err := state.checkProjectName(result.Project); err != nil {
+		conflict("%v", err)
+	}
+	if existing, ok := state.Projects[result.Project]; ok {
+		conflict("project '%s' is already tracked (archived in %s/%s)", result.Project, existing.Master, existing.ArchiveCategory)
+	}
+
+	// Project names are unique across masters, so a copy in any of them
+	// clashes; merging or overwriting picks the copy in opts.Master if set
+	copies, err := DiscoverArchiveCopies(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if aps, ok := copies[result.Project]; ok {
+		ap := aps[0]
+		for _, c := range aps {
+			if c.Master == opts.Master {
+				ap = c
+			}
+		}
+		_, tracked := state.Projects[result.Project]
+		switch {
+		case opts.Existing == "" || tracked:
+			conflict("the archive already has a project named '%s' at %s", result.Project, ap.Path)
+		case opts.Master != "" && ap.Master != opts.Master:
+			conflict("the archive's project named '%s' is in master '%s', not '%s'", result.Project, ap.Master, opts.Master)
+		case opts.Existing == ExistingMerge && isPackedArchive(ap.Path):
+			conflict("can't merge into %s, a compressed archive copy; overwrite it or choose another name", ap.Path)
+		default:
+			result.Master, result.Category, result.Detected = ap.Master, ap.Category, false
+			result.ArchivePath, result.Existing = ap.Path, opts.Existing
+		}
+	}
+
+	if err := state.CheckMasterWritable(result.Master); err != nil {
+		conflict("%v", err)
+	}
+	if result.Existing == "" {
+		categoryPath, ok := state.Masters[result.Master][result.Category]
+		if !ok {
+			newPath, canCreate := state.newCategoryPath(result.Master, result.Category)
+			switch {
+			case canCreate && opts.CreateCategory:
+				categoryPath, ok = newPath, true
+				result.NewCategory = newPath
+			case canCreate:
+				conflict("category '%s' is not configured in master '%s'; confirm creating it at %s, or pass --yes", result.Category, result.Master, newPath)
+			default:
+				conflict("category '%s' is not configured in master '%s'", result.Category, result.Master)
+			}
+		}
+		if ok {
+			result.ArchivePath = filepath.Join(state.archiveRoot(result.Master, categoryPath), result.Project) + state.archiveExt(result.Master)
+		}
+	}
+	if result.ArchivePath != "" && strings.HasPrefix(result.ArchivePath+string(filepath.Separator), localPath+string(filepath.Separator)) {
+		conflict("the archive path %s is inside the project", result.ArchivePath)
+	}
+
+	rules, err := LoadVolatileRules(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if rules, err = rules.withSkips(opts.Exclude); err != nil {
+		return nil, fmt.Errorf("invalid --exclude: %w", err)
+	}
+	if result.Size, result.ExcludedSize, err = archivedSize(ctx, localPath, rules); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to size %s: %w", localPath, err)
+	}
+	if opts.Move && !opts.DeleteExcluded {
+		if result.Unarchived, err = skippedPaths(ctx, localPath, rules); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, fmt.Errorf("failed to scan %s: %w", localPath, err)
+		}
+	}
+	return result, nil
+}
+
+// checkProjectName returns an error if name can't be a project's name in
+// the archive
+func (s *State) checkProjectName(name string) error {
+	switch {
+	case name == "" || isParkrMetadata(name) || strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("'%s' is not a valid project name", name)
+	case strings.HasPrefix(name, ".") && !s.Settings.IncludeHidden:
+		return fmt.Errorf("'%s' is hidden; set include_hidden to true to archive hidden projects", name)
+	}
+	return nil
+}
+
+// Add copies an existing local project into the archive and tracks it as
+// grabbed from there, or with Move, as parked with no local copy. The
+// category is detected from the project's contents unless given.
+func Add(ctx context.Context, sm StateStore, localPath string, opts AddOptions) (*AddResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	localPath, err := filepath.Abs(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeHidden {
+		state.Settings.IncludeHidden = true
+	}
+	ctx = state.Settings.withRemoteRetries(ctx)
+	result, err := planAdd(ctx, state, localPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+	rsyncOpts, err := state.Settings.rsyncOptions(0, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Conflicts) > 0 {
+		return nil, errorf(ErrProjectExists, "cannot add %s: %s", localPath, strings.Join(result.Conflicts, "; "))
+	}
+
+	method := state.VerificationMode(result.Project)
+	if method == VerifyGit {
+		if _, err := gitHead(ctx, localPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := addSkipPatterns(localPath, opts.Exclude); err != nil {
+		return nil, fmt.Errorf("failed to record excludes in %s: %w", VolatileFile, err)
+	}
+	volatile, err := LoadVolatileRules(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.NewCategory != "" {
+		if err := createCategoryDir(ctx, state.archiveRoot(result.Master, result.NewCategory)); err != nil {
+			return nil, fmt.Errorf("failed to create category directory: %w", err)
+		}
+	}
+
+	keys := state.ageKeys(result.Master)
+	switch result.Existing {
+	case ExistingMerge:
+		err = RsyncMerge(ctx, localPath, result.ArchivePath, volatile.RsyncExcludes()...)
+	case ExistingOverwrite:
+		err = syncToArchive(ctx, localPath, result.ArchivePath, keys, rsyncOpts, volatile.RsyncExcludes()...)
+	default:
+		err = copyIntoArchive(ctx, localPath, result.ArchivePath, keys, rsyncOpts, volatile.RsyncExcludes()...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy project: %w", err)
+	}
+
+	baseline, err := captureBaseline(ctx, localPath, method, &state.Settings)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Move {
+		// A copy that can't be read back, such as an encrypted one on a
+		// machine without the identity, is treated as not matching
+		result.Mismatches, err = compareArchiveCopy(ctx, localPath, result.ArchivePath, keys, volatile.RsyncExcludes())
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			result.Mismatches = []string{fmt.Sprintf("could not verify: %v", err)}
+		}
+		if result.Existing == ExistingMerge {
+			result.Mismatches = withoutArchiveOnly(result.Mismatches)
+		}
+		if len(result.Mismatches) > 0 && opts.AbortOnMismatch {
+			msg := fmt.Sprintf("archive copy of '%s' does not match %s (%s)", result.Project, localPath, strings.Join(result.Mismatches, ", "))
+			if result.Existing != "" {
+				return nil, errorf(ErrArchiveMismatch, "%s; the local copy was kept and the existing archive copy at %s left as it is", msg, result.ArchivePath)
+			}
+			if IsRemote(result.ArchivePath) {
+				return nil, errorf(ErrArchiveMismatch, "%s; the local copy was kept and the archive copy left at %s", msg, result.ArchivePath)
+			}
+			if err := os.RemoveAll(result.ArchivePath); err != nil {
+				return nil, errorf(ErrArchiveMismatch, "%s; the local copy was kept but removing the archive copy failed: %v", msg, err)
+			}
+			return nil, errorf(ErrArchiveMismatch, "%s; the add was undone and the local copy kept", msg)
+		}
+	}
+	description := ReadDescription(localPath, state.Settings.MetadataFile)
+
+	now := time.Now()
+	err = sm.Update(func(state *State) error {
+		if _, exists := state.Projects[result.Project]; exists {
+			return errorf(ErrProjectExists, "project '%s' was added while copying", result.Project)
+		}
+		project := &Project{
+			LocalPath:       localPath,
+			Master:          result.Master,
+			ArchiveCategory: result.Category,
+			GrabbedAt:       &now,
+			LastParkAt:      &now,
+			IsGrabbed:       true,
+			Description:     description,
+		}
+		baseline.apply(project, now)
+		state.Projects[result.Project] = project
+		if _, ok := state.Masters[result.Master][result.Category]; !ok && result.NewCategory != "" {
+			state.Masters[result.Master][result.Category] = result.NewCategory
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+
+	if opts.Move && len(result.Mismatches) == 0 && len(result.Unarchived) == 0 {
+		if err := os.RemoveAll(localPath); err != nil {
+			return nil, fmt.Errorf("added '%s' but failed to remove the local copy: %w", result.Project, err)
+		}
+		err = sm.Update(func(state *State) error {
+			if project, ok := state.Projects[result.Project]; ok {
+				project.IsGrabbed = false
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update state: %w", err)
+		}
+		result.Moved = true
+	}
+	publishEvent(sm, ProjectEvent{Project: result.Project, Op: EventAdd, LocalPath: result.LocalPath, Size: sizePtr(result.Size)})
+	return result, nil
+}
+
+// newCategoryPath returns where a master would keep a new category: next to
+// its other categories, provided they all share a parent directory
+func (s *State) newCategoryPath(master, category string) (string, bool) {
+	if category == "" || strings.HasPrefix(category, ".") || strings.ContainsAny(category, `/\:`) {
+		return "", false
+	}
+	parent := ""
+	for _, p := range s.Masters[master] {
+		dir := filepath.Dir(p)
+		if parent != "" && dir != parent {
+			return "", false
+		}
+		parent = dir
+	}
+	if parent == "" {
+		return "", false
+	}
+	return filepath.Join(parent, category), true
+}
+
+// MissingCategories returns the categories that adding paths would file
+// projects under but master ("" for the default one) doesn't have, each
+// mapped to the directory AddOptions.CreateCategory would register for it.
+// Categories with no obvious place in the master are left out; adding to
+// them fails.
+func MissingCategories(sm StateStore, paths []string, master, category string) (map[string]string, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	if master == "" {
+		master = state.DefaultMaster
+	} else if err := state.checkMaster(master); err != nil {
+		return nil, err
+	}
+	missing := make(map[string]string)
+	for _, p := range paths {
+		c := category
+		if c == "" {
+			c = state.Settings.detectCategory(p)
+		}
+		if _, ok := state.Masters[master][c]; ok {
+			continue
+		}
+		if newPath, ok := state.newCategoryPath(master, c); ok {
+			missing[c] = newPath
+		}
+	}
+	return missing, nil
+}
+
+// createCategoryDir creates a new category's archive directory, over SSH if
+// it is on another host
+func createCategoryDir(ctx context.Context, dir string) error {
+	if host, p, ok := SplitRemote(dir); ok {
+		_, err := runSSH(ctx, host, "mkdir -p "+shellQuote(p))
+		return err
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// compareArchiveCopy lists the differences between a local project and its
+// freshly written archive copy. Local copies and tarballs are compared file
+// by file; remote trees with an rsync checksum dry run.
+func compareArchiveCopy(ctx context.Context, localPath, archivePath string, keys ageKeys, excludes []string) ([]string, error) {
+	if IsRemote(archivePath) {
+		return rsyncDiff(ctx, localPath, archivePath, excludes...)
+	}
+	dir, cleanup, err := archiveDir(ctx, archivePath, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return compareTrees(ctx, localPath, dir)
+}
+
+// withoutArchiveOnly drops the files only the archive copy has from a list
+// of differences, which are expected after merging into an existing copy
+func withoutArchiveOnly(diffs []string) []string {
+	var kept []string
+	for _, d := range diffs {
+		if !strings.HasPrefix(d, archiveOnlyPrefix) {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// AddClash is a project with the name a new project would be added under
+type AddClash struct {
+	Name string `json:"name"`
+	// Existing is the archive copy with that name, or nil if the clash is
+	// only with a tracked project whose archive copy is missing
+	Existing *ArchiveProject `json:"existing,omitempty"`
+	// Tracked is set when parkr tracks the existing project, so only
+	// renaming the new one resolves the clash
+	Tracked bool `json:"tracked"`
+	// Suggested is the first free name made by adding a numeric suffix
+	Suggested string `json:"suggested"`
+}
+
+// CheckAddClash returns the project that adding localPath under name, or
+// its base name if name is empty, would clash with, or nil if there is none
+func CheckAddClash(ctx context.Context, sm StateStore, localPath, name string) (*AddClash, error) {
+	if name == "" {
+		abs, err := filepath.Abs(localPath)
+		if err != nil {
+			return nil, err
+		}
+		name = filepath.Base(abs)
+	}
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	taken := func(n string) bool {
+		_, tracked := state.Projects[n]
+		_, archived := archiveProjects[n]
+		return tracked || archived
+	}
+	if !taken(name) {
+		return nil, nil
+	}
+
+	clash := &AddClash{Name: name}
+	if ap, ok := archiveProjects[name]; ok {
+		clash.Existing = &ap
+	}
+	_, clash.Tracked = state.Projects[name]
+	for i := 2; ; i++ {
+		if suggested := fmt.Sprintf("%s-%d", name, i); !taken(suggested) {
+			clash.Suggested = suggested
+			break
+		}
+	}
+	return clash, nil
+}
+
+// DiffArchiveCopy lists how a local directory differs from an archive
+// project's copy, as "only local", "only in archive", "size differs" or
+// "contents differ" lines
+func DiffArchiveCopy(ctx context.Context, sm StateStore, localPath string, ap ArchiveProject) ([]string, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	volatile, err := LoadVolatileRules(localPath)
+	if err != nil {
+		return nil, err
+	}
+	return compareArchiveCopy(ctx, localPath, ap.Path, state.ageKeys(ap.Master), volatile.RsyncExcludes())
+}
+
+// copyIntoArchive copies a new project into the archive. A local directory
+// tree is synced into a temporary directory, which gc removes if parkr is
+// interrupted, and renamed into place, so a partial copy is never mistaken
+// for a project.
+func copyIntoArchive(ctx context.Context, src, dst string, keys ageKeys, opts RsyncOptions, excludes ...string) error {
+	if IsRemote(dst) {
+		return syncToArchive(ctx, src, dst, keys, opts, excludes...)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create category directory: %w", err)
+	}
+	if isPackedArchive(dst) {
+		return writePacked(ctx, src, dst, keys, excludes...)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), tempDirPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	if err := RsyncParallel(ctx, src, tmp, opts, excludes...); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return nil
+}
+
+// Outcomes of adding one directory in AddAll
+const (
+	AddAdded    = "added"    // Added, or would be in a dry run
+	AddSkipped  = "skipped"  // Already tracked from this path
+	AddConflict = "conflict" // Clashes with an existing or another new project
+	AddFailed   = "failed"   // Could not be read or copied
+)
+
+// AddOutcome is the result of adding one directory in AddAll
+type AddOutcome struct {
+	Path   string     `json:"path"`
+	Status string     `json:"status"`
+	Result *AddResult `json:"result,omitempty"`
+	// Reason explains a skip, conflict or failure
+	Reason string `json:"reason,omitempty"`
+}
+
+// ProjectDirsUnder returns the subdirectories of dir, sorted, for adding
+// every project under an old projects directory. Hidden ones are left out
+// unless includeHidden is set, and parkr's own always are.
+func ProjectDirsUnder(dir string, includeHidden bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !skipProjectDir(entry.Name(), includeHidden) {
+			dirs = append(dirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+// AddAll adds each directory in turn with the same options, detecting each
+// one's category unless opts.Category is set. A directory that fails does
+// not stop the others; directories already tracked from the same path are
+// skipped, so an interrupted bulk add can be rerun.
+func AddAll(ctx context.Context, sm StateStore, paths []string, opts AddOptions) ([]AddOutcome, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := []AddOutcome{}
+	names := make(map[string]string)
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return outcomes, err
+		}
+		outcome := AddOutcome{Path: p}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			outcome.Status, outcome.Reason = AddFailed, err.Error()
+			outcomes = append(outcomes, outcome)
+			continue
+		}
+		name := filepath.Base(abs)
+
+		if project, ok := state.Projects[name]; ok && filepath.Clean(project.LocalPath) == abs {
+			outcome.Status, outcome.Reason = AddSkipped, fmt.Sprintf("already tracked as '%s'", name)
+			outcomes = append(outcomes, outcome)
+			continue
+		}
+		if other, ok := names[name]; ok {
+			outcome.Status, outcome.Reason = AddConflict, fmt.Sprintf("'%s' is also being added from %s", name, other)
+			outcomes = append(outcomes, outcome)
+			continue
+		}
+		names[name] = abs
+
+		outcome.Result, err = Add(ctx, sm, abs, opts)
+		switch {
+		case errors.Is(err, ErrProjectExists):
+			outcome.Status, outcome.Reason = AddConflict, err.Error()
+		case err != nil:
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return outcomes, ctxErr
+			}
+			outcome.Status, outcome.Reason = AddFailed, err.Error()
+		case len(outcome.Result.Conflicts) > 0:
+			outcome.Status, outcome.Reason = AddConflict, strings.Join(outcome.Result.Conflicts, "; ")
+		default:
+			outcome.Status = AddAdded
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
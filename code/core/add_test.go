@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSkippedPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.py":                 "print()\n",
+		"debug.log":               "x",
+		"data/raw.csv":            "1,2\n",
+		"data/cache/a.bin":        "a",
+		"node_modules/pkg/i.js":   "",
+		"src/node_modules/x/y.js": "",
+	})
+	tests := []struct {
+		skips []string
+		want  []string
+	}{
+		{skips: nil, want: nil},
+		{skips: []string{"*.log"}, want: []string{"debug.log"}},
+		{skips: []string{"node_modules/"}, want: []string{"node_modules/", "src/node_modules/"}},
+		{skips: []string{"data/cache/", "*.csv"}, want: []string{"data/cache/", "data/raw.csv"}},
+	}
+	for _, tt := range tests {
+		rules, err := (*VolatileRules)(nil).withSkips(tt.skips)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := skippedPaths(context.Background(), dir, rules)
+		if err != nil {
+			t.Errorf("skippedPaths(%q) failed: %v", tt.skips, err)
+		} else if !slices.Equal(got, tt.want) {
+			t.Errorf("skippedPaths(%q) = %q, want %q", tt.skips, got, tt.want)
+		}
+	}
+}
+
+func TestAddMoveKeepsExcluded(t *testing.T) {
+	requireRsync(t)
+	tests := []struct {
+		name           string
+		deleteExcluded bool
+		wantKept       bool
+	}{
+		{name: "keeps", deleteExcluded: false, wantKept: true},
+		{name: "deletes", deleteExcluded: true, wantKept: false},
+	}
+	for _, tt := range tests {
+		sm, _ := testStore(t)
+		localPath := filepath.Join(t.TempDir(), tt.name)
+		writeFiles(t, localPath, map[string]string{"main.go": "package main\n", "out/bin": "binary"})
+
+		result, err := Add(context.Background(), sm, localPath, AddOptions{Category: "code", Move: true, Exclude: []string{"out/"}, DeleteExcluded: tt.deleteExcluded})
+		if err != nil {
+			t.Fatalf("%s: Add failed: %v", tt.name, err)
+		}
+		_, statErr := os.Stat(localPath)
+		if kept := statErr == nil; kept != tt.wantKept || result.Moved == tt.wantKept {
+			t.Errorf("%s: local copy kept = %v, moved = %v; want kept = %v", tt.name, kept, result.Moved, tt.wantKept)
+		}
+		if tt.wantKept && !slices.Equal(result.Unarchived, []string{"out/"}) {
+			t.Errorf("%s: Unarchived = %q, want [out/]", tt.name, result.Unarchived)
+		}
+		state, err := sm.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := state.Projects[result.Project]; p == nil || p.IsGrabbed != tt.wantKept {
+			t.Errorf("%s: project recorded as %+v, want grabbed = %v", tt.name, p, tt.wantKept)
+		}
+	}
+}
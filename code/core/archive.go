@@ -1,45 +1,167 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
-// DiscoverArchiveProjects finds all projects in archive directories
-func DiscoverArchiveProjects(state *State) (map[string]ArchiveProject, error) {
+// DiscoverArchiveProjects finds all projects in archive directories. A name
+// found in more than one master maps to the copy in the master its tracked
+// project records, else the default master, else the first master by
+// name; AlsoIn lists the others.
+func DiscoverArchiveProjects(ctx context.Context, state *State) (map[string]ArchiveProject, error) {
+	copies, err := DiscoverArchiveCopies(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string]ArchiveProject, len(copies))
+	for name, aps := range copies {
+		ap := aps[0]
+		for _, other := range aps[1:] {
+			ap.AlsoIn = append(ap.AlsoIn, other.Master)
+		}
+		projects[name] = ap
+	}
+	return projects, nil
+}
+
+// DiscoverMasterProjects finds the projects in one master's archive
+// directories, including those that DiscoverArchiveProjects would map to
+// another master's copy
+func DiscoverMasterProjects(ctx context.Context, state *State, master string) (map[string]ArchiveProject, error) {
+	if err := state.checkMaster(master); err != nil {
+		return nil, err
+	}
+	copies, err := DiscoverArchiveCopies(ctx, state)
+	if err != nil {
+		return nil, err
+	}
 	projects := make(map[string]ArchiveProject)
+	for name, aps := range copies {
+		for i, ap := range aps {
+			if ap.Master != master {
+				continue
+			}
+			for j, other := range aps {
+				if j != i {
+					ap.AlsoIn = append(ap.AlsoIn, other.Master)
+				}
+			}
+			projects[name] = ap
+		}
+	}
+	return projects, nil
+}
+
+// DiscoverArchiveCopies finds all projects in archive directories, with
+// every master's copy of each name, preferred copy first (see
+// DiscoverArchiveProjects)
+func DiscoverArchiveCopies(ctx context.Context, state *State) (map[string][]ArchiveProject, error) {
+	projects := make(map[string]map[string]ArchiveProject)
 
 	for masterName, categories := range state.Masters {
 		for categoryName, categoryPath := range categories {
-			entries, err := os.ReadDir(categoryPath)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			root := state.archiveRoot(masterName, categoryPath)
+			names, err := listProjectDirs(ctx, root)
 			if err != nil {
-				if os.IsNotExist(err) {
-					continue // Skip non-existent directories
-				}
-				return nil, fmt.Errorf("failed to read %s: %w", categoryPath, err)
+				return nil, errorf(ErrArchiveUnreachable, "failed to read %s: %w", root, err)
 			}
 
-			for _, entry := range entries {
-				if entry.IsDir() {
-					projectName := entry.Name()
-					// Skip hidden directories
-					if projectName[0] == '.' {
-						continue
-					}
-
-					projects[projectName] = ArchiveProject{
-						Name:     projectName,
-						Master:   masterName,
-						Category: categoryName,
-						Path:     filepath.Join(categoryPath, projectName),
-					}
+			for _, entry := range names {
+				if skipProjectDir(entry, state.Settings.IncludeHidden) || state.Settings.Masters[masterName].excluded(entry) {
+					continue
+				}
+
+				projectName := trimArchiveExt(entry)
+				if projects[projectName] == nil {
+					projects[projectName] = make(map[string]ArchiveProject)
+				}
+				if _, ok := projects[projectName][masterName]; ok && !isPackedArchive(entry) {
+					// A tarball takes precedence over a leftover tree
+					continue
+				}
+				projects[projectName][masterName] = ArchiveProject{
+					Name:     projectName,
+					Master:   masterName,
+					Category: categoryName,
+					Path:     filepath.Join(root, entry),
 				}
 			}
 		}
 	}
 
-	return projects, nil
+	copies := make(map[string][]ArchiveProject, len(projects))
+	for name, byMaster := range projects {
+		aps := make([]ArchiveProject, 0, len(byMaster))
+		for _, ap := range byMaster {
+			aps = append(aps, ap)
+		}
+		tracked := ""
+		if project, ok := state.Projects[name]; ok {
+			tracked = project.Master
+		}
+		rank := func(master string) int {
+			switch master {
+			case tracked:
+				return 0
+			case state.DefaultMaster:
+				return 1
+			}
+			return 2
+		}
+		sort.Slice(aps, func(i, j int) bool {
+			if ri, rj := rank(aps[i].Master), rank(aps[j].Master); ri != rj {
+				return ri < rj
+			}
+			return aps[i].Master < aps[j].Master
+		})
+		copies[name] = aps
+	}
+	return copies, nil
+}
+
+// isParkrMetadata reports whether a name in an archive category or local
+// directory is parkr's own, such as its trash, kept versions, partial
+// transfers or an unfinished copy, rather than a project
+func isParkrMetadata(name string) bool {
+	return strings.HasPrefix(name, ".parkr") || strings.HasPrefix(name, tempDirPrefix)
+}
+
+// skipProjectDir reports whether discovery passes over a directory: always
+// for parkr's own, and for other hidden names unless includeHidden is set
+func skipProjectDir(name string, includeHidden bool) bool {
+	return isParkrMetadata(name) || (name[0] == '.' && !includeHidden)
+}
+
+// listProjectDirs returns the names of the directories and project
+// tarballs in an archive category, local or remote, or none if it does not
+// exist. Tarballs keep their extension.
+func listProjectDirs(ctx context.Context, root string) ([]string, error) {
+	if host, dir, ok := SplitRemote(root); ok {
+		return listRemoteDirs(ctx, host, dir)
+	}
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || (entry.Type().IsRegular() && isPackedArchive(entry.Name())) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
 }
 
 // ArchiveProject represents a project found in the archive
@@ -48,15 +170,18 @@ type ArchiveProject struct {
 	Master   string
 	Category string
 	Path     string
+	// AlsoIn lists the other masters with a project of the same name
+	AlsoIn []string
 }
 
-// GetNewestMtime finds the newest modification time in a directory tree
-func GetNewestMtime(dirPath string) (*os.FileInfo, error) {
+// GetNewestMtime finds the newest modification time in a directory tree,
+// ignoring the volatile paths listed in its VolatileFile
+func GetNewestMtime(ctx context.Context, dirPath string) (*os.FileInfo, error) {
 	var newest os.FileInfo
 	var newestTime int64
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	err := walkTracked(dirPath, func(_ string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 		if !info.IsDir() {
@@ -75,14 +200,22 @@ func GetNewestMtime(dirPath string) (*os.FileInfo, error) {
 	return &newest, nil
 }
 
-// GetDirSize calculates the total size of a directory
-func GetDirSize(dirPath string) (int64, error) {
+// GetDirSize calculates the total size of a directory. Remote directories
+// are sized with du over SSH.
+func GetDirSize(ctx context.Context, dirPath string) (int64, error) {
+	if host, dir, ok := SplitRemote(dirPath); ok {
+		return remoteDirSize(ctx, host, dir)
+	}
+
 	var size int64
 
 	err := filepath.Walk(dirPath, func(_ string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if !info.IsDir() {
 			size += info.Size()
 		}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveSizesPath returns the file of last measured archive sizes kept
+// next to a state file. Unlike the size cache its entries never expire:
+// for a slow master, a size shown with its age beats blocking on a walk.
+func ArchiveSizesPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "archive-sizes.json")
+}
+
+// LoadArchiveSizes reads the last measured archive sizes, keyed by archive
+// path. A missing or unreadable file is treated as empty.
+func LoadArchiveSizes(statePath string) SizeCache {
+	cache := make(SizeCache)
+	data, err := os.ReadFile(ArchiveSizesPath(statePath))
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return make(SizeCache)
+	}
+	return cache
+}
+
+// saveArchiveSizes merges sizes into the archive sizes file, keeping the
+// newer measurement of each path, since list, inspect and a background
+// refresh may all be writing it
+func saveArchiveSizes(statePath string, sizes SizeCache) error {
+	merged := LoadArchiveSizes(statePath)
+	for path, entry := range sizes {
+		if old, ok := merged[path]; !ok || entry.ComputedAt.After(old.ComputedAt) {
+			merged[path] = entry
+		}
+	}
+	data, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize archive sizes: %w", err)
+	}
+	path := ArchiveSizesPath(statePath)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write archive sizes: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write archive sizes: %w", err)
+	}
+	return nil
+}
+
+// recordArchiveSize stores one measured archive size
+func recordArchiveSize(statePath, archivePath string, size int64, now time.Time) error {
+	return saveArchiveSizes(statePath, SizeCache{archivePath: {Size: size, ComputedAt: now}})
+}
+
+// SlowMaster reports whether list shows a master's last measured sizes
+// instead of walking its projects: masters on another host, and those
+// marked slow
+func (s *State) SlowMaster(master string) bool {
+	return s.Settings.Masters[master].Slow || s.hasRemoteRoot(master)
+}
+
+// SizeRefreshResult describes a refresh of slow masters' archive sizes
+type SizeRefreshResult struct {
+	Measured int `json:"measured"`
+	Failed   int `json:"failed"`
+	// Busy is set when another refresh was already running, so this one
+	// did nothing
+	Busy bool `json:"busy,omitempty"`
+}
+
+// RefreshArchiveSizes measures the archive copies of slow masters' projects
+// whose last size is missing or older than SizeCacheTTL, or all of them
+// with all, and records them next to statePath. Only one refresh runs at a
+// time; others return at once with Busy set.
+func RefreshArchiveSizes(ctx context.Context, sm StateStore, statePath string, all bool) (*SizeRefreshResult, error) {
+	lock, err := os.OpenFile(ArchiveSizesPath(statePath)+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	if ok, err := tryLockFile(lock); err != nil {
+		return nil, err
+	} else if !ok {
+		return &SizeRefreshResult{Busy: true}, nil
+	}
+	defer unlockFile(lock)
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	ctx = state.Settings.withRemoteRetries(ctx)
+	archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, ap := range archiveProjects {
+		if state.SlowMaster(ap.Master) {
+			paths = append(paths, ap.Path)
+		}
+	}
+
+	now := time.Now()
+	cache := LoadArchiveSizes(statePath)
+	measured := make(SizeCache)
+	for path, entry := range cache {
+		measured[path] = entry
+	}
+	sizes, err := DirSizes(ctx, paths, measured, all, now)
+	if err != nil {
+		return nil, err
+	}
+	result := &SizeRefreshResult{}
+	fresh := make(SizeCache)
+	for _, path := range paths {
+		switch entry := measured[path]; {
+		case sizes[path] < 0:
+			result.Failed++
+		case entry.ComputedAt.Equal(now):
+			fresh[path] = entry
+			result.Measured++
+		}
+	}
+	if len(fresh) > 0 {
+		if err := saveArchiveSizes(statePath, fresh); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
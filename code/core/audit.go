@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Audit results
+const (
+	AuditOK    = "ok"
+	AuditError = "error"
+)
+
+// AuditRecord is one run of a command that changes projects or state
+type AuditRecord struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host,omitempty"`
+	Command string    `json:"command"`
+	Args    []string  `json:"args"`
+	// StatePath is the state file the command used
+	StatePath string `json:"state_path"`
+	// Projects and Bytes are the projects the command grabbed, parked,
+	// added or removed, and the combined size of those copies. A command
+	// on one project that failed names it too.
+	Projects []string `json:"projects,omitempty"`
+	Bytes    int64    `json:"bytes,omitempty"`
+	// DurationMS is how long the command ran, in milliseconds
+	DurationMS int64  `json:"duration_ms,omitempty"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Duration returns how long the command ran, or 0 if the record predates
+// durations being recorded
+func (r AuditRecord) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// AuditLogPath returns the audit log shared by every state file and
+// profile of the current user
+func AuditLogPath() string {
+	return filepath.Join(DataDir(), "audit.jsonl")
+}
+
+// RecordAudit appends a record to the audit log at path, filling in this
+// machine's hostname if Host is empty
+func RecordAudit(path string, record AuditRecord) error {
+	if record.Host == "" {
+		record.Host, _ = os.Hostname()
+	}
+	return appendJSONLine(path, record)
+}
+
+// AuditFilter selects audit records; zero fields match everything
+type AuditFilter struct {
+	Project string
+	Since   time.Time
+	Until   time.Time
+	// StatePath matches runs against one state file
+	StatePath string
+	// Commands matches runs of any of these commands
+	Commands []string
+}
+
+// matches reports whether a record passes the filter
+func (f AuditFilter) matches(r AuditRecord) bool {
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+	if f.StatePath != "" && r.StatePath != f.StatePath {
+		return false
+	}
+	if len(f.Commands) > 0 && !slices.Contains(f.Commands, r.Command) {
+		return false
+	}
+	if f.Project == "" {
+		return true
+	}
+	for _, p := range r.Projects {
+		if p == f.Project {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadAudit reads the audit records at path that match filter, oldest
+// first. A missing log has no records; unreadable lines are skipped.
+func LoadAudit(path string, filter AuditFilter) ([]AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r AuditRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil || !filter.matches(r) {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// RecentTransfers returns the latest n grab and park runs of a project of
+// the state file at statePath, from the audit log at path, newest first
+func RecentTransfers(path, statePath, project string, n int) ([]AuditRecord, error) {
+	records, err := LoadAudit(path, AuditFilter{Project: project, StatePath: statePath, Commands: []string{"grab", "park"}})
+	if err != nil {
+		return nil, err
+	}
+	records = records[max(len(records)-n, 0):]
+	slices.Reverse(records)
+	return records, nil
+}
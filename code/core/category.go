@@ -0,0 +1,367 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CategoryInfo describes a category of a master
+type CategoryInfo struct {
+	Master   string `json:"master"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`     // Including the master's host, if any
+	Projects int    `json:"projects"` // Tracked projects filed under it
+}
+
+// ListCategories returns every master's categories, sorted by master and
+// name
+func ListCategories(sm StateStore) ([]CategoryInfo, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	var categories []CategoryInfo
+	for master, paths := range state.Masters {
+		for name, path := range paths {
+			categories = append(categories, CategoryInfo{
+				Master:   master,
+				Name:     name,
+				Path:     state.archiveRoot(master, path),
+				Projects: len(state.categoryProjects(master, name)),
+			})
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Master != categories[j].Master {
+			return categories[i].Master < categories[j].Master
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+// AddCategoryOptions controls AddCategory
+type AddCategoryOptions struct {
+	Scaffold bool // Create the category directory
+	DryRun   bool // Check the category without registering it
+}
+
+// AddCategory registers a category of a master at path, a local path or
+// host:path. The directory must exist unless opts.Scaffold is set, and may
+// not overlap another category of any master.
+func AddCategory(ctx context.Context, sm StateStore, master, name, path string, opts AddCategoryOptions) error {
+	if err := validCategoryName(name); err != nil {
+		return err
+	}
+	if _, dir, _ := SplitRemote(path); !filepath.IsAbs(dir) {
+		return fmt.Errorf("category path must be an absolute path: %s", path)
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	if err := state.checkNewCategory(master, name, path); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	root := state.archiveRoot(master, path)
+	if opts.Scaffold {
+		if err := createCategoryDir(ctx, root); err != nil {
+			return errorf(ErrArchiveUnreachable, "failed to create %s: %w", root, err)
+		}
+	} else if ok, err := archivePathExists(ctx, root); err != nil || !ok {
+		return errorf(ErrArchiveUnreachable, "category directory %s is not a directory (use --scaffold to create it)", root)
+	}
+
+	return sm.Update(func(state *State) error {
+		if err := state.checkNewCategory(master, name, path); err != nil {
+			return err
+		}
+		state.Masters[master][name] = path
+		return nil
+	})
+}
+
+// RemoveCategory unregisters a category of a master, leaving its directory
+// untouched. A category that tracked projects still belong to can't be
+// removed. With dryRun, it only checks that the category could be.
+func RemoveCategory(sm StateStore, master, name string, dryRun bool) error {
+	check := func(state *State) error {
+		if err := state.checkCategory(master, name); err != nil {
+			return err
+		}
+		if projects := state.categoryProjects(master, name); len(projects) > 0 {
+			return fmt.Errorf("category '%s' of master '%s' still has %d tracked project(s): %s", name, master, len(projects), strings.Join(projects, ", "))
+		}
+		return nil
+	}
+	if dryRun {
+		state, err := sm.Load()
+		if err != nil {
+			return err
+		}
+		return check(state)
+	}
+	return sm.Update(func(state *State) error {
+		if err := check(state); err != nil {
+			return err
+		}
+		delete(state.Masters[master], name)
+		return nil
+	})
+}
+
+// RenameCategoryOptions controls RenameCategory
+type RenameCategoryOptions struct {
+	// Path is the category's new directory. If empty, a directory named
+	// after the category moves to a sibling named after the new one, and
+	// any other directory stays where it is.
+	Path   string
+	DryRun bool // Report what would change without changing it
+}
+
+// CategoryRename describes a renamed category
+type CategoryRename struct {
+	Master   string   `json:"master"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	OldPath  string   `json:"old_path"`
+	NewPath  string   `json:"new_path"`
+	Moved    bool     `json:"moved"`              // The directory and its projects were moved
+	Projects []string `json:"projects,omitempty"` // Tracked projects now filed under the new name
+}
+
+// RenameCategory renames a category of a master, moving its directory, and
+// every project in it, to the new path. Tracked projects, and the quota,
+// local root and verify severity set for the old name, follow the rename;
+// settings shared with another master's category of the old name are left
+// alone. A category whose projects are being transferred can't be renamed.
+func RenameCategory(ctx context.Context, sm StateStore, master, from, to string, opts RenameCategoryOptions) (*CategoryRename, error) {
+	if err := validCategoryName(to); err != nil {
+		return nil, err
+	}
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	rename, err := state.planCategoryRename(master, from, to, opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return rename, nil
+	}
+
+	if rename.Moved {
+		oldRoot, newRoot := state.archiveRoot(master, rename.OldPath), state.archiveRoot(master, rename.NewPath)
+		if err := moveArchiveDir(ctx, oldRoot, newRoot); err != nil {
+			return nil, errorf(ErrArchiveUnreachable, "failed to move %s to %s: %w", oldRoot, newRoot, err)
+		}
+	}
+
+	err = sm.Update(func(state *State) error {
+		latest, err := state.planCategoryRename(master, from, to, opts.Path)
+		if err != nil {
+			return err
+		}
+		state.applyCategoryRename(latest)
+		return nil
+	})
+	if err != nil {
+		if rename.Moved {
+			// Put the directory back, so the state still describes it
+			moveArchiveDir(ctx, state.archiveRoot(master, rename.NewPath), state.archiveRoot(master, rename.OldPath))
+		}
+		return nil, err
+	}
+	return rename, nil
+}
+
+// planCategoryRename checks that a category can be renamed and works out
+// where its directory goes
+func (s *State) planCategoryRename(master, from, to, path string) (*CategoryRename, error) {
+	if err := s.checkCategory(master, from); err != nil {
+		return nil, err
+	}
+	if _, ok := s.Masters[master][to]; ok {
+		return nil, fmt.Errorf("master '%s' already has a category '%s'", master, to)
+	}
+	if err := s.CheckMasterWritable(master); err != nil {
+		return nil, err
+	}
+
+	oldPath := s.Masters[master][from]
+	newPath := path
+	if newPath == "" {
+		newPath = oldPath
+		if filepath.Base(oldPath) == from {
+			newPath = filepath.Join(filepath.Dir(oldPath), to)
+		}
+	}
+	rename := &CategoryRename{
+		Master:   master,
+		From:     from,
+		To:       to,
+		OldPath:  oldPath,
+		NewPath:  newPath,
+		Moved:    newPath != oldPath,
+		Projects: s.categoryProjects(master, from),
+	}
+	if !rename.Moved {
+		return rename, nil
+	}
+
+	if _, dir, _ := SplitRemote(newPath); !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("category path must be an absolute path: %s", newPath)
+	}
+	oldRoot, newRoot := s.archiveRoot(master, oldPath), s.archiveRoot(master, newPath)
+	oldHost, _, _ := SplitRemote(oldRoot)
+	if newHost, _, _ := SplitRemote(newRoot); newHost != oldHost {
+		return nil, fmt.Errorf("can't move %s to another host; copy it to %s yourself, then add it as a new category", oldRoot, newRoot)
+	}
+	if pathsOverlap(oldRoot, newRoot) {
+		return nil, fmt.Errorf("%s is inside or around %s", newRoot, oldRoot)
+	}
+	if err := s.checkCategoryOverlap(master, from, newPath); err != nil {
+		return nil, err
+	}
+	for projectName, t := range s.Transfers {
+		if pathsOverlap(t.Source, oldRoot) || pathsOverlap(t.Dest, oldRoot) {
+			return nil, fmt.Errorf("project '%s' has an unfinished %s in category '%s'; finish it before renaming the category", projectName, t.Op, from)
+		}
+	}
+	return rename, nil
+}
+
+// applyCategoryRename records a planned rename in s
+func (s *State) applyCategoryRename(r *CategoryRename) {
+	delete(s.Masters[r.Master], r.From)
+	s.Masters[r.Master][r.To] = r.NewPath
+	for _, name := range r.Projects {
+		s.Projects[name].ArchiveCategory = r.To
+	}
+
+	// Settings keyed by category name alone also apply to other masters'
+	// categories of that name, which keep it
+	for master, categories := range s.Masters {
+		if _, ok := categories[r.From]; ok && master != r.Master {
+			return
+		}
+	}
+	if quota, ok := s.Settings.CategoryQuotas[r.From]; ok {
+		if _, taken := s.Settings.CategoryQuotas[r.To]; !taken {
+			s.Settings.CategoryQuotas[r.To] = quota
+		}
+		delete(s.Settings.CategoryQuotas, r.From)
+	}
+	// Keep grabbing into the same local directory
+	if _, taken := s.Settings.LocalRoots[r.To]; !taken && s.LocalRoot(r.From) != GetDefaultLocalPath(r.To) {
+		if s.Settings.LocalRoots == nil {
+			s.Settings.LocalRoots = make(map[string]string)
+		}
+		s.Settings.LocalRoots[r.To] = s.LocalRoot(r.From)
+	}
+	delete(s.Settings.LocalRoots, r.From)
+	if severity, ok := s.Settings.VerifySeverity["category:"+r.From]; ok {
+		if _, taken := s.Settings.VerifySeverity["category:"+r.To]; !taken {
+			s.Settings.VerifySeverity["category:"+r.To] = severity
+		}
+		delete(s.Settings.VerifySeverity, "category:"+r.From)
+	}
+}
+
+// validCategoryName returns an error for names that can't be a directory
+// of their own or a flag
+func validCategoryName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "-") || strings.ContainsAny(name, "/\\: \t") {
+		return fmt.Errorf("invalid category name '%s'", name)
+	}
+	return nil
+}
+
+// checkCategory returns an error unless master has the category
+func (s *State) checkCategory(master, name string) error {
+	if err := s.checkMaster(master); err != nil {
+		return err
+	}
+	if _, ok := s.Masters[master][name]; !ok {
+		return errorf(ErrStateFile, "category '%s' not found in master '%s'", name, master)
+	}
+	return nil
+}
+
+// checkNewCategory returns an error if master can't have a category name
+// at path: the name is taken, or path is, or is inside or around, another
+// category's directory
+func (s *State) checkNewCategory(master, name, path string) error {
+	if err := s.checkMaster(master); err != nil {
+		return err
+	}
+	if _, ok := s.Masters[master][name]; ok {
+		return fmt.Errorf("master '%s' already has a category '%s'", master, name)
+	}
+	return s.checkCategoryOverlap(master, "", path)
+}
+
+// checkCategoryOverlap returns an error if path, a category directory of
+// master, overlaps that of any category but master's skip
+func (s *State) checkCategoryOverlap(master, skip, path string) error {
+	root := s.archiveRoot(master, path)
+	for other, categories := range s.Masters {
+		for category, existingPath := range categories {
+			if other == master && category == skip {
+				continue
+			}
+			if existingRoot := s.archiveRoot(other, existingPath); pathsOverlap(root, existingRoot) {
+				return fmt.Errorf("%s overlaps category '%s' of master '%s' at %s", root, category, other, existingRoot)
+			}
+		}
+	}
+	return nil
+}
+
+// categoryProjects returns the tracked projects in a category of a master,
+// sorted by name
+func (s *State) categoryProjects(master, category string) []string {
+	var projects []string
+	for projectName, project := range s.Projects {
+		if project.Master == master && project.ArchiveCategory == category {
+			projects = append(projects, projectName)
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+// moveArchiveDir moves an archive directory or tarball, over SSH for remote
+// paths. Within a filesystem it is renamed; across filesystems, as between
+// masters on different disks, it is copied, verified and then removed. A
+// path that doesn't exist yet has nothing to move.
+func moveArchiveDir(ctx context.Context, from, to string) error {
+	host, fromDir, remote := SplitRemote(from)
+	_, toDir, _ := SplitRemote(to)
+	if exists, err := archivePathExists(ctx, from); err != nil || !exists {
+		return err
+	}
+	if exists, err := archivePathExists(ctx, to); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%s already exists", to)
+	}
+	if remote {
+		_, err := runSSH(ctx, host, fmt.Sprintf("mkdir -p %s && mv %s %s", shellQuote(filepath.Dir(toDir)), shellQuote(fromDir), shellQuote(toDir)))
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(toDir), 0755); err != nil {
+		return err
+	}
+	return moveDir(ctx, fromDir, toDir)
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ChecksumFile is written to the root of a directory tree archive copy on
+// park. It lists every tracked file with its size, mtime and SHA-256, so
+// single files can be checked without hashing the whole project. It is
+// left out of manifests and hashes, and never copied back to local.
+const ChecksumFile = ".parkrsums"
+
+// checksumExclude is the rsync pattern for the ChecksumFile at the root of
+// a tree and the temporary files it is written through, which also keeps
+// --delete from removing them
+const checksumExclude = "/" + ChecksumFile + "*"
+
+// isChecksumFile reports whether a path relative to a tree root is its
+// ChecksumFile or one being written
+func isChecksumFile(rel string) bool {
+	return strings.HasPrefix(rel, ChecksumFile) && !strings.Contains(rel, "/")
+}
+
+// FileChecksum is one file listed in a ChecksumFile
+type FileChecksum struct {
+	Path   string `json:"path"` // Slash-separated, relative to the tree root
+	Size   int64  `json:"size"`
+	Mtime  int64  `json:"mtime"`  // Unix nanoseconds
+	SHA256 string `json:"sha256"` // Hex digest of the contents
+}
+
+// loadChecksums reads the ChecksumFile of an archive copy, over SSH if it
+// is remote. It returns nil if the copy has none, as tarballs never do.
+func loadChecksums(ctx context.Context, dir string) ([]FileChecksum, error) {
+	if isPackedArchive(dir) {
+		return nil, nil
+	}
+	var data []byte
+	if host, path, ok := SplitRemote(dir); ok {
+		out, err := runSSH(ctx, host, "cat "+shellQuote(path+"/"+ChecksumFile)+" 2>/dev/null || true")
+		if err != nil {
+			return nil, err
+		}
+		data = []byte(out)
+	} else {
+		var err error
+		data, err = os.ReadFile(filepath.Join(dir, ChecksumFile))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var sums []FileChecksum
+	if err := json.Unmarshal(data, &sums); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", ChecksumFile, dir, err)
+	}
+	return sums, nil
+}
+
+// buildChecksums hashes the tracked files under dir. Files whose size and
+// mtime match an entry of previous keep its digest instead of being read.
+func buildChecksums(ctx context.Context, dir string, previous []FileChecksum) ([]FileChecksum, error) {
+	known := make(map[string]FileChecksum, len(previous))
+	for _, sum := range previous {
+		known[sum.Path] = sum
+	}
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	sums := make([]FileChecksum, 0, len(manifest))
+	for _, e := range manifest {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum := FileChecksum{Path: e.Path, Size: e.Size, Mtime: e.Mtime}
+		if prev, ok := known[e.Path]; ok && prev.Size == e.Size && prev.Mtime == e.Mtime {
+			sum.SHA256 = prev.SHA256
+		} else {
+			digest, err := fileHash(filepath.Join(dir, filepath.FromSlash(e.Path)))
+			if err != nil {
+				return nil, err
+			}
+			sum.SHA256 = strings.TrimPrefix(digest, hashPrefix)
+		}
+		sums = append(sums, sum)
+	}
+	return sums, nil
+}
+
+// writeChecksums replaces the ChecksumFile of the archive tree dir, copying
+// it over with rsync if dir is remote
+func writeChecksums(ctx context.Context, dir string, sums []FileChecksum) error {
+	data, err := json.MarshalIndent(sums, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpDir := dir
+	if IsRemote(dir) {
+		tmpDir = ""
+	}
+	tmp, err := os.CreateTemp(tmpDir, ChecksumFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if IsRemote(dir) {
+		return execRsync(ctx, []string{tmp.Name(), dir + "/" + ChecksumFile}, nil)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, ChecksumFile))
+}
+
+// checkChecksums hashes the files under dir listed in sums and returns the
+// ones that are missing or differ. If sample is positive, only that many
+// files chosen at random are checked.
+func checkChecksums(ctx context.Context, dir string, sums []FileChecksum, sample int) ([]string, error) {
+	if sample > 0 && sample < len(sums) {
+		picked := make([]FileChecksum, 0, sample)
+		for _, i := range rand.Perm(len(sums))[:sample] {
+			picked = append(picked, sums[i])
+		}
+		sums = picked
+	}
+	var bad []string
+	for _, sum := range sums {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(sum.Path))
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			bad = append(bad, "missing: "+sum.Path)
+			continue
+		case err != nil:
+			return nil, err
+		case info.Size() != sum.Size:
+			bad = append(bad, "size differs: "+sum.Path)
+			continue
+		}
+		digest, err := fileHash(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimPrefix(digest, hashPrefix) != sum.SHA256 {
+			bad = append(bad, "contents differ: "+sum.Path)
+		}
+	}
+	return bad, nil
+}
+
+// walkLess orders slash-separated paths the way filepath.Walk visits them,
+// comparing one path element at a time
+func walkLess(a, b string) bool {
+	return slices.Compare(strings.Split(a, "/"), strings.Split(b, "/")) < 0
+}
+
+// checksumsContentHash returns the ContentHash of a tree whose files are
+// exactly those listed in sums, without reading them
+func checksumsContentHash(sums []FileChecksum) (string, error) {
+	sums = slices.Clone(sums)
+	sort.Slice(sums, func(i, j int) bool { return walkLess(sums[i].Path, sums[j].Path) })
+	h := sha256.New()
+	for _, sum := range sums {
+		raw, err := hex.DecodeString(sum.SHA256)
+		if err != nil {
+			return "", fmt.Errorf("invalid checksum for %s: %w", sum.Path, err)
+		}
+		fmt.Fprintf(h, "%s\x00", sum.Path)
+		h.Write(raw)
+	}
+	return digest(h), nil
+}
+
+// sumsCoverTree reports whether sums list exactly the tracked files under
+// dir, and if so returns the tree's ContentHash worked out from them
+func sumsCoverTree(ctx context.Context, dir string, sums []FileChecksum) (string, bool, error) {
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return "", false, err
+	}
+	if len(manifest) != len(sums) {
+		return "", false, nil
+	}
+	listed := make(map[string]bool, len(sums))
+	for _, sum := range sums {
+		listed[sum.Path] = true
+	}
+	for _, e := range manifest {
+		if !listed[e.Path] {
+			return "", false, nil
+		}
+	}
+	hash, err := checksumsContentHash(sums)
+	return hash, err == nil, err
+}
+
+// maxListedDiffs caps the differences summarizeDiffs names
+const maxListedDiffs = 5
+
+// summarizeDiffs joins the first few differences found for a message
+func summarizeDiffs(diffs []string) string {
+	if len(diffs) <= maxListedDiffs {
+		return strings.Join(diffs, "; ")
+	}
+	return fmt.Sprintf("%s; and %d more", strings.Join(diffs[:maxListedDiffs], "; "), len(diffs)-maxListedDiffs)
+}
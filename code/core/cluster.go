@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CheckoutsDir is the hidden directory in an archive category where each
+// machine sharing the archive lists the projects of that category it has
+// grabbed, one file per host, so prune --cluster on one machine can tell
+// what the others could free
+const CheckoutsDir = ".parkr-checkouts"
+
+// Checkout is a project grabbed on one machine, as listed in CheckoutsDir
+type Checkout struct {
+	Project   string `json:"project"`
+	LocalPath string `json:"local_path"`
+	Size      int64  `json:"size"` // -1 if the size could not be determined
+	// Safe is set when the local copy matched its last park, so removing
+	// it frees Size
+	Safe bool `json:"safe"`
+}
+
+// machineCheckouts is a machine's file in a category's CheckoutsDir
+type machineCheckouts struct {
+	Host      string     `json:"host"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Projects  []Checkout `json:"projects"`
+}
+
+// ClusterMachine is what another machine sharing the archive could free by
+// pruning, as of the last time it listed its checkouts
+type ClusterMachine struct {
+	Host      string    `json:"host"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Candidates are its checkouts that matched their last park, largest
+	// first
+	Candidates []Checkout `json:"candidates"`
+	Free       int64      `json:"free"`
+	// Dirty counts its checkouts with unparked work
+	Dirty int `json:"dirty"`
+}
+
+// checkoutRoots returns the local archive category directories of every
+// master, each once. Categories on another host are left out, as their
+// CheckoutsDir can't be written directly.
+func (s *State) checkoutRoots() []string {
+	var roots []string
+	seen := make(map[string]bool)
+	for master, categories := range s.Masters {
+		for _, categoryPath := range categories {
+			root := s.archiveRoot(master, categoryPath)
+			if IsRemote(root) || seen[root] {
+				continue
+			}
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// publishCheckouts lists this machine's grabbed projects in the
+// CheckoutsDir of their archive categories, and clears its list in the
+// categories it has none in. entries are the grabbed projects from a
+// report. Returns the categories that could not be written.
+func publishCheckouts(state *State, host string, entries []ReportEntry, now time.Time) []error {
+	byRoot := make(map[string][]Checkout)
+	for _, e := range entries {
+		project := state.Projects[e.Name]
+		if project == nil || !project.IsGrabbed || e.Status == StatusMissingLocal {
+			continue
+		}
+		categoryPath, ok := state.Masters[project.Master][project.ArchiveCategory]
+		if !ok {
+			continue
+		}
+		root := state.archiveRoot(project.Master, categoryPath)
+		byRoot[root] = append(byRoot[root], Checkout{
+			Project:   e.Name,
+			LocalPath: e.LocalPath,
+			Size:      e.LocalSize,
+			Safe:      e.Status == StatusSafe,
+		})
+	}
+
+	var errs []error
+	for _, root := range state.checkoutRoots() {
+		path := filepath.Join(root, CheckoutsDir, host+".json")
+		projects := byRoot[root]
+		if len(projects) == 0 {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("failed to clear %s: %w", path, err))
+			}
+			continue
+		}
+		if err := writeCheckouts(path, machineCheckouts{Host: host, UpdatedAt: now, Projects: projects}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// writeCheckouts replaces a machine's file in a CheckoutsDir
+func writeCheckouts(path string, list machineCheckouts) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize checkouts: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// readClusterMachines reads the other machines' lists from every local
+// category's CheckoutsDir and sums up what each could free. Unreadable
+// lists are skipped.
+func readClusterMachines(state *State, host string) []ClusterMachine {
+	machines := make(map[string]*ClusterMachine)
+	for _, root := range state.checkoutRoots() {
+		dir := filepath.Join(root, CheckoutsDir)
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+			if err != nil {
+				continue
+			}
+			var list machineCheckouts
+			if json.Unmarshal(data, &list) != nil || list.Host == "" || list.Host == host {
+				continue
+			}
+			m := machines[list.Host]
+			if m == nil {
+				m = &ClusterMachine{Host: list.Host, Candidates: []Checkout{}}
+				machines[list.Host] = m
+			}
+			if list.UpdatedAt.After(m.UpdatedAt) {
+				m.UpdatedAt = list.UpdatedAt
+			}
+			for _, c := range list.Projects {
+				if !c.Safe {
+					m.Dirty++
+					continue
+				}
+				m.Candidates = append(m.Candidates, c)
+				m.Free += max(c.Size, 0)
+			}
+		}
+	}
+
+	result := make([]ClusterMachine, 0, len(machines))
+	for _, m := range machines {
+		sort.Slice(m.Candidates, func(i, j int) bool { return m.Candidates[i].Size > m.Candidates[j].Size })
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Host < result[j].Host })
+	return result
+}
@@ -0,0 +1,578 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Output styles for the output setting
+const (
+	OutputText  = "text"
+	OutputPlain = "plain"
+)
+
+// ConfigKey is a setting that can be changed with "parkr config set"
+type ConfigKey struct {
+	Name        string
+	Description string
+	get         func(s *Settings) string
+	// set applies a value; "" restores the default
+	set func(s *Settings, value string) error
+}
+
+// configKeys lists the settable configuration keys in display order
+var configKeys = []ConfigKey{
+	{
+		Name:        "metadata_file",
+		Description: "File read for a project's description on park (default: README)",
+		get:         func(s *Settings) string { return s.MetadataFile },
+		set: func(s *Settings, value string) error {
+			s.MetadataFile = value
+			return nil
+		},
+	},
+	{
+		Name:        "recent_park_size",
+		Description: "Projects at least this large need a recent park before removal (e.g. 10G)",
+		get:         func(s *Settings) string { return s.RecentParkSize },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				if _, err := ParseSize(value); err != nil {
+					return err
+				}
+			}
+			s.RecentParkSize = value
+			return nil
+		},
+	},
+	{
+		Name:        "recent_park_hours",
+		Description: "How recent that park must be, in hours",
+		get: func(s *Settings) string {
+			if s.RecentParkHours == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.RecentParkHours)
+		},
+		set: func(s *Settings, value string) error {
+			hours, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.RecentParkHours = hours
+			return nil
+		},
+	},
+	{
+		Name:        "prune_verify_days",
+		Description: "Prune only removes projects whose archive copy was scrubbed within this many days",
+		get: func(s *Settings) string {
+			if s.PruneVerifyDays == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.PruneVerifyDays)
+		},
+		set: func(s *Settings, value string) error {
+			days, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.PruneVerifyDays = days
+			return nil
+		},
+	},
+	{
+		Name:        "prune_verify_action",
+		Description: "For copies not scrubbed recently: verify (scrub before removal) or block",
+		get:         func(s *Settings) string { return s.PruneVerifyAction },
+		set: func(s *Settings, value string) error {
+			if value != "" && value != VerifyActionScrub && value != VerifyActionBlock {
+				return fmt.Errorf("invalid action '%s' (expected verify or block)", value)
+			}
+			s.PruneVerifyAction = value
+			return nil
+		},
+	},
+	{
+		Name:        "verification",
+		Description: "How park records and rm checks projects: hash, mtime or git (per project with --project)",
+		get:         func(s *Settings) string { return s.Verification },
+		set: func(s *Settings, value string) error {
+			if err := validVerification(value); err != nil {
+				return err
+			}
+			s.Verification = value
+			return nil
+		},
+	},
+	{
+		Name:        "transfer_jobs",
+		Description: "How many rsync processes grab and park run at once (default 1)",
+		get: func(s *Settings) string {
+			if s.TransferJobs == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.TransferJobs)
+		},
+		set: func(s *Settings, value string) error {
+			jobs, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.TransferJobs = jobs
+			return nil
+		},
+	},
+	{
+		Name:        "bwlimit",
+		Description: "Transfer rate limit for grab, park, pull and add, per second (e.g. 5M)",
+		get:         func(s *Settings) string { return s.BandwidthLimit },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				if _, err := ParseSize(value); err != nil {
+					return err
+				}
+			}
+			s.BandwidthLimit = value
+			return nil
+		},
+	},
+	{
+		Name:        "trash_days",
+		Description: "Keep archive files that park deletes or overwrites in a trash directory for this many days",
+		get: func(s *Settings) string {
+			if s.TrashDays == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.TrashDays)
+		},
+		set: func(s *Settings, value string) error {
+			days, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.TrashDays = days
+			return nil
+		},
+	},
+	{
+		Name:        "digest_email",
+		Description: "Address 'parkr digest --send' emails the health digest to",
+		get:         func(s *Settings) string { return s.DigestEmail },
+		set: func(s *Settings, value string) error {
+			if value != "" && !strings.Contains(value, "@") {
+				return fmt.Errorf("invalid email address '%s'", value)
+			}
+			s.DigestEmail = value
+			return nil
+		},
+	},
+	{
+		Name:        "digest_smtp",
+		Description: "SMTP server (host:port) digests are emailed through; credentials come from PARKR_SMTP_USER and PARKR_SMTP_PASSWORD",
+		get:         func(s *Settings) string { return s.DigestSMTP },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				if _, port, ok := strings.Cut(value, ":"); !ok || port == "" {
+					return fmt.Errorf("invalid SMTP server '%s' (expected host:port)", value)
+				}
+			}
+			s.DigestSMTP = value
+			return nil
+		},
+	},
+	{
+		Name:        "digest_from",
+		Description: "Sender address of digest emails (default: digest_email)",
+		get:         func(s *Settings) string { return s.DigestFrom },
+		set: func(s *Settings, value string) error {
+			s.DigestFrom = value
+			return nil
+		},
+	},
+	{
+		Name:        "digest_webhook",
+		Description: "URL 'parkr digest --send' posts the health digest to as JSON",
+		get:         func(s *Settings) string { return s.DigestWebhook },
+		set: func(s *Settings, value string) error {
+			if value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+				return fmt.Errorf("invalid webhook URL '%s' (expected http:// or https://)", value)
+			}
+			s.DigestWebhook = value
+			return nil
+		},
+	},
+	{
+		Name:        "digest_stale_days",
+		Description: "The digest lists unparked work and scrubs older than this many days (default 14)",
+		get: func(s *Settings) string {
+			if s.DigestStaleDays == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.DigestStaleDays)
+		},
+		set: func(s *Settings, value string) error {
+			days, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.DigestStaleDays = days
+			return nil
+		},
+	},
+	{
+		Name:        "fast_hash_over",
+		Description: "Hash only the size and both ends of files larger than this (e.g. 1G); empty hashes every byte",
+		get:         func(s *Settings) string { return s.FastHashOver },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				if _, err := ParseSize(value); err != nil {
+					return err
+				}
+			}
+			s.FastHashOver = value
+			return nil
+		},
+	},
+	{
+		Name:        "fast_hash_chunk",
+		Description: "How much of each end of a large file fast_hash_over reads (default 4M)",
+		get:         func(s *Settings) string { return s.FastHashChunk },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				size, err := ParseSize(value)
+				if err != nil {
+					return err
+				}
+				if size <= 0 {
+					return fmt.Errorf("invalid value '%s' (expected a positive size)", value)
+				}
+			}
+			s.FastHashChunk = value
+			return nil
+		},
+	},
+	{
+		Name:        "verify_severity",
+		Description: "Verify finding severities, e.g. untracked-local=error,category:scratch=ignore",
+		get:         func(s *Settings) string { return formatVerifySeverity(s.VerifySeverity) },
+		set: func(s *Settings, value string) error {
+			rules, err := parseVerifySeverity(value)
+			if err != nil {
+				return err
+			}
+			s.VerifySeverity = rules
+			return nil
+		},
+	},
+	{
+		Name:        "detect_rules",
+		Description: "Category detection rules tried in order before the built-in ones, e.g. go.mod=golang,*.sln=dotnet",
+		get:         func(s *Settings) string { return formatDetectRules(s.DetectRules) },
+		set: func(s *Settings, value string) error {
+			rules, err := parseDetectRules(value)
+			if err != nil {
+				return err
+			}
+			s.DetectRules = rules
+			return nil
+		},
+	},
+	{
+		Name:        "language_categories",
+		Description: "Categories for detected project languages, e.g. go=golang,rust=rust,java=java",
+		get:         func(s *Settings) string { return formatLanguageCategories(s.LanguageCategories) },
+		set: func(s *Settings, value string) error {
+			categories, err := parseLanguageCategories(value)
+			if err != nil {
+				return err
+			}
+			s.LanguageCategories = categories
+			return nil
+		},
+	},
+	{
+		Name:        "keep_versions",
+		Description: "Keep this many earlier archive copies of each project when park replaces them",
+		get: func(s *Settings) string {
+			if s.KeepVersions == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.KeepVersions)
+		},
+		set: func(s *Settings, value string) error {
+			n, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.KeepVersions = n
+			return nil
+		},
+	},
+	{
+		Name:        "preflight_verify",
+		Description: "Verify a project before rm or prune removes it, and refuse on errors (true or false)",
+		get: func(s *Settings) string {
+			if !s.PreflightVerify {
+				return ""
+			}
+			return "true"
+		},
+		set: func(s *Settings, value string) error {
+			if value == "" {
+				s.PreflightVerify = false
+				return nil
+			}
+			on, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' (expected true or false)", value)
+			}
+			s.PreflightVerify = on
+			return nil
+		},
+	},
+	{
+		Name:        "local_trash_days",
+		Description: "How many days local copies that rm removes stay in the local trash (default 7); off deletes them at once",
+		get: func(s *Settings) string {
+			switch {
+			case s.LocalTrashDays < 0:
+				return "off"
+			case s.LocalTrashDays == 0:
+				return ""
+			}
+			return strconv.Itoa(s.LocalTrashDays)
+		},
+		set: func(s *Settings, value string) error {
+			if value == "off" || value == "0" {
+				s.LocalTrashDays = -1
+				return nil
+			}
+			days, err := parsePositiveInt(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' (expected a positive whole number or off)", value)
+			}
+			s.LocalTrashDays = days
+			return nil
+		},
+	},
+	{
+		Name:        "event_hook",
+		Description: "Shell command run on every grab, park, rm, prune and dirty event, given PARKR_EVENT and PARKR_PROJECT",
+		get:         func(s *Settings) string { return s.EventHook },
+		set: func(s *Settings, value string) error {
+			s.EventHook = value
+			return nil
+		},
+	},
+	{
+		Name:        "event_webhook",
+		Description: "URL every grab, park, rm, prune and dirty event is posted to as JSON",
+		get:         func(s *Settings) string { return s.EventWebhook },
+		set: func(s *Settings, value string) error {
+			if value != "" && !strings.HasPrefix(value, "http://") && !strings.HasPrefix(value, "https://") {
+				return fmt.Errorf("invalid webhook URL '%s' (expected http:// or https://)", value)
+			}
+			s.EventWebhook = value
+			return nil
+		},
+	},
+	{
+		Name:        "metrics_endpoint",
+		Description: "Where each command's duration, failures and bytes are sent: statsd://host:port, or an OTLP/HTTP URL such as http://localhost:4318/v1/metrics (default: off)",
+		get:         func(s *Settings) string { return s.MetricsEndpoint },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				if err := ValidateMetricsEndpoint(value); err != nil {
+					return err
+				}
+			}
+			s.MetricsEndpoint = value
+			return nil
+		},
+	},
+	{
+		Name:        "metrics_prefix",
+		Description: "Prefix of the exported metric names (default parkr)",
+		get:         func(s *Settings) string { return s.MetricsPrefix },
+		set: func(s *Settings, value string) error {
+			if strings.ContainsAny(value, ":|@# \t\n") || strings.HasPrefix(value, ".") || strings.HasSuffix(value, ".") {
+				return fmt.Errorf("invalid metrics prefix '%s'", value)
+			}
+			s.MetricsPrefix = value
+			return nil
+		},
+	},
+	{
+		Name:        "remote_attempts",
+		Description: "How many times rsync and ssh to a remote master are tried when the connection fails (default 3, 1 disables retries)",
+		get: func(s *Settings) string {
+			if s.RemoteAttempts == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.RemoteAttempts)
+		},
+		set: func(s *Settings, value string) error {
+			attempts, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.RemoteAttempts = attempts
+			return nil
+		},
+	},
+	{
+		Name:        "include_hidden",
+		Description: "Treat directories whose names start with '.' as projects in the archive and local scans (true or false)",
+		get: func(s *Settings) string {
+			if !s.IncludeHidden {
+				return ""
+			}
+			return "true"
+		},
+		set: func(s *Settings, value string) error {
+			if value == "" {
+				s.IncludeHidden = false
+				return nil
+			}
+			on, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' (expected true or false)", value)
+			}
+			s.IncludeHidden = on
+			return nil
+		},
+	},
+	{
+		Name:        "max_grabbed",
+		Description: "How many projects can be grabbed at once before grab warns, or blocks with quota_mode enforce",
+		get: func(s *Settings) string {
+			if s.MaxGrabbed == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.MaxGrabbed)
+		},
+		set: func(s *Settings, value string) error {
+			n, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.MaxGrabbed = n
+			return nil
+		},
+	},
+	{
+		Name:        "max_grabbed_size",
+		Description: "Total local size of grabbed projects (e.g. 200G) before grab warns, or blocks with quota_mode enforce",
+		get:         func(s *Settings) string { return s.MaxGrabbedSize },
+		set: func(s *Settings, value string) error {
+			if value != "" {
+				if _, err := ParseSize(value); err != nil {
+					return err
+				}
+			}
+			s.MaxGrabbedSize = value
+			return nil
+		},
+	},
+	{
+		Name:        "stale_grab_days",
+		Description: "Grab calls a project stale when its archive copy was last updated more than this many days ago (default 365)",
+		get: func(s *Settings) string {
+			if s.StaleGrabDays == 0 {
+				return ""
+			}
+			return strconv.Itoa(s.StaleGrabDays)
+		},
+		set: func(s *Settings, value string) error {
+			days, err := parsePositiveInt(value)
+			if err != nil {
+				return err
+			}
+			s.StaleGrabDays = days
+			return nil
+		},
+	},
+	{
+		Name:        "stale_grab_action",
+		Description: "What grab does about a stale project: warn, confirm (ask first; needs --yes without a terminal) or off",
+		get:         func(s *Settings) string { return s.StaleGrabAction },
+		set: func(s *Settings, value string) error {
+			switch value {
+			case "", StaleGrabWarn, StaleGrabConfirm, StaleGrabOff:
+			default:
+				return fmt.Errorf("invalid action '%s' (expected warn, confirm or off)", value)
+			}
+			s.StaleGrabAction = value
+			return nil
+		},
+	},
+	{
+		Name:        "quota_mode",
+		Description: "Whether exceeding a category quota or grab limit warns or blocks grab (warn or enforce)",
+		get:         func(s *Settings) string { return s.QuotaMode },
+		set: func(s *Settings, value string) error {
+			if value != "" && value != QuotaWarn && value != QuotaEnforce {
+				return fmt.Errorf("invalid quota mode '%s' (expected warn or enforce)", value)
+			}
+			s.QuotaMode = value
+			return nil
+		},
+	},
+	{
+		Name:        "output",
+		Description: "Text output style: text, or plain for labeled fields without tables, symbols or redrawn lines, for screen readers",
+		get:         func(s *Settings) string { return s.Output },
+		set: func(s *Settings, value string) error {
+			if value != "" && value != OutputText && value != OutputPlain {
+				return fmt.Errorf("invalid output '%s' (expected text or plain)", value)
+			}
+			s.Output = value
+			return nil
+		},
+	},
+}
+
+// ConfigKeys returns the settable configuration keys
+func ConfigKeys() []ConfigKey {
+	return configKeys
+}
+
+// Value returns the key's current value in s, or "" if unset
+func (k ConfigKey) Value(s *Settings) string {
+	return k.get(s)
+}
+
+// parsePositiveInt parses a positive whole number, treating "" as 0
+func parsePositiveInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid value '%s' (expected a positive whole number)", value)
+	}
+	return n, nil
+}
+
+// findConfigKey looks up a configuration key by name
+func findConfigKey(name string) (ConfigKey, error) {
+	for _, k := range configKeys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	return ConfigKey{}, fmt.Errorf("unknown config key '%s'", name)
+}
+
+// SetConfig sets a configuration key. An empty value restores its default.
+func SetConfig(sm StateStore, name, value string) error {
+	key, err := findConfigKey(name)
+	if err != nil {
+		return err
+	}
+	return sm.Update(func(state *State) error {
+		return key.set(&state.Settings, value)
+	})
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readmeNames are the files checked, in order, for a project description
+var readmeNames = []string{"README.md", "README", "README.txt", "README.rst", "readme.md"}
+
+// maxDescriptionLen caps the length of a captured description
+const maxDescriptionLen = 120
+
+// ReadDescription returns a one-line description of the project in dir,
+// taken from the first line of text in metadataFile (if set) or its README.
+// Returns "" if no description is found.
+func ReadDescription(dir, metadataFile string) string {
+	names := readmeNames
+	if metadataFile != "" {
+		names = []string{metadataFile}
+	}
+
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		desc := firstTextLine(f)
+		f.Close()
+		if desc != "" {
+			return desc
+		}
+	}
+	return ""
+}
+
+// firstTextLine returns the first line of body text, skipping blank lines,
+// markup and badges. A markdown heading is used if there is no body text.
+func firstTextLine(f *os.File) string {
+	heading := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.Trim(line, "=-*~") == "" ||
+			strings.HasPrefix(line, "[![") || strings.HasPrefix(line, "<") {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if heading == "" {
+				heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			}
+			continue
+		}
+		return truncateDescription(line)
+	}
+	return truncateDescription(heading)
+}
+
+// truncateDescription shortens s to at most maxDescriptionLen bytes
+func truncateDescription(s string) string {
+	if len(s) > maxDescriptionLen {
+		return strings.TrimSpace(s[:maxDescriptionLen-3]) + "..."
+	}
+	return s
+}
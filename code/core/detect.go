@@ -0,0 +1,261 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DetectRule files a project under Category when a file in it matches
+// Pattern, a glob matched against the project's top-level entries, or
+// against paths below it if it contains a slash
+type DetectRule struct {
+	Pattern  string `json:"pattern"`
+	Category string `json:"category"`
+}
+
+// matches reports whether the rule matches a project directory whose
+// top-level entries are names
+func (r DetectRule) matches(projectPath string, names []string) bool {
+	first, rest, nested := strings.Cut(r.Pattern, "/")
+	for _, name := range names {
+		if ok, _ := filepath.Match(first, name); !ok {
+			continue
+		}
+		if !nested || globExists(filepath.Join(projectPath, name), strings.Split(rest, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// globExists reports whether a path below dir matches the glob segments
+func globExists(dir string, segments []string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(segments[0], entry.Name()); !ok {
+			continue
+		}
+		if len(segments) == 1 || globExists(filepath.Join(dir, entry.Name()), segments[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDetectRules parses the detect_rules setting: PATTERN=CATEGORY pairs
+// separated by commas, in priority order
+func parseDetectRules(value string) ([]DetectRule, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var rules []DetectRule
+	for _, pair := range strings.Split(value, ",") {
+		pattern, category, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid rule '%s' (expected PATTERN=CATEGORY)", pair)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+		}
+		if err := validCategoryName(category); err != nil {
+			return nil, err
+		}
+		rules = append(rules, DetectRule{Pattern: pattern, Category: category})
+	}
+	return rules, nil
+}
+
+// formatDetectRules formats rules the way parseDetectRules reads them
+func formatDetectRules(rules []DetectRule) string {
+	pairs := make([]string, 0, len(rules))
+	for _, r := range rules {
+		pairs = append(pairs, r.Pattern+"="+r.Category)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// DetectCategory guesses the archive category for a project directory the
+// way add does: by the detect_rules setting, then as DetectProjectCategory
+// does with the language_categories setting applied
+func DetectCategory(sm StateStore, projectPath string) (string, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return "", err
+	}
+	return state.Settings.detectCategory(projectPath), nil
+}
+
+// detectCategory returns the category of the first of the settings'
+// detection rules that matches the project, else the category of the
+// project's language
+func (s *Settings) detectCategory(projectPath string) string {
+	if len(s.DetectRules) > 0 {
+		var names []string
+		if entries, err := os.ReadDir(projectPath); err == nil {
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+		}
+		for _, r := range s.DetectRules {
+			if r.matches(projectPath, names) {
+				return r.Category
+			}
+		}
+	}
+	return detectProjectCategory(projectPath, s.LanguageCategories)
+}
+
+// CategoryDetector inspects a project directory and returns the archive
+// category it belongs in, or "" if it does not recognise the project
+type CategoryDetector func(projectPath string) string
+
+var (
+	detectorsMu       sync.RWMutex
+	categoryDetectors []CategoryDetector
+)
+
+// RegisterCategoryDetector adds a detector consulted by DetectProjectCategory.
+// Registered detectors run before the built-in rules, most recent first.
+func RegisterCategoryDetector(d CategoryDetector) {
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	categoryDetectors = append([]CategoryDetector{d}, categoryDetectors...)
+}
+
+// DetectProjectCategory guesses the archive category for a project directory
+func DetectProjectCategory(projectPath string) string {
+	return detectProjectCategory(projectPath, nil)
+}
+
+// detectProjectCategory runs the registered detectors, then files the
+// project by its language, looking the language's category up in
+// categories before DefaultLanguageCategories
+func detectProjectCategory(projectPath string, categories map[string]string) string {
+	detectorsMu.RLock()
+	detectors := categoryDetectors
+	detectorsMu.RUnlock()
+
+	for _, d := range detectors {
+		if category := d(projectPath); category != "" {
+			return category
+		}
+	}
+
+	language := DetectProjectLanguage(projectPath)
+	if category, ok := categories[language]; ok {
+		return category
+	}
+	if category, ok := DefaultLanguageCategories[language]; ok {
+		return category
+	}
+	return "code"
+}
+
+// Project languages recognised by DetectProjectLanguage
+const (
+	LanguagePython = "python"
+	LanguageR      = "r"
+	LanguageGo     = "go"
+	LanguageRust   = "rust"
+	LanguageJava   = "java"
+	LanguageNode   = "node"
+)
+
+// DefaultLanguageCategories is the category projects of each language are
+// filed under unless the language_categories setting says otherwise
+var DefaultLanguageCategories = map[string]string{
+	LanguagePython: "pycharm",
+	LanguageR:      "rstudio",
+	LanguageGo:     "code",
+	LanguageRust:   "code",
+	LanguageJava:   "code",
+	LanguageNode:   "code",
+}
+
+// languageMarkers lists the files that identify a project's language, in
+// the order languages are tried. Node comes last because projects in other
+// languages often carry a package.json for their tooling.
+var languageMarkers = []struct {
+	Language string
+	Files    []string
+	Suffixes []string
+}{
+	{LanguagePython, []string{"pyproject.toml", "requirements.txt", "setup.py"}, nil},
+	{LanguageR, []string{"DESCRIPTION"}, []string{".Rproj"}},
+	{LanguageGo, []string{"go.mod"}, nil},
+	{LanguageRust, []string{"Cargo.toml"}, nil},
+	{LanguageJava, []string{"pom.xml", "build.gradle", "build.gradle.kts"}, nil},
+	{LanguageNode, []string{"package.json"}, nil},
+}
+
+// DetectProjectLanguage returns the language of a project directory by
+// the files at its top level, or "" if none is recognised
+func DetectProjectLanguage(projectPath string) string {
+	entries, err := os.ReadDir(projectPath)
+	if err != nil {
+		return ""
+	}
+	for _, m := range languageMarkers {
+		for _, entry := range entries {
+			if slices.Contains(m.Files, entry.Name()) {
+				return m.Language
+			}
+			for _, suffix := range m.Suffixes {
+				if strings.HasSuffix(entry.Name(), suffix) {
+					return m.Language
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// parseLanguageCategories parses the language_categories setting:
+// LANGUAGE=CATEGORY pairs separated by commas
+func parseLanguageCategories(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	categories := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		language, category, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping '%s' (expected LANGUAGE=CATEGORY)", pair)
+		}
+		if _, known := DefaultLanguageCategories[language]; !known {
+			languages := slices.Sorted(maps.Keys(DefaultLanguageCategories))
+			return nil, fmt.Errorf("unknown language '%s' (expected one of %s)", language, strings.Join(languages, ", "))
+		}
+		if err := validCategoryName(category); err != nil {
+			return nil, err
+		}
+		categories[language] = category
+	}
+	return categories, nil
+}
+
+// formatLanguageCategories formats categories the way
+// parseLanguageCategories reads them
+func formatLanguageCategories(categories map[string]string) string {
+	pairs := make([]string, 0, len(categories))
+	for language, category := range categories {
+		pairs = append(pairs, language+"="+category)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDigestStaleDays is how old unparked work or a scrub gets before
+// the digest lists it, unless the digest_stale_days setting says otherwise
+const DefaultDigestStaleDays = 14
+
+// digestRecentParks caps the parks a Digest lists
+const digestRecentParks = 5
+
+// Digest summarises the health of this machine's checkouts and their
+// archive copies, to be read or sent on a schedule
+type Digest struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	StaleDays   int       `json:"stale_days"`
+	// Stale are grabbed projects with unparked work, or never parked,
+	// whose last park (or grab) is more than StaleDays old, oldest first
+	Stale []ReportEntry `json:"stale"`
+	// Grabbed and LocalTotal count the grabbed projects and their size
+	Grabbed    int   `json:"grabbed"`
+	LocalTotal int64 `json:"local_total"`
+	// Recoverable is the local space held by projects safe to delete
+	Recoverable int64 `json:"recoverable"`
+	// Disk is the local volume holding the home directory
+	Disk *DiskUsage `json:"disk,omitempty"`
+	// RecentParks are the latest parks, newest first
+	RecentParks []ReportEntry `json:"recent_parks"`
+	// Unscrubbed are tracked projects whose archive copy hasn't passed a
+	// scrub within StaleDays, or ever
+	Unscrubbed []DigestScrub `json:"unscrubbed"`
+	// Scrubbed counts the projects that passed a scrub within StaleDays
+	Scrubbed int `json:"scrubbed"`
+}
+
+// DigestScrub is when a project's archive copy last passed a scrub
+type DigestScrub struct {
+	Name       string     `json:"name"`
+	VerifiedAt *time.Time `json:"verified_at"` // nil if never
+}
+
+// BuildDigest gathers a Digest as of now. staleDays overrides the
+// digest_stale_days setting when positive; volumePath picks the volume
+// whose free space is reported.
+func BuildDigest(ctx context.Context, sm StateStore, staleDays int, volumePath string, now time.Time) (*Digest, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	if staleDays <= 0 {
+		staleDays = state.Settings.DigestStaleDays
+	}
+	if staleDays <= 0 {
+		staleDays = DefaultDigestStaleDays
+	}
+	report, err := BuildReport(ctx, sm, SortModified)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.AddDate(0, 0, -staleDays)
+	d := &Digest{
+		GeneratedAt: now,
+		StaleDays:   staleDays,
+		Stale:       []ReportEntry{},
+		Grabbed:     len(report.Projects),
+		LocalTotal:  report.LocalTotal,
+		Recoverable: report.Recoverable,
+		RecentParks: []ReportEntry{},
+		Unscrubbed:  []DigestScrub{},
+	}
+	if usage, err := GetDiskUsage(volumePath); err == nil {
+		d.Disk = usage
+	}
+
+	for _, e := range report.Projects {
+		if e.LastParkAt != nil {
+			d.RecentParks = append(d.RecentParks, e)
+		}
+		if e.Status != StatusDirty && e.Status != StatusNeverParked {
+			continue
+		}
+		since := e.LastParkAt
+		if since == nil {
+			since = state.Projects[e.Name].GrabbedAt
+		}
+		if since == nil || since.Before(cutoff) {
+			d.Stale = append(d.Stale, e)
+		}
+	}
+	sort.SliceStable(d.Stale, func(i, j int) bool {
+		return timeOrZero(d.Stale[i].LastParkAt).Before(timeOrZero(d.Stale[j].LastParkAt))
+	})
+	sort.SliceStable(d.RecentParks, func(i, j int) bool {
+		return d.RecentParks[i].LastParkAt.After(*d.RecentParks[j].LastParkAt)
+	})
+	if len(d.RecentParks) > digestRecentParks {
+		d.RecentParks = d.RecentParks[:digestRecentParks]
+	}
+
+	names := make([]string, 0, len(state.Projects))
+	for name := range state.Projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		verified := state.Projects[name].ArchiveVerifiedAt
+		if verified != nil && !verified.Before(cutoff) {
+			d.Scrubbed++
+			continue
+		}
+		d.Unscrubbed = append(d.Unscrubbed, DigestScrub{Name: name, VerifiedAt: verified})
+	}
+	return d, nil
+}
+
+// Healthy reports whether the digest found nothing needing attention
+func (d *Digest) Healthy() bool {
+	return len(d.Stale) == 0 && len(d.Unscrubbed) == 0
+}
+
+// DigestTargets returns where the settings send digests, as strings for
+// messages: the email address and webhook URL that are configured
+func (s *Settings) DigestTargets() []string {
+	var targets []string
+	if s.DigestEmail != "" {
+		targets = append(targets, s.DigestEmail)
+	}
+	if s.DigestWebhook != "" {
+		targets = append(targets, s.DigestWebhook)
+	}
+	return targets
+}
+
+// SendDigest delivers a digest, already rendered as subject and body, to
+// every target configured in the settings: by email through digest_smtp
+// and to digest_webhook as JSON. SMTP credentials, if the server needs
+// them, come from PARKR_SMTP_USER and PARKR_SMTP_PASSWORD.
+func SendDigest(ctx context.Context, settings *Settings, d *Digest, subject, body string) error {
+	targets := settings.DigestTargets()
+	if len(targets) == 0 {
+		return fmt.Errorf("no digest target configured; set digest_email or digest_webhook")
+	}
+	if settings.DigestEmail != "" {
+		if err := sendDigestEmail(settings, subject, body); err != nil {
+			return fmt.Errorf("failed to email digest to %s: %w", settings.DigestEmail, err)
+		}
+	}
+	if settings.DigestWebhook != "" {
+		if err := postDigestWebhook(ctx, settings.DigestWebhook, d, subject, body); err != nil {
+			return fmt.Errorf("failed to post digest to %s: %w", settings.DigestWebhook, err)
+		}
+	}
+	return nil
+}
+
+// sendDigestEmail sends a plain-text email through the digest_smtp server
+func sendDigestEmail(settings *Settings, subject, body string) error {
+	if settings.DigestSMTP == "" {
+		return fmt.Errorf("digest_smtp is not set")
+	}
+	from := settings.DigestFrom
+	if from == "" {
+		from = settings.DigestEmail
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", from, settings.DigestEmail, subject)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if user := os.Getenv("PARKR_SMTP_USER"); user != "" {
+		host, _, _ := strings.Cut(settings.DigestSMTP, ":")
+		auth = smtp.PlainAuth("", user, os.Getenv("PARKR_SMTP_PASSWORD"), host)
+	}
+	return smtp.SendMail(settings.DigestSMTP, auth, from, []string{settings.DigestEmail}, []byte(msg.String()))
+}
+
+// postDigestWebhook posts a digest as JSON. The text field holds the
+// rendered digest, which chat services such as Slack show as the message.
+func postDigestWebhook(ctx context.Context, url string, d *Digest, subject, body string) error {
+	payload, err := json.Marshal(struct {
+		Text   string  `json:"text"`
+		Digest *Digest `json:"digest"`
+	}{subject + "\n\n" + body, d})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server replied %s", resp.Status)
+	}
+	return nil
+}
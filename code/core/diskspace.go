@@ -0,0 +1,27 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiskUsage describes the capacity of a volume
+type DiskUsage struct {
+	Total int64 `json:"total"`
+	Free  int64 `json:"free"`
+}
+
+// ParseFreeTarget parses a desired free-space level, either an absolute size
+// (50G) or a percentage of the volume (20%), into bytes for the given volume
+func ParseFreeTarget(s string, usage *DiskUsage) (int64, error) {
+	str := strings.TrimSpace(s)
+	if pct, ok := strings.CutSuffix(str, "%"); ok {
+		value, err := strconv.ParseFloat(pct, 64)
+		if err != nil || value < 0 || value > 100 {
+			return 0, fmt.Errorf("invalid free-space percentage '%s'", s)
+		}
+		return int64(float64(usage.Total) * value / 100), nil
+	}
+	return ParseSize(str)
+}
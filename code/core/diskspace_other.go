@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd)
+
+package core
+
+import "fmt"
+
+// GetDiskUsage is not supported on this platform
+func GetDiskUsage(path string) (*DiskUsage, error) {
+	return nil, fmt.Errorf("disk usage is not supported on this platform")
+}
+
+// volumeID is not supported on this platform
+func volumeID(path string) (uint64, error) {
+	return 0, fmt.Errorf("volumes are not supported on this platform")
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd
+
+package core
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// GetDiskUsage returns the total and available bytes on the volume holding path
+func GetDiskUsage(path string) (*DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, fmt.Errorf("failed to stat filesystem at %s: %w", path, err)
+	}
+
+	bsize := int64(st.Bsize)
+	return &DiskUsage{
+		Total: int64(st.Blocks) * bsize,
+		Free:  int64(st.Bavail) * bsize,
+	}, nil
+}
+
+// volumeID identifies the volume holding path, so paths can be grouped by
+// the volume they free space on
+func volumeID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return uint64(st.Dev), nil
+}
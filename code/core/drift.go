@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"os"
+	"sort"
+)
+
+// Drift directions reported by Drift
+const (
+	DriftInSync         = "in-sync"         // Both copies match
+	DriftLocalAhead     = "local-ahead"     // Only the local copy changed since the last sync; park to catch up
+	DriftArchiveAhead   = "archive-ahead"   // Only the archive copy changed; pull to catch up
+	DriftDiverged       = "diverged"        // Both changed since the last sync
+	DriftDiffers        = "differs"         // The copies differ, but no sync was recorded to tell which changed
+	DriftLocalMissing   = "local-missing"   // The local copy is gone
+	DriftArchiveMissing = "archive-missing" // The archive copy is gone
+	DriftUnknown        = "unknown"         // The archive copy couldn't be listed
+)
+
+// DriftEntry compares the local and archive copies of a grabbed project
+type DriftEntry struct {
+	Name        string `json:"name"`
+	LocalPath   string `json:"local_path"`
+	ArchivePath string `json:"archive_path"`
+	Drift       string `json:"drift"`
+	// LocalOnly and ArchiveOnly count the files only one copy has, and
+	// Changed those whose size or mtime differ between them
+	LocalOnly   int `json:"local_only"`
+	ArchiveOnly int `json:"archive_only"`
+	Changed     int `json:"changed"`
+	// LocalBytes and ArchiveBytes are the sizes of those files on each side
+	LocalBytes   int64 `json:"local_bytes"`
+	ArchiveBytes int64 `json:"archive_bytes"`
+	// Error says why the drift is unknown
+	Error string `json:"error,omitempty"`
+}
+
+// Drift compares the manifests of the local and archive copies of the
+// named grabbed projects, or all of them, sorted by name. The fingerprint
+// recorded at each project's last grab, park or pull tells which side
+// changed since. Remote archive copies are listed from their ChecksumFile.
+func Drift(ctx context.Context, sm StateStore, names []string) ([]DriftEntry, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	ctx = state.Settings.withRemoteRetries(ctx)
+
+	if len(names) == 0 {
+		for name, project := range state.Projects {
+			if project.IsGrabbed {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	entries := make([]DriftEntry, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		project, ok := state.Projects[name]
+		if !ok || !project.IsGrabbed {
+			return nil, errorf(ErrNotGrabbed, "project '%s' is not currently grabbed", name)
+		}
+		archivePath, err := state.GetArchivePath(name)
+		if err != nil {
+			return nil, err
+		}
+		entry := DriftEntry{Name: name, LocalPath: project.LocalPath, ArchivePath: archivePath}
+		if err := compareCopies(ctx, state.ageKeys(project.Master), project, &entry); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			entry.Drift = DriftUnknown
+			entry.Error = err.Error()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// compareCopies fills in the drift between a project's local copy and the
+// archive copy at entry.ArchivePath
+func compareCopies(ctx context.Context, keys ageKeys, project *Project, entry *DriftEntry) error {
+	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
+		entry.Drift = DriftLocalMissing
+		return nil
+	}
+	if exists, err := archivePathExists(ctx, entry.ArchivePath); err != nil {
+		return err
+	} else if !exists {
+		entry.Drift = DriftArchiveMissing
+		return nil
+	}
+
+	local, err := BuildManifest(ctx, project.LocalPath)
+	if err != nil {
+		return err
+	}
+	archive, err := archiveManifest(ctx, entry.ArchivePath, keys)
+	if err != nil {
+		return err
+	}
+	if archive == nil {
+		entry.Drift = DriftUnknown
+		entry.Error = "the remote archive copy has no " + ChecksumFile + " to list it by"
+		return nil
+	}
+
+	archiveFiles := make(map[string]ManifestEntry, len(archive))
+	for _, e := range archive {
+		archiveFiles[e.Path] = e
+	}
+	for _, e := range local {
+		other, ok := archiveFiles[e.Path]
+		delete(archiveFiles, e.Path)
+		switch {
+		case !ok:
+			entry.LocalOnly++
+			entry.LocalBytes += e.Size
+		case other.Size != e.Size || other.Mtime != e.Mtime:
+			entry.Changed++
+			entry.LocalBytes += e.Size
+			entry.ArchiveBytes += other.Size
+		}
+	}
+	for _, e := range archiveFiles {
+		entry.ArchiveOnly++
+		entry.ArchiveBytes += e.Size
+	}
+
+	baseline := project.ArchiveFingerprint
+	localChanged := manifestFingerprint(local) != baseline
+	archiveChanged := manifestFingerprint(archive) != baseline
+	switch {
+	case entry.LocalOnly+entry.ArchiveOnly+entry.Changed == 0:
+		entry.Drift = DriftInSync
+	case baseline == "":
+		entry.Drift = DriftDiffers
+	case localChanged && archiveChanged:
+		entry.Drift = DriftDiverged
+	case archiveChanged:
+		entry.Drift = DriftArchiveAhead
+	default:
+		entry.Drift = DriftLocalAhead
+	}
+	return nil
+}
+
+// archiveManifest lists the files of an archive copy. A remote copy is
+// listed from its ChecksumFile, and is nil if it has none.
+func archiveManifest(ctx context.Context, archivePath string, keys ageKeys) ([]ManifestEntry, error) {
+	if IsRemote(archivePath) {
+		sums, err := loadChecksums(ctx, archivePath)
+		if err != nil || sums == nil {
+			return nil, err
+		}
+		manifest := make([]ManifestEntry, 0, len(sums))
+		for _, sum := range sums {
+			manifest = append(manifest, ManifestEntry{Path: sum.Path, Size: sum.Size, Mtime: sum.Mtime})
+		}
+		sort.Slice(manifest, func(i, j int) bool { return walkLess(manifest[i].Path, manifest[j].Path) })
+		return manifest, nil
+	}
+	dir, cleanup, err := archiveDir(ctx, archivePath, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return BuildManifest(ctx, dir)
+}
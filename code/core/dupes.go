@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// HashIndexEntry caches the hashes of one archived project
+type HashIndexEntry struct {
+	Path         string    `json:"path"`
+	Fingerprint  string    `json:"fingerprint"`
+	ContentHash  string    `json:"content_hash"`
+	ManifestHash string    `json:"manifest_hash"`
+	Size         int64     `json:"size"`
+	Files        int       `json:"files"`
+	IndexedAt    time.Time `json:"indexed_at"`
+}
+
+// HashIndex maps project names to their cached archive hashes
+type HashIndex map[string]*HashIndexEntry
+
+// HashIndexPath returns the hash index file kept next to a state file
+func HashIndexPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "hash-index.json")
+}
+
+// LoadHashIndex reads the hash index. A missing or unreadable index is
+// treated as empty, since it can always be rebuilt.
+func LoadHashIndex(statePath string) HashIndex {
+	index := make(HashIndex)
+	data, err := os.ReadFile(HashIndexPath(statePath))
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return make(HashIndex)
+	}
+	return index
+}
+
+// Save writes the hash index next to the state file
+func (idx HashIndex) Save(statePath string) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize hash index: %w", err)
+	}
+	if err := os.WriteFile(HashIndexPath(statePath), data, 0644); err != nil {
+		return fmt.Errorf("failed to write hash index: %w", err)
+	}
+	return nil
+}
+
+// DuplicateGroup is a set of archived projects with matching hashes
+type DuplicateGroup struct {
+	// Kind is "identical" for matching contents, or "manifest" for matching
+	// file lists and sizes with differing contents
+	Kind     string   `json:"kind"`
+	Hash     string   `json:"hash"`
+	Projects []string `json:"projects"`
+	Size     int64    `json:"size"`
+}
+
+// Duplicate kinds
+const (
+	DupeIdentical = "identical"
+	DupeManifest  = "manifest"
+)
+
+// UpdateHashIndex hashes every archived project whose files have changed
+// since it was last indexed, drops projects no longer in the archive and
+// saves the index next to statePath. Projects on remote masters are not
+// indexed. Returns the updated index and the number of projects rehashed.
+func UpdateHashIndex(ctx context.Context, sm StateStore, statePath string, rehash bool) (HashIndex, int, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, 0, err
+	}
+	archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	old := LoadHashIndex(statePath)
+	index := make(HashIndex, len(archiveProjects))
+	hashed := 0
+	for name, ap := range archiveProjects {
+		if IsRemote(ap.Path) {
+			continue
+		}
+		prev := old[name]
+		if rehash {
+			prev = nil
+		}
+		entry, err := indexArchiveCopy(ctx, ap.Path, state.ageKeys(ap.Master), prev)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, 0, ctxErr
+			}
+			return nil, 0, err
+		}
+		if entry != prev {
+			hashed++
+		}
+		index[name] = entry
+	}
+
+	if err := index.Save(statePath); err != nil {
+		return nil, 0, err
+	}
+	return index, hashed, nil
+}
+
+// FindDuplicates groups indexed projects with identical contents, then
+// groups the remaining projects that share a manifest. Empty projects are
+// ignored. Groups are ordered largest first.
+func FindDuplicates(index HashIndex) []DuplicateGroup {
+	group := func(kind string, key func(*HashIndexEntry) string, skip map[string]bool) []DuplicateGroup {
+		byHash := make(map[string][]string)
+		for name, e := range index {
+			if e.Files == 0 || skip[name] {
+				continue
+			}
+			byHash[key(e)] = append(byHash[key(e)], name)
+		}
+
+		var groups []DuplicateGroup
+		for h, names := range byHash {
+			if len(names) < 2 {
+				continue
+			}
+			sort.Strings(names)
+			groups = append(groups, DuplicateGroup{Kind: kind, Hash: h, Projects: names, Size: index[names[0]].Size})
+		}
+		return groups
+	}
+
+	groups := group(DupeIdentical, func(e *HashIndexEntry) string { return e.ContentHash }, nil)
+	identical := make(map[string]bool)
+	for _, g := range groups {
+		for _, name := range g.Projects {
+			identical[name] = true
+		}
+	}
+	groups = append(groups, group(DupeManifest, func(e *HashIndexEntry) string { return e.ManifestHash }, identical)...)
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Projects[0] < groups[j].Projects[0]
+	})
+	return groups
+}
+
+// indexArchiveCopy hashes the archive copy at path, reusing prev if the
+// copy's fingerprint shows it is unchanged
+func indexArchiveCopy(ctx context.Context, path string, keys ageKeys, prev *HashIndexEntry) (*HashIndexEntry, error) {
+	dir, cleanup, err := archiveDir(ctx, path, keys)
+	if err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to read %s: %w", path, err)
+	}
+	defer cleanup()
+
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to scan %s: %w", path, err)
+	}
+	fingerprint := manifestFingerprint(manifest)
+	if prev != nil && prev.Path == path && prev.Fingerprint == fingerprint {
+		return prev, nil
+	}
+
+	contentHash, err := ContentHash(ctx, dir, manifest)
+	if err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to hash %s: %w", path, err)
+	}
+	entry := &HashIndexEntry{
+		Path:         path,
+		Fingerprint:  fingerprint,
+		ContentHash:  contentHash,
+		ManifestHash: ManifestHash(manifest),
+		Files:        len(manifest),
+		IndexedAt:    time.Now(),
+	}
+	for _, e := range manifest {
+		entry.Size += e.Size
+	}
+	return entry, nil
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// AgeExt is added to the extension of archive files encrypted with age
+const AgeExt = ".age"
+
+// EncryptedExt is the file extension of projects parked to a tree master
+// with encryption enabled: a StorageTarZst tarball encrypted with age
+const EncryptedExt = TarballExt + AgeExt
+
+// isEncryptedArchive reports whether an archive path is an encrypted project
+func isEncryptedArchive(p string) bool {
+	_, encrypted, ok := packedBackend(p)
+	return ok && encrypted
+}
+
+// ageKeys are the age keys a master's archive copies are encrypted to and
+// decrypted with
+type ageKeys struct {
+	recipient string // Public key, or a file of them; empty if unencrypted
+	identity  string // Private key file; may be empty on park-only machines
+}
+
+// ageKeys returns a master's encryption keys
+func (s *State) ageKeys(master string) ageKeys {
+	settings := s.Settings.Masters[master]
+	return ageKeys{recipient: settings.Recipient, identity: settings.Identity}
+}
+
+// SetMasterEncryption makes a master encrypt parked projects to recipient,
+// an age public key or a file listing several, and decrypt them with the
+// identity file, which may be omitted on machines that only park. A
+// recipients file must be given by its absolute path, as parks may run
+// from any directory. An empty recipient turns encryption off. Existing
+// projects are converted the next time they are parked.
+func SetMasterEncryption(sm StateStore, master, recipient, identity string) error {
+	if recipient == "" && identity != "" {
+		return fmt.Errorf("an identity needs a recipient to encrypt to")
+	}
+	if err := validRecipient(recipient); err != nil {
+		return err
+	}
+	if identity != "" {
+		if _, err := os.Stat(identity); err != nil {
+			return fmt.Errorf("invalid identity file: %w", err)
+		}
+	}
+	return sm.Update(func(state *State) error {
+		if recipient != "" && state.hasRemoteRoot(master) {
+			return fmt.Errorf("master '%s' is on a remote host; encryption needs a local or mounted archive", master)
+		}
+		return state.updateMasterSettings(master, func(settings *MasterSettings) error {
+			settings.Recipient = recipient
+			settings.Identity = identity
+			return nil
+		})
+	})
+}
+
+// validRecipient checks a master's recipient: an age or SSH public key, or
+// the absolute path of a recipients file
+func validRecipient(recipient string) error {
+	if recipient == "" {
+		return nil
+	}
+	if info, err := os.Stat(recipient); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("invalid recipient: %s is a directory", recipient)
+		}
+		if !filepath.IsAbs(recipient) {
+			return fmt.Errorf("invalid recipient: give the recipients file %s as an absolute path", recipient)
+		}
+		return nil
+	}
+	for _, prefix := range []string{"age1", "ssh-ed25519 ", "ssh-rsa "} {
+		if strings.HasPrefix(recipient, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid recipient '%s' (expected an age public key such as age1..., an SSH public key, or a recipients file)", recipient)
+}
+
+// encryptTo runs age to encrypt what write produces into dst, killing age
+// if ctx is cancelled
+func (k ageKeys) encryptTo(ctx context.Context, dst string, write func(io.Writer) error) error {
+	flag := "-r"
+	if _, err := os.Stat(k.recipient); err == nil {
+		flag = "-R"
+	}
+	cmd := exec.CommandContext(ctx, "age", flag, k.recipient, "-o", dst)
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = pr
+	return runAge(ctx, cmd, pr, pw, func() error { return write(pw) })
+}
+
+// decryptFrom runs age to decrypt src and has read consume the result,
+// killing age if ctx is cancelled
+func (k ageKeys) decryptFrom(ctx context.Context, src string, read func(io.Reader) error) error {
+	if k.identity == "" {
+		return errorf(ErrMissingKey, "%s is encrypted and no identity is configured to decrypt it (see 'parkr master encrypt')", src)
+	}
+	cmd := exec.CommandContext(ctx, "age", "-d", "-i", k.identity, src)
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = pw
+	return runAge(ctx, cmd, pw, pr, func() error { return read(pr) })
+}
+
+// runAge starts cmd with theirs as its end of a pipe, runs use on ours,
+// closes it so age sees the end of its input or stops writing, and waits
+// for age
+func runAge(ctx context.Context, cmd *exec.Cmd, theirs, ours *os.File, use func() error) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	theirs.Close()
+	if err != nil {
+		ours.Close()
+		return fmt.Errorf("age failed: %w", err)
+	}
+	useErr := use()
+	ours.Close()
+	err = cmd.Wait()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("age interrupted: %w", ctxErr)
+	}
+	if err != nil {
+		return fmt.Errorf("age failed: %w\nOutput: %s", err, stderr.String())
+	}
+	return useErr
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned by core operations. Callers should test for
+// them with errors.Is, since they are usually wrapped with project details.
+var (
+	ErrProjectNotFound    = errors.New("project not found")
+	ErrAlreadyGrabbed     = errors.New("project already grabbed")
+	ErrNotGrabbed         = errors.New("project not grabbed")
+	ErrLocalPathExists    = errors.New("local path already exists")
+	ErrLocalPathMissing   = errors.New("local path missing")
+	ErrDirtyProject       = errors.New("project has unparked changes")
+	ErrHashUnavailable    = errors.New("hash verification unavailable")
+	ErrArchiveUnreachable = errors.New("archive not accessible")
+	ErrStateFile          = errors.New("state file error")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
+	ErrReadOnlyMaster     = errors.New("master is read-only")
+	ErrStalePark          = errors.New("last park too old")
+	ErrAmbiguousProject   = errors.New("ambiguous project name")
+	ErrUnverifiedArchive  = errors.New("archive copy not recently verified")
+	ErrArchiveMismatch    = errors.New("archive copy does not match local copy")
+	ErrFileNotFound       = errors.New("file not found in archive")
+	ErrProjectExists      = errors.New("project already exists")
+	ErrMissingKey         = errors.New("decryption key not configured")
+	ErrPreflightFailed    = errors.New("preflight verification failed")
+	ErrVersionNotFound    = errors.New("archive version not found")
+	ErrTrashNotFound      = errors.New("trashed copy not found")
+	ErrNothingToUndo      = errors.New("nothing to undo")
+	ErrStateLocked        = errors.New("state file locked")
+)
+
+// detailedError carries a full human-readable message while unwrapping to
+// both a sentinel error and any error wrapped by the message
+type detailedError struct {
+	sentinel error
+	err      error
+}
+
+func (e *detailedError) Error() string   { return e.err.Error() }
+func (e *detailedError) Unwrap() []error { return []error{e.sentinel, e.err} }
+
+// errorf formats a message like fmt.Errorf and tags it with a sentinel error
+func errorf(sentinel error, format string, args ...any) error {
+	return &detailedError{sentinel: sentinel, err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventDirty is published when a grabbed project is first seen with
+// unparked changes since its last grab or park
+const EventDirty = "dirty"
+
+// EventBus delivers project events to subscribers. Unlike Store.Subscribe,
+// which reports every change to the state file, it carries what happened
+// to a project, once, from the operation that did it. Subscribers run
+// synchronously in the order they subscribed, so a short-lived command
+// has delivered every event by the time the operation returns. The zero
+// value is ready to use.
+type EventBus struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]func(ProjectEvent)
+}
+
+// Subscribe calls fn with every event published from now on and returns a
+// function that cancels the subscription
+func (b *EventBus) Subscribe(fn func(ProjectEvent)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[int]func(ProjectEvent))
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// Publish delivers an event to every subscriber
+func (b *EventBus) Publish(e ProjectEvent) {
+	b.mu.Lock()
+	subs := make([]func(ProjectEvent), 0, len(b.subs))
+	for id := 0; id < b.next; id++ {
+		if fn, ok := b.subs[id]; ok {
+			subs = append(subs, fn)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(e)
+	}
+}
+
+// eventSource is implemented by state stores that carry an EventBus
+type eventSource interface {
+	Events() *EventBus
+}
+
+// publishEvent publishes an event on sm's bus, if it has one, filling in
+// the time and this machine's hostname
+func publishEvent(sm StateStore, e ProjectEvent) {
+	source, ok := sm.(eventSource)
+	if !ok {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Host == "" {
+		e.Host, _ = os.Hostname()
+	}
+	source.Events().Publish(e)
+}
+
+// sizePtr returns a pointer to size, or nil if it is unknown or zero
+func sizePtr(size int64) *int64 {
+	if size <= 0 {
+		return nil
+	}
+	return &size
+}
+
+// stateTryLocker is implemented by state stores whose lock can be tried
+// without waiting
+type stateTryLocker interface {
+	TryLock() (unlock func(), ok bool, err error)
+}
+
+// noteDirty marks the report's dirty and conflicted projects as seen dirty
+// and publishes EventDirty for each one that wasn't already. The state file
+// is only written when there is such a project. Reports are read-only
+// commands, so when another parkr run holds the state lock, e.g. a long
+// park being watched with status --watch, the projects are left for a later
+// report rather than waiting for it.
+func noteDirty(sm StateStore, state *State, entries []ReportEntry) error {
+	fresh := false
+	for _, e := range entries {
+		if project := state.Projects[e.Name]; project != nil && project.DirtySeenAt == nil &&
+			(e.State == StateGrabbedDirty || e.State == StateConflicted) {
+			fresh = true
+		}
+	}
+	if !fresh {
+		return nil
+	}
+	if locker, ok := sm.(stateTryLocker); ok {
+		unlock, ok, err := locker.TryLock()
+		if err != nil || !ok {
+			return err
+		}
+		defer unlock()
+	}
+
+	var events []ProjectEvent
+	err := sm.Update(func(state *State) error {
+		events = nil
+		now := time.Now()
+		for _, e := range entries {
+			if e.State != StateGrabbedDirty && e.State != StateConflicted {
+				continue
+			}
+			if project, ok := state.Projects[e.Name]; ok && project.IsGrabbed && project.DirtySeenAt == nil {
+				project.DirtySeenAt = &now
+				events = append(events, ProjectEvent{Time: now, Project: e.Name, Op: EventDirty, LocalPath: e.LocalPath, Size: sizePtr(e.LocalSize)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		publishEvent(sm, e)
+	}
+	return nil
+}
+
+// eventHookTimeout bounds how long an event hook or webhook may take
+const eventHookTimeout = 30 * time.Second
+
+// RunEventHook runs command with sh -c for an event, passing it in
+// PARKR_EVENT, PARKR_PROJECT, PARKR_LOCAL_PATH, PARKR_SIZE and PARKR_HOST
+// and as JSON on stdin
+func RunEventHook(ctx context.Context, command string, e ProjectEvent) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventHookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"PARKR_EVENT="+e.Op,
+		"PARKR_PROJECT="+e.Project,
+		"PARKR_LOCAL_PATH="+e.LocalPath,
+		"PARKR_HOST="+e.Host,
+	)
+	if e.Size != nil {
+		cmd.Env = append(cmd.Env, "PARKR_SIZE="+strconv.FormatInt(*e.Size, 10))
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// PostEventWebhook posts an event to url as JSON
+func PostEventWebhook(ctx context.Context, url string, e ProjectEvent) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, eventHookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server replied %s", resp.Status)
+	}
+	return nil
+}
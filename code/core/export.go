@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// configExportVersion is the format version written by ExportConfig
+const configExportVersion = 1
+
+// ConfigExport is a machine's parkr configuration in a form that can be
+// used to initialize parkr on another machine
+type ConfigExport struct {
+	Version int `json:"version"`
+	// Home is the exporting user's home directory, used to translate local
+	// directories under it to the importing user's home
+	Home          string                       `json:"home"`
+	Masters       map[string]map[string]string `json:"masters"`
+	DefaultMaster string                       `json:"default_master"`
+	Settings      Settings                     `json:"settings"`
+	// Projects holds archive metadata for each project, without any
+	// machine-local grab state. Omitted unless requested.
+	Projects map[string]*Project `json:"projects,omitempty"`
+}
+
+// ExportConfig returns the configuration from a state file, optionally
+// including project metadata
+func ExportConfig(sm StateStore, withProjects bool) (*ConfigExport, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	export := &ConfigExport{
+		Version:       configExportVersion,
+		Home:          homeDir,
+		Masters:       state.Masters,
+		DefaultMaster: state.DefaultMaster,
+		Settings:      state.Settings,
+	}
+	if withProjects {
+		export.Projects = make(map[string]*Project, len(state.Projects))
+		for name, p := range state.Projects {
+			export.Projects[name] = &Project{
+				Master:             p.Master,
+				ArchiveCategory:    p.ArchiveCategory,
+				LastParkAt:         p.LastParkAt,
+				ArchiveContentHash: p.ArchiveContentHash,
+				LastParkMtime:      p.LastParkMtime,
+				NoHashMode:         p.NoHashMode,
+				HashMode:           p.HashMode,
+			}
+		}
+	}
+	return export, nil
+}
+
+// ParseConfigExport decodes an exported configuration
+func ParseConfigExport(data []byte) (*ConfigExport, error) {
+	var export ConfigExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse exported config: %w", err)
+	}
+	if export.Version != configExportVersion {
+		return nil, fmt.Errorf("unsupported exported config version %d", export.Version)
+	}
+	if len(export.Masters) == 0 {
+		return nil, fmt.Errorf("exported config has no masters")
+	}
+	if _, ok := export.Masters[export.DefaultMaster]; !ok {
+		return nil, fmt.Errorf("exported config's default master '%s' is not defined", export.DefaultMaster)
+	}
+	return &export, nil
+}
+
+// stateFromExport builds a new state from an exported configuration,
+// moving local roots under the exporting home to the current user's home
+func stateFromExport(export *ConfigExport) *State {
+	state := &State{
+		Masters:       export.Masters,
+		DefaultMaster: export.DefaultMaster,
+		Projects:      make(map[string]*Project),
+		Settings:      export.Settings,
+	}
+
+	homeDir, _ := os.UserHomeDir()
+	if export.Home != "" && homeDir != "" {
+		for category, root := range state.Settings.LocalRoots {
+			if rel, err := filepath.Rel(export.Home, root); err == nil && !strings.HasPrefix(rel, "..") {
+				state.Settings.LocalRoots[category] = filepath.Join(homeDir, rel)
+			}
+		}
+	}
+
+	for name, p := range export.Projects {
+		project := *p
+		project.LocalPath = ""
+		project.GrabbedAt = nil
+		project.LocalContentHash = nil
+		project.LocalHashComputedAt = nil
+		project.IsGrabbed = false
+		state.Projects[name] = &project
+	}
+	return state
+}
+
+// FetchConfigExport runs "parkr export" on a remote host over ssh and
+// parses its output. The ssh process is killed if ctx is cancelled.
+func FetchConfigExport(ctx context.Context, host string, withProjects bool) (*ConfigExport, error) {
+	args := []string{host, "parkr", "--format", "json", "export"}
+	if withProjects {
+		args = append(args, "--projects")
+	}
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, fmt.Errorf("ssh interrupted: %w", ctxErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to export config from %s: %w\nOutput: %s", host, err, stderr.String())
+	}
+	return ParseConfigExport(output)
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractOptions controls how files are copied out of the archive
+type ExtractOptions struct {
+	Force  bool // Overwrite an existing destination
+	DryRun bool // Check the path and destination without copying
+}
+
+// ExtractResult describes a completed extract
+type ExtractResult struct {
+	Project string `json:"project"`
+	Path    string `json:"path"`
+	Dest    string `json:"dest"`
+	Files   int    `json:"files"`
+	Bytes   int64  `json:"bytes"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+}
+
+// archiveFile is a path inside an archived project: a file or directory, or
+// a member of a tarball (.tar, .tar.gz or .tgz) stored in the project
+type archiveFile struct {
+	path   string // On disk
+	member string // Within the tarball at path, if set
+	info   os.FileInfo
+}
+
+// isTarball reports whether name looks like a tar archive parkr can read
+func isTarball(name string) bool {
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// locateArchiveFile resolves rel, a slash-separated path, inside an archived
+// project. A path that continues past a tarball names one of its members.
+// A compressed project is extracted to a temporary directory, which cleanup
+// removes once the file has been read.
+func locateArchiveFile(ctx context.Context, sm StateStore, projectName, rel string) (*ArchiveProject, *archiveFile, func(), error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ap, err := ResolveArchiveProject(archiveProjects, projectName, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := requireLocalArchive(ap.Path); err != nil {
+		return nil, nil, nil, err
+	}
+
+	rel = path.Clean(strings.TrimPrefix(filepath.ToSlash(rel), "/"))
+	if rel == "." || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return nil, nil, nil, fmt.Errorf("invalid path '%s' (expected a path inside the project)", rel)
+	}
+
+	dir, cleanup, err := archiveDir(ctx, ap.Path, state.ageKeys(ap.Master))
+	if err != nil {
+		return nil, nil, nil, errorf(ErrArchiveUnreachable, "failed to read %s: %v", ap.Path, err)
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i <= len(parts); i++ {
+		p := filepath.Join(dir, filepath.FromSlash(strings.Join(parts[:i], "/")))
+		info, err := os.Stat(p)
+		if err != nil {
+			break
+		}
+		if i == len(parts) {
+			return &ap, &archiveFile{path: p, info: info}, cleanup, nil
+		}
+		if !info.IsDir() {
+			if isTarball(p) {
+				return &ap, &archiveFile{path: p, member: strings.Join(parts[i:], "/"), info: info}, cleanup, nil
+			}
+			break
+		}
+	}
+	cleanup()
+	return nil, nil, nil, errorf(ErrFileNotFound, "'%s' not found in archived project '%s'", rel, ap.Name)
+}
+
+// OpenArchiveFile opens a file in an archived project for reading, without
+// grabbing the project. The path may name a member of a tarball stored in
+// the project, such as "backups/data.tar.gz/config.yml".
+func OpenArchiveFile(ctx context.Context, sm StateStore, projectName, rel string) (io.ReadCloser, error) {
+	_, file, cleanup, err := locateArchiveFile(ctx, sm, projectName, rel)
+	if err != nil {
+		return nil, err
+	}
+	var r io.ReadCloser
+	switch {
+	case file.member != "":
+		r, err = openTarMember(file.path, file.member)
+	case file.info.IsDir():
+		err = fmt.Errorf("'%s' is a directory", rel)
+	default:
+		r, err = os.Open(file.path)
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return &cleanupReader{r, cleanup}, nil
+}
+
+// cleanupReader runs cleanup once the wrapped reader is closed
+type cleanupReader struct {
+	io.ReadCloser
+	cleanup func()
+}
+
+// Close closes the reader, then runs cleanup
+func (r *cleanupReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.cleanup()
+	return err
+}
+
+// tarMemberReader reads one tarball member and closes the tarball with it
+type tarMemberReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decompressor, if any, and the tarball file
+func (r *tarMemberReader) Close() error {
+	var first error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if err := r.closers[i].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// openTarMember opens the regular file named member in the tarball at path
+func openTarMember(tarPath, member string) (io.ReadCloser, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &tarMemberReader{closers: []io.Closer{f}}
+	var src io.Reader = f
+	if !strings.HasSuffix(tarPath, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", tarPath, err)
+		}
+		r.closers = append(r.closers, gz)
+		src = gz
+	}
+
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", tarPath, err)
+		}
+		if path.Clean(hdr.Name) == member && hdr.Typeflag == tar.TypeReg {
+			r.Reader = tr
+			return r, nil
+		}
+	}
+	r.Close()
+	return nil, errorf(ErrFileNotFound, "'%s' not found in %s", member, tarPath)
+}
+
+// Extract copies a file or directory out of an archived project to dest,
+// without grabbing the project. dest must not exist unless opts.Force is set.
+func Extract(ctx context.Context, sm StateStore, projectName, rel, dest string, opts ExtractOptions) (*ExtractResult, error) {
+	ap, file, cleanup, err := locateArchiveFile(ctx, sm, projectName, rel)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if _, err := os.Lstat(dest); err == nil && !opts.Force {
+		return nil, errorf(ErrLocalPathExists, "destination already exists: %s (use --force to overwrite)", dest)
+	}
+
+	result := &ExtractResult{Project: ap.Name, Path: rel, Dest: dest, DryRun: opts.DryRun}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// copyOut copies one file, opened by open, to the local path to
+	copyOut := func(open func() (io.ReadCloser, error), to string, mode os.FileMode) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		in, err := open()
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(out, in)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		result.Files++
+		result.Bytes += n
+		return err
+	}
+	openFile := func(p string) func() (io.ReadCloser, error) {
+		return func() (io.ReadCloser, error) { return os.Open(p) }
+	}
+
+	switch {
+	case file.member != "":
+		err = copyOut(func() (io.ReadCloser, error) { return openTarMember(file.path, file.member) }, dest, 0644)
+	case file.info.IsDir():
+		err = filepath.Walk(file.path, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			sub, err := filepath.Rel(file.path, p)
+			if err != nil {
+				return err
+			}
+			to := filepath.Join(dest, sub)
+			if info.IsDir() {
+				return os.MkdirAll(to, 0755)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			return copyOut(openFile(p), to, info.Mode())
+		})
+	default:
+		err = copyOut(openFile(file.path), dest, file.info.Mode())
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to extract %s: %w", rel, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tempDirPrefix marks temporary directories left in a category directory by
+// an interrupted copy into the archive
+const tempDirPrefix = ".__parking__"
+
+// Kinds of leftover data removed by GC
+const (
+	GCTempDir  = "temp"
+	GCEmptyDir = "empty"
+	GCTrash    = "trash" // Archive files park replaced, kept past trash_days
+)
+
+// GCOptions controls archive garbage collection
+type GCOptions struct {
+	DryRun bool // Report what would be removed without removing it
+}
+
+// GCItem is one leftover directory found by GC
+type GCItem struct {
+	Path   string `json:"path"`
+	Master string `json:"master"`
+	Kind   string `json:"kind"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GCResult summarises a garbage collection run
+type GCResult struct {
+	Items     []GCItem `json:"items"`
+	Reclaimed int64    `json:"reclaimed"`
+	// Skipped lists read-only and remote masters that were not examined
+	Skipped []string `json:"skipped,omitempty"`
+	DryRun  bool     `json:"dry_run,omitempty"`
+}
+
+// GC removes leftover temporary directories, empty, untracked project
+// directories and expired trash from every writable master's category
+// directories. Masters on
+// remote hosts are skipped. Removal failures are recorded per item rather
+// than aborting the run.
+func GC(ctx context.Context, sm StateStore, opts GCOptions) (*GCResult, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GCResult{Items: []GCItem{}, DryRun: opts.DryRun}
+	for masterName, categories := range state.Masters {
+		if state.CheckMasterWritable(masterName) != nil || state.hasRemoteRoot(masterName) {
+			result.Skipped = append(result.Skipped, masterName)
+			continue
+		}
+		for _, categoryPath := range categories {
+			items, err := findGarbage(ctx, state, masterName, categoryPath)
+			if err != nil {
+				return nil, err
+			}
+			result.Items = append(result.Items, items...)
+		}
+	}
+	sort.Strings(result.Skipped)
+	sort.Slice(result.Items, func(i, j int) bool { return result.Items[i].Path < result.Items[j].Path })
+
+	for i := range result.Items {
+		item := &result.Items[i]
+		if !opts.DryRun {
+			if err := os.RemoveAll(item.Path); err != nil {
+				item.Error = err.Error()
+				continue
+			}
+		}
+		result.Reclaimed += item.Size
+	}
+	return result, nil
+}
+
+// findGarbage lists leftover directories in one category directory
+func findGarbage(ctx context.Context, state *State, master, categoryPath string) ([]GCItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(categoryPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errorf(ErrArchiveUnreachable, "failed to read %s: %w", categoryPath, err)
+	}
+
+	var items []GCItem
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		path := filepath.Join(categoryPath, name)
+
+		switch {
+		case name == TrashDir:
+			trash, err := findExpiredTrash(ctx, master, path, state.Settings.TrashDays, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, trash...)
+		case strings.HasPrefix(name, tempDirPrefix):
+			size, err := GetDirSize(ctx, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to size %s: %w", path, err)
+			}
+			items = append(items, GCItem{Path: path, Master: master, Kind: GCTempDir, Size: size})
+		case name[0] != '.':
+			if _, tracked := state.Projects[name]; tracked {
+				continue
+			}
+			children, err := os.ReadDir(path)
+			if err != nil {
+				return nil, errorf(ErrArchiveUnreachable, "failed to read %s: %w", path, err)
+			}
+			if len(children) == 0 {
+				items = append(items, GCItem{Path: path, Master: master, Kind: GCEmptyDir})
+			}
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GrabOptions controls how a project is checked out
+type GrabOptions struct {
+	DryRun      bool // Resolve paths and run checks without copying anything
+	IgnoreQuota bool // Grab even if an enforced category quota or grab limit would be exceeded
+	// Temp checks the project out under TempRoot and marks it ephemeral
+	Temp bool
+	// Latest picks the newest dated snapshot when the name matches several
+	Latest bool
+	// Jobs is how many rsync processes copy the project at once, overriding
+	// the transfer_jobs setting when positive
+	Jobs int
+	// BwLimit caps the transfer rate, as a size per second such as "5M",
+	// overriding the bwlimit setting; "0" lifts the setting's limit
+	BwLimit string
+	// Progress, if set, receives updates while the project is copied
+	Progress ProgressFunc
+	// Verify checks each copied file against the archive copy's
+	// ChecksumFile, failing with ErrArchiveMismatch if any differs
+	Verify bool
+	// Master grabs the copy in this master. Without it, a project that
+	// isn't tracked and is in more than one master is ErrAmbiguousProject.
+	Master string
+}
+
+// GrabResult describes a completed (or, in dry-run mode, planned) grab
+type GrabResult struct {
+	Project     string `json:"project"`
+	ArchivePath string `json:"archive_path"`
+	LocalPath   string `json:"local_path"`
+	Ephemeral   bool   `json:"ephemeral,omitempty"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+	// Resumed is set when the grab continues one that was interrupted
+	Resumed bool `json:"resumed,omitempty"`
+	// Verified is the number of files checked against the ChecksumFile
+	Verified int `json:"verified,omitempty"`
+	// Size is the total size of the grabbed files
+	Size int64 `json:"size,omitempty"`
+	// Warnings are non-fatal issues the caller should surface to the user
+	Warnings []string `json:"warnings,omitempty"`
+	// LastUpdated is when the archive copy was last parked, or, without a
+	// recorded park, its newest file's mtime; nil if unknown
+	LastUpdated *time.Time `json:"last_updated,omitempty"`
+	// Stale is set when LastUpdated is more than StaleDays ago, unless
+	// the stale_grab_action setting is off
+	Stale     bool `json:"stale,omitempty"`
+	StaleDays int  `json:"stale_days,omitempty"`
+}
+
+// What grab does about a stale project, set by Settings.StaleGrabAction
+const (
+	StaleGrabWarn    = "warn"
+	StaleGrabConfirm = "confirm"
+	StaleGrabOff     = "off"
+)
+
+// DefaultStaleGrabDays is how long ago an archive copy was last updated
+// before grab calls it stale, unless stale_grab_days is set
+const DefaultStaleGrabDays = 365
+
+// staleGrabDays returns the stale_grab_days setting or its default
+func (s *Settings) staleGrabDays() int {
+	if s.StaleGrabDays > 0 {
+		return s.StaleGrabDays
+	}
+	return DefaultStaleGrabDays
+}
+
+// archiveLastUpdated returns when a project's archive copy was last parked,
+// or, if no park is recorded, the mtime of its newest file, or of the
+// compressed copy itself. Remote copies without a recorded park are nil.
+func (s *State) archiveLastUpdated(ctx context.Context, ap ArchiveProject) *time.Time {
+	if project, ok := s.Projects[ap.Name]; ok && project.LastParkAt != nil {
+		return project.LastParkAt
+	}
+	if IsRemote(ap.Path) {
+		return nil
+	}
+	if isPackedArchive(ap.Path) {
+		info, err := os.Stat(ap.Path)
+		if err != nil {
+			return nil
+		}
+		t := info.ModTime()
+		return &t
+	}
+	newest, err := GetNewestMtime(ctx, ap.Path)
+	if err != nil || *newest == nil {
+		return nil
+	}
+	t := (*newest).ModTime()
+	return &t
+}
+
+// Grab checks out a project from archive to its default local directory
+func Grab(ctx context.Context, sm StateStore, projectName string, opts GrabOptions) (*GrabResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	ctx = state.Settings.withRemoteRetries(ctx)
+
+	// Find project in archive
+	var archiveProjects map[string]ArchiveProject
+	if opts.Master != "" {
+		if err := state.checkMaster(opts.Master); err != nil {
+			return nil, err
+		}
+		archiveProjects, err = DiscoverMasterProjects(ctx, state, opts.Master)
+	} else {
+		archiveProjects, err = DiscoverArchiveProjects(ctx, state)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan archive: %w", err)
+	}
+
+	archiveProject, err := ResolveArchiveProject(archiveProjects, projectName, opts.Latest)
+	if err != nil {
+		if opts.Master != "" && errors.Is(err, ErrProjectNotFound) {
+			return nil, errorf(ErrProjectNotFound, "project '%s' not found in master '%s'", projectName, opts.Master)
+		}
+		return nil, err
+	}
+	projectName = archiveProject.Name
+	if _, tracked := state.Projects[projectName]; !tracked && opts.Master == "" && len(archiveProject.AlsoIn) > 0 {
+		masters := append([]string{archiveProject.Master}, archiveProject.AlsoIn...)
+		return nil, errorf(ErrAmbiguousProject, "'%s' is in more than one master (%s); choose one with --master", projectName, strings.Join(masters, ", "))
+	}
+
+	// Check if already grabbed
+	if existingProject, exists := state.Projects[projectName]; exists && existingProject.IsGrabbed {
+		return nil, errorf(ErrAlreadyGrabbed, "project '%s' is already grabbed at %s", projectName, existingProject.LocalPath)
+	}
+
+	// Determine local path
+	localRoot := state.LocalRoot(archiveProject.Category)
+	if opts.Temp {
+		localRoot = TempRoot()
+	}
+	localPath := filepath.Join(localRoot, projectName)
+
+	// Check if local path already exists, which is expected when an
+	// interrupted grab left a partial copy there
+	transfer := Transfer{Op: TransferGrab, Source: archiveProject.Path, Dest: localPath, StartedAt: time.Now()}
+	resumed := state.resumes(projectName, transfer)
+	if _, err := os.Stat(localPath); err == nil && !resumed {
+		return nil, errorf(ErrLocalPathExists, "local path already exists: %s (use --force to overwrite)", localPath)
+	}
+
+	result := &GrabResult{
+		Project:     projectName,
+		ArchivePath: archiveProject.Path,
+		LocalPath:   localPath,
+		Ephemeral:   opts.Temp,
+		DryRun:      opts.DryRun,
+		Resumed:     resumed,
+	}
+
+	// Check the category's local quota and the limits on grabbed projects
+	usage, err := CategoryUsage(ctx, state, archiveProject.Category)
+	if err != nil {
+		return nil, err
+	}
+	grabbed, err := GrabbedUsage(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	var overruns []string
+	if usage != nil || grabbed != nil && grabbed.MaxSize > 0 {
+		size, err := GetDirSize(ctx, archiveProject.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size project: %w", err)
+		}
+		if usage != nil && usage.Exceeded(size) {
+			overruns = append(overruns, quotaMessage(projectName, usage, size))
+		}
+		if grabbed != nil {
+			overruns = append(overruns, grabbed.overruns(projectName, size)...)
+		}
+	} else if grabbed != nil {
+		overruns = grabbed.overruns(projectName, 0)
+	}
+	for _, msg := range overruns {
+		if state.Settings.EnforceQuotas() && !opts.IgnoreQuota {
+			return nil, errorf(ErrQuotaExceeded, "%s (use --force-over-quota to grab anyway)", msg)
+		}
+		result.Warnings = append(result.Warnings, msg)
+	}
+
+	if state.Settings.StaleGrabAction != StaleGrabOff {
+		result.LastUpdated = state.archiveLastUpdated(ctx, archiveProject)
+		result.StaleDays = state.Settings.staleGrabDays()
+		if result.LastUpdated != nil {
+			result.Stale = time.Since(*result.LastUpdated) > time.Duration(result.StaleDays)*24*time.Hour
+		}
+	}
+
+	rsyncOpts, err := state.Settings.rsyncOptions(opts.Jobs, opts.BwLimit, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Ensure local root exists
+	if err := os.MkdirAll(localRoot, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local directory: %w", err)
+	}
+
+	// Create the destination directory
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create project directory: %w", err)
+	}
+
+	// Copy from archive to local. If parkr is interrupted, the partial copy
+	// and the transfer record are kept so the next grab resumes.
+	if err := beginTransfer(sm, projectName, transfer); err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	if err := copyFromArchive(ctx, archiveProject.Path, localPath, state.ageKeys(archiveProject.Master), rsyncOpts); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("grab of '%s' interrupted; run it again to resume: %w", projectName, err)
+		}
+		// Clean up on failure
+		os.RemoveAll(localPath)
+		endTransfer(sm, projectName)
+		return nil, fmt.Errorf("failed to copy project: %w", err)
+	}
+
+	if opts.Verify {
+		verified, warning, err := verifyGrabbedCopy(ctx, archiveProject.Path, localPath)
+		if err != nil {
+			os.RemoveAll(localPath)
+			endTransfer(sm, projectName)
+			return nil, err
+		}
+		result.Verified = verified
+		if warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+	}
+
+	// A temporary checkout starts out clean, so record the copied tree's
+	// newest mtime as if it had just been parked
+	var baseline *time.Time
+	if opts.Temp {
+		newestInfo, err := GetNewestMtime(ctx, localPath)
+		if err != nil {
+			os.RemoveAll(localPath)
+			endTransfer(sm, projectName)
+			return nil, fmt.Errorf("failed to get mtime: %w", err)
+		}
+		mtime := time.Time{}
+		if newestInfo != nil && *newestInfo != nil {
+			mtime = (*newestInfo).ModTime()
+		}
+		baseline = &mtime
+	}
+
+	// Fingerprint the copy so pull can tell when the archive changes
+	manifest, err := BuildManifest(ctx, localPath)
+	if err != nil {
+		os.RemoveAll(localPath)
+		endTransfer(sm, projectName)
+		return nil, fmt.Errorf("failed to scan local files: %w", err)
+	}
+	for _, e := range manifest {
+		result.Size += e.Size
+	}
+
+	// Update state
+	now := time.Now()
+	err = sm.Update(func(state *State) error {
+		project := state.Projects[projectName]
+		if project == nil {
+			project = &Project{
+				NoHashMode: true, // Default to no-hash mode for Phase 1
+			}
+			state.Projects[projectName] = project
+		}
+		// Re-grabbing a tracked project keeps its tags, description,
+		// verification override and kept versions; only the fields
+		// describing the local copy start over
+		project.LocalPath = localPath
+		project.Master = archiveProject.Master
+		project.ArchiveCategory = archiveProject.Category
+		project.GrabbedAt = &now
+		project.LastParkMtime = baseline
+		project.IsGrabbed = true
+		project.Ephemeral = opts.Temp
+		project.ArchiveFingerprint = manifestFingerprint(manifest)
+		project.LocalContentHash = nil
+		project.LocalHashComputedAt = nil
+		project.DirtySeenAt = nil
+		delete(state.Transfers, projectName)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	publishEvent(sm, ProjectEvent{Time: now, Project: projectName, Op: EventGrab, LocalPath: localPath, Size: sizePtr(result.Size)})
+
+	return result, nil
+}
+
+// verifyGrabbedCopy checks a fresh local copy against its archive copy's
+// ChecksumFile and returns how many files it checked, or a warning if
+// there is nothing to check against
+func verifyGrabbedCopy(ctx context.Context, archivePath, localPath string) (int, string, error) {
+	sums, err := loadChecksums(ctx, archivePath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read checksums: %w", err)
+	}
+	if sums == nil {
+		return 0, fmt.Sprintf("%s has no %s to verify against; park the project to write one", archivePath, ChecksumFile), nil
+	}
+	bad, err := checkChecksums(ctx, localPath, sums, 0)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to verify copy: %w", err)
+	}
+	if len(bad) > 0 {
+		return 0, "", errorf(ErrArchiveMismatch, "copy of %s does not match its %s: %s", archivePath, ChecksumFile, summarizeDiffs(bad))
+	}
+	return len(sums), "", nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStore saves a fresh state, with one master whose categories are under
+// a temporary archive root, and points HOME at a temporary directory
+func testStore(t *testing.T) (*StateManager, *State) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	dir := t.TempDir()
+	state := DefaultState(filepath.Join(dir, "archive"))
+	for _, category := range state.Masters["primary"] {
+		if err := os.MkdirAll(category, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm := NewStateManagerAt(filepath.Join(dir, "state.json"))
+	if err := sm.Save(state); err != nil {
+		t.Fatal(err)
+	}
+	return sm, state
+}
+
+// requireRsync skips tests that copy projects when rsync is not installed
+func requireRsync(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("rsync"); err != nil {
+		t.Skip("rsync not installed")
+	}
+}
+
+// writeFiles creates files under dir, keyed by slash-separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGrabKeepsMetadata(t *testing.T) {
+	requireRsync(t)
+	sm, state := testStore(t)
+	writeFiles(t, filepath.Join(state.Masters["primary"]["code"], "proj"), map[string]string{"main.go": "package main\n"})
+
+	hash := "abc123"
+	parked := time.Now().Add(-time.Hour)
+	state.Projects["proj"] = &Project{
+		LocalPath:           "/old/path/proj",
+		Master:              "primary",
+		ArchiveCategory:     "code",
+		LastParkAt:          &parked,
+		ArchiveContentHash:  &hash,
+		LocalContentHash:    &hash,
+		LocalHashComputedAt: &parked,
+		DirtySeenAt:         &parked,
+		Description:         "A test project",
+		Tags:                []string{"exp", "go"},
+		Verification:        VerifyGit,
+		LastParkGitHead:     "deadbeef",
+		Versions:            []ArchiveVersion{{Path: "/archive/code/.parkr-versions/proj/1", KeptAt: parked}},
+	}
+	if err := sm.Save(state); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Grab(context.Background(), sm, "proj", GrabOptions{})
+	if err != nil {
+		t.Fatalf("Grab failed: %v", err)
+	}
+	got, err := sm.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := got.Projects["proj"]
+
+	if p.Description != "A test project" || !slices.Equal(p.Tags, []string{"exp", "go"}) ||
+		p.Verification != VerifyGit || p.LastParkGitHead != "deadbeef" || len(p.Versions) != 1 ||
+		p.ArchiveContentHash == nil || *p.ArchiveContentHash != hash {
+		t.Errorf("re-grab lost metadata: %+v", p)
+	}
+	if !p.IsGrabbed || p.LocalPath != result.LocalPath || p.GrabbedAt == nil {
+		t.Errorf("re-grab did not record the new local copy: %+v", p)
+	}
+	if p.LocalContentHash != nil || p.LocalHashComputedAt != nil || p.DirtySeenAt != nil {
+		t.Errorf("re-grab kept the old local copy's hash or dirty mark: %+v", p)
+	}
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// hashPrefix is prepended to every hex digest stored in state
+const hashPrefix = "sha256:"
+
+// DefaultFastHashChunk is how much of each end of a large file a sampled
+// hash reads, unless the fast_hash_chunk setting says otherwise
+const DefaultFastHashChunk = 4 << 20
+
+// HashMode records how a content hash was computed, so that it is only
+// ever compared with a hash computed the same way. A nil *HashMode means
+// every byte of every file was hashed.
+type HashMode struct {
+	// SampleOver is the size above which a file is sampled: only its
+	// size and first and last SampleChunk bytes are hashed
+	SampleOver  int64 `json:"sample_over"`
+	SampleChunk int64 `json:"sample_chunk"`
+}
+
+// String describes the mode for messages
+func (m *HashMode) String() string {
+	if m == nil {
+		return "full"
+	}
+	return fmt.Sprintf("sampled (first and last %s of files over %s)", FormatSize(m.SampleChunk), FormatSize(m.SampleOver))
+}
+
+// hashMode returns the mode new content hashes are made in: sampled if
+// fast_hash_over is set, else full
+func (s *Settings) hashMode() (*HashMode, error) {
+	if s.FastHashOver == "" {
+		return nil, nil
+	}
+	over, err := ParseSize(s.FastHashOver)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fast_hash_over: %w", err)
+	}
+	chunk := int64(DefaultFastHashChunk)
+	if s.FastHashChunk != "" {
+		if chunk, err = ParseSize(s.FastHashChunk); err != nil {
+			return nil, fmt.Errorf("invalid fast_hash_chunk: %w", err)
+		}
+	}
+	return &HashMode{SampleOver: over, SampleChunk: chunk}, nil
+}
+
+// ManifestEntry is one regular file in a directory tree
+type ManifestEntry struct {
+	Path  string // Slash-separated, relative to the tree root
+	Size  int64
+	Mtime int64 // Unix nanoseconds
+}
+
+// BuildManifest lists the regular files under dir in lexical path order,
+// leaving out the volatile paths listed in its VolatileFile
+func BuildManifest(ctx context.Context, dir string) ([]ManifestEntry, error) {
+	var manifest []ManifestEntry
+	err := walkTracked(dir, func(rel string, info os.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		manifest = append(manifest, ManifestEntry{
+			Path:  rel,
+			Size:  info.Size(),
+			Mtime: info.ModTime().UnixNano(),
+		})
+		return nil
+	})
+	return manifest, err
+}
+
+// ManifestHash hashes the paths and sizes in a manifest. Trees with the
+// same files of the same sizes share a manifest hash even if contents differ.
+func ManifestHash(manifest []ManifestEntry) string {
+	h := sha256.New()
+	for _, e := range manifest {
+		fmt.Fprintf(h, "%s\x00%d\n", e.Path, e.Size)
+	}
+	return digest(h)
+}
+
+// manifestFingerprint hashes paths, sizes and mtimes, so it changes
+// whenever any file is touched
+func manifestFingerprint(manifest []ManifestEntry) string {
+	h := sha256.New()
+	for _, e := range manifest {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", e.Path, e.Size, e.Mtime)
+	}
+	return digest(h)
+}
+
+// ContentHash hashes the paths and contents of the files in a manifest of dir
+func ContentHash(ctx context.Context, dir string, manifest []ManifestEntry) (string, error) {
+	return contentHash(ctx, dir, manifest, nil)
+}
+
+// contentHash is ContentHash in the given mode
+func contentHash(ctx context.Context, dir string, manifest []ManifestEntry, mode *HashMode) (string, error) {
+	h := sha256.New()
+	for _, e := range manifest {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00", e.Path)
+		path := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if mode != nil && e.Size > mode.SampleOver && e.Size > 2*mode.SampleChunk {
+			if err := sampleFile(h, path, e.Size, mode.SampleChunk); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if err := hashFile(h, path); err != nil {
+			return "", err
+		}
+	}
+	return digest(h), nil
+}
+
+// HashDirectory returns the content hash of every file under dir
+func HashDirectory(ctx context.Context, dir string) (string, error) {
+	return hashDirectory(ctx, dir, nil)
+}
+
+// hashDirectory is HashDirectory in the given mode
+func hashDirectory(ctx context.Context, dir string, mode *HashMode) (string, error) {
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+	return contentHash(ctx, dir, manifest, mode)
+}
+
+// archiveOnlyPrefix starts the compareTrees line for a file only the archive
+// copy has
+const archiveOnlyPrefix = "only in archive: "
+
+// compareTrees lists the differences between the tracked files of a local
+// copy, src, and an archive copy, dst: first by manifest, which catches
+// missing files and wrong sizes cheaply, then by hashing each remaining
+// file on both sides
+func compareTrees(ctx context.Context, src, dst string) ([]string, error) {
+	srcManifest, err := BuildManifest(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	dstManifest, err := BuildManifest(ctx, dst)
+	if err != nil {
+		return nil, err
+	}
+	dstSizes := make(map[string]int64, len(dstManifest))
+	for _, e := range dstManifest {
+		dstSizes[e.Path] = e.Size
+	}
+
+	var diffs, same []string
+	for _, e := range srcManifest {
+		size, ok := dstSizes[e.Path]
+		delete(dstSizes, e.Path)
+		switch {
+		case !ok:
+			diffs = append(diffs, "only local: "+e.Path)
+		case size != e.Size:
+			diffs = append(diffs, "size differs: "+e.Path)
+		default:
+			same = append(same, e.Path)
+		}
+	}
+	for _, e := range dstManifest {
+		if _, ok := dstSizes[e.Path]; ok {
+			diffs = append(diffs, archiveOnlyPrefix+e.Path)
+		}
+	}
+
+	for _, rel := range same {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		srcHash, err := fileHash(filepath.Join(src, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		dstHash, err := fileHash(filepath.Join(dst, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		if srcHash != dstHash {
+			diffs = append(diffs, "contents differ: "+rel)
+		}
+	}
+	return diffs, nil
+}
+
+// fileHash returns the digest of one file's contents
+func fileHash(path string) (string, error) {
+	h := sha256.New()
+	if err := hashFile(h, path); err != nil {
+		return "", err
+	}
+	return digest(h), nil
+}
+
+// hashFile writes the SHA-256 digest of a file's contents to h
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fh := sha256.New()
+	if _, err := io.Copy(fh, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	h.Write(fh.Sum(nil))
+	return nil
+}
+
+// sampleFile writes to h the SHA-256 digest of a file's size and its first
+// and last chunk bytes
+func sampleFile(h hash.Hash, path string, size, chunk int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fh := sha256.New()
+	fmt.Fprintf(fh, "%d\x00", size)
+	if _, err := io.Copy(fh, io.NewSectionReader(f, 0, chunk)); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if _, err := io.Copy(fh, io.NewSectionReader(f, size-chunk, chunk)); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	h.Write(fh.Sum(nil))
+	return nil
+}
+
+// digest formats a hash's sum for storage
+func digest(h hash.Hash) string {
+	return hashPrefix + hex.EncodeToString(h.Sum(nil))
+}
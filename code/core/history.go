@@ -0,0 +1,283 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SizeSample is one measurement of total local and/or archive usage. Either
+// total may be nil when the command that recorded it didn't measure it.
+type SizeSample struct {
+	Time         time.Time `json:"time"`
+	Source       string    `json:"source"`
+	LocalTotal   *int64    `json:"local_total,omitempty"`
+	ArchiveTotal *int64    `json:"archive_total,omitempty"`
+	// ArchiveDelta is how much a park grew or shrank the archive; it is
+	// added to the last ArchiveTotal recorded before it
+	ArchiveDelta *int64 `json:"archive_delta,omitempty"`
+}
+
+// TrendPoint is the last known usage at the end of one trend period
+type TrendPoint struct {
+	Start        time.Time `json:"start"`
+	LocalTotal   *int64    `json:"local_total"`
+	ArchiveTotal *int64    `json:"archive_total"`
+}
+
+// Trend periods
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// Operations recorded in the project history, and published as events
+// along with EventDirty
+const (
+	EventAdd   = "add"
+	EventGrab  = "grab"
+	EventPark  = "park"
+	EventRm    = "rm"
+	EventPrune = "prune"
+	EventUndo  = "undo"
+	// EventRename is published under the project's new name
+	EventRename = "rename"
+)
+
+// ProjectEvent is one grab, park or removal of a project's local copy, or
+// the first sign of unparked changes in it
+type ProjectEvent struct {
+	Time    time.Time `json:"time"`
+	Project string    `json:"project"`
+	Op      string    `json:"op"`
+	// Host is the machine the operation ran on
+	Host      string `json:"host,omitempty"`
+	LocalPath string `json:"local_path,omitempty"`
+	// Size is the size of the local copy grabbed, parked or removed, when known
+	Size *int64 `json:"size,omitempty"`
+	// RenamedFrom is the project's old name, for EventRename
+	RenamedFrom string `json:"renamed_from,omitempty"`
+}
+
+// ProjectHistoryPath returns the project history file kept next to a
+// state file
+func ProjectHistoryPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "project-history.jsonl")
+}
+
+// RecordProjectEvent appends an event to the project history for a state
+// file, filling in this machine's hostname if Host is empty. A SQLite state
+// file keeps the history in its events table.
+func RecordProjectEvent(statePath string, event ProjectEvent) error {
+	if event.Host == "" {
+		event.Host, _ = os.Hostname()
+	}
+	if IsSQLiteState(statePath) {
+		return recordSQLiteEvents(statePath, event)
+	}
+	return appendJSONLine(ProjectHistoryPath(statePath), event)
+}
+
+// LoadProjectHistory reads the recorded events for a project, oldest first.
+// A missing history file yields no events; malformed lines are skipped.
+func LoadProjectHistory(statePath, projectName string) ([]ProjectEvent, error) {
+	if IsSQLiteState(statePath) {
+		return loadSQLiteEvents(statePath, projectName)
+	}
+	events, err := loadAllProjectEvents(statePath)
+	if err != nil {
+		return nil, err
+	}
+	var matching []ProjectEvent
+	for _, e := range events {
+		if e.Project == projectName {
+			matching = append(matching, e)
+		}
+	}
+	return matching, nil
+}
+
+// loadAllProjectEvents reads every event in the project history file kept
+// next to a JSON state file, oldest first
+func loadAllProjectEvents(statePath string) ([]ProjectEvent, error) {
+	f, err := os.Open(ProjectHistoryPath(statePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read project history: %w", err)
+	}
+	defer f.Close()
+
+	var events []ProjectEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ProjectEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read project history: %w", err)
+	}
+	return events, nil
+}
+
+// SizeHistoryPath returns the size history file kept next to a state file
+func SizeHistoryPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "size-history.jsonl")
+}
+
+// RecordSizeSample appends a sample to the size history for a state file
+func RecordSizeSample(statePath string, sample SizeSample) error {
+	return appendJSONLine(SizeHistoryPath(statePath), sample)
+}
+
+// appendJSONLine appends v as one line of JSON to a history file
+func appendJSONLine(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to serialize history entry: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// LoadSizeHistory reads all recorded samples, oldest first. A missing
+// history file yields no samples; malformed lines are skipped.
+func LoadSizeHistory(statePath string) ([]SizeSample, error) {
+	f, err := os.Open(SizeHistoryPath(statePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read size history: %w", err)
+	}
+	defer f.Close()
+
+	var samples []SizeSample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s SizeSample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			continue
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read size history: %w", err)
+	}
+	return samples, nil
+}
+
+// applyArchive returns the archive total after the sample, given the one
+// before it: its ArchiveTotal, or the total before plus its ArchiveDelta
+func (s SizeSample) applyArchive(archive *int64) *int64 {
+	switch {
+	case s.ArchiveTotal != nil:
+		return s.ArchiveTotal
+	case s.ArchiveDelta != nil && archive != nil:
+		total := *archive + *s.ArchiveDelta
+		return &total
+	}
+	return archive
+}
+
+// LatestSizes returns the samples with the most recent local and archive
+// totals, or nil for those never recorded. Parks since the last archive
+// total are added to it, as of the last of them.
+func LatestSizes(samples []SizeSample) (local, archive *SizeSample) {
+	var total *int64
+	for i := range samples {
+		if samples[i].LocalTotal != nil {
+			local = &samples[i]
+		}
+		if next := samples[i].applyArchive(total); next != total {
+			total = next
+			archive = &SizeSample{Time: samples[i].Time, Source: samples[i].Source, ArchiveTotal: total}
+		}
+	}
+	return local, archive
+}
+
+// ParkSizeDelta returns how much a park changed the size of a project's
+// archive copy: the parked size less the size at the project's previous
+// add, grab, park or removal in its history, which only removes copies
+// that match the archive. ok is false if there is none.
+func ParkSizeDelta(statePath, projectName string, size int64, parkedAt time.Time) (delta int64, ok bool) {
+	events, err := LoadProjectHistory(statePath, projectName)
+	if err != nil {
+		return 0, false
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if !e.Time.Before(parkedAt) || e.Size == nil {
+			continue
+		}
+		switch e.Op {
+		case EventAdd, EventGrab, EventPark, EventRm, EventPrune, EventUndo:
+			return size - *e.Size, true
+		}
+	}
+	return 0, false
+}
+
+// SizeTrend summarises samples into the last count periods ending at now,
+// carrying the most recent known value of each total into every period
+func SizeTrend(samples []SizeSample, period string, count int, now time.Time) ([]TrendPoint, error) {
+	var step func(t time.Time, n int) time.Time
+	var start time.Time
+	y, m, d := now.Date()
+	switch period {
+	case PeriodWeek:
+		day := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+		start = day.AddDate(0, 0, -(int(day.Weekday())+6)%7) // Monday
+		step = func(t time.Time, n int) time.Time { return t.AddDate(0, 0, 7*n) }
+	case PeriodMonth:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+		step = func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) }
+	default:
+		return nil, fmt.Errorf("invalid period '%s' (expected week or month)", period)
+	}
+
+	points := make([]TrendPoint, count)
+	for i := range points {
+		points[i].Start = step(start, i-count+1)
+	}
+
+	var local, archive *int64
+	next := 0
+	for i := range points {
+		end := now
+		if i+1 < len(points) {
+			end = points[i+1].Start
+		}
+		for next < len(samples) && samples[next].Time.Before(end) {
+			if samples[next].LocalTotal != nil {
+				local = samples[next].LocalTotal
+			}
+			archive = samples[next].applyArchive(archive)
+			next++
+		}
+		points[i].LocalTotal = local
+		points[i].ArchiveTotal = archive
+	}
+	return points, nil
+}
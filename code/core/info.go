@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// ProjectInfo is the detailed view of one project shown by info
+type ProjectInfo struct {
+	Name          string     `json:"name"`
+	Master        string     `json:"master"`
+	Category      string     `json:"category"`
+	Description   string     `json:"description,omitempty"`
+	ArchivePath   string     `json:"archive_path"`
+	ArchiveSize   int64      `json:"archive_size"` // -1 if unknown
+	ArchiveExists bool       `json:"archive_exists"`
+	Grabbed       bool       `json:"grabbed"`
+	LocalPath     string     `json:"local_path,omitempty"`
+	LocalSize     int64      `json:"local_size"` // -1 if unknown
+	LocalExists   bool       `json:"local_exists"`
+	GrabbedAt     *time.Time `json:"grabbed_at"`
+	LastParkAt    *time.Time `json:"last_park_at"`
+	LastModified  *time.Time `json:"last_modified"`
+	// Status is set for grabbed projects only
+	Status string `json:"status,omitempty"`
+	// State is the project's lifecycle state; see ProjectState
+	State string `json:"state"`
+	// Verification is the method park and rm use for the project
+	Verification string `json:"verification"`
+	// HashMode is how the recorded content hash was computed, if sampled
+	HashMode *HashMode `json:"hash_mode,omitempty"`
+	// Versions are the earlier archive copies park kept, oldest first
+	Versions []ArchiveVersion `json:"versions,omitempty"`
+	// Encrypted is set when the archive copy is encrypted with age
+	Encrypted bool `json:"encrypted"`
+	// Transfers are the project's latest grab and park runs, newest first,
+	// for callers that read them from the audit log with RecentTransfers
+	Transfers []AuditRecord `json:"transfers,omitempty"`
+}
+
+// Info gathers archive and local details for a project known to the state
+// file or present in the archive
+func Info(ctx context.Context, sm StateStore, projectName string) (*ProjectInfo, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ProjectInfo{Name: projectName, ArchiveSize: -1, LocalSize: -1, Verification: state.VerificationMode(projectName)}
+	project, tracked := state.Projects[projectName]
+	if tracked {
+		info.Master = project.Master
+		info.Category = project.ArchiveCategory
+		info.Description = project.Description
+		info.Grabbed = project.IsGrabbed
+		info.GrabbedAt = project.GrabbedAt
+		info.LastParkAt = project.LastParkAt
+		info.HashMode = project.HashMode
+		info.Versions = project.Versions
+		if info.ArchivePath, err = state.GetArchivePath(projectName); err != nil {
+			return nil, err
+		}
+	} else {
+		archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+		if err != nil {
+			return nil, err
+		}
+		ap, err := ResolveArchiveProject(archiveProjects, projectName, false)
+		if err != nil {
+			return nil, err
+		}
+		info.Name = ap.Name
+		info.Master = ap.Master
+		info.Category = ap.Category
+		info.ArchivePath = ap.Path
+	}
+
+	info.Encrypted = isEncryptedArchive(info.ArchivePath)
+	if exists, _ := archivePathExists(ctx, info.ArchivePath); exists {
+		info.ArchiveExists = true
+		if size, err := GetDirSize(ctx, info.ArchivePath); err == nil {
+			info.ArchiveSize = size
+		} else if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+	}
+
+	archive := ""
+	if !info.ArchiveExists {
+		archive = ArchiveMissing
+	}
+	if !info.Grabbed {
+		info.State = state.ProjectState(info.Name, "", archive)
+		return info, nil
+	}
+
+	entry, err := EvaluateProject(ctx, projectName, project, state.VerificationMode(projectName))
+	if err != nil {
+		return nil, err
+	}
+	info.LocalPath = project.LocalPath
+	info.LocalExists = entry.Status != StatusMissingLocal
+	info.LocalSize = entry.LocalSize
+	info.LastModified = entry.LastModified
+	info.Status = entry.Status
+
+	// Unparked changes conflict if the archive copy changed elsewhere too
+	if info.ArchiveExists && (entry.Status == StatusDirty || entry.Status == StatusNeverParked) {
+		if archive, err = archiveStatus(ctx, info.ArchivePath, state.ageKeys(project.Master), project); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			archive = ArchiveUnknown
+		}
+	}
+	info.State = state.ProjectState(projectName, entry.Status, archive)
+	return info, nil
+}
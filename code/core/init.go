@@ -0,0 +1,126 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// InitOptions controls how a new state file is created
+type InitOptions struct {
+	// ArchiveRoot holds the category directories of the primary master;
+	// DefaultArchiveRoot is used if empty
+	ArchiveRoot string
+	// From copies masters, settings and any project metadata from another
+	// machine's exported configuration instead; ArchiveRoot is ignored
+	From *ConfigExport
+	// Scaffold creates the category directories and checks they are writable
+	Scaffold bool
+	DryRun   bool // Work out the configuration without writing anything
+}
+
+// InitResult describes the state file created by Init
+type InitResult struct {
+	StatePath string `json:"state_path"`
+	// Categories maps each archive category to its directory
+	Categories map[string]string `json:"categories"`
+	// LocalRoots are the existing local directories recorded in the config
+	LocalRoots map[string]string `json:"local_roots,omitempty"`
+	// Created lists category directories created by scaffolding
+	Created []string `json:"created,omitempty"`
+	// Projects is the number of projects imported from an exported config
+	Projects int  `json:"projects,omitempty"`
+	DryRun   bool `json:"dry_run,omitempty"`
+}
+
+// Init creates a new state file with a primary master under the archive
+// root, recording any default local directories that already exist
+func Init(sm *StateManager, opts InitOptions) (*InitResult, error) {
+	if sm.Exists() {
+		return nil, errorf(ErrStateFile, "state file already exists at %s", sm.StatePath())
+	}
+
+	var state *State
+	if opts.From != nil {
+		state = stateFromExport(opts.From)
+	} else {
+		root := opts.ArchiveRoot
+		if root == "" {
+			root = DefaultArchiveRoot
+		}
+		state = DefaultState(root)
+	}
+	if state.Settings.LocalRoots == nil {
+		state.Settings.LocalRoots = DetectLocalRoots()
+	}
+
+	result := &InitResult{
+		StatePath:  sm.StatePath(),
+		Categories: state.Masters[state.DefaultMaster],
+		LocalRoots: state.Settings.LocalRoots,
+		Projects:   len(state.Projects),
+		DryRun:     opts.DryRun,
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if opts.Scaffold {
+		created, err := scaffoldCategories(result.Categories)
+		if err != nil {
+			return nil, err
+		}
+		result.Created = created
+	}
+
+	if err := sm.Save(state); err != nil {
+		return nil, fmt.Errorf("failed to create state file: %w", err)
+	}
+	return result, nil
+}
+
+// DetectLocalRoots returns the default local directory of each category
+// that already exists on this machine
+func DetectLocalRoots() map[string]string {
+	roots := make(map[string]string)
+	for _, c := range DefaultCategories {
+		dir := GetDefaultLocalPath(c)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			roots[c] = dir
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	return roots
+}
+
+// scaffoldCategories creates any missing category directories and verifies
+// each one is writable. Returns the directories it created, sorted.
+func scaffoldCategories(categories map[string]string) ([]string, error) {
+	var created []string
+	for _, dir := range categories {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, errorf(ErrArchiveUnreachable, "failed to create %s: %w", dir, err)
+			}
+			created = append(created, dir)
+		}
+		if err := checkWritable(dir); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(created)
+	return created, nil
+}
+
+// checkWritable verifies a file can be created in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, tempDirPrefix)
+	if err != nil {
+		return errorf(ErrArchiveUnreachable, "%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Inspection describes an archived project's contents, read directly from
+// the archive without grabbing it
+type Inspection struct {
+	Name        string `json:"name"`
+	Master      string `json:"master"`
+	Category    string `json:"category"`
+	ArchivePath string `json:"archive_path"`
+	Description string `json:"description,omitempty"`
+	Size        int64  `json:"size"`
+	Files       int    `json:"files"`
+	// Newest is the newest file modification time in the project
+	Newest *time.Time `json:"newest"`
+	// ManifestHash covers the paths and sizes of non-volatile files
+	ManifestHash string `json:"manifest_hash"`
+	// ContentHash is taken from the hash index when it is still current
+	ContentHash string         `json:"content_hash,omitempty"`
+	Entries     []InspectEntry `json:"entries"`
+}
+
+// InspectEntry is a top-level file or directory of an archived project
+type InspectEntry struct {
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+}
+
+// Inspect summarises an archived project: its top-level entries, total size
+// and file count, and manifest hash. A compressed project is extracted to a
+// temporary directory first. statePath locates the hash index.
+func Inspect(ctx context.Context, sm StateStore, statePath, projectName string) (*Inspection, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	ap, err := ResolveArchiveProject(archiveProjects, projectName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireLocalArchive(ap.Path); err != nil {
+		return nil, err
+	}
+	dir, cleanup, err := archiveDir(ctx, ap.Path, state.ageKeys(ap.Master))
+	if err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to read %s: %v", ap.Path, err)
+	}
+	defer cleanup()
+
+	insp := &Inspection{
+		Name:        ap.Name,
+		Master:      ap.Master,
+		Category:    ap.Category,
+		ArchivePath: ap.Path,
+		Description: ReadDescription(dir, state.Settings.MetadataFile),
+		Entries:     []InspectEntry{},
+	}
+
+	entries := make(map[string]*InspectEntry)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		top, _, nested := strings.Cut(filepath.ToSlash(rel), "/")
+		entry, ok := entries[top]
+		if !ok {
+			entry = &InspectEntry{Name: top, IsDir: info.IsDir() || nested}
+			entries[top] = entry
+		}
+		if info.IsDir() {
+			return nil
+		}
+		entry.Size += info.Size()
+		entry.Files++
+		insp.Size += info.Size()
+		insp.Files++
+		if mtime := info.ModTime(); insp.Newest == nil || mtime.After(*insp.Newest) {
+			insp.Newest = &mtime
+		}
+		return nil
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, errorf(ErrArchiveUnreachable, "failed to scan %s: %v", ap.Path, err)
+	}
+	for _, e := range entries {
+		insp.Entries = append(insp.Entries, *e)
+	}
+	sort.Slice(insp.Entries, func(i, j int) bool { return insp.Entries[i].Name < insp.Entries[j].Name })
+
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to scan %s: %v", ap.Path, err)
+	}
+	insp.ManifestHash = ManifestHash(manifest)
+	// Only a cache for list; inspecting doesn't fail over it
+	recordArchiveSize(statePath, ap.Path, insp.Size, time.Now())
+	if cached, ok := LoadHashIndex(statePath)[ap.Name]; ok && cached.Path == ap.Path && cached.Fingerprint == manifestFingerprint(manifest) {
+		insp.ContentHash = cached.ContentHash
+	}
+	return insp, nil
+}
@@ -0,0 +1,45 @@
+package core
+
+// Project states, the one place status, list, info and report read a
+// project's lifecycle from. Core derives them from the recorded transfers
+// and grab, the evaluated local copy and, where checked, the archive copy.
+const (
+	StateArchived       = "archived"        // Only in the archive
+	StateGrabbing       = "grabbing"        // A grab is running or was interrupted
+	StateGrabbedClean   = "grabbed-clean"   // Grabbed, unchanged since its last sync
+	StateGrabbedDirty   = "grabbed-dirty"   // Grabbed, with unparked changes
+	StateParking        = "parking"         // A park is running or was interrupted
+	StateConflicted     = "conflicted"      // Changed here and in the archive since the last sync
+	StateMissingLocal   = "missing-local"   // Grabbed, but the local copy is gone
+	StateMissingArchive = "missing-archive" // Tracked, but the archive copy is gone
+)
+
+// ProjectState returns a project's state. status is its evaluated
+// ReportEntry status, which only grabbed projects have, and archive its
+// archive status, or "" if the archive copy was not checked. An unfinished
+// transfer takes precedence, since its copies are incomplete either way.
+func (s *State) ProjectState(projectName, status, archive string) string {
+	if t := s.Transfers[projectName]; t != nil {
+		if t.Op == TransferPark {
+			return StateParking
+		}
+		return StateGrabbing
+	}
+	if archive == ArchiveMissing {
+		return StateMissingArchive
+	}
+	project, ok := s.Projects[projectName]
+	if !ok || !project.IsGrabbed {
+		return StateArchived
+	}
+	switch status {
+	case StatusMissingLocal:
+		return StateMissingLocal
+	case StatusSafe:
+		return StateGrabbedClean
+	}
+	if archive == ArchiveUpdated {
+		return StateConflicted
+	}
+	return StateGrabbedDirty
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ListEntry is a single archived project as reported by List, or a tracked
+// one whose archive copy is missing
+type ListEntry struct {
+	Name     string `json:"name"`
+	Master   string `json:"master"`
+	Category string `json:"category"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"` // -1 if the size could not be determined
+	Grabbed  bool   `json:"grabbed"`
+	// State is the project's lifecycle state; see ProjectState. List
+	// doesn't check the archive copy, so never reports a conflict.
+	State string `json:"state"`
+	// SizeAsOf is when Size was measured, if it is a slow master's last
+	// known size rather than measured by this call; SizeStale is set when
+	// that size is missing or older than SizeCacheTTL, and wants a
+	// RefreshArchiveSizes
+	SizeAsOf  *time.Time `json:"size_as_of,omitempty"`
+	SizeStale bool       `json:"size_stale,omitempty"`
+	// Description is the project's summary captured at its last park
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// SnapshotOf is the base name of a dated snapshot such as analysis-2024
+	SnapshotOf string `json:"snapshot_of,omitempty"`
+	// AlsoIn lists the other masters with a project of the same name
+	AlsoIn []string `json:"also_in,omitempty"`
+}
+
+// ListOptions controls List
+type ListOptions struct {
+	// IncludeHidden lists hidden projects as if the include_hidden setting
+	// were on
+	IncludeHidden bool
+	// StatePath locates the last measured archive sizes, which slow
+	// masters' projects are listed with and other sizes are recorded to;
+	// empty measures every size
+	StatePath string
+	// RefreshSizes measures slow masters' projects too
+	RefreshSizes bool
+	// Master lists only the projects in this master, including copies of
+	// names whose preferred copy is in another
+	Master string
+}
+
+// List returns all archived projects, and tracked projects missing from the
+// archive, optionally filtered by category, sorted by name
+func List(ctx context.Context, sm StateStore, category string, opts ListOptions) ([]ListEntry, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeHidden {
+		state.Settings.IncludeHidden = true
+	}
+
+	// Discover projects in archive
+	var archiveProjects map[string]ArchiveProject
+	if opts.Master != "" {
+		if err := state.checkMaster(opts.Master); err != nil {
+			return nil, err
+		}
+		archiveProjects, err = DiscoverMasterProjects(ctx, state, opts.Master)
+	} else {
+		archiveProjects, err = DiscoverArchiveProjects(ctx, state)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan archive: %w", err)
+	}
+
+	now := time.Now()
+	var archiveSizes SizeCache
+	measured := make(SizeCache)
+	if opts.StatePath != "" {
+		archiveSizes = LoadArchiveSizes(opts.StatePath)
+	}
+
+	var entries []ListEntry
+	for _, ap := range archiveProjects {
+		if category != "" && ap.Category != category {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry := ListEntry{
+			Name:     ap.Name,
+			Master:   ap.Master,
+			Category: ap.Category,
+			Path:     ap.Path,
+			Size:     -1,
+			AlsoIn:   ap.AlsoIn,
+		}
+		if base, _, ok := SplitSnapshotName(ap.Name); ok {
+			entry.SnapshotOf = base
+		}
+
+		// Check if grabbed in state; another master's copy of a tracked
+		// name is just archived
+		status := ""
+		stateProject, exists := state.Projects[ap.Name]
+		if exists && stateProject.Master != ap.Master {
+			entry.State = StateArchived
+		} else if exists {
+			entry.Grabbed = stateProject.IsGrabbed
+			entry.Description = stateProject.Description
+			entry.Tags = stateProject.Tags
+			if stateProject.IsGrabbed {
+				local, err := EvaluateProject(ctx, ap.Name, stateProject, state.VerificationMode(ap.Name))
+				if err != nil {
+					return nil, err
+				}
+				status = local.Status
+			}
+		}
+		if entry.State == "" {
+			entry.State = state.ProjectState(ap.Name, status, "")
+		}
+
+		if opts.StatePath != "" && !opts.RefreshSizes && state.SlowMaster(ap.Master) {
+			if known, ok := archiveSizes[ap.Path]; ok {
+				entry.Size = known.Size
+				entry.SizeAsOf = &known.ComputedAt
+				entry.SizeStale = now.Sub(known.ComputedAt) > SizeCacheTTL
+			} else {
+				entry.SizeStale = true
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		size, err := GetDirSize(ctx, ap.Path)
+		if err == nil {
+			entry.Size = size
+			measured[ap.Path] = SizeCacheEntry{Size: size, ComputedAt: now}
+		} else if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if opts.StatePath != "" && len(measured) > 0 {
+		// Only a cache; listing doesn't fail over it
+		saveArchiveSizes(opts.StatePath, measured)
+	}
+
+	// Tracked projects whose archive copy is gone
+	for name, project := range state.Projects {
+		if ap, found := archiveProjects[name]; (found && ap.Master == project.Master) || (category != "" && project.ArchiveCategory != category) {
+			continue
+		}
+		if opts.Master != "" && project.Master != opts.Master {
+			continue
+		}
+		if _, ok := state.Masters[project.Master]; !ok {
+			continue
+		}
+		path, err := state.GetArchivePath(name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ListEntry{
+			Name:        name,
+			Master:      project.Master,
+			Category:    project.ArchiveCategory,
+			Path:        path,
+			Size:        -1,
+			Grabbed:     project.IsGrabbed,
+			State:       state.ProjectState(name, "", ArchiveMissing),
+			Description: project.Description,
+			Tags:        project.Tags,
+		})
+	}
+
+	// Sort by name
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Local project statuses reported by ScanLocal
+const (
+	LocalGrabbed   = "grabbed"   // Tracked as the local copy of a grabbed project
+	LocalArchived  = "archived"  // Not tracked here, but in the archive
+	LocalUntracked = "untracked" // Unknown to parkr
+)
+
+// LocalProject is a project directory found in a local directory
+type LocalProject struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Dir    string `json:"dir"`
+	Status string `json:"status"`
+	Size   int64  `json:"size"` // -1 if the size could not be determined
+	// Duplicate is set when another scanned directory holds a project of
+	// the same name; parkr tracks at most one of them
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// LocalScanOptions controls ScanLocal
+type LocalScanOptions struct {
+	// Refresh walks every directory instead of reusing cached sizes
+	Refresh bool
+	// IncludeHidden lists hidden directories as if the include_hidden
+	// setting were on
+	IncludeHidden bool
+}
+
+// LocalScanDirs returns the directories scanned for local projects: each
+// category's local root and the registered LocalDirectories, sorted
+func (s *State) LocalScanDirs() []string {
+	var dirs []string
+	for _, categories := range s.Masters {
+		for category := range categories {
+			dirs = append(dirs, s.LocalRoot(category))
+		}
+	}
+	dirs = append(dirs, s.LocalDirectories...)
+	for i, dir := range dirs {
+		dirs[i] = filepath.Clean(dir)
+	}
+	sort.Strings(dirs)
+	return slices.Compact(dirs)
+}
+
+// ScanLocal lists the project directories in every local scan directory,
+// their sizes and whether parkr tracks them. Missing directories are
+// skipped. Sizes are computed in parallel and cached next to statePath.
+func ScanLocal(ctx context.Context, sm StateStore, statePath string, opts LocalScanOptions) ([]LocalProject, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeHidden {
+		state.Settings.IncludeHidden = true
+	}
+	archiveProjects, err := DiscoverArchiveProjects(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	grabbedAt := make(map[string]bool)
+	for _, project := range state.Projects {
+		if project.IsGrabbed {
+			grabbedAt[filepath.Clean(project.LocalPath)] = true
+		}
+	}
+
+	projects := []LocalProject{}
+	for _, dir := range state.LocalScanDirs() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || skipProjectDir(entry.Name(), state.Settings.IncludeHidden) {
+				continue
+			}
+			p := LocalProject{Name: entry.Name(), Path: filepath.Join(dir, entry.Name()), Dir: dir}
+			_, archived := archiveProjects[p.Name]
+			switch {
+			case grabbedAt[p.Path]:
+				p.Status = LocalGrabbed
+			case archived:
+				p.Status = LocalArchived
+			default:
+				p.Status = LocalUntracked
+			}
+			projects = append(projects, p)
+		}
+	}
+
+	copies := make(map[string]int)
+	for _, p := range projects {
+		copies[p.Name]++
+	}
+	for i := range projects {
+		projects[i].Duplicate = copies[projects[i].Name] > 1
+	}
+
+	paths := make([]string, len(projects))
+	for i, p := range projects {
+		paths[i] = p.Path
+	}
+	now := time.Now()
+	cache := LoadSizeCache(statePath)
+	sizes, err := DirSizes(ctx, paths, cache, opts.Refresh, now)
+	if err != nil {
+		return nil, err
+	}
+	for i := range projects {
+		projects[i].Size = sizes[projects[i].Path]
+	}
+	if err := cache.Save(statePath, now); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// LocalCopies returns every local scan directory's copy of the named
+// project that exists on disk
+func (s *State) LocalCopies(name string) []string {
+	var copies []string
+	for _, dir := range s.LocalScanDirs() {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			copies = append(copies, p)
+		}
+	}
+	return copies
+}
+
+// AdoptLocalCopy makes path the tracked local copy of a grabbed project,
+// for when several local directories hold a copy. The local hash is
+// cleared since it described the previous copy.
+func AdoptLocalCopy(sm StateStore, projectName, path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot adopt %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cannot adopt %s: not a directory", path)
+	}
+	if filepath.Base(path) != projectName {
+		return "", fmt.Errorf("cannot adopt %s: directory name does not match project '%s'", path, projectName)
+	}
+
+	err = sm.Update(func(state *State) error {
+		project, ok := state.Projects[projectName]
+		if !ok {
+			return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+		}
+		if !project.IsGrabbed {
+			return errorf(ErrNotGrabbed, "project '%s' is not grabbed; grab it first", projectName)
+		}
+		if filepath.Clean(project.LocalPath) == path {
+			return fmt.Errorf("%s is already the tracked copy of '%s'", path, projectName)
+		}
+		project.LocalPath = path
+		project.LocalContentHash = nil
+		project.LocalHashComputedAt = nil
+		return nil
+	})
+	return path, err
+}
+
+// AddLocalDirectory registers an extra directory to scan for local projects
+func AddLocalDirectory(sm StateStore, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot add %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cannot add %s: not a directory", dir)
+	}
+
+	err = sm.Update(func(state *State) error {
+		if slices.Contains(state.LocalScanDirs(), dir) {
+			return fmt.Errorf("%s is already scanned", dir)
+		}
+		state.LocalDirectories = append(state.LocalDirectories, dir)
+		sort.Strings(state.LocalDirectories)
+		return nil
+	})
+	return dir, err
+}
+
+// RemoveLocalDirectory unregisters a directory added with AddLocalDirectory
+func RemoveLocalDirectory(sm StateStore, dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	err = sm.Update(func(state *State) error {
+		i := slices.Index(state.LocalDirectories, dir)
+		if i < 0 {
+			return fmt.Errorf("%s is not a registered local directory", dir)
+		}
+		state.LocalDirectories = slices.Delete(state.LocalDirectories, i, i+1)
+		if len(state.LocalDirectories) == 0 {
+			state.LocalDirectories = nil
+		}
+		return nil
+	})
+	return dir, err
+}
@@ -0,0 +1,390 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// trashInfoFile describes the local copy in each local trash directory
+const trashInfoFile = "trashed.json"
+
+// DefaultLocalTrashDays is how long removed local copies stay in the local
+// trash unless local_trash_days says otherwise
+const DefaultLocalTrashDays = 7
+
+// LocalTrashRetention returns how many days removed local copies are kept
+// in the local trash, or 0 if local_trash_days turned it off
+func (s *Settings) LocalTrashRetention() int {
+	switch {
+	case s.LocalTrashDays < 0:
+		return 0
+	case s.LocalTrashDays > 0:
+		return s.LocalTrashDays
+	}
+	return DefaultLocalTrashDays
+}
+
+// LocalTrashDir returns the directory rm moves deleted local copies on the
+// home volume into unless the local_trash_days setting is off. It holds one
+// directory per removal, named by trashLayout, with the copy and a
+// trashInfoFile inside.
+func LocalTrashDir() string {
+	return filepath.Join(DataDir(), "trash")
+}
+
+// VolumeTrashDir is the local trash directory rm creates next to a local
+// copy on another volume than LocalTrashDir, so the copy is renamed into it
+// rather than copied onto the home volume
+const VolumeTrashDir = ".parkr-local-trash"
+
+// trashRootFor returns the local trash directory for a copy at path:
+// LocalTrashDir if they are on the same volume, else a VolumeTrashDir next
+// to the copy
+func trashRootFor(path string) string {
+	home := LocalTrashDir()
+	if pathVolume, err := volumeID(path); err == nil {
+		if homeVolume, err := volumeID(existingParent(home)); err == nil && homeVolume == pathVolume {
+			return home
+		}
+	}
+	return filepath.Join(filepath.Dir(path), VolumeTrashDir)
+}
+
+// existingParent returns path or its nearest existing parent directory
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// TrashRoots returns every local trash directory copies may have been
+// moved into: LocalTrashDir and the VolumeTrashDirs rm has used
+func (s *State) TrashRoots() []string {
+	roots := []string{LocalTrashDir()}
+	for _, root := range s.TrashDirs {
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// TrashedCopy is a local copy moved to the local trash
+type TrashedCopy struct {
+	// ID is the copy's directory in the trash
+	ID      string `json:"id"`
+	Project string `json:"project"`
+	// Path is where the copy was removed from
+	Path      string    `json:"path"`
+	TrashedAt time.Time `json:"trashed_at"`
+	Size      int64     `json:"size"` // -1 if unknown
+	// StatePath is the state file of the parkr instance that removed the
+	// copy; copies trashed before it was recorded have none
+	StatePath string `json:"state_path,omitempty"`
+	// Root is the trash directory holding the copy; LocalTrashDir if empty
+	Root string `json:"root,omitempty"`
+}
+
+// ownedBy reports whether the copy was trashed through the state file at
+// statePath, taking "" to mean any state file. Copies with no recorded
+// state file belong to every one.
+func (t *TrashedCopy) ownedBy(statePath string) bool {
+	return statePath == "" || t.StatePath == "" || t.StatePath == statePath
+}
+
+// statePathSource is implemented by state stores backed by a state file
+type statePathSource interface {
+	StatePath() string
+}
+
+// statePathOf returns the state file behind sm, or "" if it has none
+func statePathOf(sm StateStore) string {
+	if source, ok := sm.(statePathSource); ok {
+		return source.StatePath()
+	}
+	return ""
+}
+
+// root returns the trash directory holding the copy
+func (t *TrashedCopy) root() string {
+	if t.Root == "" {
+		return LocalTrashDir()
+	}
+	return t.Root
+}
+
+// dir returns the copy's directory in its trash
+func (t *TrashedCopy) dir() string {
+	return filepath.Join(t.root(), t.ID)
+}
+
+// contents returns where the copy's files are in its trash
+func (t *TrashedCopy) contents() string {
+	return filepath.Join(t.root(), t.ID, filepath.Base(t.Path))
+}
+
+// moveToTrash moves a project's local copy at path into the trash at root,
+// recording the state file it was removed through. root must be on the
+// copy's volume: the copy is renamed, never copied, so trashing it can't
+// fill another volume.
+func moveToTrash(root, statePath, projectName, path string, size int64) (*TrashedCopy, error) {
+	now := time.Now()
+	item := &TrashedCopy{Project: projectName, Path: path, TrashedAt: now, Size: size, StatePath: statePath, Root: root}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	// Removals within the same second get numbered directories
+	for n := 1; ; n++ {
+		item.ID = now.Format(trashLayout)
+		if n > 1 {
+			item.ID += "-" + strconv.Itoa(n)
+		}
+		err := os.Mkdir(item.dir(), 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(item.dir(), trashInfoFile), append(data, '\n'), 0644); err != nil {
+		os.RemoveAll(item.dir())
+		return nil, err
+	}
+	if err := os.Rename(path, item.contents()); err != nil {
+		os.RemoveAll(item.dir())
+		if errors.Is(err, syscall.EXDEV) {
+			return nil, fmt.Errorf("%s is on another volume than the trash at %s; use --no-trash to delete it", path, root)
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// moveDir renames src to dst, copying, verifying and then removing src if
+// they are on different filesystems
+func moveDir(ctx context.Context, src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	return copyThenRemove(ctx, src, dst)
+}
+
+// copyThenRemove moves a directory or file src to dst on another
+// filesystem: it copies src with rsync, checks that the copy's content
+// hash matches, and only then removes src. A copy that fails or doesn't
+// match is removed again, leaving src as it was.
+func copyThenRemove(ctx context.Context, src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	from, to := src, dst
+	if info.IsDir() {
+		from, to = src+"/", dst+"/"
+	}
+	if err := execRsync(ctx, []string{"-a", from, to}, nil); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+
+	hash := fileHash
+	if info.IsDir() {
+		hash = func(path string) (string, error) { return HashDirectory(ctx, path) }
+	}
+	srcHash, err := hash(src)
+	if err == nil {
+		var dstHash string
+		if dstHash, err = hash(dst); err == nil && dstHash != srcHash {
+			err = fmt.Errorf("the copy at %s doesn't match %s", dst, src)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("failed to verify the copy of %s: %w", src, err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("copied %s to %s, but failed to remove it: %w", src, dst, err)
+	}
+	return nil
+}
+
+// ListTrash returns the local copies in the trash directories roots
+// removed through the state file at statePath, or every copy if it is "",
+// newest first. Several parkr instances share the trash, so each sees only
+// its own copies and those trashed before copies recorded their state
+// file. Directories without a readable trashInfoFile are skipped.
+func ListTrash(roots []string, statePath string) ([]TrashedCopy, error) {
+	var items []TrashedCopy
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(root, entry.Name(), trashInfoFile))
+			if err != nil {
+				continue
+			}
+			var item TrashedCopy
+			if err := json.Unmarshal(data, &item); err != nil || !item.ownedBy(statePath) {
+				continue
+			}
+			item.ID = entry.Name()
+			item.Root = root
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].TrashedAt.After(items[j].TrashedAt) })
+	return items, nil
+}
+
+// sameCopy reports whether t and other are the same copy in the trash
+func (t *TrashedCopy) sameCopy(other TrashedCopy) bool {
+	return t.ID == other.ID && t.root() == other.root()
+}
+
+// findTrashed picks a copy in the trash by its ID, or the newest copy of a
+// project by its name
+func findTrashed(items []TrashedCopy, spec string) (TrashedCopy, error) {
+	for _, item := range items {
+		if item.ID == spec {
+			return item, nil
+		}
+	}
+	for _, item := range items {
+		if item.Project == spec {
+			return item, nil
+		}
+	}
+	return TrashedCopy{}, errorf(ErrTrashNotFound, "no trashed copy '%s'", spec)
+}
+
+// TrashRestore describes a local copy restored from the trash
+type TrashRestore struct {
+	Item TrashedCopy `json:"item"`
+	Dest string      `json:"dest"`
+	// Tracked is set when the copy became the project's grabbed local copy
+	// again
+	Tracked bool `json:"tracked,omitempty"`
+	DryRun  bool `json:"dry_run,omitempty"`
+}
+
+// RestoreTrash moves a copy out of the local trash, one removed through
+// sm's state file, back to where it was removed from unless dest is given.
+// A copy restored to its old path becomes the project's grabbed local copy
+// again if the project is still tracked and not grabbed elsewhere.
+func RestoreTrash(ctx context.Context, sm StateStore, spec, dest string, dryRun bool) (*TrashRestore, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	items, err := ListTrash(state.TrashRoots(), statePathOf(sm))
+	if err != nil {
+		return nil, err
+	}
+	item, err := findTrashed(items, spec)
+	if err != nil {
+		return nil, err
+	}
+	result := &TrashRestore{Item: item, Dest: dest, DryRun: dryRun}
+	if result.Dest == "" {
+		result.Dest = item.Path
+	}
+	if result.Dest, err = filepath.Abs(result.Dest); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(result.Dest); err == nil {
+		return nil, errorf(ErrLocalPathExists, "destination already exists: %s", result.Dest)
+	}
+
+	if project, ok := state.Projects[item.Project]; ok && !project.IsGrabbed && result.Dest == item.Path {
+		result.Tracked = true
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(result.Dest), 0755); err != nil {
+		return nil, err
+	}
+	if err := moveDir(ctx, item.contents(), result.Dest); err != nil {
+		return nil, fmt.Errorf("failed to restore %s: %w", item.ID, err)
+	}
+	if err := os.RemoveAll(item.dir()); err != nil {
+		return nil, err
+	}
+	if err := sm.Update(dropJournalEntries([]JournalEntry{{Trashed: item}})); err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	if result.Tracked {
+		if err := trackLocalCopy(sm, item.Project, result.Dest); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// EmptyTrashResult describes the copies removed from the trash
+type EmptyTrashResult struct {
+	Removed []TrashedCopy `json:"removed"`
+	Freed   int64         `json:"freed"`
+	DryRun  bool          `json:"dry_run,omitempty"`
+}
+
+// EmptyTrash permanently removes the copies in the trash directories roots
+// removed through the state file at statePath ("" for any) more than days
+// ago, or all of them if days is 0. A VolumeTrashDir left empty is removed
+// too.
+func EmptyTrash(roots []string, statePath string, days int, dryRun bool) (*EmptyTrashResult, error) {
+	items, err := ListTrash(roots, statePath)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := &EmptyTrashResult{Removed: []TrashedCopy{}, DryRun: dryRun}
+	for _, item := range items {
+		if days > 0 && now.Before(item.TrashedAt.AddDate(0, 0, days)) {
+			continue
+		}
+		if !dryRun {
+			if err := os.RemoveAll(item.dir()); err != nil {
+				return result, fmt.Errorf("failed to remove %s: %w", item.ID, err)
+			}
+			if item.root() != LocalTrashDir() {
+				os.Remove(item.root()) // Only succeeds once it is empty
+			}
+		}
+		result.Removed = append(result.Removed, item)
+		result.Freed += max(item.Size, 0)
+	}
+	return result, nil
+}
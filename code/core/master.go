@@ -0,0 +1,296 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MasterInfo describes a configured master archive
+type MasterInfo struct {
+	Name       string            `json:"name"`
+	Categories map[string]string `json:"categories"`
+	Default    bool              `json:"default"`
+	ReadOnly   bool              `json:"read_only"`
+	Host       string            `json:"host,omitempty"`
+	Storage    string            `json:"storage"`
+	Encrypted  bool              `json:"encrypted"`
+	Exclude    []string          `json:"exclude,omitempty"`
+	Slow       bool              `json:"slow"`
+}
+
+// CheckMasterWritable returns ErrReadOnlyMaster if the master is read-only
+func (s *State) CheckMasterWritable(master string) error {
+	if s.Settings.Masters[master].ReadOnly {
+		return errorf(ErrReadOnlyMaster, "master '%s' is read-only", master)
+	}
+	return nil
+}
+
+// ListMasters returns the configured masters sorted by name
+func ListMasters(sm StateStore) ([]MasterInfo, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	masters := make([]MasterInfo, 0, len(state.Masters))
+	for name, categories := range state.Masters {
+		masters = append(masters, MasterInfo{
+			Name:       name,
+			Categories: categories,
+			Default:    name == state.DefaultMaster,
+			ReadOnly:   state.Settings.Masters[name].ReadOnly,
+			Host:       state.Settings.Masters[name].Host,
+			Storage:    state.StorageMode(name),
+			Encrypted:  state.Settings.Masters[name].Recipient != "",
+			Exclude:    state.Settings.Masters[name].Exclude,
+			Slow:       state.SlowMaster(name),
+		})
+	}
+	sort.Slice(masters, func(i, j int) bool { return masters[i].Name < masters[j].Name })
+	return masters, nil
+}
+
+// AddMasterOptions controls AddMaster
+type AddMasterOptions struct {
+	// Categories are created under the root; DefaultCategories if empty
+	Categories []string
+	// Scaffold creates the category directories, and the root if needed
+	Scaffold bool
+	DryRun   bool // Check the master without registering it
+}
+
+// AddMaster registers a new master whose categories are directories under
+// root, a local path or host:path. The root must exist unless
+// opts.Scaffold is set, and no category may overlap another master's.
+// Returns the new master's categories.
+func AddMaster(ctx context.Context, sm StateStore, name, root string, opts AddMasterOptions) (map[string]string, error) {
+	if name == "" || strings.ContainsAny(name, "/\\: \t") || strings.HasPrefix(name, "-") {
+		return nil, fmt.Errorf("invalid master name '%s'", name)
+	}
+	host, dir, remote := SplitRemote(root)
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("archive root must be an absolute path: %s", root)
+	}
+	names := opts.Categories
+	if len(names) == 0 {
+		names = DefaultCategories
+	}
+	categories := make(map[string]string, len(names))
+	for _, c := range names {
+		if c == "" || c == "." || c == ".." || strings.ContainsAny(c, "/\\") {
+			return nil, fmt.Errorf("invalid category name '%s'", c)
+		}
+		categories[c] = filepath.Join(root, c)
+		if remote {
+			categories[c] = host + ":" + filepath.Join(dir, c)
+		}
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := state.checkNewMaster(name, categories); err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return categories, nil
+	}
+
+	switch {
+	case opts.Scaffold:
+		for _, c := range names {
+			if err := createCategoryDir(ctx, categories[c]); err != nil {
+				return nil, errorf(ErrArchiveUnreachable, "failed to create %s: %w", categories[c], err)
+			}
+		}
+	case remote:
+		if _, err := runSSH(ctx, host, "test -d "+shellQuote(dir)); err != nil {
+			return nil, errorf(ErrArchiveUnreachable, "archive root %s is not a directory on %s (use --scaffold to create it): %w", dir, host, err)
+		}
+	default:
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return nil, errorf(ErrArchiveUnreachable, "archive root %s is not a directory (use --scaffold to create it)", root)
+		}
+	}
+
+	err = sm.Update(func(state *State) error {
+		if err := state.checkNewMaster(name, categories); err != nil {
+			return err
+		}
+		state.Masters[name] = categories
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// checkNewMaster returns an error if a master can't be added under name
+// with categories: the name is taken, or a category directory is, or is
+// inside or around, one of another master's
+func (s *State) checkNewMaster(name string, categories map[string]string) error {
+	if _, ok := s.Masters[name]; ok {
+		return errorf(ErrStateFile, "master '%s' already exists", name)
+	}
+	for _, p := range categories {
+		if err := s.checkCategoryOverlap(name, "", p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathsOverlap reports whether two archive paths, local or host:path, are
+// the same directory or one is inside the other
+func pathsOverlap(a, b string) bool {
+	hostA, dirA, _ := SplitRemote(a)
+	hostB, dirB, _ := SplitRemote(b)
+	if hostA != hostB {
+		return false
+	}
+	dirA, dirB = filepath.Clean(dirA), filepath.Clean(dirB)
+	sep := string(filepath.Separator)
+	return dirA == dirB || strings.HasPrefix(dirA+sep, dirB+sep) || strings.HasPrefix(dirB+sep, dirA+sep)
+}
+
+// RemoveMaster unregisters a master and its settings, leaving its archive
+// directories untouched. The default master, and one that tracked projects
+// still belong to, can't be removed.
+func RemoveMaster(sm StateStore, name string) error {
+	return sm.Update(func(state *State) error {
+		if err := state.checkMaster(name); err != nil {
+			return err
+		}
+		if name == state.DefaultMaster {
+			return fmt.Errorf("master '%s' is the default; make another master the default first", name)
+		}
+		var projects []string
+		for projectName, project := range state.Projects {
+			if project.Master == name {
+				projects = append(projects, projectName)
+			}
+		}
+		if len(projects) > 0 {
+			sort.Strings(projects)
+			return fmt.Errorf("master '%s' still has %d tracked project(s): %s", name, len(projects), strings.Join(projects, ", "))
+		}
+		delete(state.Masters, name)
+		delete(state.Settings.Masters, name)
+		return nil
+	})
+}
+
+// SetDefaultMaster makes a master the one add uses when none is given
+func SetDefaultMaster(sm StateStore, name string) error {
+	return sm.Update(func(state *State) error {
+		if err := state.checkMaster(name); err != nil {
+			return err
+		}
+		state.DefaultMaster = name
+		return nil
+	})
+}
+
+// SetMasterReadOnly marks a master read-only or writable
+func SetMasterReadOnly(sm StateStore, master string, readOnly bool) error {
+	return updateMasterSettings(sm, master, func(settings *MasterSettings) error {
+		settings.ReadOnly = readOnly
+		return nil
+	})
+}
+
+// SetMasterSlow marks a master slow, so list shows its projects' last
+// measured sizes rather than walking them. Masters on another host are
+// always treated as slow.
+func SetMasterSlow(sm StateStore, master string, slow bool) error {
+	return updateMasterSettings(sm, master, func(settings *MasterSettings) error {
+		settings.Slow = slow
+		return nil
+	})
+}
+
+// SetMasterHost sets the [user@]host a master's category paths are reached
+// on over SSH. An empty host makes them local paths again.
+func SetMasterHost(sm StateStore, master, host string) error {
+	return updateMasterSettings(sm, master, func(settings *MasterSettings) error {
+		if host != "" && (strings.ContainsAny(host, ":/ \t") || strings.HasPrefix(host, "-")) {
+			return fmt.Errorf("invalid host '%s' (expected host or user@host)", host)
+		}
+		settings.Host = host
+		return nil
+	})
+}
+
+// SetMasterExclude sets the names or glob patterns discovery ignores in a
+// master's categories. No patterns clears the list.
+func SetMasterExclude(sm StateStore, master string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil || pattern == "" || strings.Contains(pattern, "/") {
+			return fmt.Errorf("invalid exclude pattern '%s' (expected a directory name or glob)", pattern)
+		}
+	}
+	return updateMasterSettings(sm, master, func(settings *MasterSettings) error {
+		settings.Exclude = nil
+		if len(patterns) > 0 {
+			settings.Exclude = patterns
+		}
+		return nil
+	})
+}
+
+// excluded reports whether an entry of one of a master's categories
+// matches its Exclude patterns, by its own name or its project name
+func (m MasterSettings) excluded(entry string) bool {
+	for _, pattern := range m.Exclude {
+		for _, name := range []string{entry, trimArchiveExt(entry)} {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateMasterSettings applies fn to a master's settings, dropping settings
+// left at their defaults
+func updateMasterSettings(sm StateStore, master string, fn func(*MasterSettings) error) error {
+	return sm.Update(func(state *State) error {
+		return state.updateMasterSettings(master, fn)
+	})
+}
+
+// checkMaster returns an error unless a master is configured in s
+func (s *State) checkMaster(master string) error {
+	if _, ok := s.Masters[master]; !ok {
+		return errorf(ErrStateFile, "master '%s' not found", master)
+	}
+	return nil
+}
+
+// updateMasterSettings applies fn to a master's settings in s
+func (s *State) updateMasterSettings(master string, fn func(*MasterSettings) error) error {
+	if err := s.checkMaster(master); err != nil {
+		return err
+	}
+	if s.Settings.Masters == nil {
+		s.Settings.Masters = make(map[string]MasterSettings)
+	}
+	settings := s.Settings.Masters[master]
+	if err := fn(&settings); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(settings, MasterSettings{}) {
+		delete(s.Settings.Masters, master)
+	} else {
+		s.Settings.Masters[master] = settings
+	}
+	return nil
+}
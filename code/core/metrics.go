@@ -0,0 +1,224 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMetricsPrefix starts every metric name unless the metrics_prefix
+// setting says otherwise
+const DefaultMetricsPrefix = "parkr"
+
+// metricsTimeout bounds how long exporting one command's metrics may take
+const metricsTimeout = 5 * time.Second
+
+// CommandMetrics are the measurements of one command run
+type CommandMetrics struct {
+	Command  string
+	Duration time.Duration
+	// Projects and Bytes are the projects the command grabbed, parked,
+	// added or removed, and the combined size of those copies, as in its
+	// audit record
+	Projects int
+	Bytes    int64
+	Failed   bool
+}
+
+// ValidateMetricsEndpoint checks a metrics_endpoint value: statsd://host:port
+// for a StatsD daemon over UDP, or an http:// or https:// OTLP/HTTP metrics
+// URL such as http://localhost:4318/v1/metrics
+func ValidateMetricsEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid metrics endpoint '%s': %w", endpoint, err)
+	}
+	switch u.Scheme {
+	case "statsd":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return fmt.Errorf("invalid metrics endpoint '%s' (expected statsd://host:port)", endpoint)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("invalid metrics endpoint '%s' (missing host)", endpoint)
+		}
+	default:
+		return fmt.Errorf("invalid metrics endpoint '%s' (expected statsd://host:port or an http:// or https:// OTLP URL)", endpoint)
+	}
+	return nil
+}
+
+// ExportMetrics sends a command's metrics to the endpoint in s, if one is
+// set: to a StatsD daemon, or to an OpenTelemetry collector as OTLP/HTTP
+// JSON
+func (s *Settings) ExportMetrics(ctx context.Context, m CommandMetrics) error {
+	if s.MetricsEndpoint == "" {
+		return nil
+	}
+	if err := ValidateMetricsEndpoint(s.MetricsEndpoint); err != nil {
+		return err
+	}
+	prefix := s.MetricsPrefix
+	if prefix == "" {
+		prefix = DefaultMetricsPrefix
+	}
+	ctx, cancel := context.WithTimeout(ctx, metricsTimeout)
+	defer cancel()
+	if addr, ok := strings.CutPrefix(s.MetricsEndpoint, "statsd://"); ok {
+		return sendStatsD(ctx, strings.TrimSuffix(addr, "/"), prefix, m)
+	}
+	return postOTLPMetrics(ctx, s.MetricsEndpoint, prefix, m)
+}
+
+// statsdLines formats a command's metrics in the StatsD line protocol,
+// naming each after the command as no tags are assumed:
+//
+//	parkr.grab.duration:1234|ms
+//	parkr.grab.runs:1|c
+func statsdLines(prefix string, m CommandMetrics) string {
+	name := prefix + "." + m.Command + "."
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sduration:%d|ms\n", name, m.Duration.Milliseconds())
+	fmt.Fprintf(&b, "%sruns:1|c\n", name)
+	if m.Failed {
+		fmt.Fprintf(&b, "%sfailures:1|c\n", name)
+	}
+	if m.Projects > 0 {
+		fmt.Fprintf(&b, "%sprojects:%d|c\n", name, m.Projects)
+	}
+	if m.Bytes > 0 {
+		fmt.Fprintf(&b, "%sbytes:%d|c\n", name, m.Bytes)
+	}
+	return b.String()
+}
+
+// sendStatsD sends a command's metrics to a StatsD daemon in one datagram
+func sendStatsD(ctx context.Context, addr, prefix string, m CommandMetrics) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(statsdLines(prefix, m)))
+	return err
+}
+
+// otlpAttribute is a key-value attribute in OTLP JSON
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+// otlpMetricsRequest builds the OTLP JSON body of an export request for a
+// command's metrics: a duration histogram with a single run, and delta
+// sums of runs, failures, projects and bytes, each with the command and
+// its result as attributes
+func otlpMetricsRequest(prefix string, m CommandMetrics, end time.Time) map[string]any {
+	result := AuditOK
+	if m.Failed {
+		result = AuditError
+	}
+	attrs := []otlpAttribute{otlpString("command", m.Command), otlpString("result", result)}
+	start := strconv.FormatInt(end.Add(-m.Duration).UnixNano(), 10)
+	now := strconv.FormatInt(end.UnixNano(), 10)
+
+	const deltaTemporality = 1
+	sum := func(name, unit string, value int64) map[string]any {
+		return map[string]any{
+			"name": prefix + "." + name,
+			"unit": unit,
+			"sum": map[string]any{
+				"aggregationTemporality": deltaTemporality,
+				"isMonotonic":            true,
+				"dataPoints": []map[string]any{{
+					"attributes":        attrs,
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+					"asInt":             strconv.FormatInt(value, 10),
+				}},
+			},
+		}
+	}
+	failures := int64(0)
+	if m.Failed {
+		failures = 1
+	}
+	ms := float64(m.Duration) / float64(time.Millisecond)
+	metrics := []map[string]any{
+		{
+			"name": prefix + ".command.duration",
+			"unit": "ms",
+			"histogram": map[string]any{
+				"aggregationTemporality": deltaTemporality,
+				"dataPoints": []map[string]any{{
+					"attributes":        attrs,
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+					"count":             "1",
+					"sum":               ms,
+					"min":               ms,
+					"max":               ms,
+					"bucketCounts":      []string{"1"},
+					"explicitBounds":    []float64{},
+				}},
+			},
+		},
+		sum("command.runs", "{run}", 1),
+		sum("command.failures", "{run}", failures),
+		sum("command.projects", "{project}", int64(m.Projects)),
+		sum("command.bytes", "By", m.Bytes),
+	}
+
+	host, _ := os.Hostname()
+	return map[string]any{
+		"resourceMetrics": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": []otlpAttribute{otlpString("service.name", "parkr"), otlpString("host.name", host)},
+			},
+			"scopeMetrics": []map[string]any{{
+				"scope":   map[string]any{"name": "parkr"},
+				"metrics": metrics,
+			}},
+		}},
+	}
+}
+
+// postOTLPMetrics posts a command's metrics to an OTLP/HTTP endpoint as
+// JSON
+func postOTLPMetrics(ctx context.Context, endpoint, prefix string, m CommandMetrics) error {
+	payload, err := json.Marshal(otlpMetricsRequest(prefix, m, time.Now()))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("server replied %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// MoveOptions controls MoveProject. At least one of Category and Master
+// must differ from where the project is.
+type MoveOptions struct {
+	// Category is the category to move the project to; empty keeps its
+	// category name
+	Category string
+	// Master is the master to move the project to; empty keeps its master
+	Master string
+	DryRun bool // Report what would change without changing it
+}
+
+// ProjectMove describes a project moved between categories or masters
+type ProjectMove struct {
+	Project      string `json:"project"`
+	Tracked      bool   `json:"tracked"`
+	FromMaster   string `json:"from_master"`
+	FromCategory string `json:"from_category"`
+	ToMaster     string `json:"to_master"`
+	ToCategory   string `json:"to_category"`
+	OldPath      string `json:"old_path"`
+	NewPath      string `json:"new_path"`
+	// Moved is unset when there was no archive copy to move
+	Moved bool `json:"moved"`
+}
+
+// MoveProject moves a project's archive copy to another category, of its
+// master or another one on the same host, and records the move in the
+// state. Its local copy, if grabbed, stays where it is. The move is undone
+// if the state can't be updated. It refuses when the destination already
+// has a copy of the project, and for projects with an unfinished transfer.
+func MoveProject(ctx context.Context, sm StateStore, projectName string, opts MoveOptions) (*ProjectMove, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	move, err := planProjectMove(ctx, state, projectName, opts)
+	if err != nil || opts.DryRun {
+		return move, err
+	}
+
+	if move.Moved {
+		if err := moveArchiveDir(ctx, move.OldPath, move.NewPath); err != nil {
+			return nil, errorf(ErrArchiveUnreachable, "failed to move %s to %s: %w", move.OldPath, move.NewPath, err)
+		}
+	}
+	if !move.Tracked {
+		return move, nil
+	}
+	err = sm.Update(func(state *State) error {
+		project, ok := state.Projects[projectName]
+		if !ok {
+			return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+		}
+		if t := state.Transfers[projectName]; t != nil {
+			return fmt.Errorf("project '%s' has an unfinished %s; finish it before moving it", projectName, t.Op)
+		}
+		if err := state.checkCategory(move.ToMaster, move.ToCategory); err != nil {
+			return err
+		}
+		project.Master, project.ArchiveCategory = move.ToMaster, move.ToCategory
+		return nil
+	})
+	if err != nil {
+		if move.Moved {
+			// Put the copy back, so the state still describes it
+			if undoErr := moveArchiveDir(ctx, move.NewPath, move.OldPath); undoErr != nil {
+				return nil, fmt.Errorf("%w; moving the archive copy back to %s also failed, so it is left at %s: %v", err, move.OldPath, move.NewPath, undoErr)
+			}
+		}
+		return nil, err
+	}
+	return move, nil
+}
+
+// planProjectMove checks that a project can be moved and works out where
+// its archive copy goes
+func planProjectMove(ctx context.Context, state *State, projectName string, opts MoveOptions) (*ProjectMove, error) {
+	if t := state.Transfers[projectName]; t != nil {
+		return nil, fmt.Errorf("project '%s' has an unfinished %s; finish it before moving it", projectName, t.Op)
+	}
+	copies, err := DiscoverArchiveCopies(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	move := &ProjectMove{Project: projectName}
+	if project, ok := state.Projects[projectName]; ok {
+		move.Tracked = true
+		move.FromMaster, move.FromCategory = project.Master, project.ArchiveCategory
+		if move.OldPath, err = state.GetArchivePath(projectName); err != nil {
+			return nil, err
+		}
+	} else {
+		aps, ok := copies[projectName]
+		switch {
+		case !ok:
+			return nil, errorf(ErrProjectNotFound, "project '%s' not found", projectName)
+		case len(aps) > 1:
+			return nil, errorf(ErrAmbiguousProject, "'%s' is in more than one master; grab or add it so the state records which copy is its own", projectName)
+		}
+		move.FromMaster, move.FromCategory, move.OldPath = aps[0].Master, aps[0].Category, aps[0].Path
+	}
+
+	move.ToMaster, move.ToCategory = move.FromMaster, move.FromCategory
+	if opts.Master != "" {
+		move.ToMaster = opts.Master
+	}
+	if opts.Category != "" {
+		move.ToCategory = opts.Category
+	}
+	if move.ToMaster == move.FromMaster && move.ToCategory == move.FromCategory {
+		return nil, fmt.Errorf("project '%s' is already in category '%s' of master '%s'", projectName, move.FromCategory, move.FromMaster)
+	}
+	if err := state.checkCategory(move.ToMaster, move.ToCategory); err != nil {
+		return nil, err
+	}
+	for _, master := range []string{move.FromMaster, move.ToMaster} {
+		if err := state.CheckMasterWritable(master); err != nil {
+			return nil, err
+		}
+	}
+	if isEncryptedArchive(move.OldPath) && state.Settings.Masters[move.ToMaster].Recipient != state.Settings.Masters[move.FromMaster].Recipient {
+		return nil, fmt.Errorf("the archive copy of '%s' is encrypted for master '%s', and master '%s' uses other keys", projectName, move.FromMaster, move.ToMaster)
+	}
+
+	// The destination master may already have a copy, in any category
+	for _, ap := range copies[projectName] {
+		if ap.Master == move.ToMaster && ap.Path != move.OldPath {
+			return nil, errorf(ErrProjectExists, "master '%s' already has a copy of '%s' at %s; rename or remove one of them first", move.ToMaster, projectName, ap.Path)
+		}
+	}
+
+	root := state.archiveRoot(move.ToMaster, state.Masters[move.ToMaster][move.ToCategory])
+	move.NewPath = filepath.Join(root, filepath.Base(move.OldPath))
+	oldHost, _, _ := SplitRemote(move.OldPath)
+	if newHost, _, _ := SplitRemote(move.NewPath); newHost != oldHost {
+		return nil, fmt.Errorf("can't move %s to another host; grab it, then add it to master '%s'", move.OldPath, move.ToMaster)
+	}
+	if move.Moved, err = archivePathExists(ctx, move.OldPath); err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to check %s: %w", move.OldPath, err)
+	}
+	return move, nil
+}
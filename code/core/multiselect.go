@@ -0,0 +1,139 @@
+package core
+
+import "strings"
+
+// SelectItem is one row of a MultiSelect
+type SelectItem struct {
+	// Key identifies the item to the caller, such as a project name or path
+	Key string
+	// Columns are the row's text, shown after its checkbox; the first is
+	// its name, which filters match
+	Columns  []string
+	Size     int64 // -1 if unknown
+	Selected bool
+	// Disabled rows are shown but can't be selected; Reason says why
+	Disabled bool
+	Reason   string
+}
+
+// MultiSelect is the state of a list the user picks items from: which are
+// selected, which row the cursor is on, and a filter narrowing the rows
+// shown. Front ends draw it and feed it keys; it does no I/O itself.
+type MultiSelect struct {
+	items   []SelectItem
+	filter  string
+	visible []int // indexes into items that match the filter
+	cursor  int   // index into visible
+}
+
+// NewMultiSelect returns a selection over items, with the cursor on the
+// first. Disabled items are never selected, whatever Selected says.
+func NewMultiSelect(items []SelectItem) *MultiSelect {
+	m := &MultiSelect{items: items}
+	for i := range m.items {
+		if m.items[i].Disabled {
+			m.items[i].Selected = false
+		}
+	}
+	m.SetFilter("")
+	return m
+}
+
+// Items returns every item, including those the filter hides
+func (m *MultiSelect) Items() []SelectItem {
+	return m.items
+}
+
+// Visible returns the indexes into Items of the rows the filter shows, in
+// order
+func (m *MultiSelect) Visible() []int {
+	return m.visible
+}
+
+// Cursor returns the position in Visible of the row under the cursor
+func (m *MultiSelect) Cursor() int {
+	return m.cursor
+}
+
+// Filter returns the current filter text
+func (m *MultiSelect) Filter() string {
+	return m.filter
+}
+
+// SetFilter shows only the items whose name contains filter, ignoring
+// case; an empty filter shows them all. Selected items that are hidden
+// stay selected. The cursor moves to the first row shown.
+func (m *MultiSelect) SetFilter(filter string) {
+	m.filter = filter
+	m.visible = m.visible[:0]
+	needle := strings.ToLower(filter)
+	for i, it := range m.items {
+		if needle == "" || (len(it.Columns) > 0 && strings.Contains(strings.ToLower(it.Columns[0]), needle)) {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.cursor = 0
+}
+
+// Move moves the cursor by delta rows, stopping at the first and last
+func (m *MultiSelect) Move(delta int) {
+	m.cursor = min(max(m.cursor+delta, 0), max(len(m.visible)-1, 0))
+}
+
+// Toggle selects or deselects the item under the cursor, unless it is
+// disabled
+func (m *MultiSelect) Toggle() {
+	if len(m.visible) == 0 {
+		return
+	}
+	it := &m.items[m.visible[m.cursor]]
+	if !it.Disabled {
+		it.Selected = !it.Selected
+	}
+}
+
+// SetSelected selects or deselects Items()[i], unless it is disabled
+func (m *MultiSelect) SetSelected(i int, selected bool) {
+	if !m.items[i].Disabled {
+		m.items[i].Selected = selected
+	}
+}
+
+// ToggleAll selects every enabled row shown, or deselects them all if they
+// already are
+func (m *MultiSelect) ToggleAll() {
+	all := true
+	for _, i := range m.visible {
+		if !m.items[i].Disabled {
+			all = all && m.items[i].Selected
+		}
+	}
+	for _, i := range m.visible {
+		if !m.items[i].Disabled {
+			m.items[i].Selected = !all
+		}
+	}
+}
+
+// Selected returns the keys of the selected items, in order, including any
+// the filter hides
+func (m *MultiSelect) Selected() []string {
+	var keys []string
+	for _, it := range m.items {
+		if it.Selected {
+			keys = append(keys, it.Key)
+		}
+	}
+	return keys
+}
+
+// SelectedSize returns the total known size of the selected items
+func (m *MultiSelect) SelectedSize() int64 {
+	var total int64
+	for _, it := range m.items {
+		if it.Selected {
+			total += max(it.Size, 0)
+		}
+	}
+	return total
+}
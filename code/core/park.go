@@ -0,0 +1,469 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// ParkOptions controls how a project is synced back to the archive
+type ParkOptions struct {
+	DryRun bool // Resolve paths and run checks without syncing anything
+	// VerifyRemote hashes the archive copy after syncing and fails with
+	// ErrArchiveMismatch, without recording the park, if it differs from
+	// the local copy
+	VerifyRemote bool
+	// Jobs is how many rsync processes sync the project at once, overriding
+	// the transfer_jobs setting when positive
+	Jobs int
+	// BwLimit caps the transfer rate, as a size per second such as "5M",
+	// overriding the bwlimit setting; "0" lifts the setting's limit
+	BwLimit string
+	// Progress, if set, receives updates while the project is synced; it is
+	// not called for tarball storage
+	Progress ProgressFunc
+	// NoDelete keeps archive files that are gone locally, making the sync
+	// additive. It needs tree storage and can't be combined with
+	// VerifyRemote, since the archive copy may then have more files.
+	NoDelete bool
+}
+
+// ParkResult describes a completed (or, in dry-run mode, planned) park
+type ParkResult struct {
+	Project     string    `json:"project"`
+	LocalPath   string    `json:"local_path"`
+	ArchivePath string    `json:"archive_path"`
+	ParkedAt    time.Time `json:"parked_at"`
+	// Size is the total size of the parked files
+	Size int64 `json:"size,omitempty"`
+	// Verification is the method rm will use to check the parked copy
+	Verification string `json:"verification"`
+	// RemoteVerified is set when VerifyRemote confirmed the archive copy
+	RemoteVerified bool `json:"remote_verified,omitempty"`
+	DryRun         bool `json:"dry_run,omitempty"`
+	// Resumed is set when the park continues one that was interrupted
+	Resumed bool `json:"resumed,omitempty"`
+	// Preview is what a dry run would change in the archive
+	Preview *SyncPreview `json:"preview,omitempty"`
+	// Version is the previous archive copy the park kept, if any
+	Version *ArchiveVersion `json:"version,omitempty"`
+	// Warnings are non-fatal issues the caller should surface to the user
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SyncPreview is what parking a project would change in its archive copy
+type SyncPreview struct {
+	Files int   `json:"files"` // Files that would be copied
+	Bytes int64 `json:"bytes"` // Their total size, an upper bound on the data sent
+	// Deleted are the archive files that would be removed because they are
+	// gone locally
+	Deleted []string `json:"deleted,omitempty"`
+	// Rewrite is set when the archive copy is a tarball, which is written
+	// again in full; Files and Deleted are then not known
+	Rewrite bool `json:"rewrite,omitempty"`
+	// TrashDays is how long deleted and overwritten files are kept in the
+	// category's TrashDir; 0 means they are gone at once
+	TrashDays int `json:"trash_days,omitempty"`
+	// KeepVersions is set when the current archive copy would be kept as a
+	// version first, to how many versions are kept
+	KeepVersions int `json:"keep_versions,omitempty"`
+}
+
+// PreviewPark works out what parking a project with opts would transfer
+// and delete, without changing anything
+func PreviewPark(ctx context.Context, sm StateStore, projectName string, opts ParkOptions) (*SyncPreview, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planPark(ctx, state, projectName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return previewPark(ctx, plan, opts.NoDelete)
+}
+
+// previewPark asks rsync what syncing the project would do, or sizes the
+// tarball that would be written
+func previewPark(ctx context.Context, plan *parkPlan, noDelete bool) (*SyncPreview, error) {
+	if isPackedArchive(plan.target) {
+		copied, _, err := archivedSize(ctx, plan.project.LocalPath, plan.volatile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size project: %w", err)
+		}
+		return &SyncPreview{Bytes: copied, Rewrite: true}, nil
+	}
+	// A copy still stored as a tarball is replaced by a fresh tree
+	dst := plan.target
+	if plan.archivePath != plan.target {
+		dst = ""
+	}
+	preview, err := rsyncPreview(ctx, plan.project.LocalPath, dst, !noDelete, plan.excludes()...)
+	if err != nil {
+		return nil, err
+	}
+	preview.TrashDays = plan.trashDays
+	preview.KeepVersions = plan.keepVersions
+	return preview, nil
+}
+
+// Park syncs a grabbed project's local changes back to the archive
+func Park(ctx context.Context, sm StateStore, projectName string, opts ParkOptions) (*ParkResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	ctx = state.Settings.withRemoteRetries(ctx)
+	plan, err := planPark(ctx, state, projectName, opts)
+	if err != nil {
+		return nil, err
+	}
+	project, archivePath, target := plan.project, plan.archivePath, plan.target
+	method, keys := plan.method, plan.keys
+
+	rsyncOpts, err := state.Settings.rsyncOptions(opts.Jobs, opts.BwLimit, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	rsyncOpts.KeepExtra = opts.NoDelete
+	if plan.trashDays > 0 {
+		rsyncOpts.BackupDir = trashPath(target, time.Now())
+	}
+
+	// A tree sync picks up where an interrupted one stopped; a tarball is
+	// always written from scratch
+	transfer := Transfer{Op: TransferPark, Source: project.LocalPath, Dest: target, StartedAt: time.Now()}
+	resumed := !isPackedArchive(target) && state.resumes(projectName, transfer)
+
+	if opts.DryRun {
+		preview, err := previewPark(ctx, plan, opts.NoDelete)
+		if err != nil {
+			return nil, err
+		}
+		return &ParkResult{
+			Project:      projectName,
+			LocalPath:    project.LocalPath,
+			ArchivePath:  target,
+			Verification: method,
+			DryRun:       true,
+			Resumed:      resumed,
+			Preview:      preview,
+		}, nil
+	}
+
+	// An interrupted park already kept the copy it started to sync over
+	var version *ArchiveVersion
+	if plan.keepVersions > 0 && !resumed {
+		if version, err = keepVersion(ctx, sm, projectName, archivePath, project.LastParkAt); err != nil {
+			return nil, fmt.Errorf("failed to keep the previous archive copy: %w", err)
+		}
+	}
+
+	if !isPackedArchive(target) {
+		if err := beginTransfer(sm, projectName, transfer); err != nil {
+			return nil, fmt.Errorf("failed to update state: %w", err)
+		}
+	}
+	if err := syncToArchive(ctx, project.LocalPath, target, keys, rsyncOpts, plan.excludes()...); err != nil {
+		if ctx.Err() != nil && !isPackedArchive(target) {
+			return nil, fmt.Errorf("park of '%s' interrupted; run it again to resume: %w", projectName, err)
+		}
+		endTransfer(sm, projectName)
+		return nil, fmt.Errorf("failed to sync project: %w", err)
+	}
+	if target != archivePath {
+		if err := os.RemoveAll(archivePath); err != nil {
+			return nil, fmt.Errorf("parked to %s but failed to remove the previous copy: %w", target, err)
+		}
+	}
+
+	var warnings []string
+	if !isPackedArchive(target) {
+		if err := updateChecksums(ctx, project.LocalPath, target, opts.NoDelete); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to update %s in the archive copy: %v", ChecksumFile, err))
+		}
+	}
+
+	baseline, err := captureBaseline(ctx, project.LocalPath, method, &state.Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var verifiedHash *string
+	if opts.VerifyRemote {
+		if verifiedHash, err = verifyArchiveCopy(ctx, projectName, project.LocalPath, target, keys, baseline.contentHash, baseline.hashMode); err != nil {
+			return nil, err
+		}
+	}
+
+	description := ReadDescription(project.LocalPath, state.Settings.MetadataFile)
+
+	// Update state
+	now := time.Now()
+	err = sm.Update(func(state *State) error {
+		delete(state.Transfers, projectName)
+		project, exists := state.Projects[projectName]
+		if !exists || !project.IsGrabbed {
+			return errorf(ErrNotGrabbed, "project '%s' was released while parking", projectName)
+		}
+
+		project.LastParkAt = &now
+		project.DirtySeenAt = nil
+		baseline.apply(project, now)
+		if verifiedHash != nil {
+			project.ArchiveContentHash = verifiedHash
+			project.ArchiveVerifiedAt = &now
+		}
+		if description != "" {
+			project.Description = description
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	if plan.keepVersions > 0 {
+		warnings = append(warnings, pruneVersions(ctx, sm, projectName, plan.keepVersions)...)
+	}
+	publishEvent(sm, ProjectEvent{Time: now, Project: projectName, Op: EventPark, LocalPath: project.LocalPath, Size: sizePtr(baseline.size)})
+
+	return &ParkResult{
+		Project:        projectName,
+		LocalPath:      project.LocalPath,
+		ArchivePath:    target,
+		ParkedAt:       now,
+		Size:           baseline.size,
+		Verification:   method,
+		RemoteVerified: verifiedHash != nil,
+		Resumed:        resumed,
+		Version:        version,
+		Warnings:       warnings,
+	}, nil
+}
+
+// updateChecksums rewrites the ChecksumFile of a freshly synced archive
+// tree from the local copy, only hashing the files that changed since the
+// last park. An additive park keeps the entries of files it left in place.
+func updateChecksums(ctx context.Context, localPath, archivePath string, additive bool) error {
+	previous, err := loadChecksums(ctx, archivePath)
+	if err != nil {
+		return err
+	}
+	sums, err := buildChecksums(ctx, localPath, previous)
+	if err != nil {
+		return err
+	}
+	if additive {
+		listed := make(map[string]bool, len(sums))
+		for _, sum := range sums {
+			listed[sum.Path] = true
+		}
+		for _, sum := range previous {
+			if !listed[sum.Path] {
+				sums = append(sums, sum)
+			}
+		}
+		sort.Slice(sums, func(i, j int) bool { return walkLess(sums[i].Path, sums[j].Path) })
+	}
+	return writeChecksums(ctx, archivePath, sums)
+}
+
+// parkPlan is what a park resolves before it syncs anything
+type parkPlan struct {
+	project     *Project
+	archivePath string // Where the archive copy is now
+	target      string // Where it is written, in the master's storage mode
+	method      string // How rm will verify the parked copy
+	keys        ageKeys
+	volatile    *VolatileRules
+	trashDays   int // Keep replaced archive files this long; 0 if tarball
+	// keepVersions is how many earlier archive copies to keep; 0 if
+	// tarball or the copy is being converted
+	keepVersions int
+}
+
+// excludes returns the rsync patterns leaving the volatile files out of the
+// sync and the archive's ChecksumFile alone
+func (p *parkPlan) excludes() []string {
+	return append(p.volatile.RsyncExcludes(), checksumExclude)
+}
+
+// planPark checks that a project can be parked and resolves where its
+// archive copy goes
+func planPark(ctx context.Context, state *State, projectName string, opts ParkOptions) (*parkPlan, error) {
+	// Check if project is grabbed
+	project, exists := state.Projects[projectName]
+	if !exists || !project.IsGrabbed {
+		return nil, errorf(ErrNotGrabbed, "project '%s' is not currently grabbed", projectName)
+	}
+
+	if err := state.CheckMasterWritable(project.Master); err != nil {
+		return nil, err
+	}
+
+	// Verify local path exists
+	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
+		return nil, errorf(ErrLocalPathMissing, "local path does not exist: %s", project.LocalPath)
+	}
+
+	// Get archive path
+	archivePath, err := state.GetArchivePath(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify archive path exists
+	if exists, err := archivePathExists(ctx, archivePath); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, errorf(ErrArchiveUnreachable, "archive path does not exist: %s", archivePath)
+	}
+
+	// Git verification records the checked-out commit, so the local copy
+	// must be a repository
+	method := state.VerificationMode(projectName)
+	if method == VerifyGit {
+		if _, err := gitHead(ctx, project.LocalPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Park in the master's storage mode, replacing a copy stored the other
+	// way once the new one is written
+	target := trimArchiveExt(archivePath) + state.archiveExt(project.Master)
+	keys := state.ageKeys(project.Master)
+	if opts.VerifyRemote || isPackedArchive(target) {
+		if err := requireLocalArchive(target); err != nil {
+			return nil, err
+		}
+	}
+	if opts.NoDelete {
+		if opts.VerifyRemote {
+			return nil, fmt.Errorf("an additive park can't be verified, since the archive copy keeps files that are gone locally")
+		}
+		if isPackedArchive(target) {
+			return nil, fmt.Errorf("master '%s' stores projects as tarballs, which are always rewritten in full; an additive park needs %s storage", project.Master, StorageTree)
+		}
+		if target != archivePath {
+			return nil, fmt.Errorf("the archive copy at %s is being converted to %s storage, which replaces it; park normally first", archivePath, StorageTree)
+		}
+	}
+
+	volatile, err := LoadVolatileRules(project.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	trashDays := state.Settings.TrashDays
+	if isPackedArchive(target) {
+		trashDays = 0
+	}
+	keepVersions := state.Settings.KeepVersions
+	if isPackedArchive(target) || target != archivePath {
+		keepVersions = 0
+	}
+	return &parkPlan{
+		project:      project,
+		archivePath:  archivePath,
+		target:       target,
+		method:       method,
+		keys:         keys,
+		volatile:     volatile,
+		trashDays:    trashDays,
+		keepVersions: keepVersions,
+	}, nil
+}
+
+// verifyArchiveCopy hashes a freshly synced archive copy and checks it
+// against the local copy, whose hash in mode may already be known. It
+// returns the verified hash.
+func verifyArchiveCopy(ctx context.Context, projectName, localPath, archivePath string, keys ageKeys, localHash *string, mode *HashMode) (*string, error) {
+	if localHash == nil {
+		hash, err := hashDirectory(ctx, localPath, mode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash local files: %w", err)
+		}
+		localHash = &hash
+	}
+	dir, cleanup, err := archiveDir(ctx, archivePath, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive copy: %w", err)
+	}
+	defer cleanup()
+	archiveHash, err := hashDirectory(ctx, dir, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash archive copy: %w", err)
+	}
+	if archiveHash != *localHash {
+		return nil, errorf(ErrArchiveMismatch, "archive copy of '%s' at %s does not match the local copy after syncing; the park was not recorded, run it again", projectName, archivePath)
+	}
+	return localHash, nil
+}
+
+// ParkAllPlan is the grabbed projects parking all of them with unparked
+// work would sync
+type ParkAllPlan struct {
+	// Park are the projects with unparked changes, or never parked, and
+	// those with an interrupted park, by name
+	Park []ReportEntry `json:"park"`
+	// Conflicted also changed in the archive since this machine last
+	// synced them; parking would overwrite that, so they are left alone
+	Conflicted []ReportEntry `json:"conflicted"`
+	// Clean counts the grabbed projects with nothing to park
+	Clean int `json:"clean"`
+}
+
+// PlanParkAll finds the grabbed projects with work to park, deciding as
+// rm does: by newest mtime against the last park, or with
+// VerifySafeToDelete for hash- and git-verified projects, so a copy that
+// was only touched isn't parked and one changed under old mtimes is. Their
+// archive copies are checked for changes made elsewhere.
+func PlanParkAll(ctx context.Context, sm StateStore) (*ParkAllPlan, error) {
+	report, err := BuildReport(ctx, sm, SortName)
+	if err != nil {
+		return nil, err
+	}
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ParkAllPlan{Park: []ReportEntry{}, Conflicted: []ReportEntry{}}
+	var pending []ReportEntry
+	for _, e := range report.Projects {
+		project := state.Projects[e.Name]
+		if project != nil && e.State != StateParking && (e.Status == StatusSafe || e.Status == StatusDirty) &&
+			(e.Verification == VerifyHash || e.Verification == VerifyGit) {
+			if err := VerifySafeToDelete(ctx, e.Name, project, e.Verification); err == nil {
+				e.Status, e.Reason = StatusSafe, "matches its last park"
+			} else if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			} else {
+				e.Status, e.Reason = StatusDirty, err.Error()
+			}
+		}
+		switch {
+		case e.State == StateParking, e.Status == StatusDirty, e.Status == StatusNeverParked:
+			pending = append(pending, e)
+		case e.Status == StatusSafe:
+			plan.Clean++
+		}
+	}
+	if err := CheckArchiveUpdates(ctx, state, pending); err != nil {
+		return nil, err
+	}
+	for _, e := range pending {
+		// An interrupted park has already changed the archive copy itself
+		if e.ArchiveStatus == ArchiveUpdated && state.Transfers[e.Name] == nil {
+			plan.Conflicted = append(plan.Conflicted, e)
+		} else {
+			plan.Park = append(plan.Park, e)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// StatePathEnv names the environment variable that overrides the default
+// state file; --state and --profile still take precedence over it
+const StatePathEnv = "PARKR_STATE_PATH"
+
+// legacyDir returns ~/.parkr, where parkr keeps everything unless the XDG
+// base directories are set
+func legacyDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".parkr")
+}
+
+// useXDG reports whether parkr's files follow the XDG base directory
+// layout: when XDG_CONFIG_HOME or XDG_DATA_HOME is set and there is no
+// ~/.parkr to keep using
+func useXDG() bool {
+	if xdgDir("XDG_CONFIG_HOME") == "" && xdgDir("XDG_DATA_HOME") == "" {
+		return false
+	}
+	info, err := os.Stat(legacyDir())
+	return err != nil || !info.IsDir()
+}
+
+// xdgDir returns the directory an XDG variable names, or "" if it is unset
+// or, against the spec, relative
+func xdgDir(env string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return ""
+}
+
+// ConfigDir returns the directory holding the default state file and
+// profiles: ~/.parkr, or $XDG_CONFIG_HOME/parkr (~/.config/parkr)
+func ConfigDir() string {
+	if !useXDG() {
+		return legacyDir()
+	}
+	if dir := xdgDir("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "parkr")
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".config", "parkr")
+}
+
+// DataDir returns the directory holding the audit log and local trash:
+// ~/.parkr, or $XDG_DATA_HOME/parkr (~/.local/share/parkr)
+func DataDir() string {
+	if !useXDG() {
+		return legacyDir()
+	}
+	if dir := xdgDir("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "parkr")
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".local", "share", "parkr")
+}
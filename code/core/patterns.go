@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Sets of projects MatchProjects expands patterns against
+const (
+	// MatchGrabbed are the tracked projects with a local copy
+	MatchGrabbed = "grabbed"
+	// MatchUngrabbed are the projects in the archive that aren't grabbed:
+	// tracked ones without a local copy and those discovered in archive
+	// directories
+	MatchUngrabbed = "ungrabbed"
+)
+
+// IsProjectPattern reports whether a project argument is a glob pattern,
+// such as ml-* or experiment-202[34]-*
+func IsProjectPattern(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// PatternMatch is what one project argument given to MatchProjects stood
+// for
+type PatternMatch struct {
+	Arg string `json:"arg"`
+	// Pattern is unset for an argument taken as a project name
+	Pattern  bool     `json:"pattern"`
+	Projects []string `json:"projects"`
+}
+
+// MatchProjects expands the glob patterns among args against a set of
+// projects, MatchGrabbed or MatchUngrabbed, and returns what each argument
+// stood for. Other arguments, and patterns naming a project exactly, are
+// taken as project names, whether or not the project exists. A pattern
+// matching no project in the set fails with ErrProjectNotFound.
+func MatchProjects(ctx context.Context, sm StateStore, args []string, set string) ([]PatternMatch, error) {
+	matches := make([]PatternMatch, 0, len(args))
+	if !slices.ContainsFunc(args, IsProjectPattern) {
+		for _, arg := range args {
+			matches = append(matches, PatternMatch{Arg: arg, Projects: []string{arg}})
+		}
+		return matches, nil
+	}
+	for _, arg := range args {
+		if _, err := path.Match(arg, ""); err != nil {
+			return nil, fmt.Errorf("invalid project pattern '%s'", arg)
+		}
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	names, err := state.projectSet(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		if !IsProjectPattern(arg) || slices.Contains(names, arg) || state.Projects[arg] != nil {
+			matches = append(matches, PatternMatch{Arg: arg, Projects: []string{arg}})
+			continue
+		}
+		match := PatternMatch{Arg: arg, Pattern: true}
+		for _, name := range names {
+			if ok, _ := path.Match(arg, name); ok {
+				match.Projects = append(match.Projects, name)
+			}
+		}
+		if len(match.Projects) == 0 {
+			return nil, errorf(ErrProjectNotFound, "no %s project matches '%s'", set, arg)
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// projectSet returns the names of the projects in a set MatchProjects
+// expands patterns against, sorted
+func (s *State) projectSet(ctx context.Context, set string) ([]string, error) {
+	var names []string
+	switch set {
+	case MatchGrabbed:
+		for name, project := range s.Projects {
+			if project.IsGrabbed {
+				names = append(names, name)
+			}
+		}
+	case MatchUngrabbed:
+		copies, err := DiscoverArchiveCopies(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		for name := range copies {
+			if project := s.Projects[name]; project == nil || !project.IsGrabbed {
+				names = append(names, name)
+			}
+		}
+		for name, project := range s.Projects {
+			if _, found := copies[name]; !found && !project.IsGrabbed {
+				names = append(names, name)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown project set '%s'", set)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MatchedProjects returns the projects matches stand for, in order, each
+// once
+func MatchedProjects(matches []PatternMatch) []string {
+	var projects []string
+	for _, m := range matches {
+		for _, name := range m.Projects {
+			if !slices.Contains(projects, name) {
+				projects = append(projects, name)
+			}
+		}
+	}
+	return projects
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferProgress is a snapshot of a copy to or from the archive
+type TransferProgress struct {
+	Bytes int64 // Transferred so far
+	// Percent of the whole transfer done, or -1 if unknown, as when several
+	// rsync processes run at once
+	Percent int
+	Files   int // Files checked so far
+	// TotalFiles is the number of files found so far, which grows while
+	// rsync is still scanning the source
+	TotalFiles int
+	ETA        time.Duration // Estimated time left; 0 if unknown
+}
+
+// ProgressFunc receives TransferProgress updates as a transfer runs. It may
+// be called from goroutines other than the caller's.
+type ProgressFunc func(TransferProgress)
+
+// progress2Line matches a line of rsync --info=progress2 output, such as
+//
+//	134,217,728  50%   64.00MB/s    0:00:02 (xfr#3, to-chk=5/10)
+var progress2Line = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%\s+\S+\s+(\d+):(\d\d):(\d\d)(?:\s+\(xfr#\d+, (?:to|ir)-chk=(\d+)/(\d+)\))?`)
+
+// parseProgress2 parses a line of rsync --info=progress2 output
+func parseProgress2(line string) (TransferProgress, bool) {
+	m := progress2Line.FindStringSubmatch(line)
+	if m == nil {
+		return TransferProgress{}, false
+	}
+	var p TransferProgress
+	p.Bytes, _ = strconv.ParseInt(strings.ReplaceAll(m[1], ",", ""), 10, 64)
+	p.Percent, _ = strconv.Atoi(m[2])
+	h, _ := strconv.Atoi(m[3])
+	min, _ := strconv.Atoi(m[4])
+	sec, _ := strconv.Atoi(m[5])
+	p.ETA = time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	if m[6] != "" {
+		remaining, _ := strconv.Atoi(m[6])
+		p.TotalFiles, _ = strconv.Atoi(m[7])
+		p.Files = p.TotalFiles - remaining
+	}
+	return p, true
+}
+
+// splitProgressLines is a bufio.SplitFunc for rsync output, whose progress
+// lines end in a carriage return so they overwrite each other
+func splitProgressLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, c := range data {
+		if c == '\r' || c == '\n' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// progressSum adds up the progress of rsync processes running at once, so
+// they can be reported as one transfer
+type progressSum struct {
+	mu      sync.Mutex
+	report  ProgressFunc
+	done    TransferProgress // Totals of the finished runs
+	running map[int]TransferProgress
+}
+
+// newProgressSum returns a progressSum passing totals to report
+func newProgressSum(report ProgressFunc) *progressSum {
+	return &progressSum{report: report, running: make(map[int]TransferProgress)}
+}
+
+// run returns the ProgressFunc for one rsync process, identified by id
+func (s *progressSum) run(id int) ProgressFunc {
+	return func(p TransferProgress) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.running[id] = p
+		s.report(s.total())
+	}
+}
+
+// finish folds a finished run into the totals
+func (s *progressSum) finish(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.running[id]
+	delete(s.running, id)
+	s.done.Bytes += p.Bytes
+	s.done.Files += p.Files
+	s.done.TotalFiles += p.TotalFiles
+}
+
+// total adds up every run. The caller must hold s.mu.
+func (s *progressSum) total() TransferProgress {
+	t := s.done
+	t.Percent = -1
+	for _, p := range s.running {
+		t.Bytes += p.Bytes
+		t.Files += p.Files
+		t.TotalFiles += p.TotalFiles
+	}
+	return t
+}
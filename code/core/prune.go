@@ -0,0 +1,483 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PrunePlan is the set of candidates selected to free a target amount of space
+type PrunePlan struct {
+	Target   int64         `json:"target"`
+	Selected []ReportEntry `json:"selected"`
+	Total    int64         `json:"total"`
+	// Shortfall is how far the selection falls short of the target (0 if met)
+	Shortfall int64 `json:"shortfall"`
+	// Volumes is set when the target was derived from a desired free-space
+	// level rather than given directly: each local volume holding grabbed
+	// projects or local roots, with its own deficit that only projects on
+	// it are selected to cover
+	Volumes  []PruneVolume `json:"volumes,omitempty"`
+	volumeOf map[string]int
+	// Dirty lists grabbed projects with unparked work, oldest first. They
+	// are not selected unless ParkFirst moves them into the plan.
+	Dirty []ReportEntry `json:"dirty"`
+	// ToPark names selected projects that must be parked before removal
+	ToPark []string `json:"to_park,omitempty"`
+	// Candidates lists every safe-to-delete project, oldest first, whether
+	// or not it was selected
+	Candidates []ReportEntry `json:"-"`
+	// Kept names projects protected by KeepLatestPerTag
+	Kept []string `json:"kept,omitempty"`
+	// Cluster lists what the other machines sharing the archive could
+	// free; see AddCluster
+	Cluster []ClusterMachine `json:"cluster,omitempty"`
+}
+
+// PruneVolume is a local volume prune --free raises the free space on
+type PruneVolume struct {
+	// Path is the first local root or project found on the volume
+	Path       string     `json:"path"`
+	Disk       *DiskUsage `json:"disk"`
+	FreeTarget int64      `json:"free_target"`
+	// Deficit is how much must be freed on the volume to reach FreeTarget
+	Deficit int64 `json:"deficit"`
+	// Selected is the combined local size of the selected projects on it
+	Selected int64 `json:"selected"`
+}
+
+// AddCluster lists this machine's grabbed projects in the archive's
+// CheckoutsDir and fills in Cluster from the other machines' lists. Call
+// it before KeepLatestPerTag or ParkFirst change the plan, and again after
+// ExecutePrune to drop the removed projects from the list. The returned
+// errors are categories whose list could not be written.
+func (p *PrunePlan) AddCluster(sm StateStore) ([]error, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	errs := publishCheckouts(state, host, append(slices.Clone(p.Candidates), p.Dirty...), time.Now())
+	p.Cluster = readClusterMachines(state, host)
+	return errs, nil
+}
+
+// selectCandidates selects candidates, oldest first, until their combined
+// local size reaches the target, or each volume's deficit
+func (p *PrunePlan) selectCandidates() {
+	p.clearSelection()
+	for _, c := range p.Candidates {
+		if p.needs(c) {
+			p.add(c)
+		}
+	}
+	p.setShortfall()
+}
+
+// clearSelection empties the selection
+func (p *PrunePlan) clearSelection() {
+	p.Selected = []ReportEntry{}
+	p.ToPark = nil
+	p.Total = 0
+	for i := range p.Volumes {
+		p.Volumes[i].Selected = 0
+	}
+}
+
+// needs reports whether removing e still helps reach the target: while the
+// selection falls short of it, or of the deficit of e's volume when the
+// plan has volumes
+func (p *PrunePlan) needs(e ReportEntry) bool {
+	if p.Volumes == nil {
+		return p.Total < p.Target
+	}
+	v, ok := p.volumeOf[e.Name]
+	return ok && p.Volumes[v].Selected < p.Volumes[v].Deficit
+}
+
+// add selects e
+func (p *PrunePlan) add(e ReportEntry) {
+	p.Selected = append(p.Selected, e)
+	p.Total += max(e.LocalSize, 0)
+	if v, ok := p.volumeOf[e.Name]; ok {
+		p.Volumes[v].Selected += max(e.LocalSize, 0)
+	}
+}
+
+// setShortfall works out how far the selection falls short of the target,
+// summing each volume's shortfall when the plan has volumes
+func (p *PrunePlan) setShortfall() {
+	p.Shortfall = 0
+	if p.Volumes == nil {
+		p.Shortfall = max(p.Target-p.Total, 0)
+		return
+	}
+	for _, v := range p.Volumes {
+		p.Shortfall += max(v.Deficit-v.Selected, 0)
+	}
+}
+
+// KeepLatestPerTag protects the most recently modified project of each tag
+// from pruning, so only its older siblings can be removed, and redoes the
+// selection. It must be called before ParkFirst or Choose.
+func (p *PrunePlan) KeepLatestPerTag() {
+	latest := make(map[string]ReportEntry)
+	for _, e := range append(slices.Clone(p.Candidates), p.Dirty...) {
+		for _, tag := range e.Tags {
+			cur, ok := latest[tag]
+			if !ok || timeOrZero(e.LastModified).After(timeOrZero(cur.LastModified)) {
+				latest[tag] = e
+			}
+		}
+	}
+
+	kept := make(map[string]bool)
+	for _, e := range latest {
+		kept[e.Name] = true
+	}
+	keep := func(entries []ReportEntry) []ReportEntry {
+		return slices.DeleteFunc(slices.Clone(entries), func(e ReportEntry) bool { return kept[e.Name] })
+	}
+	p.Candidates = keep(p.Candidates)
+	p.Dirty = keep(p.Dirty)
+
+	p.Kept = p.Kept[:0]
+	for name := range kept {
+		p.Kept = append(p.Kept, name)
+	}
+	slices.Sort(p.Kept)
+	p.selectCandidates()
+}
+
+// Parkable returns the dirty projects ParkFirst could select to cover the
+// shortfall: all of them, or with volumes those on a volume still short
+func (p *PrunePlan) Parkable() []ReportEntry {
+	var entries []ReportEntry
+	for _, e := range p.Dirty {
+		if p.Volumes == nil || p.needs(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// ParkableSize returns the combined local size of the Parkable projects
+func (p *PrunePlan) ParkableSize() int64 {
+	var total int64
+	for _, e := range p.Parkable() {
+		if e.LocalSize > 0 {
+			total += e.LocalSize
+		}
+	}
+	return total
+}
+
+// ParkFirst covers any shortfall by selecting dirty projects, oldest first,
+// to be parked and then removed. Returns the number of projects added.
+func (p *PrunePlan) ParkFirst() int {
+	added := 0
+	remaining := p.Dirty[:0:0]
+	for _, e := range p.Dirty {
+		if !p.needs(e) {
+			remaining = append(remaining, e)
+			continue
+		}
+		p.add(e)
+		p.ToPark = append(p.ToPark, e.Name)
+		added++
+	}
+	p.Dirty = remaining
+	p.setShortfall()
+	return added
+}
+
+// Choose replaces the automatic selection with the named projects, taken
+// from the plan's candidates and dirty projects. Chosen dirty projects are
+// parked before removal.
+func (p *PrunePlan) Choose(names []string) {
+	chosen := make(map[string]bool, len(names))
+	for _, n := range names {
+		chosen[n] = true
+	}
+
+	dirty := append(p.Dirty, p.dirtySelected()...)
+	p.clearSelection()
+	p.Dirty = []ReportEntry{}
+	for _, e := range p.Candidates {
+		if chosen[e.Name] {
+			p.add(e)
+		}
+	}
+	SortReportEntries(dirty, SortModified)
+	for _, e := range dirty {
+		if !chosen[e.Name] {
+			p.Dirty = append(p.Dirty, e)
+			continue
+		}
+		p.add(e)
+		p.ToPark = append(p.ToPark, e.Name)
+	}
+	p.setShortfall()
+}
+
+// dirtySelected returns the selected projects that are to be parked first
+func (p *PrunePlan) dirtySelected() []ReportEntry {
+	var entries []ReportEntry
+	for _, e := range p.Selected {
+		if slices.Contains(p.ToPark, e.Name) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// PruneOptions controls how a prune plan is executed
+type PruneOptions struct {
+	NoHash bool // Use mtime verification for all projects
+	Force  bool // Skip verification entirely
+	// NoTrash deletes the local copies at once instead of moving them to
+	// the local trash, which keeps using the space they take up
+	NoTrash bool
+}
+
+// PruneOutcome is the result of removing one selected project
+type PruneOutcome struct {
+	Project string `json:"project"`
+	Size    int64  `json:"size"`
+	Parked  bool   `json:"parked,omitempty"`
+	Removed bool   `json:"removed"`
+	// Trashed is set when the removed copy was moved to the local trash
+	Trashed bool   `json:"trashed,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PlanPrune selects pruning candidates, oldest first, until their combined
+// local size reaches target
+func PlanPrune(ctx context.Context, sm StateStore, target int64) (*PrunePlan, error) {
+	report, err := BuildReport(ctx, sm, SortModified)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PrunePlan{
+		Target:     target,
+		Selected:   []ReportEntry{},
+		Dirty:      []ReportEntry{},
+		Candidates: report.Candidates,
+	}
+	for _, e := range report.Projects {
+		if e.Status == StatusDirty || e.Status == StatusNeverParked {
+			plan.Dirty = append(plan.Dirty, e)
+		}
+	}
+
+	plan.selectCandidates()
+	return plan, nil
+}
+
+// PlanPruneToFree plans a prune that raises the free space on every local
+// volume holding grabbed projects or local roots to freeSpec, given as a
+// size (50G) or a percentage of each volume (20%). Candidates are grouped
+// by volume, and only those on a volume short of free space are selected,
+// until its deficit is covered.
+func PlanPruneToFree(ctx context.Context, sm StateStore, freeSpec string) (*PrunePlan, error) {
+	plan, err := PlanPrune(ctx, sm, 0)
+	if err != nil {
+		return nil, err
+	}
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []string
+	for _, categories := range state.Masters {
+		for category := range categories {
+			roots = append(roots, state.LocalRoot(category))
+		}
+	}
+	for _, root := range state.Settings.LocalRoots {
+		roots = append(roots, root)
+	}
+	slices.Sort(roots)
+	roots = slices.Compact(roots)
+
+	plan.Volumes = []PruneVolume{}
+	plan.volumeOf = make(map[string]int)
+	volumes := make(map[uint64]int)
+	volumeIndex := func(path string) (int, bool, error) {
+		device, err := volumeID(path)
+		if err != nil {
+			// A local root that doesn't exist yet holds nothing to prune
+			return 0, false, nil
+		}
+		if v, ok := volumes[device]; ok {
+			return v, true, nil
+		}
+		usage, err := GetDiskUsage(path)
+		if err != nil {
+			return 0, false, err
+		}
+		want, err := ParseFreeTarget(freeSpec, usage)
+		if err != nil {
+			return 0, false, err
+		}
+		volumes[device] = len(plan.Volumes)
+		plan.Volumes = append(plan.Volumes, PruneVolume{
+			Path:       path,
+			Disk:       usage,
+			FreeTarget: want,
+			Deficit:    max(want-usage.Free, 0),
+		})
+		plan.Target += plan.Volumes[len(plan.Volumes)-1].Deficit
+		return len(plan.Volumes) - 1, true, nil
+	}
+	for _, root := range roots {
+		if _, _, err := volumeIndex(root); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range append(slices.Clone(plan.Candidates), plan.Dirty...) {
+		v, ok, err := volumeIndex(e.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			plan.volumeOf[e.Name] = v
+		}
+	}
+
+	plan.selectCandidates()
+	return plan, nil
+}
+
+// ExecutePrune removes the local copies of every project in the plan,
+// re-verifying each one at deletion time. Projects listed in ToPark are
+// parked first. Failures are recorded per project rather than aborting the
+// remaining removals.
+func ExecutePrune(ctx context.Context, sm StateStore, plan *PrunePlan, opts PruneOptions) ([]PruneOutcome, error) {
+	var outcomes []PruneOutcome
+	batch := time.Now().Format(trashLayout)
+	for _, entry := range plan.Selected {
+		if err := ctx.Err(); err != nil {
+			return outcomes, err
+		}
+
+		outcome := PruneOutcome{Project: entry.Name, Size: entry.LocalSize}
+		if slices.Contains(plan.ToPark, entry.Name) {
+			if _, err := Park(ctx, sm, entry.Name, ParkOptions{}); err != nil {
+				outcome.Error = fmt.Sprintf("park failed: %v", err)
+				outcomes = append(outcomes, outcome)
+				continue
+			}
+			outcome.Parked = true
+		}
+
+		if err := ensureArchiveVerified(ctx, sm, entry.Name, time.Now()); err != nil {
+			outcome.Error = err.Error()
+			outcomes = append(outcomes, outcome)
+			continue
+		}
+
+		rm, err := Rm(ctx, sm, entry.Name, RmOptions{NoHash: opts.NoHash, Force: opts.Force, NoTrash: opts.NoTrash, event: EventPrune, batch: batch})
+		if err != nil {
+			outcome.Error = err.Error()
+		} else {
+			outcome.Removed = true
+			outcome.Trashed = rm.Trashed != nil
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
+
+// Actions for archive copies that haven't been verified recently enough
+const (
+	VerifyActionScrub = "verify"
+	VerifyActionBlock = "block"
+)
+
+// archiveVerifiedSince reports whether a project's archive copy passed a
+// scrub within the configured prune window
+func (s *Settings) archiveVerifiedSince(project *Project, now time.Time) bool {
+	if s.PruneVerifyDays <= 0 {
+		return true
+	}
+	window := time.Duration(s.PruneVerifyDays) * 24 * time.Hour
+	return project.ArchiveVerifiedAt != nil && now.Sub(*project.ArchiveVerifiedAt) <= window
+}
+
+// UnverifiedSelected returns the selected projects whose archive copies
+// have not passed a scrub within the prune_verify_days window
+func (p *PrunePlan) UnverifiedSelected(state *State, now time.Time) []string {
+	var names []string
+	for _, e := range p.Selected {
+		if project, ok := state.Projects[e.Name]; ok && !state.Settings.archiveVerifiedSince(project, now) {
+			names = append(names, e.Name)
+		}
+	}
+	return names
+}
+
+// ensureArchiveVerified applies the prune verification rule to a project
+// about to be removed: a stale archive copy is scrubbed on the fly, or
+// rejected when the action is "block"
+func ensureArchiveVerified(ctx context.Context, sm StateStore, projectName string, now time.Time) error {
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	project, ok := state.Projects[projectName]
+	if !ok || state.Settings.archiveVerifiedSince(project, now) {
+		return nil
+	}
+	if state.Settings.PruneVerifyAction == VerifyActionBlock {
+		return errorf(ErrUnverifiedArchive, "archive copy of '%s' has not been verified in the last %d day(s). Run 'parkr verify --scrub %s'",
+			projectName, state.Settings.PruneVerifyDays, projectName)
+	}
+	return ScrubArchiveCopy(ctx, sm, projectName)
+}
+
+// ParseSize parses a size such as 10G, 500MB, 2t or 1024 into bytes.
+// Negative, NaN and infinite values, and sizes too large for an int64,
+// are rejected.
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "B")
+
+	multiplier := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = 1024
+		case 'M':
+			multiplier = 1024 * 1024
+		case 'G':
+			multiplier = 1024 * 1024 * 1024
+		case 'T':
+			multiplier = 1024 * 1024 * 1024 * 1024
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid size '%s' (expected e.g. 10G, 500M, 2T)", s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, the first size that
+	// overflows
+	if value*float64(multiplier) >= math.MaxInt64 {
+		return 0, fmt.Errorf("size '%s' is too large", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
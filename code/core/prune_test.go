@@ -0,0 +1,44 @@
+package core
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "0", want: 0},
+		{in: "10K", want: 10 * 1024},
+		{in: "500MB", want: 500 * 1024 * 1024},
+		{in: "2t", want: 2 * 1024 * 1024 * 1024 * 1024},
+		{in: " 1.5G ", want: 1536 * 1024 * 1024},
+		{in: "", wantErr: true},
+		{in: "G", wantErr: true},
+		{in: "ten", wantErr: true},
+		{in: "-1G", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "nanG", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "+InfT", wantErr: true},
+		{in: "1e300", wantErr: true},
+		{in: "9223372036854775807", wantErr: true},
+		{in: "8388608T", wantErr: true},
+		{in: "8388607T", want: 8388607 * 1024 * 1024 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSize(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSize(%q) failed: %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
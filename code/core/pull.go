@@ -0,0 +1,265 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Archive statuses set by CheckArchiveUpdates
+const (
+	ArchiveCurrent = "current" // Unchanged since this machine last synced
+	ArchiveUpdated = "updated" // Changed elsewhere; pull to catch up
+	ArchiveUnknown = "unknown" // No fingerprint recorded, or unreadable
+	ArchiveMissing = "missing" // The archive copy is gone
+)
+
+// PullOptions controls how a project is re-synced from the archive
+type PullOptions struct {
+	DryRun bool // Check for updates and local changes without copying
+}
+
+// PullResult describes a completed (or, in dry-run mode, planned) pull
+type PullResult struct {
+	Project     string `json:"project"`
+	ArchivePath string `json:"archive_path"`
+	LocalPath   string `json:"local_path"`
+	// Updated is false when the archive had not changed and nothing was copied
+	Updated bool `json:"updated"`
+	DryRun  bool `json:"dry_run,omitempty"`
+}
+
+// syncBaseline is what a local copy looks like right after it was synced
+// with the archive, recorded so later changes on either side can be spotted
+type syncBaseline struct {
+	newestMtime *time.Time
+	contentHash *string // Hash verification only
+	hashMode    *HashMode
+	gitHead     string // Git verification only
+	fingerprint string
+	size        int64 // Total size of the tracked files
+}
+
+// captureBaseline records the state of a freshly synced local copy under the
+// given verification method, hashing it in the mode settings ask for
+func captureBaseline(ctx context.Context, dir, method string, settings *Settings) (*syncBaseline, error) {
+	b := &syncBaseline{}
+
+	newestInfo, err := GetNewestMtime(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mtime: %w", err)
+	}
+	if newestInfo != nil && *newestInfo != nil {
+		mtime := (*newestInfo).ModTime()
+		b.newestMtime = &mtime
+	}
+
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan local files: %w", err)
+	}
+	b.fingerprint = manifestFingerprint(manifest)
+	for _, e := range manifest {
+		b.size += e.Size
+	}
+
+	switch method {
+	case VerifyHash:
+		if b.hashMode, err = settings.hashMode(); err != nil {
+			return nil, err
+		}
+		hash, err := contentHash(ctx, dir, manifest, b.hashMode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash local files: %w", err)
+		}
+		b.contentHash = &hash
+	case VerifyGit:
+		if b.gitHead, err = gitHead(ctx, dir); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// apply stores the baseline in project
+func (b *syncBaseline) apply(project *Project, now time.Time) {
+	if b.newestMtime != nil {
+		project.LastParkMtime = b.newestMtime
+	}
+	// The archive copy has changed: record its new hash, if computed, and
+	// drop any earlier scrub
+	project.ArchiveContentHash = b.contentHash
+	project.LocalContentHash = b.contentHash
+	project.HashMode = b.hashMode
+	if b.contentHash != nil {
+		project.LocalHashComputedAt = &now
+	}
+	project.NoHashMode = b.contentHash == nil
+	project.ArchiveVerifiedAt = nil
+	project.LastParkGitHead = b.gitHead
+	project.ArchiveFingerprint = b.fingerprint
+}
+
+// archiveStatus compares a project's archive copy with the fingerprint
+// recorded when this machine last synced it
+func archiveStatus(ctx context.Context, archivePath string, keys ageKeys, project *Project) (string, error) {
+	if project.ArchiveFingerprint == "" || IsRemote(archivePath) {
+		return ArchiveUnknown, nil
+	}
+	dir, cleanup, err := archiveDir(ctx, archivePath, keys)
+	if err != nil {
+		return "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer cleanup()
+	manifest, err := BuildManifest(ctx, dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan archive: %w", err)
+	}
+	if manifestFingerprint(manifest) != project.ArchiveFingerprint {
+		return ArchiveUpdated, nil
+	}
+	return ArchiveCurrent, nil
+}
+
+// checkArchive is archiveStatus for an archive copy that may be gone
+func checkArchive(ctx context.Context, archivePath string, keys ageKeys, project *Project) (string, error) {
+	if exists, err := archivePathExists(ctx, archivePath); err != nil {
+		return "", err
+	} else if !exists {
+		return ArchiveMissing, nil
+	}
+	return archiveStatus(ctx, archivePath, keys, project)
+}
+
+// CheckArchiveUpdates sets ArchiveStatus on each entry, reporting which
+// archive copies are gone or were changed by another machine since this one
+// last synced, and updates State to match
+func CheckArchiveUpdates(ctx context.Context, state *State, entries []ReportEntry) error {
+	for i := range entries {
+		e := &entries[i]
+		project, ok := state.Projects[e.Name]
+		if !ok {
+			continue
+		}
+		archivePath, err := state.GetArchivePath(e.Name)
+		if err != nil {
+			return err
+		}
+		status, err := checkArchive(ctx, archivePath, state.ageKeys(project.Master), project)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			status = ArchiveUnknown
+		}
+		e.ArchiveStatus = status
+		e.State = state.ProjectState(e.Name, e.Status, status)
+	}
+	return nil
+}
+
+// Pull re-syncs a grabbed project from the archive after another machine
+// parked changes to it. It refuses if the local copy has changed since it
+// was last synced, since those changes would be overwritten.
+func Pull(ctx context.Context, sm StateStore, projectName string, opts PullOptions) (*PullResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	ctx = state.Settings.withRemoteRetries(ctx)
+
+	project, exists := state.Projects[projectName]
+	if !exists || !project.IsGrabbed {
+		return nil, errorf(ErrNotGrabbed, "project '%s' is not currently grabbed", projectName)
+	}
+	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
+		return nil, errorf(ErrLocalPathMissing, "local path does not exist: %s", project.LocalPath)
+	}
+
+	archivePath, err := state.GetArchivePath(projectName)
+	if err != nil {
+		return nil, err
+	}
+	if exists, err := archivePathExists(ctx, archivePath); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, errorf(ErrArchiveUnreachable, "archive path does not exist: %s", archivePath)
+	}
+
+	result := &PullResult{Project: projectName, ArchivePath: archivePath, LocalPath: project.LocalPath, DryRun: opts.DryRun}
+
+	status, err := archiveStatus(ctx, archivePath, state.ageKeys(project.Master), project)
+	if err != nil {
+		return nil, err
+	}
+	if status == ArchiveCurrent {
+		return result, nil
+	}
+
+	method := state.VerificationMode(projectName)
+	if err := verifyUnchangedSinceSync(ctx, projectName, project, method); err != nil {
+		return nil, err
+	}
+
+	volatile, err := LoadVolatileRules(project.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Updated = true
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Copy from archive to local, keeping local-only skipped paths
+	rsyncOpts, err := state.Settings.rsyncOptions(0, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	keys := state.ageKeys(project.Master)
+	if err := copyFromArchive(ctx, archivePath, project.LocalPath, keys, rsyncOpts, volatile.RsyncExcludes()...); err != nil {
+		return nil, fmt.Errorf("failed to sync project: %w", err)
+	}
+
+	baseline, err := captureBaseline(ctx, project.LocalPath, method, &state.Settings)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = sm.Update(func(state *State) error {
+		project, exists := state.Projects[projectName]
+		if !exists || !project.IsGrabbed {
+			return errorf(ErrNotGrabbed, "project '%s' was released while pulling", projectName)
+		}
+		baseline.apply(project, now)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+
+	return result, nil
+}
+
+// verifyUnchangedSinceSync checks that a local copy still matches the
+// fingerprint recorded at its last grab, park or pull. Projects synced before
+// fingerprints were recorded fall back to the verification method.
+func verifyUnchangedSinceSync(ctx context.Context, projectName string, project *Project, method string) error {
+	if project.ArchiveFingerprint == "" {
+		return VerifySafeToDelete(ctx, projectName, project, method)
+	}
+	manifest, err := BuildManifest(ctx, project.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to check local files: %w", err)
+	}
+	if manifestFingerprint(manifest) != project.ArchiveFingerprint {
+		return errorf(ErrDirtyProject, "project '%s' has local changes since it was last synced, and pulling would overwrite them", projectName)
+	}
+	return nil
+}
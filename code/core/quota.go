@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Quota modes
+const (
+	QuotaWarn    = "warn"
+	QuotaEnforce = "enforce"
+)
+
+// QuotaUsage describes local usage of a category against its quota
+type QuotaUsage struct {
+	Category string `json:"category"`
+	Used     int64  `json:"used"`
+	Limit    int64  `json:"limit"`
+}
+
+// Exceeded reports whether adding bytes would take usage over the quota
+func (q *QuotaUsage) Exceeded(adding int64) bool {
+	return q.Used+adding > q.Limit
+}
+
+// CategoryQuota returns the configured local quota for a category in bytes
+func (s *Settings) CategoryQuota(category string) (int64, bool, error) {
+	spec, ok := s.CategoryQuotas[category]
+	if !ok {
+		return 0, false, nil
+	}
+	limit, err := ParseSize(spec)
+	if err != nil {
+		return 0, false, errorf(ErrStateFile, "invalid quota for category '%s': %w", category, err)
+	}
+	return limit, true, nil
+}
+
+// EnforceQuotas reports whether quotas block operations rather than warn
+func (s *Settings) EnforceQuotas() bool {
+	return s.QuotaMode == QuotaEnforce
+}
+
+// CategoryUsage sums the local size of grabbed projects in a category and
+// compares it with the category's quota. Returns nil if no quota is set.
+func CategoryUsage(ctx context.Context, state *State, category string) (*QuotaUsage, error) {
+	limit, ok, err := state.Settings.CategoryQuota(category)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	usage := &QuotaUsage{Category: category, Limit: limit}
+	for _, p := range state.Projects {
+		if !p.IsGrabbed || p.ArchiveCategory != category {
+			continue
+		}
+		size, err := GetDirSize(ctx, p.LocalPath)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			continue
+		}
+		usage.Used += size
+	}
+	return usage, nil
+}
+
+// GrabUsage describes the projects grabbed at once against the max_grabbed
+// and max_grabbed_size limits
+type GrabUsage struct {
+	Projects    int `json:"projects"`
+	MaxProjects int `json:"max_projects,omitempty"`
+	// Size is only summed when MaxSize is set
+	Size    int64 `json:"size"`
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+// GrabbedUsage counts the grabbed projects, and sums their local size if
+// max_grabbed_size is set. Returns nil if neither limit is set.
+func GrabbedUsage(ctx context.Context, state *State) (*GrabUsage, error) {
+	usage := &GrabUsage{MaxProjects: state.Settings.MaxGrabbed}
+	if spec := state.Settings.MaxGrabbedSize; spec != "" {
+		limit, err := ParseSize(spec)
+		if err != nil {
+			return nil, errorf(ErrStateFile, "invalid max_grabbed_size: %w", err)
+		}
+		usage.MaxSize = limit
+	}
+	if usage.MaxProjects == 0 && usage.MaxSize == 0 {
+		return nil, nil
+	}
+
+	for _, p := range state.Projects {
+		if !p.IsGrabbed {
+			continue
+		}
+		usage.Projects++
+		if usage.MaxSize == 0 {
+			continue
+		}
+		size, err := GetDirSize(ctx, p.LocalPath)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			continue
+		}
+		usage.Size += size
+	}
+	return usage, nil
+}
+
+// overruns describes each grab limit that grabbing a project of the given
+// size would take usage over
+func (u *GrabUsage) overruns(projectName string, adding int64) []string {
+	var msgs []string
+	if u.MaxProjects > 0 && u.Projects+1 > u.MaxProjects {
+		msgs = append(msgs, fmt.Sprintf("grabbing '%s' would make %d projects grabbed at once, over the limit of %d; park and rm or prune some first",
+			projectName, u.Projects+1, u.MaxProjects))
+	}
+	if u.MaxSize > 0 && u.Size+adding > u.MaxSize {
+		msgs = append(msgs, fmt.Sprintf("grabbing '%s' (%s) would put grabbed projects at %s, over the %s limit; park and rm or prune some first",
+			projectName, FormatSize(adding), FormatSize(u.Size+adding), FormatSize(u.MaxSize)))
+	}
+	return msgs
+}
+
+// quotaMessage describes a quota overrun for warnings and errors
+func quotaMessage(projectName string, usage *QuotaUsage, adding int64) string {
+	return fmt.Sprintf("grabbing '%s' (%s) would put category '%s' at %s, over its %s quota",
+		projectName, FormatSize(adding), usage.Category, FormatSize(usage.Used+adding), FormatSize(usage.Limit))
+}
+
+// QuotaUtilization pairs configured quotas with per-category totals from a
+// report, sorted by category name. Categories without a quota are omitted.
+func QuotaUtilization(state *State, totals []CategoryTotal) ([]QuotaUsage, error) {
+	used := make(map[string]int64, len(totals))
+	for _, t := range totals {
+		used[t.Category] = t.LocalSize
+	}
+
+	categories := make([]string, 0, len(state.Settings.CategoryQuotas))
+	for category := range state.Settings.CategoryQuotas {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	usages := make([]QuotaUsage, 0, len(categories))
+	for _, category := range categories {
+		limit, _, err := state.Settings.CategoryQuota(category)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, QuotaUsage{Category: category, Used: used[category], Limit: limit})
+	}
+	return usages, nil
+}
+
+// SetCategoryQuota sets the local quota for a category
+func SetCategoryQuota(sm StateStore, category, size string) error {
+	if _, err := ParseSize(size); err != nil {
+		return err
+	}
+	return sm.Update(func(state *State) error {
+		if state.Settings.CategoryQuotas == nil {
+			state.Settings.CategoryQuotas = make(map[string]string)
+		}
+		state.Settings.CategoryQuotas[category] = size
+		return nil
+	})
+}
+
+// UnsetCategoryQuota removes the local quota for a category
+func UnsetCategoryQuota(sm StateStore, category string) error {
+	return sm.Update(func(state *State) error {
+		if _, ok := state.Settings.CategoryQuotas[category]; !ok {
+			return fmt.Errorf("no quota set for category '%s'", category)
+		}
+		delete(state.Settings.CategoryQuotas, category)
+		return nil
+	})
+}
+
+// SetQuotaMode sets whether exceeding a quota warns or blocks grab
+func SetQuotaMode(sm StateStore, mode string) error {
+	if mode != QuotaWarn && mode != QuotaEnforce {
+		return fmt.Errorf("invalid quota mode '%s' (expected warn or enforce)", mode)
+	}
+	return sm.Update(func(state *State) error {
+		state.Settings.QuotaMode = mode
+		return nil
+	})
+}
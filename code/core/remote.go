@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SplitRemote splits an rsync-style remote path such as user@nas:/archive
+// into its host and path. ok is false for local paths.
+func SplitRemote(p string) (host, path string, ok bool) {
+	if p == "" || p[0] == '/' || p[0] == '.' || p[0] == '~' {
+		return "", p, false
+	}
+	colon := strings.IndexByte(p, ':')
+	if colon <= 0 || strings.ContainsRune(p[:colon], '/') {
+		return "", p, false
+	}
+	return p[:colon], p[colon+1:], true
+}
+
+// IsRemote reports whether p is on another host
+func IsRemote(p string) bool {
+	_, _, ok := SplitRemote(p)
+	return ok
+}
+
+// archiveRoot returns where a master keeps a category: its configured path,
+// prefixed with the master's host if it has one and the path names none
+func (s *State) archiveRoot(master, categoryPath string) string {
+	host := s.Settings.Masters[master].Host
+	if host == "" || IsRemote(categoryPath) {
+		return categoryPath
+	}
+	return host + ":" + categoryPath
+}
+
+// hasRemoteRoot reports whether any of a master's categories is on another
+// host
+func (s *State) hasRemoteRoot(master string) bool {
+	for _, categoryPath := range s.Masters[master] {
+		if IsRemote(s.archiveRoot(master, categoryPath)) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireLocalArchive fails for archive paths on another host, which
+// operations that read files directly can't reach
+func requireLocalArchive(p string) error {
+	if host, _, ok := SplitRemote(p); ok {
+		return errorf(ErrArchiveUnreachable, "%s is on remote host %s; mount it locally to read it directly", p, host)
+	}
+	return nil
+}
+
+// archivePathExists reports whether an archive directory exists, checking
+// over SSH for remote paths
+func archivePathExists(ctx context.Context, p string) (bool, error) {
+	host, dir, ok := SplitRemote(p)
+	if !ok {
+		_, err := os.Stat(p)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	_, err := runSSH(ctx, host, "test -d "+shellQuote(dir))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// listRemoteDirs returns the names of the directories in dir on host,
+// hidden ones included, or none if dir does not exist
+func listRemoteDirs(ctx context.Context, host, dir string) ([]string, error) {
+	out, err := runSSH(ctx, host, "cd "+shellQuote(dir)+" 2>/dev/null || exit 0; ls -1Ap")
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, line := range strings.Split(out, "\n") {
+		if name, ok := strings.CutSuffix(line, "/"); ok && name != "" {
+			dirs = append(dirs, name)
+		}
+	}
+	return dirs, nil
+}
+
+// remoteDirSize returns the disk usage of dir on host, as reported by du
+func remoteDirSize(ctx context.Context, host, dir string) (int64, error) {
+	out, err := runSSH(ctx, host, "du -sk "+shellQuote(dir))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected du output from %s: %q", host, out)
+	}
+	kb, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected du output from %s: %q", host, out)
+	}
+	return kb * 1024, nil
+}
+
+// runSSH runs a shell command on host and returns its output, retrying if
+// the connection fails
+func runSSH(ctx context.Context, host, command string) (string, error) {
+	var out string
+	err := retryRemote(ctx, func() error {
+		var err error
+		out, err = runSSHOnce(ctx, host, command)
+		return err
+	}, sshTransient)
+	return out, err
+}
+
+// runSSHOnce runs a shell command on host once for runSSH
+func runSSHOnce(ctx context.Context, host, command string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", host, command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", fmt.Errorf("ssh interrupted: %w", ctxErr)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() != 255 {
+			// The command ran and failed; let callers inspect the status
+			return "", err
+		}
+		return "", errorf(ErrArchiveUnreachable, "ssh to %s failed: %s", host, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
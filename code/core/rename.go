@@ -0,0 +1,191 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProjectRename describes a renamed project
+type ProjectRename struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Tracked bool   `json:"tracked"`
+	// OldArchivePath and NewArchivePath are where the archive copy was and
+	// is; ArchiveMoved is unset when there was no archive copy to move
+	OldArchivePath string `json:"old_archive_path"`
+	NewArchivePath string `json:"new_archive_path"`
+	ArchiveMoved   bool   `json:"archive_moved"`
+	// OldLocalPath and NewLocalPath are set when a grabbed project's local
+	// copy is moved
+	OldLocalPath string `json:"old_local_path,omitempty"`
+	NewLocalPath string `json:"new_local_path,omitempty"`
+}
+
+// RenameProject renames a project: its archive copy, its local copy if
+// grabbed, which moves to a sibling named after the new name, and its
+// state entry. Each step is undone if a later one fails, so the project is
+// either renamed everywhere or nowhere; if undoing fails too, the error
+// says where each copy was left. A project with an unfinished
+// transfer, or in more than one master, can't be renamed.
+func RenameProject(ctx context.Context, sm StateStore, from, to string, dryRun bool) (*ProjectRename, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	rename, err := planProjectRename(ctx, state, from, to)
+	if err != nil || dryRun {
+		return rename, err
+	}
+
+	if rename.ArchiveMoved {
+		if err := moveArchiveDir(ctx, rename.OldArchivePath, rename.NewArchivePath); err != nil {
+			return nil, errorf(ErrArchiveUnreachable, "failed to move %s to %s: %w", rename.OldArchivePath, rename.NewArchivePath, err)
+		}
+	}
+	// undo puts back the copies moved so far, last first, adding to err
+	// those it couldn't and where they were left
+	var undoSteps []func() error
+	undo := func(err error) error {
+		var failed []string
+		for i := len(undoSteps) - 1; i >= 0; i-- {
+			if undoErr := undoSteps[i](); undoErr != nil {
+				failed = append(failed, undoErr.Error())
+			}
+		}
+		if len(failed) == 0 {
+			return err
+		}
+		return fmt.Errorf("%w; %s", err, strings.Join(failed, "; "))
+	}
+	if rename.ArchiveMoved {
+		undoSteps = append(undoSteps, func() error {
+			if err := moveArchiveDir(ctx, rename.NewArchivePath, rename.OldArchivePath); err != nil {
+				return fmt.Errorf("moving the archive copy back to %s also failed, so it is left at %s: %v", rename.OldArchivePath, rename.NewArchivePath, err)
+			}
+			return nil
+		})
+	}
+
+	if rename.NewLocalPath != "" {
+		if err := os.Rename(rename.OldLocalPath, rename.NewLocalPath); err != nil {
+			return nil, undo(fmt.Errorf("failed to move %s to %s: %w", rename.OldLocalPath, rename.NewLocalPath, err))
+		}
+		undoSteps = append(undoSteps, func() error {
+			if err := os.Rename(rename.NewLocalPath, rename.OldLocalPath); err != nil {
+				return fmt.Errorf("moving the local copy back to %s also failed, so it is left at %s: %v", rename.OldLocalPath, rename.NewLocalPath, err)
+			}
+			return nil
+		})
+	}
+
+	if !rename.Tracked {
+		publishEvent(sm, ProjectEvent{Project: to, Op: EventRename, RenamedFrom: from})
+		return rename, nil
+	}
+	err = sm.Update(func(state *State) error {
+		project, ok := state.Projects[from]
+		if !ok {
+			return errorf(ErrProjectNotFound, "project '%s' not found in state", from)
+		}
+		if _, taken := state.Projects[to]; taken {
+			return errorf(ErrProjectExists, "project '%s' is already tracked", to)
+		}
+		if state.Transfers[from] != nil {
+			return fmt.Errorf("project '%s' has an unfinished %s; finish it before renaming", from, state.Transfers[from].Op)
+		}
+		delete(state.Projects, from)
+		state.Projects[to] = project
+		if rename.NewLocalPath != "" {
+			project.LocalPath = rename.NewLocalPath
+		}
+		// Undo restores trashed copies by project name
+		for i := range state.Journal {
+			if state.Journal[i].Project == from {
+				state.Journal[i].Project = to
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Put the copies back, so the state still describes them
+		return nil, undo(err)
+	}
+	publishEvent(sm, ProjectEvent{Project: to, Op: EventRename, LocalPath: rename.NewLocalPath, RenamedFrom: from})
+	return rename, nil
+}
+
+// planProjectRename checks that a project can be renamed and works out
+// where its copies go
+func planProjectRename(ctx context.Context, state *State, from, to string) (*ProjectRename, error) {
+	if to == from {
+		return nil, fmt.Errorf("project '%s' already has that name", from)
+	}
+	if err := state.checkProjectName(to); err != nil {
+		return nil, err
+	}
+	if existing, ok := state.Projects[to]; ok {
+		return nil, errorf(ErrProjectExists, "project '%s' is already tracked (archived in %s/%s)", to, existing.Master, existing.ArchiveCategory)
+	}
+	if t := state.Transfers[from]; t != nil {
+		return nil, fmt.Errorf("project '%s' has an unfinished %s; finish it before renaming", from, t.Op)
+	}
+
+	copies, err := DiscoverArchiveCopies(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if aps, ok := copies[to]; ok {
+		return nil, errorf(ErrProjectExists, "the archive already has a project named '%s' at %s", to, aps[0].Path)
+	}
+	if aps := copies[from]; len(aps) > 1 {
+		masters := make([]string, 0, len(aps))
+		for _, ap := range aps {
+			masters = append(masters, ap.Master)
+		}
+		sort.Strings(masters)
+		return nil, fmt.Errorf("project '%s' is in more than one master (%s); remove the copies you don't need first", from, strings.Join(masters, ", "))
+	}
+
+	rename := &ProjectRename{From: from, To: to}
+	master := ""
+	project, tracked := state.Projects[from]
+	if tracked {
+		rename.Tracked = true
+		master = project.Master
+		if rename.OldArchivePath, err = state.GetArchivePath(from); err != nil {
+			return nil, err
+		}
+	} else {
+		aps, ok := copies[from]
+		if !ok {
+			return nil, errorf(ErrProjectNotFound, "project '%s' not found", from)
+		}
+		master = aps[0].Master
+		rename.OldArchivePath = aps[0].Path
+	}
+	if err := state.CheckMasterWritable(master); err != nil {
+		return nil, err
+	}
+
+	// A compressed copy keeps its extension
+	ext := strings.TrimPrefix(filepath.Base(rename.OldArchivePath), from)
+	rename.NewArchivePath = filepath.Join(filepath.Dir(rename.OldArchivePath), to+ext)
+	if rename.ArchiveMoved, err = archivePathExists(ctx, rename.OldArchivePath); err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to check %s: %w", rename.OldArchivePath, err)
+	}
+
+	if tracked && project.IsGrabbed {
+		if _, err := os.Stat(project.LocalPath); err == nil {
+			newLocal := filepath.Join(filepath.Dir(project.LocalPath), to)
+			if _, err := os.Lstat(newLocal); err == nil {
+				return nil, errorf(ErrLocalPathExists, "local path already exists: %s", newLocal)
+			}
+			rename.OldLocalPath, rename.NewLocalPath = project.LocalPath, newLocal
+		}
+	}
+	return rename, nil
+}
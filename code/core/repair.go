@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Repairs SuggestRepairs can offer for a verify finding
+const (
+	RepairAdopt   = "adopt"   // Track Path as the project's grabbed local copy
+	RepairRelease = "release" // Mark the project not grabbed
+	RepairForget  = "forget"  // Drop the project from state; the archive is left alone
+)
+
+// Repair is one way of fixing a verify finding
+type Repair struct {
+	Action      string `json:"action"`
+	Path        string `json:"path,omitempty"` // Adopt only
+	Description string `json:"description"`
+}
+
+// SuggestRepairs lists the repairs that would fix a finding in the current
+// state, most likely first. Findings about archive contents or keys have
+// none, and neither do findings for projects no longer in state.
+func SuggestRepairs(sm StateStore, f VerifyFinding) ([]Repair, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	project, ok := state.Projects[f.Project]
+	if !ok {
+		return nil, nil
+	}
+	forget := Repair{Action: RepairForget, Description: "forget the project, leaving its archive copy and any local copy alone"}
+
+	var repairs []Repair
+	adopt := func(path, verb string) {
+		repairs = append(repairs, Repair{Action: RepairAdopt, Path: path, Description: fmt.Sprintf("%s %s", verb, path)})
+	}
+	switch f.Check {
+	case CheckLocalMissing:
+		for _, p := range state.LocalCopies(f.Project) {
+			adopt(p, "relink to the local copy in")
+		}
+		repairs = append(repairs, Repair{Action: RepairRelease, Description: "mark it not grabbed, as the local copy is gone"}, forget)
+	case CheckUntrackedLocal:
+		adopt(project.LocalPath, "mark it grabbed again, tracking")
+		repairs = append(repairs, forget)
+	case CheckDuplicateLocal:
+		for _, p := range state.LocalCopies(f.Project) {
+			if !project.IsGrabbed || p != filepath.Clean(project.LocalPath) {
+				adopt(p, "track instead the local copy in")
+			}
+		}
+	case CheckArchiveMissing:
+		repairs = append(repairs, forget)
+	}
+	return repairs, nil
+}
+
+// ApplyRepair carries out a repair for a project
+func ApplyRepair(sm StateStore, projectName string, r Repair) error {
+	switch r.Action {
+	case RepairAdopt:
+		return trackLocalCopy(sm, projectName, r.Path)
+	case RepairRelease:
+		return sm.Update(func(state *State) error {
+			if _, ok := state.Projects[projectName]; !ok {
+				return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+			}
+			return releaseProject(projectName)(state)
+		})
+	case RepairForget:
+		return sm.Update(func(state *State) error {
+			if _, ok := state.Projects[projectName]; !ok {
+				return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+			}
+			delete(state.Projects, projectName)
+			delete(state.Transfers, projectName)
+			return nil
+		})
+	}
+	return fmt.Errorf("unknown repair '%s'", r.Action)
+}
+
+// trackLocalCopy makes path the grabbed local copy of a project, grabbed
+// or not. Like AdoptLocalCopy it clears the local hash, and a released
+// project counts as grabbed now.
+func trackLocalCopy(sm StateStore, projectName, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err != nil {
+		return fmt.Errorf("cannot adopt %s: %w", path, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("cannot adopt %s: not a directory", path)
+	}
+	now := time.Now()
+	return sm.Update(func(state *State) error {
+		project, ok := state.Projects[projectName]
+		if !ok {
+			return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+		}
+		if !project.IsGrabbed {
+			project.IsGrabbed = true
+			project.GrabbedAt = &now
+		}
+		project.LocalPath = path
+		project.LocalContentHash = nil
+		project.LocalHashComputedAt = nil
+		return nil
+	})
+}
@@ -0,0 +1,395 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Project statuses reported for grabbed projects
+const (
+	StatusSafe         = "safe"
+	StatusDirty        = "dirty"
+	StatusNeverParked  = "never-parked"
+	StatusMissingLocal = "missing-local"
+)
+
+// timeLayout is used for timestamps in human-readable explanations
+const timeLayout = "2006-01-02 15:04:05"
+
+// ReportEntry describes the local state of one grabbed project
+type ReportEntry struct {
+	Name         string     `json:"name"`
+	LocalPath    string     `json:"local_path"`
+	Category     string     `json:"category"`
+	Tags         []string   `json:"tags,omitempty"`
+	LocalSize    int64      `json:"local_size"` // -1 if the size could not be determined
+	LastModified *time.Time `json:"last_modified"`
+	LastParkAt   *time.Time `json:"last_park_at"`
+	Status       string     `json:"status"`
+	Candidate    bool       `json:"candidate"`
+	// State is the project's lifecycle state; see ProjectState
+	State string `json:"state"`
+	// Verification is the method used to decide Status
+	Verification string `json:"verification"`
+	// ArchiveStatus is set by CheckArchiveUpdates
+	ArchiveStatus string `json:"archive_status,omitempty"`
+	// Reason explains why the project is or isn't a pruning candidate
+	Reason string `json:"reason"`
+}
+
+// Report summarises grabbed projects and which of them are safe to prune
+type Report struct {
+	Projects []ReportEntry `json:"projects"`
+	// Candidates are the safe-to-delete projects, oldest first
+	Candidates  []ReportEntry `json:"candidates"`
+	Recoverable int64         `json:"recoverable"`
+	// LocalTotal is the combined local size of the listed projects
+	LocalTotal int64 `json:"local_total"`
+	// SizeBands summarises all grabbed projects by local size, regardless of
+	// any filter applied afterwards
+	SizeBands []SizeBand `json:"size_bands"`
+	// Categories holds per-category subtotals of the listed projects
+	Categories []CategoryTotal `json:"categories"`
+}
+
+// CategoryTotal sums local usage and recoverable space for one category
+type CategoryTotal struct {
+	Category    string `json:"category"`
+	Projects    int    `json:"projects"`
+	LocalSize   int64  `json:"local_size"`
+	Candidates  int    `json:"candidates"`
+	Recoverable int64  `json:"recoverable"`
+}
+
+// SizeBand counts grabbed projects within a range of local sizes
+type SizeBand struct {
+	Label string `json:"label"`
+	Min   int64  `json:"min"`
+	Max   int64  `json:"max,omitempty"` // 0 means unbounded
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+// FilterMinSize drops projects smaller than minSize (and those of unknown
+// size) from the report's listings and recomputes the recoverable total
+func (r *Report) FilterMinSize(minSize int64) {
+	if minSize <= 0 {
+		return
+	}
+
+	keep := func(entries []ReportEntry) []ReportEntry {
+		filtered := []ReportEntry{}
+		for _, e := range entries {
+			if e.LocalSize >= minSize {
+				filtered = append(filtered, e)
+			}
+		}
+		return filtered
+	}
+
+	r.Projects = keep(r.Projects)
+	r.Candidates = keep(r.Candidates)
+	r.Recoverable = 0
+	for _, c := range r.Candidates {
+		r.Recoverable += c.LocalSize
+	}
+	r.LocalTotal = 0
+	for _, p := range r.Projects {
+		r.LocalTotal += p.LocalSize
+	}
+	r.Categories = computeCategoryTotals(r.Projects)
+}
+
+// CountStatus returns how many listed projects have the given status
+func (r *Report) CountStatus(status string) int {
+	n := 0
+	for _, e := range r.Projects {
+		if e.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// computeCategoryTotals groups entries by archive category, largest first
+func computeCategoryTotals(entries []ReportEntry) []CategoryTotal {
+	byName := make(map[string]*CategoryTotal)
+	for _, e := range entries {
+		t, ok := byName[e.Category]
+		if !ok {
+			t = &CategoryTotal{Category: e.Category}
+			byName[e.Category] = t
+		}
+		t.Projects++
+		size := max(e.LocalSize, 0)
+		t.LocalSize += size
+		if e.Candidate {
+			t.Candidates++
+			t.Recoverable += size
+		}
+	}
+
+	totals := make([]CategoryTotal, 0, len(byName))
+	for _, t := range byName {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].LocalSize != totals[j].LocalSize {
+			return totals[i].LocalSize > totals[j].LocalSize
+		}
+		return totals[i].Category < totals[j].Category
+	})
+	return totals
+}
+
+// computeSizeBands buckets entries into <1 GB, 1-10 GB and >10 GB bands
+func computeSizeBands(entries []ReportEntry) []SizeBand {
+	const gb = 1024 * 1024 * 1024
+	bands := []SizeBand{
+		{Label: ">10 GB", Min: 10 * gb},
+		{Label: "1-10 GB", Min: gb, Max: 10 * gb},
+		{Label: "<1 GB", Min: 0, Max: gb},
+	}
+
+	for _, e := range entries {
+		if e.LocalSize < 0 {
+			continue
+		}
+		for i := range bands {
+			if e.LocalSize >= bands[i].Min && (bands[i].Max == 0 || e.LocalSize < bands[i].Max) {
+				bands[i].Count++
+				bands[i].Size += e.LocalSize
+				break
+			}
+		}
+	}
+	return bands
+}
+
+// Sort orders for report listings
+const (
+	SortModified = "modified"
+	SortSize     = "size"
+	SortName     = "name"
+)
+
+// BuildReport inspects every grabbed project and classifies it for pruning.
+// Projects are listed in the given sort order (modified, size or name).
+func BuildReport(ctx context.Context, sm StateStore, sortBy string) (*Report, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Projects:   []ReportEntry{},
+		Candidates: []ReportEntry{},
+	}
+
+	for name, project := range state.Projects {
+		if !project.IsGrabbed {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry, err := EvaluateProject(ctx, name, project, state.VerificationMode(name))
+		if err != nil {
+			return nil, err
+		}
+		entry.State = state.ProjectState(name, entry.Status, "")
+		report.Projects = append(report.Projects, *entry)
+		report.LocalTotal += max(entry.LocalSize, 0)
+
+		if entry.Candidate {
+			report.Candidates = append(report.Candidates, *entry)
+			if entry.LocalSize > 0 {
+				report.Recoverable += entry.LocalSize
+			}
+		}
+	}
+
+	if err := noteDirty(sm, state, report.Projects); err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	if err := SortReportEntries(report.Projects, sortBy); err != nil {
+		return nil, err
+	}
+	report.SizeBands = computeSizeBands(report.Projects)
+	report.Categories = computeCategoryTotals(report.Projects)
+	SortReportEntries(report.Candidates, SortModified)
+
+	return report, nil
+}
+
+// EvaluateProject computes a grabbed project's size, newest mtime and
+// pruning status under the given verification method, recording the reason
+// for the decision. Hash mode classifies by mtime, leaving the content hash
+// to be checked on removal.
+func EvaluateProject(ctx context.Context, name string, project *Project, method string) (*ReportEntry, error) {
+	entry := &ReportEntry{
+		Name:         name,
+		LocalPath:    project.LocalPath,
+		Category:     project.ArchiveCategory,
+		Tags:         project.Tags,
+		LocalSize:    -1,
+		LastParkAt:   project.LastParkAt,
+		Verification: method,
+	}
+
+	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
+		entry.Status = StatusMissingLocal
+		entry.Reason = fmt.Sprintf("local path %s does not exist", project.LocalPath)
+		return entry, nil
+	}
+
+	size, err := GetDirSize(ctx, project.LocalPath)
+	if err == nil {
+		entry.LocalSize = size
+	} else if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	newestInfo, err := GetNewestMtime(ctx, project.LocalPath)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		entry.Status = StatusDirty
+		entry.Reason = fmt.Sprintf("could not scan local files: %v", err)
+		return entry, nil
+	}
+	if newestInfo != nil && *newestInfo != nil {
+		mtime := (*newestInfo).ModTime()
+		entry.LastModified = &mtime
+	}
+
+	if method == VerifyGit {
+		return evaluateGit(ctx, entry, project)
+	}
+
+	switch {
+	case project.LastParkMtime == nil:
+		entry.Status = StatusNeverParked
+		entry.Reason = "never parked"
+	case method == VerifyHash && (project.NoHashMode || project.ArchiveContentHash == nil):
+		entry.Status = StatusDirty
+		entry.Reason = "parked without a content hash; park again to verify by hash"
+	case entry.LastModified != nil && entry.LastModified.After(*project.LastParkMtime):
+		entry.Status = StatusDirty
+		entry.Reason = fmt.Sprintf("modified at %s after park at %s",
+			entry.LastModified.Format(timeLayout), project.LastParkMtime.Format(timeLayout))
+	default:
+		entry.Status = StatusSafe
+		entry.Candidate = true
+		if entry.LastModified != nil {
+			entry.Reason = fmt.Sprintf("newest file %s is not after park at %s",
+				entry.LastModified.Format(timeLayout), project.LastParkMtime.Format(timeLayout))
+		} else {
+			entry.Reason = "no files modified since park"
+		}
+	}
+
+	return entry, nil
+}
+
+// evaluateGit classifies a git-verified project by comparing its checkout
+// with the commit recorded at its last park
+func evaluateGit(ctx context.Context, entry *ReportEntry, project *Project) (*ReportEntry, error) {
+	if project.LastParkGitHead == "" {
+		entry.Status = StatusNeverParked
+		entry.Reason = "never parked with git verification"
+		return entry, nil
+	}
+
+	changes, err := gitChanges(ctx, project)
+	switch {
+	case err != nil:
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		entry.Status = StatusDirty
+		entry.Reason = fmt.Sprintf("could not check git status: %v", err)
+	case changes != "":
+		entry.Status = StatusDirty
+		entry.Reason = changes
+	default:
+		entry.Status = StatusSafe
+		entry.Candidate = true
+		entry.Reason = fmt.Sprintf("clean checkout of parked commit %s", shortCommit(project.LastParkGitHead))
+	}
+	return entry, nil
+}
+
+// SortReportEntries sorts entries in place. Modified order is oldest first,
+// size order is largest first.
+func SortReportEntries(entries []ReportEntry, sortBy string) error {
+	var less func(a, b ReportEntry) bool
+	switch sortBy {
+	case SortModified, "":
+		less = func(a, b ReportEntry) bool {
+			return timeOrZero(a.LastModified).Before(timeOrZero(b.LastModified))
+		}
+	case SortSize:
+		less = func(a, b ReportEntry) bool { return a.LocalSize > b.LocalSize }
+	case SortName:
+		less = func(a, b ReportEntry) bool { return a.Name < b.Name }
+	default:
+		return fmt.Errorf("invalid sort field '%s' (expected modified, size or name)", sortBy)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if less(entries[i], entries[j]) {
+			return true
+		}
+		if less(entries[j], entries[i]) {
+			return false
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return nil
+}
+
+// timeOrZero dereferences t, returning the zero time for nil
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// FormatAge formats the time elapsed since t, e.g. "3 weeks ago"
+func FormatAge(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+
+	d := time.Since(*t)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d.Minutes()), "min")
+	case d < 24*time.Hour:
+		return plural(int(d.Hours()), "hour")
+	case d < 7*24*time.Hour:
+		return plural(int(d.Hours()/24), "day")
+	case d < 30*24*time.Hour:
+		return plural(int(d.Hours()/(24*7)), "week")
+	case d < 365*24*time.Hour:
+		return plural(int(d.Hours()/(24*30)), "month")
+	default:
+		return plural(int(d.Hours()/(24*365)), "year")
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import "time"
+
+// Operations recorded in State.Transfers
+const (
+	TransferGrab = "grab"
+	TransferPark = "park"
+)
+
+// rsyncPartialDir is where rsync keeps partly copied files when a transfer
+// is interrupted, relative to each destination directory, so the next run
+// continues them instead of starting over. rsync protects it from --delete
+// and removes it once the files are complete.
+const rsyncPartialDir = ".parkr-partial"
+
+// Transfer is a grab or park that was started and has not finished. If it
+// was interrupted, running the same command again resumes it.
+type Transfer struct {
+	Op        string    `json:"op"`
+	Source    string    `json:"source"`
+	Dest      string    `json:"dest"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// beginTransfer records that a transfer of a project is under way,
+// keeping the start time of an interrupted one it resumes
+func beginTransfer(sm StateStore, projectName string, t Transfer) error {
+	return sm.Update(func(state *State) error {
+		if prev := state.Transfers[projectName]; prev != nil && prev.Op == t.Op && prev.Dest == t.Dest {
+			t.StartedAt = prev.StartedAt
+		}
+		if state.Transfers == nil {
+			state.Transfers = make(map[string]*Transfer)
+		}
+		state.Transfers[projectName] = &t
+		return nil
+	})
+}
+
+// endTransfer forgets a project's transfer once it has finished or been
+// cleaned up
+func endTransfer(sm StateStore, projectName string) error {
+	return sm.Update(func(state *State) error {
+		delete(state.Transfers, projectName)
+		return nil
+	})
+}
+
+// resumes reports whether a transfer continues one of the same project
+// that was interrupted
+func (s *State) resumes(projectName string, t Transfer) bool {
+	prev := s.Transfers[projectName]
+	return prev != nil && prev.Op == t.Op && prev.Dest == t.Dest
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultRemoteAttempts is how many times a remote rsync or ssh command is
+// tried when the remote_attempts setting is unset
+const DefaultRemoteAttempts = 3
+
+// Backoff between attempts starts at retryBaseDelay and doubles up to
+// retryMaxDelay
+const (
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// transientRsyncCodes are the rsync exit codes for a dropped or stalled
+// connection: socket I/O (10), protocol data stream (12), timeout (30),
+// daemon connection timeout (35) and the ssh transport failing (255)
+var transientRsyncCodes = map[int]bool{10: true, 12: true, 30: true, 35: true, 255: true}
+
+// retryKey is the context key for the number of attempts remote operations
+// get
+type retryKey struct{}
+
+// withRemoteRetries returns ctx carrying the remote_attempts setting, which
+// the rsync and ssh commands run under it follow
+func (s *Settings) withRemoteRetries(ctx context.Context) context.Context {
+	attempts := s.RemoteAttempts
+	if attempts <= 0 {
+		attempts = DefaultRemoteAttempts
+	}
+	return context.WithValue(ctx, retryKey{}, attempts)
+}
+
+// remoteAttempts returns how many attempts ctx allows a remote operation
+func remoteAttempts(ctx context.Context) int {
+	if attempts, ok := ctx.Value(retryKey{}).(int); ok {
+		return attempts
+	}
+	return DefaultRemoteAttempts
+}
+
+// retryRemote runs op until it succeeds, fails for a reason transient does
+// not accept, or has used up ctx's attempts, waiting longer before each
+// retry. An error after retries says how many attempts were made.
+func retryRemote(ctx context.Context, op func() error, transient func(error) bool) error {
+	attempts := remoteAttempts(ctx)
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || ctx.Err() != nil || !transient(err) {
+			return err
+		}
+		if attempt >= attempts {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, retryMaxDelay)
+	}
+}
+
+// rsyncTransient reports whether an rsync failure was the network's
+func rsyncTransient(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && transientRsyncCodes[exitErr.ExitCode()]
+}
+
+// sshTransient reports whether an ssh failure was ssh's own, such as a
+// refused or dropped connection, rather than the remote command's
+func sshTransient(err error) bool {
+	return errors.Is(err, ErrArchiveUnreachable)
+}
+
+// hasRemoteArg reports whether any non-option argument of an rsync command
+// is on another host
+func hasRemoteArg(args []string) bool {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") && IsRemote(arg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Verification methods, configured per project or globally and reported in
+// RmResult
+const (
+	VerifyHash  = "hash"
+	VerifyMtime = "mtime"
+	VerifyGit   = "git"
+	VerifyNone  = "none"
+)
+
+// RmOptions controls the safety checks performed before removing a local copy
+type RmOptions struct {
+	NoHash bool // Use mtime verification instead of the configured method
+	Force  bool // Skip verification entirely
+	DryRun bool // Verify but do not delete anything
+	// NoTrash deletes the local copy at once instead of moving it to the
+	// local trash
+	NoTrash bool
+	// event is the operation published and journaled for the removal;
+	// EventRm if empty
+	event string
+	// batch groups the removals of one prune in the journal
+	batch string
+}
+
+// RmResult describes a completed local removal
+type RmResult struct {
+	Project   string `json:"project"`
+	LocalPath string `json:"local_path"`
+	// Verification is the method used to confirm the removal was safe
+	Verification string `json:"verification,omitempty"`
+	// LocalMissing is true when the local copy was already gone and only
+	// state was updated
+	LocalMissing bool `json:"local_missing,omitempty"`
+	// Size is how much the removed local copy held, if it could be sized
+	Size int64 `json:"size,omitempty"`
+	// Trashed is set when the local copy was moved to the local trash
+	// rather than deleted
+	Trashed *TrashedCopy `json:"trashed,omitempty"`
+	DryRun  bool         `json:"dry_run,omitempty"`
+	// Warnings are problems emptying expired copies from the trash
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Rm removes the local copy of a project after verifying it is safe to do so
+func Rm(ctx context.Context, sm StateStore, projectName string, opts RmOptions) (*RmResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if project is grabbed
+	project, exists := state.Projects[projectName]
+	if !exists || !project.IsGrabbed {
+		return nil, errorf(ErrNotGrabbed, "project '%s' is not currently grabbed", projectName)
+	}
+
+	result := &RmResult{Project: projectName, LocalPath: project.LocalPath, DryRun: opts.DryRun}
+
+	// Verify local path exists
+	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) {
+		result.LocalMissing = true
+		if opts.DryRun {
+			return result, nil
+		}
+
+		// Local path doesn't exist, just update state
+		if err := sm.Update(releaseProject(projectName)); err != nil {
+			return nil, fmt.Errorf("failed to update state: %w", err)
+		}
+		return result, nil
+	}
+
+	// Safety verification
+	if !opts.Force {
+		if err := preflightVerify(ctx, sm, &state.Settings, projectName); err != nil {
+			return nil, err
+		}
+		method := state.VerificationMode(projectName)
+		if opts.NoHash {
+			method = VerifyMtime
+		}
+		if err := VerifySafeToDelete(ctx, projectName, project, method); err != nil {
+			return nil, err
+		}
+		if err := state.Settings.CheckRecentPark(ctx, projectName, project, time.Now()); err != nil {
+			return nil, err
+		}
+		result.Verification = method
+	} else {
+		result.Verification = VerifyNone
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Delete local copy, or move it to the trash
+	size, err := GetDirSize(ctx, project.LocalPath)
+	if err == nil {
+		result.Size = size
+	} else {
+		size = -1
+	}
+	if days := state.Settings.LocalTrashRetention(); days > 0 && !opts.NoTrash {
+		root, statePath := trashRootFor(project.LocalPath), statePathOf(sm)
+		if result.Trashed, err = moveToTrash(root, statePath, projectName, project.LocalPath, size); err != nil {
+			return nil, fmt.Errorf("failed to move local copy to the trash: %w", err)
+		}
+		if _, err := EmptyTrash(append(state.TrashRoots(), root), statePath, days, false); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to empty expired trash: %v", err))
+		}
+	} else if err := os.RemoveAll(project.LocalPath); err != nil {
+		return nil, fmt.Errorf("failed to remove local copy: %w", err)
+	}
+
+	// Update state, journaling a trashed removal so undo can revert it
+	err = sm.Update(func(state *State) error {
+		if result.Trashed != nil {
+			if project, ok := state.Projects[projectName]; ok {
+				state.recordRemoval(opts.event, opts.batch, projectName, project, result.Trashed)
+			}
+			if root := result.Trashed.Root; root != LocalTrashDir() && !slices.Contains(state.TrashDirs, root) {
+				state.TrashDirs = append(state.TrashDirs, root)
+				sort.Strings(state.TrashDirs)
+			}
+		}
+		return releaseProject(projectName)(state)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	event := opts.event
+	if event == "" {
+		event = EventRm
+	}
+	publishEvent(sm, ProjectEvent{Project: projectName, Op: event, LocalPath: result.LocalPath, Size: sizePtr(result.Size)})
+
+	return result, nil
+}
+
+// releaseProject returns a state update marking a project as no longer grabbed
+func releaseProject(projectName string) func(*State) error {
+	return func(state *State) error {
+		if project, exists := state.Projects[projectName]; exists {
+			project.IsGrabbed = false
+		}
+		return nil
+	}
+}
+
+// CheckRecentPark enforces the recent-park rule: a local copy at least
+// RecentParkSize large must have been parked within RecentParkHours of now
+func (s *Settings) CheckRecentPark(ctx context.Context, projectName string, project *Project, now time.Time) error {
+	if s.RecentParkSize == "" || s.RecentParkHours <= 0 {
+		return nil
+	}
+	threshold, err := ParseSize(s.RecentParkSize)
+	if err != nil {
+		return errorf(ErrStateFile, "invalid recent_park_size: %w", err)
+	}
+
+	size, err := GetDirSize(ctx, project.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to size local copy: %w", err)
+	}
+	if size < threshold {
+		return nil
+	}
+
+	window := time.Duration(s.RecentParkHours) * time.Hour
+	if project.LastParkAt == nil || now.Sub(*project.LastParkAt) > window {
+		return errorf(ErrStalePark, "project '%s' is %s and was not parked in the last %d hour(s). Park it again or use --force",
+			projectName, FormatSize(size), s.RecentParkHours)
+	}
+	return nil
+}
+
+// VerifySafeToDelete checks, using the given verification method, that a
+// grabbed project has not been modified since its last park
+func VerifySafeToDelete(ctx context.Context, projectName string, project *Project, method string) error {
+	switch method {
+	case VerifyHash:
+		return verifyHash(ctx, projectName, project)
+	case VerifyGit:
+		return verifyGit(ctx, projectName, project)
+	}
+
+	// Mtime verification
+	if project.LastParkMtime == nil {
+		return errorf(ErrDirtyProject, "project '%s' has never been parked - cannot verify safety", projectName)
+	}
+
+	newestInfo, err := GetNewestMtime(ctx, project.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to check local files: %w", err)
+	}
+
+	if newestInfo != nil && *newestInfo != nil {
+		currentMtime := (*newestInfo).ModTime()
+		if currentMtime.After(*project.LastParkMtime) {
+			return errorf(ErrDirtyProject, "project '%s' has been modified since last park (newest: %s, parked: %s). Park first or use --force",
+				projectName, currentMtime.Format("2006-01-02 15:04:05"), project.LastParkMtime.Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// SizeCacheTTL is how long a cached directory size is reused before the
+// directory is walked again
+const SizeCacheTTL = time.Hour
+
+// maxSizeWorkers caps how many directories DirSizes walks at once
+const maxSizeWorkers = 8
+
+// SizeCacheEntry is one cached directory size
+type SizeCacheEntry struct {
+	Size       int64     `json:"size"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// SizeCache maps directory paths to their cached sizes
+type SizeCache map[string]SizeCacheEntry
+
+// SizeCachePath returns the size cache file kept next to a state file
+func SizeCachePath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "size-cache.json")
+}
+
+// LoadSizeCache reads the size cache. A missing or unreadable cache is
+// treated as empty, since it can always be rebuilt.
+func LoadSizeCache(statePath string) SizeCache {
+	cache := make(SizeCache)
+	data, err := os.ReadFile(SizeCachePath(statePath))
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return make(SizeCache)
+	}
+	return cache
+}
+
+// Save writes the size cache next to the state file, dropping expired
+// entries
+func (c SizeCache) Save(statePath string, now time.Time) error {
+	for dir, entry := range c {
+		if now.Sub(entry.ComputedAt) > SizeCacheTTL {
+			delete(c, dir)
+		}
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize size cache: %w", err)
+	}
+	if err := os.WriteFile(SizeCachePath(statePath), data, 0644); err != nil {
+		return fmt.Errorf("failed to write size cache: %w", err)
+	}
+	return nil
+}
+
+// DirSizes sizes several directories, walking up to maxSizeWorkers of them
+// in parallel. Sizes cached within SizeCacheTTL are reused unless refresh is
+// set, and fresh sizes are added to cache. Directories that can't be read
+// get size -1.
+func DirSizes(ctx context.Context, dirs []string, cache SizeCache, refresh bool, now time.Time) (map[string]int64, error) {
+	sizes := make(map[string]int64, len(dirs))
+	var todo []string
+	for _, dir := range dirs {
+		if entry, ok := cache[dir]; ok && !refresh && now.Sub(entry.ComputedAt) <= SizeCacheTTL {
+			sizes[dir] = entry.Size
+			continue
+		}
+		todo = append(todo, dir)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for range min(len(todo), runtime.NumCPU(), maxSizeWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range jobs {
+				size, err := GetDirSize(ctx, dir)
+				mu.Lock()
+				if err != nil {
+					sizes[dir] = -1
+				} else {
+					sizes[dir] = size
+					cache[dir] = SizeCacheEntry{Size: size, ComputedAt: now}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, dir := range todo {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- dir
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// snapshotSuffix matches a dated suffix on a project name: -2024,
+// -2024-03, -2024-03-15 or -20240315
+var snapshotSuffix = regexp.MustCompile(`^(.+)-((?:19|20)\d{2}(?:-?\d{2}(?:-?\d{2})?)?)$`)
+
+// SplitSnapshotName splits a dated snapshot name such as "analysis-2024"
+// into its base name and date suffix. ok is false for undated names.
+func SplitSnapshotName(name string) (base, date string, ok bool) {
+	m := snapshotSuffix.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// snapshotsOf returns the archived snapshots of base, oldest first
+func snapshotsOf(archiveProjects map[string]ArchiveProject, base string) []string {
+	var names []string
+	dates := make(map[string]string)
+	for name := range archiveProjects {
+		if b, date, ok := SplitSnapshotName(name); ok && b == base {
+			names = append(names, name)
+			dates[name] = strings.ReplaceAll(date, "-", "")
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// Compare dates padded to full length so 2024 sorts before 20240315
+		di, dj := dates[names[i]]+"0000", dates[names[j]]+"0000"
+		if di[:8] != dj[:8] {
+			return di[:8] < dj[:8]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// ResolveArchiveProject finds the archived project called name. If there is
+// none but there are dated snapshots of that name, a single snapshot is
+// returned; with several, latest picks the newest and otherwise the result
+// is ErrAmbiguousProject.
+func ResolveArchiveProject(archiveProjects map[string]ArchiveProject, name string, latest bool) (ArchiveProject, error) {
+	if ap, ok := archiveProjects[name]; ok {
+		return ap, nil
+	}
+
+	snapshots := snapshotsOf(archiveProjects, name)
+	switch {
+	case len(snapshots) == 0:
+		return ArchiveProject{}, errorf(ErrProjectNotFound, "project '%s' not found in archive", name)
+	case len(snapshots) == 1 || latest:
+		return archiveProjects[snapshots[len(snapshots)-1]], nil
+	default:
+		return ArchiveProject{}, errorf(ErrAmbiguousProject, "'%s' matches several snapshots: %s (name one, or use --latest)",
+			name, strings.Join(snapshots, ", "))
+	}
+}
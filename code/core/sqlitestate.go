@@ -0,0 +1,323 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SQLiteStateFile is the name of a SQLite state file, used in place of
+// state.json in the parkr or profile directory once it exists
+const SQLiteStateFile = "state.db"
+
+// sqliteSchema creates the tables of a SQLite state file: one row per
+// project and per master, the remaining top-level state fields as JSON in
+// meta, and the project history in events
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS projects (name TEXT PRIMARY KEY, data TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS masters (name TEXT PRIMARY KEY, categories TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS events (id INTEGER PRIMARY KEY, time TEXT NOT NULL, project TEXT NOT NULL, op TEXT NOT NULL, data TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS events_project ON events (project, id);
+`
+
+// IsSQLiteState reports whether a state file path names a SQLite database
+// rather than JSON, by its extension
+func IsSQLiteState(path string) bool {
+	switch filepath.Ext(path) {
+	case ".db", ".sqlite", ".sqlite3":
+		return true
+	}
+	return false
+}
+
+// defaultStatePath returns the state file in dir: the SQLite one if it
+// exists, otherwise state.json
+func defaultStatePath(dir string) string {
+	if db := filepath.Join(dir, SQLiteStateFile); fileExists(db) {
+		return db
+	}
+	return filepath.Join(dir, "state.json")
+}
+
+// sqliteCommand is the program SQLite state files are read and written
+// with; it needs SQLite 3.24 or later
+const sqliteCommand = "sqlite3"
+
+// CheckSQLite returns an error if SQLite state files can't be used on this
+// machine because the sqlite3 command is missing
+func CheckSQLite() error {
+	if _, err := exec.LookPath(sqliteCommand); err != nil {
+		return errorf(ErrStateFile, "SQLite state files need the %s command (SQLite 3.24 or later), which is not on PATH; install it or use a JSON state file", sqliteCommand)
+	}
+	return nil
+}
+
+// CheckBackend returns an error if the state file can't be read or written
+// on this machine, such as a SQLite one without the sqlite3 command
+func (sm *StateManager) CheckBackend() error {
+	if IsSQLiteState(sm.statePath) {
+		return CheckSQLite()
+	}
+	return nil
+}
+
+// runSQLite runs a SQL script against the database at path with the
+// sqlite3 command, stopping at the first error, and returns its output.
+// Values go in through input rather than the script, so they are never
+// quoted into SQL: the script reads them as (SELECT doc FROM input).
+func runSQLite(path, script string, input []byte) (string, error) {
+	if input != nil {
+		f, err := os.CreateTemp("", "parkr-sqlite-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(input)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", err
+		}
+		script = "CREATE TEMP TABLE input AS SELECT CAST(readfile(" + sqlQuote(f.Name()) + ") AS TEXT) AS doc;\n" + script
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(sqliteCommand, "-batch", "-bail", path)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", CheckSQLite()
+	}
+	if err != nil {
+		return "", fmt.Errorf("sqlite3 failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// sqlQuote quotes s as a SQL string literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// loadSQLiteState reads a SQLite state file as the JSON document state.json
+// would hold
+func loadSQLiteState(path string) ([]byte, error) {
+	out, err := runSQLite(path, `SELECT json_object(
+  'projects', (SELECT json_group_object(name, json(data)) FROM projects),
+  'masters', (SELECT json_group_object(name, json(categories)) FROM masters),
+  'meta', (SELECT json_group_object(key, json(value)) FROM meta));
+`, nil)
+	if err != nil {
+		return nil, err
+	}
+	var tables struct {
+		Projects json.RawMessage            `json:"projects"`
+		Masters  json.RawMessage            `json:"masters"`
+		Meta     map[string]json.RawMessage `json:"meta"`
+	}
+	if err := json.Unmarshal([]byte(out), &tables); err != nil {
+		return nil, err
+	}
+	doc := tables.Meta
+	if doc == nil {
+		doc = make(map[string]json.RawMessage)
+	}
+	doc["projects"] = tables.Projects
+	doc["masters"] = tables.Masters
+	return json.Marshal(doc)
+}
+
+// sqliteSave brings the tables of a SQLite state file in line with the
+// rows in input, in one transaction: rows whose value changed are updated,
+// new ones inserted and missing ones deleted, and the others left alone.
+// input maps each table to its rows, each value as JSON text.
+const sqliteSave = `BEGIN;
+INSERT INTO projects (name, data) SELECT key, value FROM json_each((SELECT doc FROM input), '$.projects') WHERE true
+  ON CONFLICT (name) DO UPDATE SET data = excluded.data WHERE data IS NOT excluded.data;
+DELETE FROM projects WHERE name NOT IN (SELECT key FROM json_each((SELECT doc FROM input), '$.projects'));
+INSERT INTO masters (name, categories) SELECT key, value FROM json_each((SELECT doc FROM input), '$.masters') WHERE true
+  ON CONFLICT (name) DO UPDATE SET categories = excluded.categories WHERE categories IS NOT excluded.categories;
+DELETE FROM masters WHERE name NOT IN (SELECT key FROM json_each((SELECT doc FROM input), '$.masters'));
+INSERT INTO meta (key, value) SELECT key, value FROM json_each((SELECT doc FROM input), '$.meta') WHERE true
+  ON CONFLICT (key) DO UPDATE SET value = excluded.value WHERE value IS NOT excluded.value;
+DELETE FROM meta WHERE key NOT IN (SELECT key FROM json_each((SELECT doc FROM input), '$.meta'));
+COMMIT;
+`
+
+// saveSQLiteState writes the state serialized in data to a SQLite state
+// file, changing only the rows that differ from what it holds
+func saveSQLiteState(path string, data []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	rows := make(map[string]map[string]string)
+	for _, table := range []string{"projects", "masters"} {
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(doc[table], &values); err != nil {
+			return err
+		}
+		rows[table] = compactValues(values)
+		delete(doc, table)
+	}
+	rows["meta"] = compactValues(doc)
+
+	input, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	_, err = runSQLite(path, sqliteSchema+sqliteSave, input)
+	return err
+}
+
+// compactValues returns each JSON value as compact JSON text
+func compactValues(values map[string]json.RawMessage) map[string]string {
+	compact := make(map[string]string, len(values))
+	for key, value := range values {
+		compact[key] = string(compactJSON(value))
+	}
+	return compact
+}
+
+// compactJSON strips the indentation from a JSON value
+func compactJSON(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// sqliteEvent is an events table row, as passed to sqlite3
+type sqliteEvent struct {
+	Time    string `json:"time"`
+	Project string `json:"project"`
+	Op      string `json:"op"`
+	Data    string `json:"data"`
+}
+
+// recordSQLiteEvents appends events to the events table of a SQLite state
+// file, in one transaction
+func recordSQLiteEvents(path string, events ...ProjectEvent) error {
+	rows := make([]sqliteEvent, 0, len(events))
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to serialize history entry: %w", err)
+		}
+		rows = append(rows, sqliteEvent{Time: e.Time.UTC().Format(time.RFC3339Nano), Project: e.Project, Op: e.Op, Data: string(data)})
+	}
+	input, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("failed to serialize history entry: %w", err)
+	}
+	script := sqliteSchema + `BEGIN;
+INSERT INTO events (time, project, op, data)
+  SELECT json_extract(value, '$.time'), json_extract(value, '$.project'), json_extract(value, '$.op'), json_extract(value, '$.data')
+  FROM json_each((SELECT doc FROM input)) ORDER BY key;
+COMMIT;
+`
+	if _, err := runSQLite(path, script, input); err != nil {
+		return fmt.Errorf("failed to record project history: %w", err)
+	}
+	return nil
+}
+
+// loadSQLiteEvents reads a project's events from a SQLite state file,
+// oldest first
+func loadSQLiteEvents(path, projectName string) ([]ProjectEvent, error) {
+	script := sqliteSchema + `SELECT json_group_array(json(data)) FROM
+  (SELECT data FROM events WHERE project = (SELECT doc FROM input) ORDER BY id);
+`
+	out, err := runSQLite(path, script, []byte(projectName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project history: %w", err)
+	}
+	var events []ProjectEvent
+	if err := json.Unmarshal([]byte(out), &events); err != nil {
+		return nil, fmt.Errorf("failed to read project history: %w", err)
+	}
+	return events, nil
+}
+
+// MigrateResult describes a state file copied into a SQLite database
+type MigrateResult struct {
+	Source   string `json:"source"`
+	Dest     string `json:"dest"`
+	Projects int    `json:"projects"`
+	Events   int    `json:"events"`
+	// Retired is where the JSON state file was moved so the default state
+	// location picks up the database, if it was
+	Retired string `json:"retired,omitempty"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+}
+
+// MigrateState copies the JSON state file of sm, and its project history,
+// into a new SQLite database at dest, by default state.db beside it. A
+// state file in a default location (ConfigDir or a profile directory) is
+// then renamed to state.json.migrated, so parkr uses the database from
+// then on; any other path has to be given as the database from then on.
+func MigrateState(sm *StateManager, dest string, dryRun bool) (*MigrateResult, error) {
+	src := sm.StatePath()
+	if IsSQLiteState(src) {
+		return nil, errorf(ErrStateFile, "%s is already a SQLite state file", src)
+	}
+	if dest == "" {
+		dest = filepath.Join(filepath.Dir(src), SQLiteStateFile)
+	}
+	if !IsSQLiteState(dest) {
+		return nil, errorf(ErrStateFile, "the SQLite state file must end in .db, .sqlite or .sqlite3: %s", dest)
+	}
+	if fileExists(dest) {
+		return nil, errorf(ErrStateFile, "%s already exists", dest)
+	}
+	if err := CheckSQLite(); err != nil {
+		return nil, err
+	}
+
+	unlock, err := sm.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	events, err := loadAllProjectEvents(src)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrateResult{Source: src, Dest: dest, Projects: len(state.Projects), Events: len(events), DryRun: dryRun}
+	if filepath.Base(src) == "state.json" && filepath.Dir(dest) == filepath.Dir(src) && filepath.Base(dest) == SQLiteStateFile {
+		result.Retired = src + ".migrated"
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if err := NewStateManagerAt(dest).Save(state); err != nil {
+		return nil, err
+	}
+	if len(events) > 0 {
+		if err := recordSQLiteEvents(dest, events...); err != nil {
+			os.Remove(dest)
+			return nil, err
+		}
+	}
+	if result.Retired != "" {
+		if err := os.Rename(src, result.Retired); err != nil {
+			return nil, errorf(ErrStateFile, "migrated to %s, but failed to retire %s: %w", dest, src, err)
+		}
+	}
+	return result, nil
+}
@@ -2,7 +2,6 @@ package core
 
 import (
 	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -21,6 +20,29 @@ type Project struct {
 	LastParkMtime       *time.Time `json:"last_park_mtime"`
 	NoHashMode          bool       `json:"no_hash_mode"`
 	IsGrabbed           bool       `json:"is_grabbed"`
+	// HashMode is how ArchiveContentHash and LocalContentHash were
+	// computed; nil means every byte was hashed
+	HashMode *HashMode `json:"hash_mode,omitempty"`
+	// Description is a one-line summary captured from the README on park
+	Description string `json:"description,omitempty"`
+	// Ephemeral marks a temporary checkout that clean-temp may delete
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// Tags group related projects, e.g. a family of experiment checkouts
+	Tags []string `json:"tags,omitempty"`
+	// ArchiveVerifiedAt is when the archive copy last passed a scrub
+	ArchiveVerifiedAt *time.Time `json:"archive_verified_at,omitempty"`
+	// Verification overrides Settings.Verification for this project
+	Verification string `json:"verification,omitempty"`
+	// LastParkGitHead is the commit checked out at the last git-mode park
+	LastParkGitHead string `json:"last_park_git_head,omitempty"`
+	// ArchiveFingerprint covers the paths, sizes and mtimes of the archive
+	// copy when this machine last grabbed, parked or pulled it
+	ArchiveFingerprint string `json:"archive_fingerprint,omitempty"`
+	// Versions are the earlier archive copies park kept, oldest first
+	Versions []ArchiveVersion `json:"versions,omitempty"`
+	// DirtySeenAt is when a report first found unparked changes since the
+	// last grab or park, and EventDirty was published
+	DirtySeenAt *time.Time `json:"dirty_seen_at,omitempty"`
 }
 
 // State represents the entire parkr state file
@@ -28,19 +50,191 @@ type State struct {
 	Masters       map[string]map[string]string `json:"masters"`
 	DefaultMaster string                       `json:"default_master"`
 	Projects      map[string]*Project          `json:"projects"`
+	Settings      Settings                     `json:"settings"`
+	// LocalDirectories are scanned for local projects in addition to the
+	// category local roots
+	LocalDirectories []string `json:"local_directories,omitempty"`
+	// Transfers are the grabs and parks under way or interrupted, keyed by
+	// project name
+	Transfers map[string]*Transfer `json:"transfers,omitempty"`
+	// Journal records the latest removals undo can revert, oldest first
+	Journal []JournalEntry `json:"journal,omitempty"`
+	// TrashDirs are the VolumeTrashDirs rm has moved local copies into
+	TrashDirs []string `json:"trash_dirs,omitempty"`
+}
+
+// Settings holds user configuration stored in the state file
+type Settings struct {
+	// CategoryQuotas limits the local space used by grabbed projects in a
+	// category, as a size string such as "50G"
+	CategoryQuotas map[string]string `json:"category_quotas,omitempty"`
+	// QuotaMode is "warn" (default) or "enforce"
+	QuotaMode string `json:"quota_mode,omitempty"`
+	// MaxGrabbed and MaxGrabbedSize limit how many projects are grabbed
+	// at once and their total local size, a size string such as "200G";
+	// zero and empty mean no limit. QuotaMode applies to them too.
+	MaxGrabbed     int    `json:"max_grabbed,omitempty"`
+	MaxGrabbedSize string `json:"max_grabbed_size,omitempty"`
+	// StaleGrabDays is how long ago a project's archive copy was last
+	// updated before grab calls it stale; 0 means DefaultStaleGrabDays
+	StaleGrabDays int `json:"stale_grab_days,omitempty"`
+	// StaleGrabAction is what grab does about a stale project: "warn"
+	// (default), "confirm" or "off"
+	StaleGrabAction string `json:"stale_grab_action,omitempty"`
+	// MetadataFile names the file a project description is read from on
+	// park, instead of the README
+	MetadataFile string `json:"metadata_file,omitempty"`
+	// RecentParkSize and RecentParkHours require local copies of at least
+	// RecentParkSize to have been parked within RecentParkHours before they
+	// can be removed. The rule is off unless both are set.
+	RecentParkSize  string `json:"recent_park_size,omitempty"`
+	RecentParkHours int    `json:"recent_park_hours,omitempty"`
+	// PruneVerifyDays requires the archive copy of each project removed by
+	// prune to have passed a scrub within this many days (0 disables it)
+	PruneVerifyDays int `json:"prune_verify_days,omitempty"`
+	// PruneVerifyAction is "verify" (default) to scrub stale copies on the
+	// fly, or "block" to refuse to remove them
+	PruneVerifyAction string `json:"prune_verify_action,omitempty"`
+	// LocalRoots overrides the local directory for a category
+	LocalRoots map[string]string `json:"local_roots,omitempty"`
+	// Masters holds per-master options, keyed by master name
+	Masters map[string]MasterSettings `json:"masters,omitempty"`
+	// Verification is how park records and rm checks a project's state:
+	// "hash", "mtime" (default) or "git"
+	Verification string `json:"verification,omitempty"`
+	// TransferJobs is how many rsync processes grab and park run at once;
+	// 0 or 1 copies with a single rsync
+	TransferJobs int `json:"transfer_jobs,omitempty"`
+	// BandwidthLimit caps the rate of archive transfers, as a size per
+	// second such as "5M"; empty means unlimited
+	BandwidthLimit string `json:"bwlimit,omitempty"`
+	// TrashDays, when set, makes park move archive files it would delete or
+	// overwrite into the category's TrashDir, where gc removes them after
+	// this many days
+	TrashDays int `json:"trash_days,omitempty"`
+	// DigestEmail and DigestWebhook are where 'parkr digest --send'
+	// delivers the health digest; email goes through the DigestSMTP
+	// server (host:port) from DigestFrom, or DigestEmail if that is empty
+	DigestEmail   string `json:"digest_email,omitempty"`
+	DigestWebhook string `json:"digest_webhook,omitempty"`
+	DigestSMTP    string `json:"digest_smtp,omitempty"`
+	DigestFrom    string `json:"digest_from,omitempty"`
+	// DigestStaleDays is how old unparked work or a scrub gets before the
+	// digest lists it; 0 means DefaultDigestStaleDays
+	DigestStaleDays int `json:"digest_stale_days,omitempty"`
+	// FastHashOver, when set, makes new content hashes sample files larger
+	// than this size, hashing their size and their first and last
+	// FastHashChunk (default DefaultFastHashChunk) instead of every byte
+	FastHashOver  string `json:"fast_hash_over,omitempty"`
+	FastHashChunk string `json:"fast_hash_chunk,omitempty"`
+	// VerifySeverity overrides the severity of verify findings, keyed by
+	// check name or "category:NAME" for every finding in a category
+	VerifySeverity map[string]string `json:"verify_severity,omitempty"`
+	// DetectRules file projects added without a category, in priority
+	// order, before the built-in detection rules
+	DetectRules []DetectRule `json:"detect_rules,omitempty"`
+	// LanguageCategories overrides DefaultLanguageCategories, keyed by
+	// the language DetectProjectLanguage reports
+	LanguageCategories map[string]string `json:"language_categories,omitempty"`
+	// KeepVersions, when set, makes park keep the archive copy it is about
+	// to sync over in the category's VersionsDir, removing the oldest kept
+	// copies beyond this many
+	KeepVersions int `json:"keep_versions,omitempty"`
+	// PreflightVerify makes rm, and so prune, verify a project first and
+	// refuse to remove it if verify reports errors for it
+	PreflightVerify bool `json:"preflight_verify,omitempty"`
+	// LocalTrashDays is how many days rm keeps the local copies it moves
+	// into the local trash instead of deleting them; 0 means
+	// DefaultLocalTrashDays and a negative value turns the trash off
+	LocalTrashDays int `json:"local_trash_days,omitempty"`
+	// EventHook is a shell command run for every project event, and
+	// EventWebhook a URL each event is posted to as JSON
+	EventHook    string `json:"event_hook,omitempty"`
+	EventWebhook string `json:"event_webhook,omitempty"`
+	// MetricsEndpoint, when set, receives each command's duration,
+	// failures, projects and bytes: statsd://host:port for StatsD, or an
+	// OTLP/HTTP URL. MetricsPrefix starts the metric names; empty means
+	// DefaultMetricsPrefix.
+	MetricsEndpoint string `json:"metrics_endpoint,omitempty"`
+	MetricsPrefix   string `json:"metrics_prefix,omitempty"`
+	// RemoteAttempts is how many times an rsync or ssh command to another
+	// host is tried when its connection fails; 0 means
+	// DefaultRemoteAttempts
+	RemoteAttempts int `json:"remote_attempts,omitempty"`
+	// IncludeHidden makes discovery and local scans treat directories whose
+	// names start with '.' as projects; parkr's own metadata directories
+	// are always skipped
+	IncludeHidden bool `json:"include_hidden,omitempty"`
+	// Output is OutputText (default) or OutputPlain, which prints labeled
+	// fields instead of tables, symbols and redrawn lines
+	Output string `json:"output,omitempty"`
+}
+
+// MasterSettings holds options for one master archive
+type MasterSettings struct {
+	// ReadOnly blocks every operation that would write to the master
+	ReadOnly bool `json:"read_only,omitempty"`
+	// Host is the [user@]host reached over SSH for category paths that do
+	// not name a host themselves
+	Host string `json:"host,omitempty"`
+	// Storage is StorageTree, StorageTarZst or the mode of a registered
+	// StorageBackend; empty means StorageTree
+	Storage string `json:"storage,omitempty"`
+	// Recipient is the age public key, or a file of them, that parked
+	// projects are encrypted to; empty means no encryption
+	Recipient string `json:"recipient,omitempty"`
+	// Identity is the age private key file used to decrypt archive copies
+	Identity string `json:"identity,omitempty"`
+	// Slow makes list show the master's last measured archive sizes at
+	// once, refreshing them in the background, as it always does for
+	// masters on another host
+	Slow bool `json:"slow,omitempty"`
+	// Exclude lists names, or glob patterns such as "@*", that discovery
+	// ignores in the master's categories, such as lost+found or a NAS's
+	// @eaDir
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// StateStore is the state access used by core operations. Update applies
+// fn to the latest state and persists the result, so concurrent writers
+// only touch the projects they change.
+type StateStore interface {
+	Load() (*State, error)
+	Update(fn func(*State) error) error
 }
 
 // StateManager handles reading and writing state
 type StateManager struct {
 	statePath string
+	events    EventBus
+	// lockTimeout is how long Lock waits; DefaultLockTimeout if nil
+	lockTimeout *time.Duration
 }
 
-// NewStateManager creates a state manager with default path
+// NewStateManager creates a state manager for the default state file:
+// $PARKR_STATE_PATH if set, otherwise the one in ConfigDir
 func NewStateManager() *StateManager {
-	homeDir, _ := os.UserHomeDir()
-	return &StateManager{
-		statePath: filepath.Join(homeDir, ".parkr", "state.json"),
+	if path := os.Getenv(StatePathEnv); path != "" {
+		return NewStateManagerAt(path)
+	}
+	return &StateManager{statePath: defaultStatePath(ConfigDir())}
+}
+
+// NewStateManagerForProfile creates a state manager for a named profile,
+// whose state lives in <ConfigDir>/profiles/<name>/
+func NewStateManagerForProfile(name string) *StateManager {
+	return &StateManager{statePath: defaultStatePath(filepath.Join(ProfilesDir(), name))}
+}
+
+// NewStateManagerAt creates a state manager for an explicit state file
+// path, a SQLite database if it ends in .db, .sqlite or .sqlite3. A
+// relative path is made absolute, so the audit log and local trash name
+// the same state file wherever parkr runs from.
+func NewStateManagerAt(statePath string) *StateManager {
+	if abs, err := filepath.Abs(statePath); err == nil {
+		statePath = abs
 	}
+	return &StateManager{statePath: statePath}
 }
 
 // StatePath returns the path to the state file
@@ -48,19 +242,25 @@ func (sm *StateManager) StatePath() string {
 	return sm.statePath
 }
 
+// Events returns the bus that operations on this state file publish
+// project events on
+func (sm *StateManager) Events() *EventBus {
+	return &sm.events
+}
+
 // Load reads the state file from disk
 func (sm *StateManager) Load() (*State, error) {
-	data, err := os.ReadFile(sm.statePath)
+	data, err := sm.read()
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("state file not found at %s - run 'parkr init' first", sm.statePath)
+			return nil, errorf(ErrStateFile, "state file not found at %s - run 'parkr init' first", sm.statePath)
 		}
-		return nil, fmt.Errorf("failed to read state file: %w", err)
+		return nil, errorf(ErrStateFile, "failed to read state file: %w", err)
 	}
 
 	var state State
 	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, fmt.Errorf("failed to parse state file: %w", err)
+		return nil, errorf(ErrStateFile, "failed to parse state file: %w", err)
 	}
 
 	// Initialize maps if nil
@@ -74,33 +274,70 @@ func (sm *StateManager) Load() (*State, error) {
 	return &state, nil
 }
 
+// read returns the state file's contents as JSON
+func (sm *StateManager) read() ([]byte, error) {
+	if !IsSQLiteState(sm.statePath) {
+		return os.ReadFile(sm.statePath)
+	}
+	// sqlite3 would create a missing database
+	if _, err := os.Stat(sm.statePath); err != nil {
+		return nil, err
+	}
+	return loadSQLiteState(sm.statePath)
+}
+
 // Save writes the state file to disk
 func (sm *StateManager) Save(state *State) error {
 	// Ensure directory exists
 	dir := filepath.Dir(sm.statePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create state directory: %w", err)
+		return errorf(ErrStateFile, "failed to create state directory: %w", err)
 	}
 
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to serialize state: %w", err)
+		return errorf(ErrStateFile, "failed to serialize state: %w", err)
+	}
+
+	if IsSQLiteState(sm.statePath) {
+		if err := saveSQLiteState(sm.statePath, data); err != nil {
+			return errorf(ErrStateFile, "failed to save state file: %w", err)
+		}
+		return nil
 	}
 
 	// Write to temp file first, then rename (atomic)
 	tmpPath := sm.statePath + ".tmp"
 	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write state file: %w", err)
+		return errorf(ErrStateFile, "failed to write state file: %w", err)
 	}
 
 	if err := os.Rename(tmpPath, sm.statePath); err != nil {
 		os.Remove(tmpPath) // Clean up on failure
-		return fmt.Errorf("failed to save state file: %w", err)
+		return errorf(ErrStateFile, "failed to save state file: %w", err)
 	}
 
 	return nil
 }
 
+// Update loads the current state, applies fn and saves the result, holding
+// the state file lock throughout. Nothing is written if fn returns an error.
+func (sm *StateManager) Update(fn func(*State) error) error {
+	unlock, err := sm.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	if err := fn(state); err != nil {
+		return err
+	}
+	return sm.Save(state)
+}
+
 // Exists checks if the state file exists
 func (sm *StateManager) Exists() bool {
 	_, err := os.Stat(sm.statePath)
@@ -109,40 +346,56 @@ func (sm *StateManager) Exists() bool {
 
 // CreateDefault creates a new state file with default configuration
 func (sm *StateManager) CreateDefault() error {
-	state := &State{
-		Masters: map[string]map[string]string{
-			"primary": {
-				"code":    "/Volumes/Extra/project-archive/code",
-				"pycharm": "/Volumes/Extra/project-archive/pycharm",
-				"rstudio": "/Volumes/Extra/project-archive/rstudio",
-				"misc":    "/Volumes/Extra/project-archive/misc",
-			},
-		},
+	return sm.Save(DefaultState(DefaultArchiveRoot))
+}
+
+// DefaultArchiveRoot is the archive root used when none is given to init
+const DefaultArchiveRoot = "/Volumes/Extra/project-archive"
+
+// DefaultCategories are the archive categories created for a new master
+var DefaultCategories = []string{"code", "pycharm", "rstudio", "misc"}
+
+// DefaultState returns a fresh state with a single "primary" master whose
+// default categories live under archiveRoot
+func DefaultState(archiveRoot string) *State {
+	categories := make(map[string]string, len(DefaultCategories))
+	for _, c := range DefaultCategories {
+		categories[c] = filepath.Join(archiveRoot, c)
+	}
+	return &State{
+		Masters:       map[string]map[string]string{"primary": categories},
 		DefaultMaster: "primary",
 		Projects:      make(map[string]*Project),
 	}
-
-	return sm.Save(state)
 }
 
 // GetArchivePath returns the full archive path for a project
 func (s *State) GetArchivePath(projectName string) (string, error) {
 	project, exists := s.Projects[projectName]
 	if !exists {
-		return "", fmt.Errorf("project '%s' not found in state", projectName)
+		return "", errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
 	}
 
 	master, exists := s.Masters[project.Master]
 	if !exists {
-		return "", fmt.Errorf("master '%s' not found", project.Master)
+		return "", errorf(ErrStateFile, "master '%s' not found", project.Master)
 	}
 
 	categoryPath, exists := master[project.ArchiveCategory]
 	if !exists {
-		return "", fmt.Errorf("category '%s' not found in master '%s'", project.ArchiveCategory, project.Master)
+		return "", errorf(ErrStateFile, "category '%s' not found in master '%s'", project.ArchiveCategory, project.Master)
 	}
 
-	return filepath.Join(categoryPath, projectName), nil
+	return storedArchivePath(filepath.Join(s.archiveRoot(project.Master, categoryPath), projectName)), nil
+}
+
+// LocalRoot returns the local directory projects of a category are grabbed
+// into, preferring a configured root over the built-in default
+func (s *State) LocalRoot(category string) string {
+	if root, ok := s.Settings.LocalRoots[category]; ok {
+		return root
+	}
+	return GetDefaultLocalPath(category)
 }
 
 // GetDefaultLocalPath returns the default local path for a category
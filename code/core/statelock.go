@@ -0,0 +1,148 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLockTimeout is how long a state manager waits for another parkr
+// run to release the state file lock
+const DefaultLockTimeout = 30 * time.Second
+
+// lockPollInterval is how often a waiting state manager retries the lock
+const lockPollInterval = 100 * time.Millisecond
+
+// heldLock is a state file lock held by this process
+type heldLock struct {
+	file *os.File
+	refs int
+}
+
+// heldLocks holds this process's state file locks by lock file path. The
+// lock is advisory and per process: a command holding it can still Update
+// through any state manager for the same file, and concurrent goroutines
+// are left to the Store's own serialization.
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = make(map[string]*heldLock)
+)
+
+// LockPath returns the lock file guarding the state file
+func (sm *StateManager) LockPath() string {
+	return sm.statePath + ".lock"
+}
+
+// SetLockTimeout sets how long Lock waits for another parkr run to release
+// the state file; 0 fails at once if it is held
+func (sm *StateManager) SetLockTimeout(timeout time.Duration) {
+	sm.lockTimeout = &timeout
+}
+
+// Lock takes the advisory lock on the state file, waiting up to the lock
+// timeout for another parkr run holding it, and returns a function that
+// releases it. Update takes the lock itself; mutating commands take it for
+// their whole run so their reads and writes aren't interleaved with
+// another run's. Locks taken again by the same process are counted.
+func (sm *StateManager) Lock() (func(), error) {
+	timeout := DefaultLockTimeout
+	if sm.lockTimeout != nil {
+		timeout = *sm.lockTimeout
+	}
+	return sm.lock(timeout)
+}
+
+// TryLock takes the state file lock if no other parkr run holds it, without
+// waiting. ok is false, with no error, when another run holds it.
+func (sm *StateManager) TryLock() (unlock func(), ok bool, err error) {
+	unlock, err = sm.lock(0)
+	if errors.Is(err, ErrStateLocked) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return unlock, true, nil
+}
+
+// lock takes the state file lock, waiting up to timeout
+func (sm *StateManager) lock(timeout time.Duration) (func(), error) {
+	path := sm.LockPath()
+	heldLocksMu.Lock()
+	defer heldLocksMu.Unlock()
+
+	if held, ok := heldLocks[path]; ok {
+		held.refs++
+		return sm.unlocker(path), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errorf(ErrStateFile, "failed to create state directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errorf(ErrStateFile, "failed to open lock file: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, errorf(ErrStateFile, "failed to lock state file: %w", err)
+		}
+		if ok {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			holder := lockHolder(f)
+			f.Close()
+			return nil, errorf(ErrStateLocked, "state file %s is in use by another parkr run%s; waited %s (see --lock-timeout)", sm.statePath, holder, timeout)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// Record the holder for the error message of anyone waiting
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	heldLocks[path] = &heldLock{file: f, refs: 1}
+	return sm.unlocker(path), nil
+}
+
+// unlocker returns a function releasing one hold of the lock at path,
+// unlocking the file when the last is released
+func (sm *StateManager) unlocker(path string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			heldLocksMu.Lock()
+			defer heldLocksMu.Unlock()
+			held := heldLocks[path]
+			if held == nil {
+				return
+			}
+			if held.refs--; held.refs > 0 {
+				return
+			}
+			delete(heldLocks, path)
+			held.file.Truncate(0)
+			unlockFile(held.file)
+			held.file.Close()
+		})
+	}
+}
+
+// lockHolder describes the process recorded in a lock file, if any
+func lockHolder(f *os.File) string {
+	data := make([]byte, 32)
+	n, _ := f.ReadAt(data, 0)
+	pid := strings.TrimSpace(string(data[:n]))
+	if pid == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (pid %s)", pid)
+}
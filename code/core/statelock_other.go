@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd)
+
+package core
+
+import "os"
+
+// tryLockFile always succeeds: state file locking is not supported on this
+// platform
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op where state file locking is not supported
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// StorageBackend stores parked projects as single archive files, for the
+// masters set to the storage mode it is registered under. parkr chooses the
+// files to pack, leaving out volatile ones, writes the archive file under a
+// temporary name and renames it into place, and layers encryption on top
+// for masters that have it.
+type StorageBackend interface {
+	// Ext is the file extension of the archive files, such as ".tar.zst"
+	Ext() string
+	// Pack writes an archive of the files and directories listed in
+	// files to w. They are slash-separated paths relative to dir, parents
+	// before their contents, starting with "." for dir itself.
+	Pack(ctx context.Context, dir string, files []string, w io.Writer) error
+	// Unpack extracts an archive read from r into the existing directory dir
+	Unpack(ctx context.Context, r io.Reader, dir string) error
+}
+
+var (
+	backendsMu      sync.RWMutex
+	storageBackends = map[string]StorageBackend{StorageTarZst: tarZstBackend{}}
+)
+
+// RegisterStorageBackend adds a storage mode, which SetMasterStorage can
+// then set masters to, replacing any backend registered under the same
+// name. Backends must keep their name and extension once projects are
+// stored with them. It panics if mode is StorageTree or the extension is
+// empty or another backend's.
+func RegisterStorageBackend(mode string, b StorageBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if mode == "" || mode == StorageTree {
+		panic(fmt.Sprintf("parkr: cannot register a storage backend as '%s'", mode))
+	}
+	ext := b.Ext()
+	if !strings.HasPrefix(ext, ".") || strings.HasSuffix(ext, AgeExt) {
+		panic(fmt.Sprintf("parkr: invalid storage backend extension '%s'", ext))
+	}
+	for name, other := range storageBackends {
+		if name != mode && other.Ext() == ext {
+			panic(fmt.Sprintf("parkr: storage backend extension '%s' is already used by %s", ext, name))
+		}
+	}
+	storageBackends[mode] = b
+}
+
+// storageBackend returns the backend registered for a storage mode
+func storageBackend(mode string) (StorageBackend, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := storageBackends[mode]
+	return b, ok
+}
+
+// StorageModes returns the storage modes masters can be set to:
+// StorageTree, then the registered backends in name order
+func StorageModes() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	modes := make([]string, 0, len(storageBackends))
+	for mode := range storageBackends {
+		modes = append(modes, mode)
+	}
+	slices.Sort(modes)
+	return append([]string{StorageTree}, modes...)
+}
+
+// packedExts returns the extensions of the registered backends' archive
+// files, each encrypted one before the plain one
+func packedExts() []string {
+	var exts []string
+	for _, mode := range StorageModes()[1:] {
+		b, _ := storageBackend(mode)
+		exts = append(exts, b.Ext()+AgeExt, b.Ext())
+	}
+	return exts
+}
+
+// packedBackend returns the backend that stores the archive file at p, by
+// its extension, and whether the file is encrypted; ok is false if p is
+// not an archive file, such as a directory tree
+func packedBackend(p string) (b StorageBackend, encrypted, ok bool) {
+	name, encrypted := strings.CutSuffix(p, AgeExt)
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	for _, backend := range storageBackends {
+		// The longest matching extension wins, so ".tar.zst" isn't taken
+		// for a backend's ".zst"
+		if strings.HasSuffix(name, backend.Ext()) && (b == nil || len(backend.Ext()) > len(b.Ext())) {
+			b = backend
+		}
+	}
+	return b, encrypted, b != nil
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ProjectChange describes a change to a single project's state. Old is nil
+// for newly tracked projects and New is nil for projects that were removed.
+// Both are shared between subscribers and must be treated as read-only.
+type ProjectChange struct {
+	Name string
+	Old  *Project
+	New  *Project
+}
+
+// Store is a concurrency-safe, in-memory view of a state file for
+// long-running processes. Writes are serialized and subscribers are
+// notified of every project that changes, whether the change was made
+// through the store or by another parkr process writing the file.
+type Store struct {
+	sm *StateManager
+
+	mu      sync.Mutex
+	state   *State
+	modTime time.Time
+
+	subsMu sync.Mutex
+	subs   map[chan ProjectChange]struct{}
+}
+
+// NewStore creates a store backed by the given state manager
+func NewStore(sm *StateManager) *Store {
+	return &Store{
+		sm:   sm,
+		subs: make(map[chan ProjectChange]struct{}),
+	}
+}
+
+// StatePath returns the path to the underlying state file
+func (s *Store) StatePath() string {
+	return s.sm.StatePath()
+}
+
+// Events returns the bus that operations through the store publish
+// project events on
+func (s *Store) Events() *EventBus {
+	return s.sm.Events()
+}
+
+// Load returns a copy of the current state, re-reading the file if it has
+// changed on disk
+func (s *Store) Load() (*State, error) {
+	s.mu.Lock()
+	changes, err := s.refreshLocked()
+	var state *State
+	if err == nil {
+		state, err = copyState(s.state)
+	}
+	s.mu.Unlock()
+
+	s.publish(changes)
+	return state, err
+}
+
+// TryLock takes the state file lock if no other parkr run holds it, without
+// waiting
+func (s *Store) TryLock() (func(), bool, error) {
+	return s.sm.TryLock()
+}
+
+// Update applies fn to the latest state and saves it. Updates are
+// serialized, so concurrent callers never overwrite each other's changes.
+func (s *Store) Update(fn func(*State) error) error {
+	unlock, err := s.sm.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	s.mu.Lock()
+	changes, err := s.refreshLocked()
+	if err != nil {
+		s.mu.Unlock()
+		s.publish(changes)
+		return err
+	}
+
+	next, err := copyState(s.state)
+	if err == nil {
+		err = fn(next)
+	}
+	if err == nil {
+		err = s.sm.Save(next)
+	}
+	if err == nil {
+		changes = append(changes, diffProjects(s.state, next)...)
+		s.state = next
+		s.modTime = statModTime(s.sm.StatePath())
+	}
+	s.mu.Unlock()
+
+	s.publish(changes)
+	return err
+}
+
+// Refresh re-reads the state file if another process has modified it and
+// notifies subscribers of any resulting changes
+func (s *Store) Refresh() error {
+	s.mu.Lock()
+	changes, err := s.refreshLocked()
+	s.mu.Unlock()
+
+	s.publish(changes)
+	return err
+}
+
+// Subscribe returns a channel receiving every project change and a function
+// that cancels the subscription. Slow subscribers miss changes rather than
+// blocking writers, so the channel is buffered.
+func (s *Store) Subscribe() (<-chan ProjectChange, func()) {
+	ch := make(chan ProjectChange, 64)
+
+	s.subsMu.Lock()
+	s.subs[ch] = struct{}{}
+	s.subsMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.subsMu.Lock()
+			delete(s.subs, ch)
+			s.subsMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// refreshLocked reloads the state file when its mtime has changed. The
+// caller must hold s.mu.
+func (s *Store) refreshLocked() ([]ProjectChange, error) {
+	modTime := statModTime(s.sm.StatePath())
+	if s.state != nil && modTime.Equal(s.modTime) {
+		return nil, nil
+	}
+
+	state, err := s.sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ProjectChange
+	if s.state != nil {
+		changes = diffProjects(s.state, state)
+	}
+	s.state = state
+	s.modTime = modTime
+	return changes, nil
+}
+
+// publish delivers changes to all subscribers without blocking
+func (s *Store) publish(changes []ProjectChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	for ch := range s.subs {
+		for _, change := range changes {
+			select {
+			case ch <- change:
+			default:
+			}
+		}
+	}
+}
+
+// diffProjects lists the projects that differ between two states
+func diffProjects(old, new *State) []ProjectChange {
+	var changes []ProjectChange
+	for name, p := range new.Projects {
+		if prev, ok := old.Projects[name]; !ok || !reflect.DeepEqual(prev, p) {
+			changes = append(changes, ProjectChange{Name: name, Old: old.Projects[name], New: p})
+		}
+	}
+	for name, p := range old.Projects {
+		if _, ok := new.Projects[name]; !ok {
+			changes = append(changes, ProjectChange{Name: name, Old: p})
+		}
+	}
+	return changes
+}
+
+// copyState returns a deep copy of state
+func copyState(state *State) (*State, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	var c State
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Projects == nil {
+		c.Projects = make(map[string]*Project)
+	}
+	if c.Masters == nil {
+		c.Masters = make(map[string]map[string]string)
+	}
+	return &c, nil
+}
+
+// statModTime returns the modification time of path, or the zero time
+func statModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// normalizeTags trims tags and rejects empty ones or ones containing commas
+// or whitespace
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || strings.ContainsAny(t, ", \t") {
+			return nil, fmt.Errorf("invalid tag '%s'", t)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// UpdateTags adds and removes tags on a project known to the state file and
+// returns its resulting tags, sorted. With no changes it just reads them.
+func UpdateTags(sm StateStore, projectName string, add, remove []string) ([]string, error) {
+	add, err := normalizeTags(add)
+	if err != nil {
+		return nil, err
+	}
+	remove, err = normalizeTags(remove)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	err = sm.Update(func(state *State) error {
+		project, ok := state.Projects[projectName]
+		if !ok {
+			return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+		}
+		for _, t := range add {
+			if !slices.Contains(project.Tags, t) {
+				project.Tags = append(project.Tags, t)
+			}
+		}
+		project.Tags = slices.DeleteFunc(project.Tags, func(t string) bool { return slices.Contains(remove, t) })
+		slices.Sort(project.Tags)
+		if len(project.Tags) == 0 {
+			project.Tags = nil
+		}
+		tags = slices.Clone(project.Tags)
+		return nil
+	})
+	return tags, err
+}
@@ -0,0 +1,301 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Built-in archive storage modes, set per master in MasterSettings.Storage;
+// RegisterStorageBackend adds others
+const (
+	StorageTree   = "tree"    // A directory tree synced with rsync (default)
+	StorageTarZst = "tar.zst" // A zstd-compressed tarball, project.tar.zst
+)
+
+// TarballExt is the file extension of projects stored as StorageTarZst
+const TarballExt = ".tar.zst"
+
+// isPackedArchive reports whether an archive path is a project stored as
+// an archive file by a storage backend, encrypted or not
+func isPackedArchive(p string) bool {
+	_, _, ok := packedBackend(p)
+	return ok
+}
+
+// trimArchiveExt strips an archive file's extension, and any encryption
+// extension, from an archive path or name
+func trimArchiveExt(p string) string {
+	b, _, ok := packedBackend(p)
+	if !ok {
+		return p
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(p, AgeExt), b.Ext())
+}
+
+// archiveExt returns the extension of the archive copies a master writes:
+// its storage backend's, with AgeExt added if it encrypts them, or "" for
+// directory trees. Encryption stores trees as StorageTarZst tarballs.
+func (s *State) archiveExt(master string) string {
+	ext := ""
+	if b, ok := storageBackend(s.StorageMode(master)); ok {
+		ext = b.Ext()
+	}
+	if s.Settings.Masters[master].Recipient != "" {
+		if ext == "" {
+			ext = TarballExt
+		}
+		ext += AgeExt
+	}
+	return ext
+}
+
+// StorageMode returns how a master stores parked projects
+func (s *State) StorageMode(master string) string {
+	if mode := s.Settings.Masters[master].Storage; mode != "" {
+		return mode
+	}
+	return StorageTree
+}
+
+// SetMasterStorage sets how a master stores parked projects. Existing
+// projects are converted the next time they are parked.
+func SetMasterStorage(sm StateStore, master, mode string) error {
+	if modes := StorageModes(); !slices.Contains(modes, mode) {
+		return fmt.Errorf("invalid storage mode '%s' (expected %s)", mode, strings.Join(modes, ", "))
+	}
+	return sm.Update(func(state *State) error {
+		if mode == StorageTree && state.Settings.Masters[master].Recipient != "" {
+			return fmt.Errorf("master '%s' encrypts parked projects, which are always stored as tarballs; turn encryption off first", master)
+		}
+		if mode != StorageTree && state.hasRemoteRoot(master) {
+			return fmt.Errorf("master '%s' is on a remote host; %s storage needs a local or mounted archive", master, mode)
+		}
+		return state.updateMasterSettings(master, func(settings *MasterSettings) error {
+			settings.Storage = mode
+			if mode == StorageTree {
+				settings.Storage = ""
+			}
+			return nil
+		})
+	})
+}
+
+// storedArchivePath returns where a project's archive copy is: its
+// encrypted or plain archive file if one exists, otherwise the directory
+// tree at dir
+func storedArchivePath(dir string) string {
+	if IsRemote(dir) {
+		return dir
+	}
+	for _, ext := range packedExts() {
+		if info, err := os.Stat(dir + ext); err == nil && info.Mode().IsRegular() {
+			return dir + ext
+		}
+	}
+	return dir
+}
+
+// syncToArchive copies a local project to its archive path, writing an
+// archive file if the path names one and syncing a directory tree otherwise
+func syncToArchive(ctx context.Context, src, dst string, keys ageKeys, opts RsyncOptions, excludes ...string) error {
+	if isPackedArchive(dst) {
+		return writePacked(ctx, src, dst, keys, excludes...)
+	}
+	if !IsRemote(dst) {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return fmt.Errorf("failed to create archive directory: %w", err)
+		}
+	}
+	return RsyncParallel(ctx, src, dst, opts, excludes...)
+}
+
+// copyFromArchive copies an archive copy into the local directory dst,
+// extracting it first if it is an archive file. Its ChecksumFile stays behind.
+func copyFromArchive(ctx context.Context, src, dst string, keys ageKeys, opts RsyncOptions, excludes ...string) error {
+	dir, cleanup, err := archiveDir(ctx, src, keys)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return RsyncParallel(ctx, dir, dst, opts, append(excludes, checksumExclude)...)
+}
+
+// writePacked packs src into the archive file dst with its storage
+// backend, leaving out paths matching excludes, and encrypts it if dst is
+// an encrypted archive. The file is written in a temporary directory next
+// to dst, which gc removes if parkr is interrupted, and renamed into place.
+func writePacked(ctx context.Context, src, dst string, keys ageKeys, excludes ...string) error {
+	b, encrypted, _ := packedBackend(dst)
+	if encrypted && keys.recipient == "" {
+		return fmt.Errorf("cannot write %s: no recipient configured to encrypt to", dst)
+	}
+	files, err := packFileList(src, excludes)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dst), tempDirPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmp := filepath.Join(tmpDir, filepath.Base(dst))
+	pack := func(w io.Writer) error {
+		if err := b.Pack(ctx, src, files, w); err != nil {
+			return fmt.Errorf("failed to pack %s: %w", src, err)
+		}
+		return nil
+	}
+	if encrypted {
+		err = keys.encryptTo(ctx, tmp, pack)
+	} else {
+		err = writeFileWith(tmp, pack)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// writeFileWith creates the file path and has write fill it
+func writeFileWith(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// packFileList returns the paths under src, relative to it and starting
+// with ".", that are not left out by the skip patterns excludes. tar's and
+// other archivers' --exclude matching differs from rsync's, so backends are
+// given the list from the volatile file's own matching instead.
+func packFileList(src string, excludes []string) ([]string, error) {
+	rules, err := (*VolatileRules)(nil).withSkips(excludes)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && rules.Skipped(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", src, err)
+	}
+	return files, nil
+}
+
+// extractPacked unpacks the archive file src into the existing directory
+// dst with its storage backend, decrypting it first if it is encrypted
+func extractPacked(ctx context.Context, src, dst string, keys ageKeys) error {
+	b, encrypted, ok := packedBackend(src)
+	if !ok {
+		return fmt.Errorf("no storage backend reads %s", src)
+	}
+	unpack := func(r io.Reader) error {
+		if err := b.Unpack(ctx, r, dst); err != nil {
+			return fmt.Errorf("failed to unpack %s: %w", src, err)
+		}
+		return nil
+	}
+	if encrypted {
+		return keys.decryptFrom(ctx, src, unpack)
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return unpack(f)
+}
+
+// tarZstBackend stores projects as zstd-compressed tarballs, with tar
+type tarZstBackend struct{}
+
+// Ext returns TarballExt
+func (tarZstBackend) Ext() string {
+	return TarballExt
+}
+
+// Pack writes a tarball of files to w
+func (tarZstBackend) Pack(ctx context.Context, dir string, files []string, w io.Writer) error {
+	var list bytes.Buffer
+	for _, f := range files {
+		if f != "." {
+			f = "./" + f
+		}
+		list.WriteString(f)
+		list.WriteByte(0)
+	}
+	return runTar(ctx, &list, w, "--zstd", "--format=posix", "-cf", "-", "-C", dir, "--no-recursion", "--null", "-T", "-")
+}
+
+// Unpack extracts a tarball read from r into dir
+func (tarZstBackend) Unpack(ctx context.Context, r io.Reader, dir string) error {
+	return runTar(ctx, r, nil, "--zstd", "-xf", "-", "-C", dir)
+}
+
+// runTar runs tar with stdin and stdout connected to in and out, killing it
+// if ctx is cancelled
+func runTar(ctx context.Context, in io.Reader, out io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "tar", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = in, out, &stderr
+	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("tar interrupted: %w", ctxErr)
+	}
+	if err != nil {
+		return fmt.Errorf("tar failed: %w\nOutput: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// archiveDir returns a directory holding an archive copy's files, for
+// operations that read them. An archive file is extracted into a temporary
+// directory, which cleanup removes.
+func archiveDir(ctx context.Context, archivePath string, keys ageKeys) (dir string, cleanup func(), err error) {
+	if !isPackedArchive(archivePath) {
+		return archivePath, func() {}, nil
+	}
+	if err := requireLocalArchive(archivePath); err != nil {
+		return "", nil, err
+	}
+	dir, err = os.MkdirTemp("", "parkr-extract-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := extractPacked(ctx, archivePath, dir, keys); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// TempRoot returns the directory temporary checkouts are made in
+func TempRoot() string {
+	return filepath.Join(os.TempDir(), "parkr")
+}
+
+// CleanTempOptions controls clean-temp
+type CleanTempOptions struct {
+	DryRun bool // Verify each checkout but delete nothing
+}
+
+// CleanTempOutcome is the result of cleaning one ephemeral checkout
+type CleanTempOutcome struct {
+	Project   string `json:"project"`
+	LocalPath string `json:"local_path"`
+	Removed   bool   `json:"removed"`
+	// Skipped explains why a checkout was kept, e.g. it has local changes
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// CleanTemp removes every ephemeral checkout that has no changes since it
+// was grabbed (or last parked). Checkouts with changes are kept.
+func CleanTemp(ctx context.Context, sm StateStore, opts CleanTempOptions) ([]CleanTempOutcome, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, p := range state.Projects {
+		if p.IsGrabbed && p.Ephemeral {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	outcomes := []CleanTempOutcome{}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return outcomes, err
+		}
+		outcome := CleanTempOutcome{Project: name, LocalPath: state.Projects[name].LocalPath}
+		if _, err := Rm(ctx, sm, name, RmOptions{NoHash: true, DryRun: opts.DryRun}); err != nil {
+			outcome.Skipped = err.Error()
+		} else {
+			outcome.Removed = true
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes, nil
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrashDir is the hidden directory in an archive category where park moves
+// the archive files it deletes or overwrites when the trash_days setting is
+// on. It holds one directory per park, named by trashLayout, with the
+// project's replaced files inside.
+const TrashDir = ".parkr-trash"
+
+// trashLayout is the time layout of the directories in TrashDir
+const trashLayout = "2006-01-02_150405"
+
+// trashPath returns where a park at now moves the files it replaces in the
+// archive copy at archivePath. The path is on the archive's host.
+func trashPath(archivePath string, now time.Time) string {
+	_, path, _ := SplitRemote(archivePath)
+	return filepath.Join(filepath.Dir(path), TrashDir, now.Format(trashLayout), filepath.Base(path))
+}
+
+// findExpiredTrash lists the park directories in a category's TrashDir
+// older than days, or all of them if days is 0 because the trash is off
+func findExpiredTrash(ctx context.Context, master, trashDir string, days int, now time.Time) ([]GCItem, error) {
+	entries, err := os.ReadDir(trashDir)
+	if err != nil {
+		return nil, errorf(ErrArchiveUnreachable, "failed to read %s: %w", trashDir, err)
+	}
+	var items []GCItem
+	for _, entry := range entries {
+		parked, err := time.ParseInLocation(trashLayout, entry.Name(), time.Local)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if days > 0 && now.Before(parked.AddDate(0, 0, days)) {
+			continue
+		}
+		path := filepath.Join(trashDir, entry.Name())
+		size, err := GetDirSize(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size %s: %w", path, err)
+		}
+		items = append(items, GCItem{Path: path, Master: master, Kind: GCTrash, Size: size})
+	}
+	return items, nil
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// journalLimit is how many removals State.Journal keeps
+const journalLimit = 20
+
+// JournalEntry is a removal of a local copy that undo can revert: the copy
+// went to the local trash, and Before is the project's state beforehand
+type JournalEntry struct {
+	Time    time.Time   `json:"time"`
+	Op      string      `json:"op"`
+	Project string      `json:"project"`
+	Before  Project     `json:"before"`
+	Trashed TrashedCopy `json:"trashed"`
+	// Batch is shared by the removals of one prune, which undo reverts
+	// together
+	Batch string `json:"batch,omitempty"`
+}
+
+// recordRemoval journals a removal whose local copy was moved to the trash
+func (s *State) recordRemoval(op, batch, projectName string, before *Project, trashed *TrashedCopy) {
+	if op == "" {
+		op = EventRm
+	}
+	s.Journal = append(s.Journal, JournalEntry{
+		Time:    trashed.TrashedAt,
+		Op:      op,
+		Project: projectName,
+		Before:  *before,
+		Trashed: *trashed,
+		Batch:   batch,
+	})
+	if len(s.Journal) > journalLimit {
+		s.Journal = s.Journal[len(s.Journal)-journalLimit:]
+	}
+}
+
+// lastOperation returns the journal entries of the latest operation: the
+// last removal and any others from the same prune
+func (s *State) lastOperation() []JournalEntry {
+	n := len(s.Journal)
+	if n == 0 {
+		return nil
+	}
+	start := n - 1
+	if batch := s.Journal[start].Batch; batch != "" {
+		for start > 0 && s.Journal[start-1].Batch == batch {
+			start--
+		}
+	}
+	return s.Journal[start:]
+}
+
+// UndoResult describes a reverted (or, in dry-run mode, revertible)
+// operation
+type UndoResult struct {
+	Op       string         `json:"op"`
+	Restored []JournalEntry `json:"restored"`
+	DryRun   bool           `json:"dry_run,omitempty"`
+}
+
+// Undo reverts the latest rm or prune recorded in the journal, moving each
+// local copy back from its trash and marking the project grabbed
+// there again. Tags, descriptions and other changes made since the removal
+// are kept. It refuses if a copy is no longer in the trash,
+// its old path is taken, or the project was grabbed or parked since.
+func Undo(ctx context.Context, sm StateStore, dryRun bool) (*UndoResult, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	entries := state.lastOperation()
+	if len(entries) == 0 {
+		return nil, errorf(ErrNothingToUndo, "no removal to undo; rm and prune can only be undone while the local trash is on")
+	}
+	result := &UndoResult{Op: entries[0].Op, Restored: entries, DryRun: dryRun}
+
+	items, err := ListTrash(state.TrashRoots(), statePathOf(sm))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !slices.ContainsFunc(items, e.Trashed.sameCopy) {
+			// Emptied or restored from the trash: the operation can't be
+			// undone any more, so stop it hiding the one before, unless
+			// this is a dry run
+			if dryRun {
+				return nil, errorf(ErrTrashNotFound, "the local copy of '%s' is no longer in the trash (%s), so its %s can't be undone", e.Project, e.Trashed.ID, e.Op)
+			}
+			if err := sm.Update(dropJournalEntries(entries)); err != nil {
+				return nil, fmt.Errorf("failed to update state: %w", err)
+			}
+			return nil, errorf(ErrTrashNotFound, "the local copy of '%s' is no longer in the trash (%s), so its %s can't be undone; run undo again for the operation before it", e.Project, e.Trashed.ID, e.Op)
+		}
+		if _, err := os.Lstat(e.Trashed.Path); err == nil {
+			return nil, errorf(ErrLocalPathExists, "cannot restore '%s': %s already exists", e.Project, e.Trashed.Path)
+		}
+		project, ok := state.Projects[e.Project]
+		if !ok {
+			return nil, errorf(ErrProjectNotFound, "project '%s' is no longer tracked", e.Project)
+		}
+		if project.IsGrabbed || !timeOrZero(project.GrabbedAt).Equal(timeOrZero(e.Before.GrabbedAt)) ||
+			!timeOrZero(project.LastParkAt).Equal(timeOrZero(e.Before.LastParkAt)) {
+			return nil, errorf(ErrAlreadyGrabbed, "'%s' was grabbed or parked since it was removed; use 'parkr trash restore %s' instead", e.Project, e.Trashed.ID)
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	var restored []JournalEntry
+	var moveErr error
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			moveErr = err
+			break
+		}
+		if err := moveDir(ctx, e.Trashed.contents(), e.Trashed.Path); err != nil {
+			moveErr = fmt.Errorf("failed to restore '%s': %w", e.Project, err)
+			break
+		}
+		os.RemoveAll(e.Trashed.dir())
+		restored = append(restored, e)
+	}
+
+	err = sm.Update(func(state *State) error {
+		for _, e := range restored {
+			if project, ok := state.Projects[e.Project]; ok {
+				project.unremove(&e.Before)
+			}
+		}
+		return dropJournalEntries(restored)(state)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	for _, e := range restored {
+		publishEvent(sm, ProjectEvent{Project: e.Project, Op: EventUndo, LocalPath: e.Trashed.Path, Size: sizePtr(e.Trashed.Size)})
+	}
+	result.Restored = restored
+	return result, moveErr
+}
+
+// unremove reverts what rm changed in a project, taking the local copy's
+// path and grabbed flag from before the removal
+func (p *Project) unremove(before *Project) {
+	p.LocalPath = before.LocalPath
+	p.IsGrabbed = before.IsGrabbed
+}
+
+// dropJournalEntries returns a state update removing entries from the
+// journal
+func dropJournalEntries(entries []JournalEntry) func(*State) error {
+	return func(state *State) error {
+		var journal []JournalEntry
+		for _, e := range state.Journal {
+			if !slices.ContainsFunc(entries, func(d JournalEntry) bool { return d.Trashed.sameCopy(e.Trashed) }) {
+				journal = append(journal, e)
+			}
+		}
+		state.Journal = journal
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUndoMissingTrashCopy(t *testing.T) {
+	sm, state := testStore(t)
+	localPath := filepath.Join(t.TempDir(), "proj")
+	project := &Project{LocalPath: localPath, Master: "primary", ArchiveCategory: "code", NoHashMode: true}
+	state.Projects["proj"] = project
+	// The journal records a removal whose copy has since gone from the trash
+	state.Journal = []JournalEntry{{
+		Time:    time.Now(),
+		Op:      EventRm,
+		Project: "proj",
+		Before:  *project,
+		Trashed: TrashedCopy{ID: "20260101-120000-proj", Project: "proj", Path: localPath, TrashedAt: time.Now(), Size: -1, StatePath: sm.StatePath()},
+	}}
+	if err := sm.Save(state); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dryRun      bool
+		wantJournal int
+	}{
+		{dryRun: true, wantJournal: 1},
+		{dryRun: false, wantJournal: 0},
+	}
+	for _, tt := range tests {
+		if _, err := Undo(context.Background(), sm, tt.dryRun); !errors.Is(err, ErrTrashNotFound) {
+			t.Errorf("Undo(dryRun=%v) error = %v, want ErrTrashNotFound", tt.dryRun, err)
+		}
+		got, err := sm.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Journal) != tt.wantJournal {
+			t.Errorf("Undo(dryRun=%v) left %d journal entries, want %d", tt.dryRun, len(got.Journal), tt.wantJournal)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// validVerification reports an error for anything but a known verification
+// method; "" means the default
+func validVerification(method string) error {
+	switch method {
+	case "", VerifyHash, VerifyMtime, VerifyGit:
+		return nil
+	}
+	return fmt.Errorf("invalid verification '%s' (expected hash, mtime or git)", method)
+}
+
+// VerificationMode returns the verification method for a project: its own
+// setting, else the global setting, else mtime
+func (s *State) VerificationMode(projectName string) string {
+	if project, ok := s.Projects[projectName]; ok && project.Verification != "" {
+		return project.Verification
+	}
+	if s.Settings.Verification != "" {
+		return s.Settings.Verification
+	}
+	return VerifyMtime
+}
+
+// SetProjectVerification sets a project's verification method, overriding
+// the global setting. An empty method restores the global setting.
+func SetProjectVerification(sm StateStore, projectName, method string) error {
+	if err := validVerification(method); err != nil {
+		return err
+	}
+	return sm.Update(func(state *State) error {
+		project, ok := state.Projects[projectName]
+		if !ok {
+			return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+		}
+		project.Verification = method
+		return nil
+	})
+}
+
+// verifyHash compares a local copy's content hash against the one recorded
+// at its last park
+func verifyHash(ctx context.Context, projectName string, project *Project) error {
+	if project.NoHashMode || project.ArchiveContentHash == nil {
+		return errorf(ErrHashUnavailable, "project '%s' was parked without a content hash. Park it again, or use --no-hash or --force to delete", projectName)
+	}
+	hash, err := hashDirectory(ctx, project.LocalPath, project.HashMode)
+	if err != nil {
+		return fmt.Errorf("failed to hash local files: %w", err)
+	}
+	if hash != *project.ArchiveContentHash {
+		return errorf(ErrDirtyProject, "project '%s' content has changed since last park. Park first or use --force", projectName)
+	}
+	return nil
+}
+
+// verifyGit checks that a local copy is a clean checkout of the commit
+// recorded at its last park
+func verifyGit(ctx context.Context, projectName string, project *Project) error {
+	if project.LastParkGitHead == "" {
+		return errorf(ErrDirtyProject, "project '%s' has never been parked with git verification - cannot verify safety", projectName)
+	}
+	changes, err := gitChanges(ctx, project)
+	if err != nil {
+		return err
+	}
+	if changes != "" {
+		return errorf(ErrDirtyProject, "project '%s' has %s. Park first or use --force", projectName, changes)
+	}
+	return nil
+}
+
+// gitChanges describes how a local checkout differs from the commit recorded
+// at its last park, or returns "" if it does not
+func gitChanges(ctx context.Context, project *Project) (string, error) {
+	head, err := gitHead(ctx, project.LocalPath)
+	if err != nil {
+		return "", err
+	}
+	if head != project.LastParkGitHead {
+		return fmt.Sprintf("new commits since park (HEAD %s, parked %s)", shortCommit(head), shortCommit(project.LastParkGitHead)), nil
+	}
+	status, err := gitStatus(ctx, project.LocalPath)
+	if err != nil {
+		return "", err
+	}
+	rules, err := LoadVolatileRules(project.LocalPath)
+	if err != nil {
+		return "", err
+	}
+	var ignored []gitStatusEntry
+	for _, e := range status {
+		switch {
+		case rules.Match(e.path, e.dir):
+		case e.ignored:
+			ignored = append(ignored, e)
+		default:
+			return "uncommitted changes", nil
+		}
+	}
+	return ignoredChanges(ctx, project, ignored, rules)
+}
+
+// ignoredChanges checks the gitignored paths in a checkout, which park
+// archives but git can't tell are unchanged, by their mtimes: it describes
+// the first file modified since the last park, or returns "" if there is
+// none
+func ignoredChanges(ctx context.Context, project *Project, ignored []gitStatusEntry, rules *VolatileRules) (string, error) {
+	if len(ignored) == 0 {
+		return "", nil
+	}
+	if project.LastParkMtime == nil {
+		return fmt.Sprintf("gitignored files git can't verify (%s)", ignored[0].path), nil
+	}
+	var changed string
+	for _, e := range ignored {
+		root := filepath.Join(project.LocalPath, filepath.FromSlash(e.path))
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(project.LocalPath, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rules.Match(rel, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.IsDir() && info.ModTime().After(*project.LastParkMtime) {
+				changed = rel
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to check gitignored files: %w", err)
+		}
+		if changed != "" {
+			return fmt.Sprintf("changes to gitignored file %s", changed), nil
+		}
+	}
+	return "", nil
+}
+
+// gitStatusEntry is a path "git status" reports as changed, untracked or
+// ignored
+type gitStatusEntry struct {
+	path    string
+	dir     bool // An untracked or ignored directory, reported as a whole
+	ignored bool // Matched by a .gitignore, so git doesn't track its changes
+}
+
+// gitStatus lists the paths that differ from HEAD in the checkout in dir,
+// and the gitignored ones
+func gitStatus(ctx context.Context, dir string) ([]gitStatusEntry, error) {
+	out, err := gitOutput(ctx, dir, "status", "--porcelain", "-z", "--ignored=matching")
+	if err != nil {
+		return nil, err
+	}
+	return parsePorcelain(out), nil
+}
+
+// parsePorcelain parses "git status --porcelain -z" output: a two-letter
+// status, a space and a path for each entry, ended by NUL, with paths left
+// unquoted. Ignored paths have the status "!!". A rename or copy is
+// followed by the path it came from, which a rename changed too.
+func parsePorcelain(out string) []gitStatusEntry {
+	var entries []gitStatusEntry
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if len(field) < 4 {
+			continue
+		}
+		entry := porcelainEntry(field[3:])
+		entry.ignored = field[:2] == "!!"
+		entries = append(entries, entry)
+		if strings.ContainsAny(field[:2], "RC") && i+1 < len(fields) {
+			i++
+			if strings.Contains(field[:2], "R") {
+				entries = append(entries, porcelainEntry(fields[i]))
+			}
+		}
+	}
+	return entries
+}
+
+// porcelainEntry makes an entry of a path from "git status --porcelain",
+// where untracked and ignored directories end in a slash
+func porcelainEntry(p string) gitStatusEntry {
+	return gitStatusEntry{path: strings.TrimSuffix(p, "/"), dir: strings.HasSuffix(p, "/")}
+}
+
+// gitHead returns the commit checked out in dir
+func gitHead(ctx context.Context, dir string) (string, error) {
+	return runGit(ctx, dir, "rev-parse", "HEAD")
+}
+
+// runGit runs a git command in dir and returns its trimmed output
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := gitOutput(ctx, dir, args...)
+	return strings.TrimSpace(out), err
+}
+
+// gitOutput runs a git command in dir and returns its output as is
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed in %s: %s", args[0], dir, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// shortCommit abbreviates a commit hash for messages
+func shortCommit(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
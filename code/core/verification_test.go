@@ -0,0 +1,51 @@
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePorcelain(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []gitStatusEntry
+	}{
+		{name: "empty", in: "", want: nil},
+		{
+			name: "modified and untracked",
+			in:   " M logs/x\x00?? new.txt\x00",
+			want: []gitStatusEntry{{path: "logs/x"}, {path: "new.txt"}},
+		},
+		{
+			name: "untracked directory",
+			in:   "?? build/\x00",
+			want: []gitStatusEntry{{path: "build", dir: true}},
+		},
+		{
+			name: "spaces and quotes left as is",
+			in:   "MM my file.txt\x00?? \"odd\" name\x00",
+			want: []gitStatusEntry{{path: "my file.txt"}, {path: "\"odd\" name"}},
+		},
+		{
+			name: "rename lists both paths",
+			in:   "R  new name.go\x00old name.go\x00 M other\x00",
+			want: []gitStatusEntry{{path: "new name.go"}, {path: "old name.go"}, {path: "other"}},
+		},
+		{
+			name: "copy lists only the new path",
+			in:   "C  copy.go\x00orig.go\x00",
+			want: []gitStatusEntry{{path: "copy.go"}},
+		},
+		{
+			name: "ignored file and directory",
+			in:   "!! .env\x00!! node_modules/\x00",
+			want: []gitStatusEntry{{path: ".env", ignored: true}, {path: "node_modules", dir: true, ignored: true}},
+		},
+	}
+	for _, tt := range tests {
+		if got := parsePorcelain(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parsePorcelain(%q) = %+v, want %+v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Verification checks reported in VerifyFinding
+const (
+	CheckArchivePath    = "archive-path"    // archive location can't be resolved
+	CheckArchiveMissing = "archive-missing" // tracked project missing from the archive
+	CheckLocalMissing   = "local-missing"   // grabbed project with no local copy
+	CheckUntrackedLocal = "untracked-local" // released project whose local copy remains
+	CheckArchiveCorrupt = "archive-corrupt" // archive contents no longer match their recorded hash
+	CheckArchiveDiffers = "archive-differs" // archive contents differ from a clean local copy
+	CheckScrubFailed    = "scrub-failed"    // archive copy could not be read
+	CheckDuplicateLocal = "duplicate-local" // more than one local directory holds the project
+	CheckMissingKey     = "missing-key"     // encrypted archive copy with no usable identity
+)
+
+// verifyChecks lists every check, for validating verify_severity
+var verifyChecks = []string{
+	CheckArchivePath, CheckArchiveMissing, CheckLocalMissing, CheckUntrackedLocal, CheckArchiveCorrupt,
+	CheckArchiveDiffers, CheckScrubFailed, CheckDuplicateLocal, CheckMissingKey,
+}
+
+// Severities of verify findings. Only errors make a verification fail;
+// ignored findings are only counted.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityIgnore  = "ignore"
+)
+
+// checkSeverity is the severity of each check's findings; the rest are
+// errors. These describe leftovers that lose no data.
+var checkSeverity = map[string]string{
+	CheckUntrackedLocal: SeverityWarning,
+	CheckDuplicateLocal: SeverityWarning,
+}
+
+// severityCategoryPrefix starts a verify_severity rule covering every
+// finding for the projects of one category, e.g. "category:scratch"
+const severityCategoryPrefix = "category:"
+
+// parseVerifySeverity parses a verify_severity value: comma-separated
+// RULE=SEVERITY pairs, where RULE is a check name or "category:NAME"
+func parseVerifySeverity(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	rules := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		rule, severity, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule '%s' (expected CHECK=SEVERITY or category:NAME=SEVERITY)", pair)
+		}
+		switch severity {
+		case SeverityError, SeverityWarning, SeverityIgnore:
+		default:
+			return nil, fmt.Errorf("invalid severity '%s' (expected error, warning or ignore)", severity)
+		}
+		category, isCategory := strings.CutPrefix(rule, severityCategoryPrefix)
+		if isCategory && category == "" || !isCategory && !slices.Contains(verifyChecks, rule) {
+			return nil, fmt.Errorf("unknown check '%s' (expected one of %s, or category:NAME)", rule, strings.Join(verifyChecks, ", "))
+		}
+		rules[rule] = severity
+	}
+	return rules, nil
+}
+
+// formatVerifySeverity formats rules the way parseVerifySeverity reads them
+func formatVerifySeverity(rules map[string]string) string {
+	pairs := make([]string, 0, len(rules))
+	for rule, severity := range rules {
+		pairs = append(pairs, rule+"="+severity)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// findingSeverity returns the severity of a check's finding for a project
+// in category: the verify_severity rule for the category, else the one for
+// the check, else the check's default
+func (s *Settings) findingSeverity(check, category string) string {
+	if severity, ok := s.VerifySeverity[severityCategoryPrefix+category]; ok {
+		return severity
+	}
+	if severity, ok := s.VerifySeverity[check]; ok {
+		return severity
+	}
+	if severity, ok := checkSeverity[check]; ok {
+		return severity
+	}
+	return SeverityError
+}
+
+// VerifyFinding is one inconsistency found by Verify
+type VerifyFinding struct {
+	Project  string `json:"project"`
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Paths are the archive or local paths the finding is about
+	Paths []string `json:"paths,omitempty"`
+}
+
+// VerifyOptions controls which projects Verify examines and how deeply
+type VerifyOptions struct {
+	// Projects limits verification to these names; empty means all
+	Projects []string
+	// Scrub also reads and hashes archive copies, see ScrubArchiveCopy
+	Scrub bool
+	// Sample limits a scrub to this many randomly chosen files of each
+	// archive copy that has a ChecksumFile, checking them against it; 0
+	// checks every file
+	Sample int
+}
+
+// VerifyReport is the result of Verify
+type VerifyReport struct {
+	Checked  int             `json:"checked"`
+	Scrubbed []string        `json:"scrubbed,omitempty"`
+	Findings []VerifyFinding `json:"findings"`
+	// Encrypted lists the checked projects whose archive copy is encrypted
+	Encrypted []string `json:"encrypted,omitempty"`
+	// Errors and Warnings count the findings of each severity
+	Errors   int `json:"errors"`
+	Warnings int `json:"warnings"`
+	// Ignored counts the findings verify_severity left out of Findings
+	Ignored int `json:"ignored"`
+}
+
+// OK reports whether verification found no errors
+func (r *VerifyReport) OK() bool {
+	return r.Errors == 0
+}
+
+// Verify checks the state file against the archive and local disk: that
+// every tracked project exists in the archive, that grabbed projects have
+// a local copy and released ones don't, and that no project has copies in
+// several local directories. With Scrub it also verifies the
+// contents of archive copies.
+func Verify(ctx context.Context, sm StateStore, opts VerifyOptions) (*VerifyReport, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	names := opts.Projects
+	if len(names) == 0 {
+		for name := range state.Projects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	report := &VerifyReport{Findings: []VerifyFinding{}}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		project, ok := state.Projects[name]
+		if !ok {
+			return nil, errorf(ErrProjectNotFound, "project '%s' not found in state", name)
+		}
+		report.Checked++
+
+		finding := func(check string, paths []string, format string, args ...any) {
+			severity := state.Settings.findingSeverity(check, project.ArchiveCategory)
+			switch severity {
+			case SeverityIgnore:
+				report.Ignored++
+				return
+			case SeverityError:
+				report.Errors++
+			default:
+				report.Warnings++
+			}
+			report.Findings = append(report.Findings, VerifyFinding{
+				Project:  name,
+				Check:    check,
+				Severity: severity,
+				Message:  fmt.Sprintf(format, args...),
+				Paths:    paths,
+			})
+		}
+
+		archivePath, err := state.GetArchivePath(name)
+		if err != nil {
+			finding(CheckArchivePath, nil, "%v", err)
+			continue
+		}
+		archiveExists, err := archivePathExists(ctx, archivePath)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			finding(CheckArchivePath, []string{archivePath}, "%v", err)
+			continue
+		}
+		if !archiveExists {
+			finding(CheckArchiveMissing, []string{archivePath}, "archive copy %s does not exist", archivePath)
+		}
+		if isEncryptedArchive(archivePath) {
+			report.Encrypted = append(report.Encrypted, name)
+			if identity := state.ageKeys(project.Master).identity; identity == "" {
+				finding(CheckMissingKey, []string{archivePath}, "archive copy is encrypted but master '%s' has no identity to decrypt it", project.Master)
+			} else if _, err := os.Stat(identity); err != nil {
+				finding(CheckMissingKey, []string{archivePath, identity}, "archive copy is encrypted but identity file %s can't be read: %v", identity, err)
+			}
+		}
+
+		_, localErr := os.Stat(project.LocalPath)
+		localExists := project.LocalPath != "" && localErr == nil
+		switch {
+		case project.IsGrabbed && !localExists:
+			finding(CheckLocalMissing, []string{project.LocalPath}, "grabbed but local copy %s does not exist", project.LocalPath)
+		case !project.IsGrabbed && localExists:
+			finding(CheckUntrackedLocal, []string{project.LocalPath}, "not grabbed but local copy %s still exists", project.LocalPath)
+		}
+		if copies := state.LocalCopies(name); len(copies) > 1 {
+			if project.IsGrabbed && slices.Contains(copies, filepath.Clean(project.LocalPath)) {
+				finding(CheckDuplicateLocal, copies, "local copies in %s; only %s is tracked (use 'parkr local adopt %s <path>' to track another)",
+					strings.Join(copies, ", "), project.LocalPath, name)
+			} else {
+				finding(CheckDuplicateLocal, copies, "local copies in %s; parkr tracks at most one", strings.Join(copies, ", "))
+			}
+		}
+
+		if opts.Scrub && archiveExists {
+			if err := scrubArchiveCopy(ctx, sm, name, opts.Sample); err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				check := CheckScrubFailed
+				var mismatch *scrubMismatch
+				if errors.As(err, &mismatch) {
+					check = mismatch.check
+				}
+				finding(check, []string{archivePath}, "%v", err)
+				continue
+			}
+			report.Scrubbed = append(report.Scrubbed, name)
+		}
+	}
+	return report, nil
+}
+
+// preflightVerify runs Verify on a project about to be removed when the
+// preflight_verify setting is on, failing with ErrPreflightFailed if it
+// reports any errors
+func preflightVerify(ctx context.Context, sm StateStore, settings *Settings, projectName string) error {
+	if !settings.PreflightVerify {
+		return nil
+	}
+	report, err := Verify(ctx, sm, VerifyOptions{Projects: []string{projectName}})
+	if err != nil {
+		return err
+	}
+	if report.OK() {
+		return nil
+	}
+	var messages []string
+	for _, f := range report.Findings {
+		if f.Severity == SeverityError {
+			messages = append(messages, f.Message)
+		}
+	}
+	return errorf(ErrPreflightFailed, "verify found %d error(s) for '%s': %s. Fix them, or run 'parkr verify %s' for details",
+		report.Errors, projectName, strings.Join(messages, "; "), projectName)
+}
+
+// scrubMismatch reports archive contents that failed a scrub comparison
+type scrubMismatch struct {
+	check string
+	msg   string
+}
+
+func (e *scrubMismatch) Error() string { return e.msg }
+
+// ScrubArchiveCopy reads and hashes a project's archive copy. For a grabbed
+// project whose local copy is unchanged since park, the archive must match
+// the local contents; otherwise it must match the archive hash recorded by
+// the last successful scrub, if any. On success the archive hash and
+// verification time are recorded in state.
+//
+// An archive copy with a ChecksumFile is checked file by file against it,
+// which names the files that went bad and, since the ChecksumFile was
+// written from the local copy, spares hashing an unchanged local copy.
+func ScrubArchiveCopy(ctx context.Context, sm StateStore, projectName string) error {
+	return scrubArchiveCopy(ctx, sm, projectName, 0)
+}
+
+// scrubArchiveCopy implements ScrubArchiveCopy. A positive sample only
+// checks that many files against the ChecksumFile, recording nothing.
+func scrubArchiveCopy(ctx context.Context, sm StateStore, projectName string, sample int) error {
+	state, err := sm.Load()
+	if err != nil {
+		return err
+	}
+	project, ok := state.Projects[projectName]
+	if !ok {
+		return errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+	}
+	archivePath, err := state.GetArchivePath(projectName)
+	if err != nil {
+		return err
+	}
+
+	if err := requireLocalArchive(archivePath); err != nil {
+		return err
+	}
+
+	sums, err := loadChecksums(ctx, archivePath)
+	if err != nil {
+		return errorf(ErrArchiveUnreachable, "failed to read checksums of '%s': %w", projectName, err)
+	}
+	if sums != nil {
+		bad, err := checkChecksums(ctx, archivePath, sums, sample)
+		if err != nil {
+			return errorf(ErrArchiveUnreachable, "failed to read archive copy of '%s': %w", projectName, err)
+		}
+		if len(bad) > 0 {
+			return &scrubMismatch{CheckArchiveCorrupt, fmt.Sprintf("archive copy of '%s' no longer matches its %s: %s",
+				projectName, ChecksumFile, summarizeDiffs(bad))}
+		}
+		if sample > 0 {
+			return nil
+		}
+	}
+
+	// Every file matched its checksum; if no others were added since, the
+	// checksums give the archive hash without reading the files again. They
+	// hold full digests, so a sampled hash must be worked out from the files.
+	var archiveHash string
+	fromSums := false
+	if sums != nil && project.HashMode == nil {
+		if archiveHash, fromSums, err = sumsCoverTree(ctx, archivePath, sums); err != nil {
+			return errorf(ErrArchiveUnreachable, "failed to read archive copy of '%s': %w", projectName, err)
+		}
+	}
+	if !fromSums {
+		dir, cleanup, err := archiveDir(ctx, archivePath, state.ageKeys(project.Master))
+		if err != nil {
+			return errorf(ErrArchiveUnreachable, "failed to read archive copy of '%s': %w", projectName, err)
+		}
+		defer cleanup()
+		archiveHash, err = hashDirectory(ctx, dir, project.HashMode)
+		if err != nil {
+			return errorf(ErrArchiveUnreachable, "failed to read archive copy of '%s': %w", projectName, err)
+		}
+	}
+
+	// The checksums were written from the local copy when it was parked,
+	// so matching them is as good as matching an unchanged local copy
+	compared := false
+	unchanged := project.IsGrabbed && VerifySafeToDelete(ctx, projectName, project, VerifyMtime) == nil
+	if unchanged && fromSums {
+		compared = true
+	} else if unchanged {
+		localHash, err := hashDirectory(ctx, project.LocalPath, project.HashMode)
+		if err != nil {
+			return fmt.Errorf("failed to read local copy of '%s': %w", projectName, err)
+		}
+		if localHash != archiveHash {
+			return &scrubMismatch{CheckArchiveDiffers, fmt.Sprintf("archive copy of '%s' differs from its unchanged local copy", projectName)}
+		}
+		compared = true
+	}
+	if !compared && project.ArchiveContentHash != nil && *project.ArchiveContentHash != archiveHash {
+		return &scrubMismatch{CheckArchiveCorrupt, fmt.Sprintf("archive copy of '%s' no longer matches the hash recorded at %s",
+			projectName, formatTimeOrNever(project.ArchiveVerifiedAt))}
+	}
+
+	now := time.Now()
+	return sm.Update(func(state *State) error {
+		if p, ok := state.Projects[projectName]; ok {
+			p.ArchiveContentHash = &archiveHash
+			p.ArchiveVerifiedAt = &now
+		}
+		return nil
+	})
+}
+
+// formatTimeOrNever formats an optional timestamp for messages
+func formatTimeOrNever(t *time.Time) string {
+	if t == nil {
+		return "an unknown time"
+	}
+	return t.Format(timeLayout)
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionsDir is the hidden directory in an archive category where park
+// keeps earlier archive copies when the keep_versions setting is on. It
+// holds one directory per project, with one copy inside per park, named
+// by trashLayout.
+const VersionsDir = ".parkr-versions"
+
+// ArchiveVersion is an earlier archive copy of a project, kept by park
+// before it synced over it
+type ArchiveVersion struct {
+	// Path is where the copy is, with a host: prefix if it is remote
+	Path string `json:"path"`
+	// ParkedAt is when the kept contents were last parked, if known
+	ParkedAt *time.Time `json:"parked_at,omitempty"`
+	KeptAt   time.Time  `json:"kept_at"`
+}
+
+// versionPath returns where a park at now keeps the archive copy at
+// archivePath, on the same host
+func versionPath(archivePath string, now time.Time) string {
+	host, path, remote := SplitRemote(archivePath)
+	dir := filepath.Join(filepath.Dir(path), VersionsDir, filepath.Base(path), now.Format(trashLayout))
+	if remote {
+		return host + ":" + dir
+	}
+	return dir
+}
+
+// keepVersion copies a project's archive copy into VersionsDir and records
+// it in state. The copy hard-links every file, so it takes little space
+// until park replaces them; rsync writes changed files anew rather than in
+// place, leaving the kept ones intact.
+func keepVersion(ctx context.Context, sm StateStore, projectName, archivePath string, parkedAt *time.Time) (*ArchiveVersion, error) {
+	now := time.Now()
+	version := &ArchiveVersion{Path: versionPath(archivePath, now), ParkedAt: parkedAt, KeptAt: now}
+	exclude := "--exclude=" + rsyncPartialDir + "/"
+	if host, path, ok := SplitRemote(archivePath); ok {
+		_, dst, _ := SplitRemote(version.Path)
+		command := fmt.Sprintf("mkdir -p %s && rsync -a %s %s %s/ %s/", shellQuote(filepath.Dir(dst)),
+			shellQuote("--link-dest="+path), shellQuote(exclude), shellQuote(path), shellQuote(dst))
+		if _, err := runSSH(ctx, host, command); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(version.Path), 0755); err != nil {
+			return nil, err
+		}
+		args := []string{"-a", "--link-dest=" + archivePath, exclude, archivePath + "/", version.Path + "/"}
+		if err := execRsync(ctx, args, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	err := sm.Update(func(state *State) error {
+		if p, ok := state.Projects[projectName]; ok {
+			p.Versions = append(p.Versions, *version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	return version, nil
+}
+
+// pruneVersions removes a project's oldest kept versions beyond keep and
+// returns a warning for each one that could not be removed, which stays
+// recorded to be tried again on the next park
+func pruneVersions(ctx context.Context, sm StateStore, projectName string, keep int) []string {
+	state, err := sm.Load()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	project, ok := state.Projects[projectName]
+	if !ok || len(project.Versions) <= keep {
+		return nil
+	}
+
+	var warnings []string
+	removed := make(map[string]bool)
+	for _, v := range project.Versions[:len(project.Versions)-keep] {
+		if err := removeVersion(ctx, v.Path); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to remove old version %s: %v", v.Path, err))
+			continue
+		}
+		removed[v.Path] = true
+	}
+	err = sm.Update(func(state *State) error {
+		if p, ok := state.Projects[projectName]; ok {
+			var kept []ArchiveVersion
+			for _, v := range p.Versions {
+				if !removed[v.Path] {
+					kept = append(kept, v)
+				}
+			}
+			p.Versions = kept
+		}
+		return nil
+	})
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("failed to update state: %v", err))
+	}
+	return warnings
+}
+
+// removeVersion deletes a kept archive copy, over SSH if it is remote
+func removeVersion(ctx context.Context, path string) error {
+	if host, dir, ok := SplitRemote(path); ok {
+		_, err := runSSH(ctx, host, "rm -rf "+shellQuote(dir))
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// FindVersion picks one of a project's kept versions, oldest first as
+// recorded in state, by its directory name or by a number counting back
+// from the newest, which is 1
+func FindVersion(versions []ArchiveVersion, spec string) (ArchiveVersion, error) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 1 || n > len(versions) {
+			return ArchiveVersion{}, fmt.Errorf("no version %d; %d kept", n, len(versions))
+		}
+		return versions[len(versions)-n], nil
+	}
+	for _, v := range versions {
+		if filepath.Base(v.Path) == spec {
+			return v, nil
+		}
+	}
+	return ArchiveVersion{}, fmt.Errorf("no version '%s'", spec)
+}
+
+// RestoreOptions controls what RestoreVersion does with a kept version
+type RestoreOptions struct {
+	// Version names the version, as FindVersion reads it
+	Version string
+	// Dest is the local directory the version is copied to, unless
+	// ReplaceArchive is set; empty means PROJECT-VERSION in the current
+	// directory
+	Dest string
+	// ReplaceArchive syncs the version over the project's archive copy
+	// instead, keeping the current copy as a version first if
+	// keep_versions is on
+	ReplaceArchive bool
+	DryRun         bool
+}
+
+// RestoreResult describes a completed (or, in dry-run mode, planned) restore
+type RestoreResult struct {
+	Project string         `json:"project"`
+	Version ArchiveVersion `json:"version"`
+	// Dest is the local copy written, or the archive copy replaced
+	Dest            string `json:"dest"`
+	ReplacedArchive bool   `json:"replaced_archive,omitempty"`
+	// Kept is the archive copy kept as a version before it was replaced
+	Kept     *ArchiveVersion `json:"kept,omitempty"`
+	DryRun   bool            `json:"dry_run,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// RestoreVersion copies a project's kept version to a new local directory,
+// untracked, or syncs it over the archive copy. The archive copy can only
+// be replaced while the project isn't grabbed, since its local copy would
+// then no longer match the archive.
+func RestoreVersion(ctx context.Context, sm StateStore, projectName string, opts RestoreOptions) (*RestoreResult, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	project, ok := state.Projects[projectName]
+	if !ok {
+		return nil, errorf(ErrProjectNotFound, "project '%s' not found in state", projectName)
+	}
+	if len(project.Versions) == 0 {
+		return nil, errorf(ErrVersionNotFound, "project '%s' has no kept versions", projectName)
+	}
+	version, err := FindVersion(project.Versions, opts.Version)
+	if err != nil {
+		return nil, errorf(ErrVersionNotFound, "project '%s' has %v", projectName, err)
+	}
+	if exists, err := archivePathExists(ctx, version.Path); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, errorf(ErrVersionNotFound, "version %s of '%s' no longer exists", version.Path, projectName)
+	}
+	result := &RestoreResult{Project: projectName, Version: version, Dest: opts.Dest, ReplacedArchive: opts.ReplaceArchive, DryRun: opts.DryRun}
+
+	if !opts.ReplaceArchive {
+		if result.Dest == "" {
+			result.Dest = projectName + "-" + filepath.Base(version.Path)
+		}
+		if _, err := os.Lstat(result.Dest); err == nil {
+			return nil, errorf(ErrLocalPathExists, "destination already exists: %s", result.Dest)
+		}
+		if opts.DryRun {
+			return result, nil
+		}
+		if err := execRsync(ctx, []string{"-a", "--exclude=" + checksumExclude, version.Path + "/", result.Dest + "/"}, nil); err != nil {
+			return nil, fmt.Errorf("failed to copy version: %w", err)
+		}
+		return result, nil
+	}
+
+	if project.IsGrabbed {
+		return nil, errorf(ErrAlreadyGrabbed, "project '%s' is grabbed, and its local copy would no longer match the archive; remove it with 'parkr rm' first", projectName)
+	}
+	if err := state.CheckMasterWritable(project.Master); err != nil {
+		return nil, err
+	}
+	archivePath, err := state.GetArchivePath(projectName)
+	if err != nil {
+		return nil, err
+	}
+	if isPackedArchive(archivePath) {
+		return nil, fmt.Errorf("the archive copy at %s is a tarball; versions can only be restored over %s storage", archivePath, StorageTree)
+	}
+	result.Dest = archivePath
+	if opts.DryRun {
+		return result, nil
+	}
+
+	keep := state.Settings.KeepVersions
+	if keep > 0 {
+		if result.Kept, err = keepVersion(ctx, sm, projectName, archivePath, project.LastParkAt); err != nil {
+			return nil, fmt.Errorf("failed to keep the current archive copy: %w", err)
+		}
+	}
+	if err := syncVersion(ctx, version.Path, archivePath); err != nil {
+		return nil, fmt.Errorf("failed to restore version: %w", err)
+	}
+
+	// The archive copy now holds other contents: forget its hashes and scrub
+	err = sm.Update(func(state *State) error {
+		if p, ok := state.Projects[projectName]; ok {
+			p.ArchiveContentHash = nil
+			p.ArchiveVerifiedAt = nil
+			p.ArchiveFingerprint = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state: %w", err)
+	}
+	if keep > 0 {
+		result.Warnings = pruneVersions(ctx, sm, projectName, keep)
+	}
+	return result, nil
+}
+
+// syncVersion makes the archive copy dst match the kept version src, which
+// is on the same host
+func syncVersion(ctx context.Context, src, dst string) error {
+	args := []string{"-a", "--delete", "--exclude=" + rsyncPartialDir + "/"}
+	if host, srcPath, ok := SplitRemote(src); ok {
+		_, dstPath, _ := SplitRemote(dst)
+		for i, arg := range args {
+			args[i] = shellQuote(arg)
+		}
+		_, err := runSSH(ctx, host, "rsync "+strings.Join(args, " ")+" "+shellQuote(srcPath)+"/ "+shellQuote(dstPath)+"/")
+		return err
+	}
+	return execRsync(ctx, append(args, src+"/", dst+"/"), nil)
+}
@@ -0,0 +1,281 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// VolatileFile lists paths in a project whose changes never make it dirty,
+// such as logs, caches and SQLite WAL files. It uses .gitignore-style
+// patterns, one per line:
+//
+//	# comments and blank lines are ignored
+//	*.log          any file named *.log, at any depth
+//	cache/         any directory named cache, and everything in it
+//	/tmp/scratch   a path relative to the project root
+//	skip *-wal     volatile, and also not synced to the archive
+const VolatileFile = ".parkrvolatile"
+
+// skipPrefix marks a volatile pattern that park leaves out of the archive
+const skipPrefix = "skip "
+
+// volatilePattern is one line of a volatile file
+type volatilePattern struct {
+	raw      string // As written, for rsync
+	pattern  string // Without leading and trailing slashes
+	anchored bool   // Matched against the whole relative path, not a name
+	dirOnly  bool
+	skip     bool
+}
+
+// VolatileRules are the parsed patterns of a project's volatile file. A nil
+// *VolatileRules matches nothing.
+type VolatileRules struct {
+	patterns []volatilePattern
+}
+
+// LoadVolatileRules reads dir's volatile file, returning nil if it has none
+func LoadVolatileRules(dir string) (*VolatileRules, error) {
+	f, err := os.Open(filepath.Join(dir, VolatileFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules := &VolatileRules{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p, err := parseVolatilePattern(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", VolatileFile, line, err)
+		}
+		rules.patterns = append(rules.patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseVolatilePattern parses one non-comment line of a volatile file
+func parseVolatilePattern(text string) (volatilePattern, error) {
+	p := volatilePattern{}
+	if rest, ok := strings.CutPrefix(text, skipPrefix); ok {
+		p.skip = true
+		text = strings.TrimSpace(rest)
+	}
+	p.raw = text
+	p.dirOnly = strings.HasSuffix(text, "/")
+	text = strings.TrimSuffix(text, "/")
+	p.anchored = strings.Contains(text, "/")
+	p.pattern = strings.TrimPrefix(text, "/")
+	if _, err := path.Match(p.pattern, ""); err != nil || p.pattern == "" {
+		return p, fmt.Errorf("invalid pattern '%s'", p.raw)
+	}
+	return p, nil
+}
+
+// withSkips returns a copy of r with patterns added as skip entries
+func (r *VolatileRules) withSkips(patterns []string) (*VolatileRules, error) {
+	rules := &VolatileRules{}
+	if r != nil {
+		rules.patterns = append(rules.patterns, r.patterns...)
+	}
+	for _, text := range patterns {
+		p, err := parseVolatilePattern(skipPrefix + strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+		rules.patterns = append(rules.patterns, p)
+	}
+	return rules, nil
+}
+
+// Match reports whether rel, a slash-separated path relative to the project
+// root, is volatile: it or one of its parent directories matches a pattern
+func (r *VolatileRules) Match(rel string, isDir bool) bool {
+	return r.match(rel, isDir, false)
+}
+
+// Skipped reports whether rel is left out of the archive: it or one of its
+// parent directories matches a skip pattern
+func (r *VolatileRules) Skipped(rel string, isDir bool) bool {
+	return r.match(rel, isDir, true)
+}
+
+// match implements Match, considering only skip patterns if skipOnly is set
+func (r *VolatileRules) match(rel string, isDir, skipOnly bool) bool {
+	if r == nil {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		dir := isDir || i < len(parts)-1
+		for _, p := range r.patterns {
+			if (p.dirOnly && !dir) || (skipOnly && !p.skip) {
+				continue
+			}
+			subject := parts[i]
+			if p.anchored {
+				subject = prefix
+			}
+			if ok, _ := path.Match(p.pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RsyncExcludes returns the patterns park should leave out of the archive
+func (r *VolatileRules) RsyncExcludes() []string {
+	if r == nil {
+		return nil
+	}
+	var excludes []string
+	for _, p := range r.patterns {
+		if p.skip {
+			excludes = append(excludes, p.raw)
+		}
+	}
+	return excludes
+}
+
+// walkTracked walks the files under dir, skipping volatile paths and the
+// ChecksumFile
+func walkTracked(dir string, fn func(rel string, info os.FileInfo) error) error {
+	rules, err := LoadVolatileRules(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && (rules.Match(rel, info.IsDir()) || isChecksumFile(rel)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(rel, info)
+	})
+}
+
+// archivedSize totals the files under dir that park would copy to the
+// archive and those its skip rules leave out
+func archivedSize(ctx context.Context, dir string, rules *VolatileRules) (copied, skipped int64, err error) {
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rules.Skipped(filepath.ToSlash(rel), false) {
+			skipped += info.Size()
+		} else {
+			copied += info.Size()
+		}
+		return nil
+	})
+	return copied, skipped, err
+}
+
+// skippedPaths lists the files in dir that skip patterns leave out of the
+// archive, slash-separated and relative to dir. A skipped directory is
+// listed once, with a trailing slash.
+func skippedPaths(ctx context.Context, dir string, rules *VolatileRules) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !rules.Skipped(rel, d.IsDir()) {
+			return nil
+		}
+		if d.IsDir() {
+			paths = append(paths, rel+"/")
+			return filepath.SkipDir
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	return paths, err
+}
+
+// addSkipPatterns appends patterns to dir's volatile file as skip entries,
+// creating the file if needed and leaving out patterns it already lists
+func addSkipPatterns(dir string, patterns []string) error {
+	file := filepath.Join(dir, VolatileFile)
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+
+	var b strings.Builder
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		b.WriteString("\n")
+	}
+	for _, p := range patterns {
+		line := skipPrefix + strings.TrimSpace(p)
+		if !existing[line] {
+			existing[line] = true
+			b.WriteString(line + "\n")
+		}
+	}
+	if strings.TrimSpace(b.String()) == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// Copies of a project a path given to Which can lie in
+const (
+	CopyLocal   = "local"
+	CopyArchive = "archive"
+)
+
+// WhichResult is the project a path belongs to, with the details info
+// shows for it
+type WhichResult struct {
+	// Path is the absolute path asked about
+	Path string `json:"path"`
+	// Copy is CopyLocal or CopyArchive, the copy of the project Path is in
+	Copy string `json:"copy"`
+	// Relative is Path relative to the top of that copy, "." for the top
+	Relative string `json:"relative"`
+	*ProjectInfo
+}
+
+// Which finds the project path belongs to: the grabbed project whose local
+// copy holds it, else the archive project holding it in a category
+// directory on this host. The path itself needn't exist. Paths in no
+// project fail with ErrProjectNotFound.
+func Which(ctx context.Context, sm StateStore, path string) (*WhichResult, error) {
+	state, err := sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Match the path as given and with symlinks resolved, since local
+	// copies are recorded however they were named when grabbed
+	candidates := []string{abs}
+	if resolved := resolveSymlinks(abs); resolved != abs {
+		candidates = append(candidates, resolved)
+	}
+
+	var projectName, copyName, top string
+	for _, p := range candidates {
+		for name, project := range state.Projects {
+			if !project.IsGrabbed || project.LocalPath == "" {
+				continue
+			}
+			// The deepest local copy wins when one is grabbed inside another
+			if root := filepath.Clean(project.LocalPath); pathWithin(p, root) && len(root) > len(top) {
+				projectName, copyName, top = name, CopyLocal, root
+			}
+		}
+	}
+	if projectName == "" {
+		projectName, top = state.archiveProjectAt(candidates)
+		copyName = CopyArchive
+	}
+	if projectName == "" {
+		return nil, errorf(ErrProjectNotFound, "%s is not in a grabbed project or an archive category on this host", abs)
+	}
+
+	info, err := Info(ctx, sm, projectName)
+	if err != nil {
+		return nil, err
+	}
+	result := &WhichResult{Path: abs, Copy: copyName, Relative: ".", ProjectInfo: info}
+	for _, p := range candidates {
+		if pathWithin(p, top) {
+			result.Relative, _ = filepath.Rel(top, p)
+			break
+		}
+	}
+	return result, nil
+}
+
+// archiveProjectAt returns the name and archive directory of the project
+// holding the first of paths to lie inside a category directory on this
+// host, or "" if none does. The name drops any tarball extension.
+func (s *State) archiveProjectAt(paths []string) (string, string) {
+	for _, p := range paths {
+		for master, categories := range s.Masters {
+			for _, categoryPath := range categories {
+				root := s.archiveRoot(master, categoryPath)
+				if IsRemote(root) {
+					continue
+				}
+				root = filepath.Clean(root)
+				if p == root || !pathWithin(p, root) {
+					continue
+				}
+				name, _, _ := strings.Cut(p[len(root)+1:], string(filepath.Separator))
+				return trimArchiveExt(name), filepath.Join(root, name)
+			}
+		}
+	}
+	return "", ""
+}
+
+// resolveSymlinks resolves the symlinks in the longest part of an absolute
+// path that exists, keeping the rest as given
+func resolveSymlinks(p string) string {
+	rest := ""
+	for dir := p; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if dir == filepath.Dir(dir) {
+			return p
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// pathWithin reports whether p is root or lies below it
+func pathWithin(p, root string) bool {
+	return p == root || strings.HasPrefix(p, root+string(filepath.Separator))
+}
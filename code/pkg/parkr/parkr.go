@@ -0,0 +1,660 @@
+// Package parkr is the stable library API for embedding parkr in other
+// programs such as GUIs and automation scripts.
+//
+// A Client wraps a state file and exposes the same operations as the parkr
+// command line tool. Operations never write to stdout or stderr; they return
+// structured results and errors instead. Errors can be matched with errors.Is
+// against the sentinel values exported by this package.
+//
+// A Client is safe for concurrent use. State updates made through it are
+// serialized, and Subscribe reports every project change, including those
+// made by other parkr processes (detected when the state file is next read
+// or on Refresh).
+//
+// Example:
+//
+//	c := parkr.New()
+//	res, err := c.Grab(ctx, "ml-pipeline", parkr.GrabOptions{})
+//	if errors.Is(err, parkr.ErrAlreadyGrabbed) {
+//		...
+//	}
+package parkr
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/jamespark/parkr/core"
+)
+
+// Result and option types returned by Client operations
+type (
+	AddOptions       = core.AddOptions
+	AddResult        = core.AddResult
+	AddOutcome       = core.AddOutcome
+	AddClash         = core.AddClash
+	ArchiveProject   = core.ArchiveProject
+	GrabOptions      = core.GrabOptions
+	GrabResult       = core.GrabResult
+	ParkOptions      = core.ParkOptions
+	ParkResult       = core.ParkResult
+	ParkAllPlan      = core.ParkAllPlan
+	SyncPreview      = core.SyncPreview
+	ArchiveVersion   = core.ArchiveVersion
+	RestoreOptions   = core.RestoreOptions
+	RestoreResult    = core.RestoreResult
+	ProjectEvent     = core.ProjectEvent
+	EventBus         = core.EventBus
+	AuditRecord      = core.AuditRecord
+	AuditFilter      = core.AuditFilter
+	DriftEntry       = core.DriftEntry
+	Transfer         = core.Transfer
+	TransferProgress = core.TransferProgress
+	ProgressFunc     = core.ProgressFunc
+	RmOptions        = core.RmOptions
+	RmResult         = core.RmResult
+	PatternMatch     = core.PatternMatch
+	TrashedCopy      = core.TrashedCopy
+	TrashRestore     = core.TrashRestore
+	EmptyTrashResult = core.EmptyTrashResult
+	JournalEntry     = core.JournalEntry
+	UndoResult       = core.UndoResult
+	PullOptions      = core.PullOptions
+	PullResult       = core.PullResult
+	ListEntry        = core.ListEntry
+	Report           = core.Report
+	Digest           = core.Digest
+	DigestScrub      = core.DigestScrub
+	ReportEntry      = core.ReportEntry
+	PrunePlan        = core.PrunePlan
+	PruneOptions     = core.PruneOptions
+	PruneOutcome     = core.PruneOutcome
+	PruneVolume      = core.PruneVolume
+	ClusterMachine   = core.ClusterMachine
+	Checkout         = core.Checkout
+	DiskUsage        = core.DiskUsage
+	QuotaUsage       = core.QuotaUsage
+	MasterInfo       = core.MasterInfo
+	AddMasterOptions = core.AddMasterOptions
+	CategoryInfo     = core.CategoryInfo
+	CategoryRename   = core.CategoryRename
+	GCOptions        = core.GCOptions
+	InitOptions      = core.InitOptions
+	InitResult       = core.InitResult
+	ConfigExport     = core.ConfigExport
+	ProjectInfo      = core.ProjectInfo
+	WhichResult      = core.WhichResult
+	ProjectRename    = core.ProjectRename
+	MoveOptions      = core.MoveOptions
+	ProjectMove      = core.ProjectMove
+	Inspection       = core.Inspection
+	InspectEntry     = core.InspectEntry
+	ExtractOptions   = core.ExtractOptions
+	ExtractResult    = core.ExtractResult
+	LocalProject     = core.LocalProject
+	LocalScanOptions = core.LocalScanOptions
+	DuplicateGroup   = core.DuplicateGroup
+	CleanTempOptions = core.CleanTempOptions
+	CleanTempOutcome = core.CleanTempOutcome
+	VerifyOptions    = core.VerifyOptions
+	VerifyReport     = core.VerifyReport
+	VerifyFinding    = core.VerifyFinding
+	GCResult         = core.GCResult
+	State            = core.State
+	Project          = core.Project
+	ProjectChange    = core.ProjectChange
+
+	// CategoryDetector inspects a project directory and returns its archive
+	// category, or "" to defer to the next detector
+	CategoryDetector = core.CategoryDetector
+
+	// StorageBackend packs parked projects into archive files for the
+	// masters set to the storage mode it is registered under
+	StorageBackend = core.StorageBackend
+)
+
+// Errors returned by Client operations
+var (
+	ErrProjectNotFound    = core.ErrProjectNotFound
+	ErrAlreadyGrabbed     = core.ErrAlreadyGrabbed
+	ErrNotGrabbed         = core.ErrNotGrabbed
+	ErrLocalPathExists    = core.ErrLocalPathExists
+	ErrLocalPathMissing   = core.ErrLocalPathMissing
+	ErrDirtyProject       = core.ErrDirtyProject
+	ErrHashUnavailable    = core.ErrHashUnavailable
+	ErrArchiveUnreachable = core.ErrArchiveUnreachable
+	ErrStateFile          = core.ErrStateFile
+	ErrQuotaExceeded      = core.ErrQuotaExceeded
+	ErrReadOnlyMaster     = core.ErrReadOnlyMaster
+	ErrStalePark          = core.ErrStalePark
+	ErrAmbiguousProject   = core.ErrAmbiguousProject
+	ErrUnverifiedArchive  = core.ErrUnverifiedArchive
+	ErrArchiveMismatch    = core.ErrArchiveMismatch
+	ErrFileNotFound       = core.ErrFileNotFound
+	ErrProjectExists      = core.ErrProjectExists
+	ErrMissingKey         = core.ErrMissingKey
+)
+
+// Client runs parkr operations against a single state file
+type Client struct {
+	sm *core.Store
+}
+
+// New returns a client using the default state file: $PARKR_STATE_PATH, or
+// state.json in ~/.parkr or $XDG_CONFIG_HOME/parkr
+func New() *Client {
+	return &Client{sm: core.NewStore(core.NewStateManager())}
+}
+
+// Open returns a client using the state file at statePath
+func Open(statePath string) *Client {
+	return &Client{sm: core.NewStore(core.NewStateManagerAt(statePath))}
+}
+
+// OpenProfile returns a client using a named profile's state file
+// (profiles/<name>/state.json in ~/.parkr or $XDG_CONFIG_HOME/parkr)
+func OpenProfile(name string) (*Client, error) {
+	if err := core.ValidateProfileName(name); err != nil {
+		return nil, err
+	}
+	return &Client{sm: core.NewStore(core.NewStateManagerForProfile(name))}, nil
+}
+
+// Profiles returns the names of existing profiles
+func Profiles() ([]string, error) {
+	return core.ListProfiles()
+}
+
+// Init creates a new state file at statePath ("" for the default location)
+// and returns a client using it. It fails with ErrStateFile if the file
+// already exists.
+func Init(statePath string, opts InitOptions) (*Client, *InitResult, error) {
+	sm := core.NewStateManager()
+	if statePath != "" {
+		sm = core.NewStateManagerAt(statePath)
+	}
+	result, err := core.Init(sm, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Client{sm: core.NewStore(sm)}, result, nil
+}
+
+// StatePath returns the path of the state file used by the client
+func (c *Client) StatePath() string {
+	return c.sm.StatePath()
+}
+
+// History returns the grabs, parks and removals recorded for a project by
+// the parkr command, oldest first
+func (c *Client) History(projectName string) ([]ProjectEvent, error) {
+	return core.LoadProjectHistory(c.StatePath(), projectName)
+}
+
+// State loads and returns the current state. The returned value is a copy;
+// modifying it does not affect the state file.
+func (c *Client) State() (*State, error) {
+	return c.sm.Load()
+}
+
+// Events returns the bus the client's operations publish project events
+// on: grabs, parks, removals and projects found dirty by a report. Unlike
+// Subscribe, it only carries this client's own operations.
+func (c *Client) Events() *EventBus {
+	return c.sm.Events()
+}
+
+// Subscribe returns a channel of project state changes and a function to
+// cancel the subscription. Changes are dropped for subscribers that fall
+// behind, so consumers should re-read State after a burst of updates.
+func (c *Client) Subscribe() (<-chan ProjectChange, func()) {
+	return c.sm.Subscribe()
+}
+
+// Refresh re-reads the state file if another process has changed it,
+// notifying subscribers. Long-running embedders should call it periodically.
+func (c *Client) Refresh() error {
+	return c.sm.Refresh()
+}
+
+// List returns archived projects, optionally filtered by category
+func (c *Client) List(ctx context.Context, category string) ([]ListEntry, error) {
+	return core.List(ctx, c.sm, category, core.ListOptions{StatePath: c.sm.StatePath()})
+}
+
+// Add copies an existing local project into the archive, detecting its
+// category unless opts.Category is set. A dry run reports the plan and any
+// conflicts in the result instead of failing.
+func (c *Client) Add(ctx context.Context, localPath string, opts AddOptions) (*AddResult, error) {
+	return core.Add(ctx, c.sm, localPath, opts)
+}
+
+// AddAll adds several local projects, reporting each one's outcome. One
+// failing does not stop the others.
+func (c *Client) AddAll(ctx context.Context, paths []string, opts AddOptions) ([]AddOutcome, error) {
+	return core.AddAll(ctx, c.sm, paths, opts)
+}
+
+// CheckAddClash returns the project that adding localPath under name, or
+// its base name if name is empty, would clash with, or nil
+func (c *Client) CheckAddClash(ctx context.Context, localPath, name string) (*AddClash, error) {
+	return core.CheckAddClash(ctx, c.sm, localPath, name)
+}
+
+// DiffArchiveCopy lists how a local directory differs from an archive
+// project's copy
+func (c *Client) DiffArchiveCopy(ctx context.Context, localPath string, ap ArchiveProject) ([]string, error) {
+	return core.DiffArchiveCopy(ctx, c.sm, localPath, ap)
+}
+
+// MissingCategories returns the categories adding paths would need that the
+// default master lacks, mapped to the directories AddOptions.CreateCategory
+// would register for them
+func (c *Client) MissingCategories(paths []string, category string) (map[string]string, error) {
+	return core.MissingCategories(c.sm, paths, "", category)
+}
+
+// Grab copies a project from the archive to its default local directory
+func (c *Client) Grab(ctx context.Context, projectName string, opts GrabOptions) (*GrabResult, error) {
+	return core.Grab(ctx, c.sm, projectName, opts)
+}
+
+// Park syncs a grabbed project's local changes back to the archive
+func (c *Client) Park(ctx context.Context, projectName string, opts ParkOptions) (*ParkResult, error) {
+	return core.Park(ctx, c.sm, projectName, opts)
+}
+
+// PlanParkAll finds the grabbed projects with unparked work, as park --all
+// does, setting aside those also changed in the archive
+func (c *Client) PlanParkAll(ctx context.Context) (*ParkAllPlan, error) {
+	return core.PlanParkAll(ctx, c.sm)
+}
+
+// PreviewPark works out what parking a project with opts would transfer
+// and delete
+func (c *Client) PreviewPark(ctx context.Context, projectName string, opts ParkOptions) (*SyncPreview, error) {
+	return core.PreviewPark(ctx, c.sm, projectName, opts)
+}
+
+// Rm removes the local copy of a grabbed project after verifying it is safe
+func (c *Client) Rm(ctx context.Context, projectName string, opts RmOptions) (*RmResult, error) {
+	return core.Rm(ctx, c.sm, projectName, opts)
+}
+
+// Pull re-syncs a grabbed project from the archive after another machine
+// parked changes to it, failing with ErrDirtyProject if that would overwrite
+// local changes
+func (c *Client) Pull(ctx context.Context, projectName string, opts PullOptions) (*PullResult, error) {
+	return core.Pull(ctx, c.sm, projectName, opts)
+}
+
+// CheckArchiveUpdates sets ArchiveStatus on report entries to "updated" for
+// projects whose archive copy changed elsewhere since this machine synced it
+func (c *Client) CheckArchiveUpdates(ctx context.Context, entries []ReportEntry) error {
+	state, err := c.sm.Load()
+	if err != nil {
+		return err
+	}
+	return core.CheckArchiveUpdates(ctx, state, entries)
+}
+
+// Info returns archive and local details for a project
+func (c *Client) Info(ctx context.Context, projectName string) (*ProjectInfo, error) {
+	return core.Info(ctx, c.sm, projectName)
+}
+
+// RenameProject renames a project's archive copy, local copy and state
+// entry, undoing the steps taken if one fails
+func (c *Client) RenameProject(ctx context.Context, from, to string, dryRun bool) (*ProjectRename, error) {
+	return core.RenameProject(ctx, c.sm, from, to, dryRun)
+}
+
+// MoveProject moves a project's archive copy to another category or master
+// on the same host
+func (c *Client) MoveProject(ctx context.Context, projectName string, opts MoveOptions) (*ProjectMove, error) {
+	return core.MoveProject(ctx, c.sm, projectName, opts)
+}
+
+// MatchProjects expands the glob patterns among project arguments, such as
+// ml-*, against the "grabbed" or "ungrabbed" projects, as grab, park and
+// rm do
+func (c *Client) MatchProjects(ctx context.Context, args []string, set string) ([]PatternMatch, error) {
+	return core.MatchProjects(ctx, c.sm, args, set)
+}
+
+// Which returns the project a file or directory belongs to, in its local
+// copy or its archive copy on this host
+func (c *Client) Which(ctx context.Context, path string) (*WhichResult, error) {
+	return core.Which(ctx, c.sm, path)
+}
+
+// Inspect summarises an archived project's contents without grabbing it
+func (c *Client) Inspect(ctx context.Context, projectName string) (*Inspection, error) {
+	return core.Inspect(ctx, c.sm, c.sm.StatePath(), projectName)
+}
+
+// OpenArchiveFile opens a file in an archived project without grabbing it.
+// The path may continue into a tarball stored in the project, e.g.
+// "backups/data.tar.gz/config.yml". The caller must close the reader.
+func (c *Client) OpenArchiveFile(ctx context.Context, projectName, path string) (io.ReadCloser, error) {
+	return core.OpenArchiveFile(ctx, c.sm, projectName, path)
+}
+
+// Extract copies a file or directory out of an archived project to dest
+func (c *Client) Extract(ctx context.Context, projectName, path, dest string, opts ExtractOptions) (*ExtractResult, error) {
+	return core.Extract(ctx, c.sm, projectName, path, dest, opts)
+}
+
+// RestoreVersion copies a kept archive version of a project to a local
+// directory, or syncs it over the archive copy
+func (c *Client) RestoreVersion(ctx context.Context, projectName string, opts RestoreOptions) (*RestoreResult, error) {
+	return core.RestoreVersion(ctx, c.sm, projectName, opts)
+}
+
+// Trash lists the local copies rm and prune moved to the local trash
+// through the client's state file, newest first
+func (c *Client) Trash() ([]TrashedCopy, error) {
+	state, err := c.sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	return core.ListTrash(state.TrashRoots(), c.sm.StatePath())
+}
+
+// RestoreTrash moves a copy out of the local trash, back to where it was
+// removed from unless dest is given
+func (c *Client) RestoreTrash(ctx context.Context, spec, dest string, dryRun bool) (*TrashRestore, error) {
+	return core.RestoreTrash(ctx, c.sm, spec, dest, dryRun)
+}
+
+// EmptyTrash permanently removes the copies in the local trash, of the
+// client's state file, older than days, or all of them if days is 0
+func (c *Client) EmptyTrash(days int, dryRun bool) (*EmptyTrashResult, error) {
+	state, err := c.sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	return core.EmptyTrash(state.TrashRoots(), c.sm.StatePath(), days, dryRun)
+}
+
+// Drift compares the local and archive copies of the named grabbed
+// projects, or all of them
+func (c *Client) Drift(ctx context.Context, names ...string) ([]DriftEntry, error) {
+	return core.Drift(ctx, c.sm, names)
+}
+
+// Audit reads the audit log records matching filter, oldest first
+func (c *Client) Audit(filter AuditFilter) ([]AuditRecord, error) {
+	return core.LoadAudit(core.AuditLogPath(), filter)
+}
+
+// RecentTransfers returns the latest n grabs and parks of a project from
+// the audit log, newest first
+func (c *Client) RecentTransfers(projectName string, n int) ([]AuditRecord, error) {
+	return core.RecentTransfers(core.AuditLogPath(), c.sm.StatePath(), projectName, n)
+}
+
+// Undo reverts the latest rm or prune whose local copies went to the
+// local trash, restoring them and the projects' state
+func (c *Client) Undo(ctx context.Context, dryRun bool) (*UndoResult, error) {
+	return core.Undo(ctx, c.sm, dryRun)
+}
+
+// AdoptLocalCopy makes path the tracked local copy of a grabbed project
+func (c *Client) AdoptLocalCopy(projectName, path string) (string, error) {
+	return core.AdoptLocalCopy(c.sm, projectName, path)
+}
+
+// ScanLocal lists the project directories found in the local roots and
+// registered local directories, their sizes, and whether parkr tracks each
+func (c *Client) ScanLocal(ctx context.Context, opts LocalScanOptions) ([]LocalProject, error) {
+	return core.ScanLocal(ctx, c.sm, c.sm.StatePath(), opts)
+}
+
+// AddLocalDirectory registers an extra directory to scan for local projects
+// and returns its absolute path
+func (c *Client) AddLocalDirectory(dir string) (string, error) {
+	return core.AddLocalDirectory(c.sm, dir)
+}
+
+// RemoveLocalDirectory unregisters a directory added with AddLocalDirectory
+func (c *Client) RemoveLocalDirectory(dir string) (string, error) {
+	return core.RemoveLocalDirectory(c.sm, dir)
+}
+
+// SetConfig sets a configuration key such as "metadata_file"; an empty value
+// restores the key's default
+func (c *Client) SetConfig(key, value string) error {
+	return core.SetConfig(c.sm, key, value)
+}
+
+// SetProjectVerification sets a project's verification method ("hash",
+// "mtime" or "git"), overriding the "verification" config key. An empty
+// method restores the global setting.
+func (c *Client) SetProjectVerification(projectName, method string) error {
+	return core.SetProjectVerification(c.sm, projectName, method)
+}
+
+// Report classifies grabbed projects and lists those safe to prune. sortBy
+// is one of "modified" (default), "size" or "name".
+func (c *Client) Report(ctx context.Context, sortBy string) (*Report, error) {
+	return core.BuildReport(ctx, c.sm, sortBy)
+}
+
+// Digest summarises stale projects, disk usage, recent parks and scrubs;
+// staleDays overrides the digest_stale_days setting when positive
+func (c *Client) Digest(ctx context.Context, staleDays int, volumePath string) (*Digest, error) {
+	return core.BuildDigest(ctx, c.sm, staleDays, volumePath, time.Now())
+}
+
+// PlanPrune selects the oldest safe-to-delete projects whose combined local
+// size reaches target bytes, without deleting anything
+func (c *Client) PlanPrune(ctx context.Context, target int64) (*PrunePlan, error) {
+	return core.PlanPrune(ctx, c.sm, target)
+}
+
+// PlanPruneToFree plans a prune that raises free space on every local volume
+// holding grabbed projects to freeSpec, a size (50G) or a percentage of each
+// volume (20%)
+func (c *Client) PlanPruneToFree(ctx context.Context, freeSpec string) (*PrunePlan, error) {
+	return core.PlanPruneToFree(ctx, c.sm, freeSpec)
+}
+
+// ExecutePrune removes every project in plan, re-verifying each at deletion
+// time. Per-project failures are reported in the outcomes.
+func (c *Client) ExecutePrune(ctx context.Context, plan *PrunePlan, opts PruneOptions) ([]PruneOutcome, error) {
+	return core.ExecutePrune(ctx, c.sm, plan, opts)
+}
+
+// Quotas returns each configured category quota and its current local usage
+func (c *Client) Quotas(ctx context.Context) ([]QuotaUsage, error) {
+	state, err := c.sm.Load()
+	if err != nil {
+		return nil, err
+	}
+	report, err := core.BuildReport(ctx, c.sm, core.SortName)
+	if err != nil {
+		return nil, err
+	}
+	return core.QuotaUtilization(state, report.Categories)
+}
+
+// SetCategoryQuota limits the local space used by a category, e.g. "50G"
+func (c *Client) SetCategoryQuota(category, size string) error {
+	return core.SetCategoryQuota(c.sm, category, size)
+}
+
+// UnsetCategoryQuota removes a category's quota
+func (c *Client) UnsetCategoryQuota(category string) error {
+	return core.UnsetCategoryQuota(c.sm, category)
+}
+
+// SetQuotaMode sets whether grab warns ("warn") or fails with
+// ErrQuotaExceeded ("enforce") when a quota would be exceeded
+func (c *Client) SetQuotaMode(mode string) error {
+	return core.SetQuotaMode(c.sm, mode)
+}
+
+// Masters returns the configured masters sorted by name
+func (c *Client) Masters() ([]MasterInfo, error) {
+	return core.ListMasters(c.sm)
+}
+
+// AddMaster registers a new master with categories under root, a local
+// path or host:path, and returns them
+func (c *Client) AddMaster(ctx context.Context, name, root string, opts AddMasterOptions) (map[string]string, error) {
+	return core.AddMaster(ctx, c.sm, name, root, opts)
+}
+
+// RemoveMaster unregisters a master that no tracked project belongs to,
+// leaving its archive directories in place
+func (c *Client) RemoveMaster(name string) error {
+	return core.RemoveMaster(c.sm, name)
+}
+
+// SetDefaultMaster makes a master the one add uses when none is given
+func (c *Client) SetDefaultMaster(name string) error {
+	return core.SetDefaultMaster(c.sm, name)
+}
+
+// Categories returns every master's categories
+func (c *Client) Categories() ([]CategoryInfo, error) {
+	return core.ListCategories(c.sm)
+}
+
+// AddCategory registers a category of a master at path, a local path or
+// host:path, creating its directory if scaffold is set
+func (c *Client) AddCategory(ctx context.Context, master, name, path string, scaffold bool) error {
+	return core.AddCategory(ctx, c.sm, master, name, path, core.AddCategoryOptions{Scaffold: scaffold})
+}
+
+// RemoveCategory unregisters a category no tracked project belongs to,
+// leaving its directory in place
+func (c *Client) RemoveCategory(master, name string) error {
+	return core.RemoveCategory(c.sm, master, name, false)
+}
+
+// RenameCategory renames a category, moving its directory to path, or
+// alongside under the new name if path is empty and the directory is named
+// after the category
+func (c *Client) RenameCategory(ctx context.Context, master, from, to, path string) (*CategoryRename, error) {
+	return core.RenameCategory(ctx, c.sm, master, from, to, core.RenameCategoryOptions{Path: path})
+}
+
+// SetMasterReadOnly marks a master read-only, after which operations that
+// would write to it fail with ErrReadOnlyMaster
+func (c *Client) SetMasterReadOnly(master string, readOnly bool) error {
+	return core.SetMasterReadOnly(c.sm, master, readOnly)
+}
+
+// SetMasterHost makes a master's category paths refer to a remote host
+// reached over SSH, e.g. "user@nas"; "" makes them local again
+func (c *Client) SetMasterHost(master, host string) error {
+	return core.SetMasterHost(c.sm, master, host)
+}
+
+// SetMasterStorage sets whether a master stores parked projects as
+// directory trees ("tree"), zstd-compressed tarballs ("tar.zst") or with a
+// registered StorageBackend
+func (c *Client) SetMasterStorage(master, mode string) error {
+	return core.SetMasterStorage(c.sm, master, mode)
+}
+
+// SetMasterEncryption makes a master encrypt parked projects with age to
+// recipient, a public key or a file of them, and decrypt them with the
+// identity file, which may be empty on machines that only park. An empty
+// recipient turns encryption off.
+func (c *Client) SetMasterEncryption(master, recipient, identity string) error {
+	return core.SetMasterEncryption(c.sm, master, recipient, identity)
+}
+
+// GC removes leftover temporary and empty untracked directories from every
+// writable master. Per-item failures are reported in the result.
+func (c *Client) GC(ctx context.Context, opts GCOptions) (*GCResult, error) {
+	return core.GC(ctx, c.sm, opts)
+}
+
+// ExportConfig returns the client's configuration for initializing another
+// machine with Init, optionally including project metadata
+func (c *Client) ExportConfig(withProjects bool) (*ConfigExport, error) {
+	return core.ExportConfig(c.sm, withProjects)
+}
+
+// ParseConfigExport decodes a configuration written by "parkr export"
+func ParseConfigExport(data []byte) (*ConfigExport, error) {
+	return core.ParseConfigExport(data)
+}
+
+// FindDuplicates refreshes the archive hash index, rehashing only projects
+// whose files changed unless rehash is set, and returns groups of identical
+// or near-identical projects
+func (c *Client) FindDuplicates(ctx context.Context, rehash bool) ([]DuplicateGroup, error) {
+	index, _, err := core.UpdateHashIndex(ctx, c.sm, c.sm.StatePath(), rehash)
+	if err != nil {
+		return nil, err
+	}
+	return core.FindDuplicates(index), nil
+}
+
+// CleanTemp removes temporary checkouts made with GrabOptions.Temp that have
+// no changes, keeping any that do
+func (c *Client) CleanTemp(ctx context.Context, opts CleanTempOptions) ([]CleanTempOutcome, error) {
+	return core.CleanTemp(ctx, c.sm, opts)
+}
+
+// UpdateTags adds and removes a project's tags and returns the result
+func (c *Client) UpdateTags(projectName string, add, remove []string) ([]string, error) {
+	return core.UpdateTags(c.sm, projectName, add, remove)
+}
+
+// Verify checks state against the archive and local copies, optionally
+// scrubbing archive contents
+func (c *Client) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	return core.Verify(ctx, c.sm, opts)
+}
+
+// ParseSize parses sizes such as 10G, 500MB or 2T into bytes
+func ParseSize(s string) (int64, error) {
+	return core.ParseSize(s)
+}
+
+// RegisterCategoryDetector adds a category detector used when adding
+// projects. Registered detectors take priority over the built-in rules, so
+// site-specific builds can register them from an init function.
+func RegisterCategoryDetector(d CategoryDetector) {
+	core.RegisterCategoryDetector(d)
+}
+
+// RegisterStorageBackend adds a storage mode that SetMasterStorage can set
+// masters to, storing their parked projects as archive files written and
+// read by b. Like detectors, backends are registered from an init function;
+// it panics on the tree mode or an extension another backend uses.
+func RegisterStorageBackend(mode string, b StorageBackend) {
+	core.RegisterStorageBackend(mode, b)
+}
+
+// ProjectDirsUnder lists the subdirectories of dir, the projects an "add
+// everything under" request passes to AddAll, including hidden ones if
+// includeHidden is set
+func ProjectDirsUnder(dir string, includeHidden bool) ([]string, error) {
+	return core.ProjectDirsUnder(dir, includeHidden)
+}
+
+// DetectProjectCategory returns the archive category for a project directory
+// by the built-in and registered detectors alone
+func DetectProjectCategory(projectPath string) string {
+	return core.DetectProjectCategory(projectPath)
+}
+
+// DetectProjectLanguage returns the language of a project directory, such
+// as "go" or "node", or "" if it isn't recognised
+func DetectProjectLanguage(projectPath string) string {
+	return core.DetectProjectLanguage(projectPath)
+}
+
+// DetectCategory returns the archive category add would file a project
+// directory under, applying the detect_rules setting first
+func (c *Client) DetectCategory(projectPath string) (string, error) {
+	return core.DetectCategory(c.sm, projectPath)
+}